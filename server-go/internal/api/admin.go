@@ -7,15 +7,16 @@ import (
 	"gorm.io/gorm"
 	"safegram-server/internal/models"
 	"safegram-server/internal/redis"
+	"safegram-server/internal/websocket"
 )
 
 // getOnlineCount возвращает количество онлайн пользователей из Redis
 func getOnlineCount() int {
-	onlineUsers, err := redis.GetOnlineUsers()
+	count, err := redis.OnlineCount()
 	if err != nil {
 		return 0
 	}
-	return len(onlineUsers)
+	return int(count)
 }
 
 // RequireAdmin проверяет, что пользователь является админом
@@ -234,34 +235,53 @@ func GetAdminStats(db *gorm.DB) gin.HandlerFunc {
 // GetAdminFeedback возвращает список обратной связи от пользователей
 func GetAdminFeedback(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// TODO: В будущем можно добавить модель Feedback
-		// Пока возвращаем пустой массив
-		c.JSON(http.StatusOK, []gin.H{})
-	}
-}
-
-// GetAdminReports возвращает список жалоб пользователей
-func GetAdminReports(db *gorm.DB) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// TODO: В будущем можно добавить модель Report
-		// Пока возвращаем пустой массив
-		c.JSON(http.StatusOK, []gin.H{})
+		var feedback []models.Feedback
+		if err := db.Order("created_at DESC").Limit(200).Find(&feedback).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		c.JSON(http.StatusOK, feedback)
 	}
 }
 
-// GetAdminModQueue возвращает очередь модерации
+// GetAdminModQueue возвращает очередь модерации: сообщения, ожидающие проверки, во всех чатах
 func GetAdminModQueue(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// TODO: В будущем можно добавить модель ModerationQueue
-		// Пока возвращаем пустой массив
-		c.JSON(http.StatusOK, []gin.H{})
+		var messages []models.Message
+		if err := db.Where("moderation_status = ? AND deleted_at IS NULL", "pending").
+			Preload("Sender").
+			Order("created_at ASC").
+			Limit(200).
+			Find(&messages).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		c.JSON(http.StatusOK, messages)
 	}
 }
 
-// ApproveModItem одобряет элемент в очереди модерации
-func ApproveModItem(db *gorm.DB) gin.HandlerFunc {
+// ApproveModItem одобряет сообщение из очереди модерации от имени администрации
+func ApproveModItem(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// TODO: В будущем реализовать логику одобрения
+		userID, _ := c.Get("userID")
+		userIDStr, _ := userID.(string)
+
+		var msg models.Message
+		if err := db.Preload("Sender").First(&msg, "id = ? AND moderation_status = ?", c.Param("id"), "pending").Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+
+		msg.ModerationStatus = "approved"
+		msg.ModerationReason = ""
+		db.Model(&msg).Updates(map[string]interface{}{"moderation_status": "approved", "moderation_reason": ""})
+		bumpUnread(db, msg)
+		refreshChatSummary(db, msg.ChatID)
+		refreshThreadSummary(db, wsHub, msg.ThreadID)
+		broadcastApprovedMessage(db, wsHub, msg)
+		go attachLinkPreview(db, wsHub, msg)
+
+		logModeration(db, msg.ChatID, "", userIDStr, "moderation_approve", msg.SenderID, msg.ID, gin.H{"source": "admin"})
 		c.JSON(http.StatusOK, gin.H{"ok": true})
 	}
 }
@@ -0,0 +1,696 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"safegram-server/internal/authz"
+	"safegram-server/internal/models"
+)
+
+var validRuleConditions = map[string]bool{
+	"regex":         true,
+	"banned_words":  true,
+	"links":         true,
+	"invites":       true,
+	"caps":          true,
+	"flood":         true,
+	"account_age":   true,
+	"repeated_text": true,
+}
+
+var validRuleActions = map[string]bool{
+	"delete":   true,
+	"queue":    true,
+	"warn":     true,
+	"mute":     true,
+	"temp_ban": true,
+	"kick":     true,
+}
+
+var (
+	linkPattern   = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"]+`)
+	invitePattern = regexp.MustCompile(`(?i)(?:/app/(?:servers/)?join/[A-Za-z0-9_\-=]+|\bt\.me/(?:joinchat/|\+)?[A-Za-z0-9_\-]+|\bdiscord(?:\.gg|(?:app)?\.com/invite)/[A-Za-z0-9\-]+|\bchat\.whatsapp\.com/[A-Za-z0-9]+)`)
+
+	// скомпилированные regex правил (pattern -> *regexp.Regexp)
+	ruleRegexCache sync.Map
+)
+
+// Максимальная длительность бана при эскалации предупреждений (7 дней)
+const maxEscalationBanMinutes = 7 * 24 * 60
+
+func compileRulePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := ruleRegexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	ruleRegexCache.Store(pattern, re)
+	return re, nil
+}
+
+// automodHit сработавшее правило
+type automodHit struct {
+	RuleID    string   `json:"ruleId,omitempty"`
+	Rule      string   `json:"rule"`
+	Condition string   `json:"condition"`
+	Actions   []string `json:"actions"`
+	DryRun    bool     `json:"dryRun"`
+	Duration  int      `json:"durationMinutes,omitempty"`
+}
+
+// automodVerdict итог проверки сообщения правилами чата
+type automodVerdict struct {
+	Status   string // "" — пропустить, "pending" — в очередь, "rejected" — удалить
+	Reason   string
+	Hits     []automodHit
+	Settings models.ChatModerationSettings
+}
+
+// chatModerationRules правила чата по приоритету. Старые поля настроек
+// (BannedWords, MaxMsgsPer10s) работают как встроенные правила.
+func chatModerationRules(db *gorm.DB, settings models.ChatModerationSettings) []models.ModerationRule {
+	violationAction := "delete"
+	if settings.QueueOnViolation {
+		violationAction = "queue"
+	}
+	maxMsgs := settings.MaxMsgsPer10s
+	if maxMsgs <= 0 {
+		maxMsgs = 8
+	}
+
+	rules := []models.ModerationRule{{
+		Name:          "spam",
+		Enabled:       true,
+		Condition:     "flood",
+		Threshold:     maxMsgs,
+		WindowSeconds: 10,
+		Actions:       violationAction + ",warn",
+	}}
+	if settings.BannedWords != "" {
+		rules = append(rules, models.ModerationRule{
+			Name:      "banned_word",
+			Enabled:   true,
+			Condition: "banned_words",
+			Pattern:   settings.BannedWords,
+			Actions:   violationAction + ",warn",
+		})
+	}
+
+	var custom []models.ModerationRule
+	db.Where("chat_id = ? AND enabled = ?", settings.ChatID, true).Order("priority ASC, created_at ASC").Find(&custom)
+	return append(rules, custom...)
+}
+
+// ruleMatches проверяет условие правила для сообщения
+func ruleMatches(db *gorm.DB, rule models.ModerationRule, chatID, userID, text string, now time.Time) bool {
+	switch rule.Condition {
+	case "regex":
+		if text == "" || rule.Pattern == "" {
+			return false
+		}
+		re, err := compileRulePattern(rule.Pattern)
+		return err == nil && re.MatchString(text)
+
+	case "banned_words":
+		// работает только для незашифрованного текста
+		if text == "" {
+			return false
+		}
+		lower := strings.ToLower(text)
+		for _, w := range strings.Split(rule.Pattern, ",") {
+			w = strings.TrimSpace(strings.ToLower(w))
+			if w != "" && strings.Contains(lower, w) {
+				return true
+			}
+		}
+		return false
+
+	case "links":
+		allowed := map[string]bool{}
+		for _, d := range strings.Split(rule.Pattern, ",") {
+			if d = strings.TrimSpace(strings.ToLower(d)); d != "" {
+				allowed[d] = true
+			}
+		}
+		for _, link := range linkPattern.FindAllString(text, -1) {
+			if !strings.Contains(link, "://") {
+				link = "http://" + link
+			}
+			u, err := url.Parse(link)
+			if err != nil {
+				return true
+			}
+			host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+			if !allowed[host] {
+				return true
+			}
+		}
+		return false
+
+	case "invites":
+		return text != "" && invitePattern.MatchString(text)
+
+	case "caps":
+		threshold := rule.Threshold
+		if threshold <= 0 {
+			threshold = 70
+		}
+		letters, upper := 0, 0
+		for _, r := range text {
+			if unicode.IsLetter(r) {
+				letters++
+				if unicode.IsUpper(r) {
+					upper++
+				}
+			}
+		}
+		// короткие сообщения ("OK", "ЛОЛ") не считаются
+		return letters >= 8 && upper*100 >= threshold*letters
+
+	case "flood":
+		threshold := rule.Threshold
+		if threshold <= 0 {
+			threshold = 8
+		}
+		window := rule.WindowSeconds
+		if window <= 0 {
+			window = 10
+		}
+		var cnt int64
+		db.Model(&models.Message{}).
+			Where("chat_id = ? AND sender_id = ? AND created_at > ?", chatID, userID, now.Add(-time.Duration(window)*time.Second)).
+			Count(&cnt)
+		return cnt >= int64(threshold)
+
+	case "account_age":
+		minutes := rule.Threshold
+		if minutes <= 0 {
+			minutes = 24 * 60
+		}
+		var user models.User
+		if err := db.Select("created_at").First(&user, "id = ?", userID).Error; err != nil {
+			return false
+		}
+		return user.CreatedAt.After(now.Add(-time.Duration(minutes) * time.Minute))
+
+	case "repeated_text":
+		if text == "" {
+			return false
+		}
+		threshold := rule.Threshold
+		if threshold <= 0 {
+			threshold = 3
+		}
+		window := rule.WindowSeconds
+		if window <= 0 {
+			window = 60
+		}
+		// текущее сообщение тоже считается повтором
+		var cnt int64
+		db.Model(&models.Message{}).
+			Where("chat_id = ? AND sender_id = ? AND text = ? AND created_at > ?", chatID, userID, text, now.Add(-time.Duration(window)*time.Second)).
+			Count(&cnt)
+		return cnt+1 >= int64(threshold)
+	}
+	return false
+}
+
+func splitRuleActions(actions string) []string {
+	result := make([]string, 0)
+	for _, a := range strings.Split(actions, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+// evaluateAutomod проверяет сообщение правилами чата. Мастер-переключатель — settings.Enabled.
+func evaluateAutomod(db *gorm.DB, chatID, userID, text string, now time.Time) automodVerdict {
+	var verdict automodVerdict
+	if err := db.Where("chat_id = ?", chatID).First(&verdict.Settings).Error; err != nil || !verdict.Settings.Enabled {
+		return verdict
+	}
+
+	for _, rule := range chatModerationRules(db, verdict.Settings) {
+		if !ruleMatches(db, rule, chatID, userID, text, now) {
+			continue
+		}
+		hit := automodHit{
+			RuleID:    rule.ID,
+			Rule:      rule.Name,
+			Condition: rule.Condition,
+			Actions:   splitRuleActions(rule.Actions),
+			DryRun:    verdict.Settings.DryRun || rule.DryRun,
+			Duration:  rule.DurationMinutes,
+		}
+		verdict.Hits = append(verdict.Hits, hit)
+		if hit.DryRun {
+			continue
+		}
+
+		reason := rule.Condition
+		if rule.ID == "" {
+			reason = rule.Name // встроенные правила: "spam" | "banned_word"
+		}
+		for _, action := range hit.Actions {
+			switch action {
+			case "delete", "mute", "temp_ban", "kick":
+				if verdict.Status != "rejected" {
+					verdict.Status = "rejected"
+					verdict.Reason = reason
+				}
+			case "queue":
+				if verdict.Status == "" {
+					verdict.Status = "pending"
+					verdict.Reason = reason
+				}
+			}
+		}
+	}
+	return verdict
+}
+
+// applyAutomod выполняет действия сработавших правил (после сохранения сообщения)
+func applyAutomod(db *gorm.DB, verdict automodVerdict, chatID, userID, messageID string) {
+	done := map[string]bool{}
+	for _, hit := range verdict.Hits {
+		meta := gin.H{"ruleId": hit.RuleID, "rule": hit.Rule, "condition": hit.Condition, "actions": hit.Actions}
+		if hit.DryRun {
+			logModeration(db, chatID, "", "", "automod_dry_run", userID, messageID, meta)
+			continue
+		}
+		logModeration(db, chatID, "", "", "automod_violation", userID, messageID, meta)
+
+		for _, action := range hit.Actions {
+			if done[action] {
+				continue
+			}
+			done[action] = true
+			switch action {
+			case "warn":
+				applyWarning(db, &verdict.Settings, chatID, userID, "", "automod:"+hit.Rule)
+			case "mute":
+				mins := hit.Duration
+				if mins <= 0 {
+					mins = 10
+				}
+				muteChatMember(db, chatID, userID, "", "automod:"+hit.Rule, mins)
+			case "temp_ban":
+				mins := hit.Duration
+				if mins <= 0 {
+					mins = verdict.Settings.BanMinutes
+				}
+				if mins <= 0 {
+					mins = 10
+				}
+				banChatMember(db, chatID, userID, "", "automod:"+hit.Rule, mins)
+			case "kick":
+				db.Where("chat_id = ? AND user_id = ?", chatID, userID).Delete(&models.ChatMember{})
+				logMemberEvent(db, "chat", chatID, userID, "", "remove", gin.H{"reason": "automod:" + hit.Rule})
+				logModeration(db, chatID, "", "", "kick", userID, "", gin.H{"reason": "automod:" + hit.Rule})
+			}
+		}
+	}
+}
+
+// applyWarning выдает предупреждение и применяет эскалацию по WarnThreshold:
+// каждые WarnThreshold предупреждений за 24 часа — бан, длительность удваивается.
+// settings == nil — настройки загружаются из БД (эскалация только если они есть).
+func applyWarning(db *gorm.DB, settings *models.ChatModerationSettings, chatID, userID, actorID, reason string) {
+	_ = db.Create(&models.ChatWarning{
+		ID:      uuid.New().String(),
+		ChatID:  chatID,
+		UserID:  userID,
+		ActorID: actorID,
+		Reason:  reason,
+	}).Error
+	logMemberEvent(db, "chat", chatID, userID, actorID, "warn", gin.H{"reason": reason})
+	logModeration(db, chatID, "", actorID, "warn", userID, "", gin.H{"reason": reason})
+
+	if settings == nil {
+		var s models.ChatModerationSettings
+		if err := db.Where("chat_id = ?", chatID).First(&s).Error; err != nil {
+			return
+		}
+		settings = &s
+	}
+
+	threshold := settings.WarnThreshold
+	if threshold <= 0 {
+		threshold = 2
+	}
+	var warnCnt int64
+	db.Model(&models.ChatWarning{}).
+		Where("chat_id = ? AND user_id = ? AND created_at > ?", chatID, userID, time.Now().Add(-24*time.Hour)).
+		Count(&warnCnt)
+	if warnCnt < int64(threshold) || warnCnt%int64(threshold) != 0 {
+		return
+	}
+
+	mins := settings.BanMinutes
+	if mins <= 0 {
+		mins = 10
+	}
+	for level := warnCnt / int64(threshold); level > 1 && mins < maxEscalationBanMinutes; level-- {
+		mins *= 2
+	}
+	if mins > maxEscalationBanMinutes {
+		mins = maxEscalationBanMinutes
+	}
+	banChatMember(db, chatID, userID, actorID, "warn_threshold", mins)
+}
+
+func banChatMember(db *gorm.DB, chatID, userID, actorID, reason string, minutes int) time.Time {
+	exp := time.Now().Add(time.Duration(minutes) * time.Minute)
+	_ = db.Create(&models.ChatBan{
+		ID:        uuid.New().String(),
+		ChatID:    chatID,
+		UserID:    userID,
+		ActorID:   actorID,
+		Reason:    reason,
+		ExpiresAt: &exp,
+	}).Error
+	logMemberEvent(db, "chat", chatID, userID, actorID, "ban", gin.H{"expiresAt": exp, "reason": reason})
+	logModeration(db, chatID, "", actorID, "ban", userID, "", gin.H{"expiresAt": exp, "reason": reason})
+	return exp
+}
+
+func muteChatMember(db *gorm.DB, chatID, userID, actorID, reason string, minutes int) time.Time {
+	exp := time.Now().Add(time.Duration(minutes) * time.Minute)
+	_ = db.Create(&models.ChatMute{
+		ID:        uuid.New().String(),
+		ChatID:    chatID,
+		UserID:    userID,
+		ActorID:   actorID,
+		Reason:    reason,
+		ExpiresAt: &exp,
+	}).Error
+	logMemberEvent(db, "chat", chatID, userID, actorID, "mute", gin.H{"expiresAt": exp, "reason": reason})
+	logModeration(db, chatID, "", actorID, "mute", userID, "", gin.H{"expiresAt": exp, "reason": reason})
+	return exp
+}
+
+// validateModerationRule проверяет условие, действия и regex правила
+func validateModerationRule(rule *models.ModerationRule) string {
+	if !validRuleConditions[rule.Condition] {
+		return "invalid_condition"
+	}
+	actions := splitRuleActions(rule.Actions)
+	if len(actions) == 0 {
+		return "invalid_actions"
+	}
+	for _, a := range actions {
+		if !validRuleActions[a] {
+			return "invalid_actions"
+		}
+	}
+	rule.Actions = strings.Join(actions, ",")
+	if rule.Condition == "regex" {
+		if rule.Pattern == "" || len(rule.Pattern) > 500 {
+			return "invalid_pattern"
+		}
+		if _, err := compileRulePattern(rule.Pattern); err != nil {
+			return "invalid_pattern"
+		}
+	}
+	if rule.Threshold < 0 || rule.WindowSeconds < 0 || rule.DurationMinutes < 0 {
+		return "invalid_threshold"
+	}
+	return ""
+}
+
+// GetModerationRules правила автомодерации чата (manage_moderation)
+func GetModerationRules(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chatID := c.Param("id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if !authz.Can(userIDStr, authz.Chat(chatID), authz.ManageModeration) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var rules []models.ModerationRule
+		db.Where("chat_id = ?", chatID).Order("priority ASC, created_at ASC").Find(&rules)
+		c.JSON(http.StatusOK, gin.H{"rules": rules})
+	}
+}
+
+// CreateModerationRule создать правило (manage_moderation)
+func CreateModerationRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chatID := c.Param("id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if !authz.Can(userIDStr, authz.Chat(chatID), authz.ManageModeration) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var req struct {
+			Name            string `json:"name" binding:"required"`
+			Enabled         *bool  `json:"enabled"`
+			DryRun          bool   `json:"dryRun"`
+			Priority        int    `json:"priority"`
+			Condition       string `json:"condition" binding:"required"`
+			Pattern         string `json:"pattern"`
+			Threshold       int    `json:"threshold"`
+			WindowSeconds   int    `json:"windowSeconds"`
+			Actions         string `json:"actions" binding:"required"`
+			DurationMinutes int    `json:"durationMinutes"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		rule := models.ModerationRule{
+			ID:              uuid.New().String(),
+			ChatID:          chatID,
+			Name:            req.Name,
+			Enabled:         req.Enabled == nil || *req.Enabled,
+			DryRun:          req.DryRun,
+			Priority:        req.Priority,
+			Condition:       req.Condition,
+			Pattern:         req.Pattern,
+			Threshold:       req.Threshold,
+			WindowSeconds:   req.WindowSeconds,
+			Actions:         req.Actions,
+			DurationMinutes: req.DurationMinutes,
+			CreatedBy:       userIDStr,
+		}
+		if errCode := validateModerationRule(&rule); errCode != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errCode})
+			return
+		}
+		if err := db.Create(&rule).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		logModeration(db, chatID, "", userIDStr, "automod_rule_create", "", "", gin.H{"ruleId": rule.ID, "name": rule.Name})
+		c.JSON(http.StatusCreated, gin.H{"rule": rule})
+	}
+}
+
+// UpdateModerationRule изменить правило (manage_moderation)
+func UpdateModerationRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chatID := c.Param("id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if !authz.Can(userIDStr, authz.Chat(chatID), authz.ManageModeration) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var rule models.ModerationRule
+		if err := db.Where("id = ? AND chat_id = ?", c.Param("ruleId"), chatID).First(&rule).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+
+		var req struct {
+			Name            *string `json:"name"`
+			Enabled         *bool   `json:"enabled"`
+			DryRun          *bool   `json:"dryRun"`
+			Priority        *int    `json:"priority"`
+			Condition       *string `json:"condition"`
+			Pattern         *string `json:"pattern"`
+			Threshold       *int    `json:"threshold"`
+			WindowSeconds   *int    `json:"windowSeconds"`
+			Actions         *string `json:"actions"`
+			DurationMinutes *int    `json:"durationMinutes"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		if req.Name != nil && *req.Name != "" {
+			rule.Name = *req.Name
+		}
+		if req.Enabled != nil {
+			rule.Enabled = *req.Enabled
+		}
+		if req.DryRun != nil {
+			rule.DryRun = *req.DryRun
+		}
+		if req.Priority != nil {
+			rule.Priority = *req.Priority
+		}
+		if req.Condition != nil {
+			rule.Condition = *req.Condition
+		}
+		if req.Pattern != nil {
+			rule.Pattern = *req.Pattern
+		}
+		if req.Threshold != nil {
+			rule.Threshold = *req.Threshold
+		}
+		if req.WindowSeconds != nil {
+			rule.WindowSeconds = *req.WindowSeconds
+		}
+		if req.Actions != nil {
+			rule.Actions = *req.Actions
+		}
+		if req.DurationMinutes != nil {
+			rule.DurationMinutes = *req.DurationMinutes
+		}
+		if errCode := validateModerationRule(&rule); errCode != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errCode})
+			return
+		}
+
+		db.Save(&rule)
+		logModeration(db, chatID, "", userIDStr, "automod_rule_update", "", "", gin.H{"ruleId": rule.ID, "name": rule.Name})
+		c.JSON(http.StatusOK, gin.H{"rule": rule})
+	}
+}
+
+// DeleteModerationRule удалить правило (manage_moderation)
+func DeleteModerationRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chatID := c.Param("id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if !authz.Can(userIDStr, authz.Chat(chatID), authz.ManageModeration) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		res := db.Where("id = ? AND chat_id = ?", c.Param("ruleId"), chatID).Delete(&models.ModerationRule{})
+		if res.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+
+		logModeration(db, chatID, "", userIDStr, "automod_rule_delete", "", "", gin.H{"ruleId": c.Param("ruleId")})
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// TestModerationRules показывает, какие правила сработали бы на тексте (без действий)
+func TestModerationRules(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chatID := c.Param("id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if !authz.Can(userIDStr, authz.Chat(chatID), authz.ManageModeration) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var req struct {
+			Text   string `json:"text"`
+			UserID string `json:"userId"` // от чьего имени проверять (flood, возраст аккаунта)
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+		if req.UserID == "" {
+			req.UserID = userIDStr
+		}
+
+		var settings models.ChatModerationSettings
+		if err := db.Where("chat_id = ?", chatID).First(&settings).Error; err != nil {
+			settings = models.ChatModerationSettings{ChatID: chatID}
+		}
+
+		now := time.Now()
+		hits := make([]automodHit, 0)
+		for _, rule := range chatModerationRules(db, settings) {
+			if ruleMatches(db, rule, chatID, req.UserID, req.Text, now) {
+				hits = append(hits, automodHit{
+					RuleID:    rule.ID,
+					Rule:      rule.Name,
+					Condition: rule.Condition,
+					Actions:   splitRuleActions(rule.Actions),
+					DryRun:    settings.DryRun || rule.DryRun,
+					Duration:  rule.DurationMinutes,
+				})
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"enabled": settings.Enabled, "hits": hits})
+	}
+}
+
+// GetAutomodDryRunLog срабатывания правил в режиме dry-run (manage_moderation)
+func GetAutomodDryRunLog(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chatID := c.Param("id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if !authz.Can(userIDStr, authz.Chat(chatID), authz.ManageModeration) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var logs []models.ModerationLog
+		db.Where("chat_id = ? AND action = ?", chatID, "automod_dry_run").Order("created_at DESC").Limit(300).Find(&logs)
+		c.JSON(http.StatusOK, gin.H{"logs": logs})
+	}
+}
@@ -0,0 +1,441 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"safegram-server/internal/authz"
+	"safegram-server/internal/models"
+	"safegram-server/internal/websocket"
+)
+
+// callRingTimeout время вызова, после которого звонок считается пропущенным
+const callRingTimeout = 45 * time.Second
+
+// activeCall состояние идущего звонка (ringing | answered)
+type activeCall struct {
+	call           models.Call
+	timer          *time.Timer
+	callerClientID string // устройство звонящего
+	calleeClientID string // устройство, принявшее звонок
+}
+
+// callManager конечный автомат 1:1 звонков, управляемый сигналингом
+type callManager struct {
+	db    *gorm.DB
+	hub   *websocket.Hub
+	mu    sync.Mutex
+	calls map[string]*activeCall
+}
+
+var calls *callManager
+
+// RegisterCallSignaling подключает обработчики call:* и webrtc:* к хабу.
+// Вызывается до запуска wsHub.Run.
+func RegisterCallSignaling(db *gorm.DB, hub *websocket.Hub) {
+	calls = &callManager{db: db, hub: hub, calls: make(map[string]*activeCall)}
+
+	// Звонки, оставшиеся активными после перезапуска, закрываем
+	now := time.Now()
+	db.Model(&models.Call{}).Where("status = ?", "ringing").
+		Updates(map[string]interface{}{"status": "missed", "ended_at": now})
+	db.Model(&models.Call{}).Where("status = ?", "answered").
+		Updates(map[string]interface{}{"status": "ended", "ended_at": now})
+
+	hub.On("call:invite", calls.invite)
+	hub.On("call:accept", calls.accept)
+	hub.On("call:decline", calls.decline)
+	hub.On("call:cancel", calls.cancel)
+	hub.On("call:hangup", calls.hangup)
+	hub.On("webrtc:hangup", calls.hangup)
+	hub.On("webrtc:offer", calls.relay)
+	hub.On("webrtc:answer", calls.relay)
+	hub.On("webrtc:ice", calls.relay)
+	hub.OnDisconnect(calls.disconnected)
+}
+
+func callPayload(call models.Call) gin.H {
+	var answeredAt, endedAt *int64
+	if call.AnsweredAt != nil {
+		ms := call.AnsweredAt.Unix() * 1000
+		answeredAt = &ms
+	}
+	if call.EndedAt != nil {
+		ms := call.EndedAt.Unix() * 1000
+		endedAt = &ms
+	}
+	return gin.H{
+		"id":         call.ID,
+		"chatId":     call.ChatID,
+		"callerId":   call.CallerID,
+		"receiverId": call.ReceiverID,
+		"type":       call.Type,
+		"status":     call.Status,
+		"duration":   call.Duration,
+		"startedAt":  call.StartedAt.Unix() * 1000,
+		"answeredAt": answeredAt,
+		"endedAt":    endedAt,
+	}
+}
+
+func wsEvent(eventType string, data gin.H) []byte {
+	payload, _ := json.Marshal(gin.H{"type": eventType, "data": data})
+	return payload
+}
+
+func (m *callManager) sendError(client *websocket.Client, callID, code string) {
+	client.Send(wsEvent("call:error", gin.H{"callId": callID, "error": code}))
+}
+
+// busy проверяет, участвует ли пользователь в активном звонке (под m.mu)
+func (m *callManager) busy(userID string) bool {
+	for _, ac := range m.calls {
+		if ac.call.CallerID == userID || ac.call.ReceiverID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// invite call:invite {chatId, to, type} — создает звонок в состоянии ringing
+func (m *callManager) invite(client *websocket.Client, msg map[string]interface{}) {
+	callerID := client.UserID()
+	chatID, _ := msg["chatId"].(string)
+	calleeID, _ := msg["to"].(string)
+	callType, _ := msg["type"].(string)
+	if t, _ := msg["callType"].(string); t != "" {
+		callType = t
+	}
+	if callType != "video" {
+		callType = "voice"
+	}
+
+	if chatID == "" || calleeID == "" || calleeID == callerID {
+		m.sendError(client, "", "bad_request")
+		return
+	}
+	var chat models.Chat
+	if err := m.db.Select("id", "type").First(&chat, "id = ?", chatID).Error; err != nil || chat.Type != "dm" {
+		m.sendError(client, "", "not_found")
+		return
+	}
+	if !authz.IsMember(callerID, authz.Chat(chatID)) || !authz.IsMember(calleeID, authz.Chat(chatID)) {
+		m.sendError(client, "", "forbidden")
+		return
+	}
+	if code := interactionDenied(m.db, callerID, calleeID, callsRule); code != "" {
+		m.sendError(client, "", code)
+		return
+	}
+
+	call := models.Call{
+		ID:         uuid.New().String(),
+		ChatID:     chatID,
+		CallerID:   callerID,
+		ReceiverID: calleeID,
+		Type:       callType,
+		Status:     "ringing",
+		StartedAt:  time.Now(),
+	}
+
+	m.mu.Lock()
+	if m.busy(callerID) {
+		m.mu.Unlock()
+		m.sendError(client, "", "already_in_call")
+		return
+	}
+	calleeBusy := m.busy(calleeID)
+	if calleeBusy {
+		now := call.StartedAt
+		call.Status = "busy"
+		call.EndedAt = &now
+	} else {
+		ac := &activeCall{call: call, callerClientID: client.ID()}
+		ac.timer = time.AfterFunc(callRingTimeout, func() { m.timeout(call.ID) })
+		m.calls[call.ID] = ac
+	}
+	m.mu.Unlock()
+
+	if err := m.db.Create(&call).Error; err != nil {
+		log.Printf("Failed to create call: %v", err)
+	}
+
+	if calleeBusy {
+		client.Send(wsEvent("call:busy", callPayload(call)))
+		return
+	}
+
+	client.Send(wsEvent("call:ringing", callPayload(call)))
+
+	var caller models.User
+	m.db.First(&caller, "id = ?", callerID)
+	incoming := callPayload(call)
+	incoming["caller"] = gin.H{"id": caller.ID, "username": caller.Username, "avatarUrl": visibleAvatar(m.db, calleeID, caller)}
+	m.hub.SendToUser(calleeID, wsEvent("call:incoming", incoming))
+
+	// Ни одного подключенного устройства — диспетчер будит через push
+	title := "Входящий звонок"
+	if callType == "video" {
+		title = "Входящий видеозвонок"
+	}
+	dispatchNotification(m.db, m.hub, notification{
+		UserID: calleeID,
+		Kind:   notifyCall,
+		ChatID: chatID,
+		Title:  title,
+		Body:   caller.Username,
+		Data:   map[string]interface{}{"type": "call:incoming", "callId": call.ID, "chatId": chatID},
+	})
+}
+
+// timeout срабатывает, если никто не ответил за callRingTimeout
+func (m *callManager) timeout(callID string) {
+	m.finish(callID, "ringing", "missed", "timeout", "")
+}
+
+// finish переводит звонок из состояния from в конечное, считает длительность и уведомляет стороны.
+// from проверяется под m.mu, поэтому ответ, пришедший между проверкой вызывающего и
+// завершением, не затирается. Возвращает false, если звонок уже в другом состоянии
+func (m *callManager) finish(callID, from, status, reason, exceptClientID string) bool {
+	m.mu.Lock()
+	ac, ok := m.calls[callID]
+	if !ok || ac.call.Status != from {
+		m.mu.Unlock()
+		return false
+	}
+	delete(m.calls, callID)
+	ac.timer.Stop()
+
+	now := time.Now()
+	call := ac.call
+	call.Status = status
+	call.EndedAt = &now
+	if call.AnsweredAt != nil {
+		call.Duration = int(now.Sub(*call.AnsweredAt).Seconds())
+	}
+	m.mu.Unlock()
+
+	m.db.Model(&models.Call{}).Where("id = ?", call.ID).Updates(map[string]interface{}{
+		"status":   call.Status,
+		"ended_at": call.EndedAt,
+		"duration": call.Duration,
+	})
+
+	stopCallRecordings(m.db, m.hub, call.ID)
+
+	payload := callPayload(call)
+	payload["reason"] = reason
+	event := wsEvent("call:ended", payload)
+	m.hub.SendToUserExcept(call.CallerID, exceptClientID, event)
+	m.hub.SendToUserExcept(call.ReceiverID, exceptClientID, event)
+
+	if status == "missed" || status == "cancelled" {
+		var caller models.User
+		m.db.Select("id", "username").First(&caller, "id = ?", call.CallerID)
+		dispatchNotification(m.db, m.hub, notification{
+			UserID: call.ReceiverID,
+			Kind:   notifyCall,
+			ChatID: call.ChatID,
+			Title:  "Пропущенный звонок",
+			Body:   caller.Username,
+			Data:   map[string]interface{}{"type": "call:missed", "callId": call.ID, "chatId": call.ChatID},
+		})
+	}
+	return true
+}
+
+// lookup возвращает копию активного звонка, в котором участвует пользователь
+func (m *callManager) lookup(client *websocket.Client, msg map[string]interface{}) (models.Call, bool) {
+	callID, _ := msg["callId"].(string)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ac, ok := m.calls[callID]
+	if !ok || (ac.call.CallerID != client.UserID() && ac.call.ReceiverID != client.UserID()) {
+		return models.Call{}, false
+	}
+	return ac.call, true
+}
+
+// accept call:accept {callId} — ответ на звонок с одного из устройств вызываемого
+func (m *callManager) accept(client *websocket.Client, msg map[string]interface{}) {
+	callID, _ := msg["callId"].(string)
+	m.mu.Lock()
+	ac, ok := m.calls[callID]
+	if !ok || ac.call.ReceiverID != client.UserID() {
+		m.mu.Unlock()
+		m.sendError(client, callID, "not_found")
+		return
+	}
+	if ac.call.Status != "ringing" {
+		m.mu.Unlock()
+		m.sendError(client, callID, "already_answered")
+		return
+	}
+	ac.timer.Stop()
+	now := time.Now()
+	ac.call.Status = "answered"
+	ac.call.AnsweredAt = &now
+	ac.calleeClientID = client.ID()
+	call := ac.call
+	m.mu.Unlock()
+
+	m.db.Model(&models.Call{}).Where("id = ?", call.ID).
+		Updates(map[string]interface{}{"status": "answered", "answered_at": now})
+
+	m.hub.SendToUser(call.CallerID, wsEvent("call:accepted", callPayload(call)))
+	client.Send(wsEvent("call:accepted", callPayload(call)))
+
+	// Остальные устройства вызываемого перестают звонить
+	cancelled := callPayload(call)
+	cancelled["reason"] = "answered_elsewhere"
+	m.hub.SendToUserExcept(call.ReceiverID, client.ID(), wsEvent("call:cancelled", cancelled))
+}
+
+// decline call:decline {callId}
+func (m *callManager) decline(client *websocket.Client, msg map[string]interface{}) {
+	call, ok := m.lookup(client, msg)
+	if !ok || call.ReceiverID != client.UserID() || call.Status != "ringing" {
+		m.sendError(client, call.ID, "not_found")
+		return
+	}
+	m.finish(call.ID, "ringing", "declined", "declined", "")
+}
+
+// cancel call:cancel {callId} — звонящий отменяет вызов до ответа
+func (m *callManager) cancel(client *websocket.Client, msg map[string]interface{}) {
+	call, ok := m.lookup(client, msg)
+	if !ok || call.CallerID != client.UserID() || call.Status != "ringing" {
+		m.sendError(client, call.ID, "not_found")
+		return
+	}
+	m.finish(call.ID, "ringing", "cancelled", "cancelled", "")
+}
+
+// hangup call:hangup / webrtc:hangup {callId}
+func (m *callManager) hangup(client *websocket.Client, msg map[string]interface{}) {
+	if _, ok := msg["callId"].(string); !ok {
+		m.sendError(client, "", "call_id_required")
+		return
+	}
+	call, ok := m.lookup(client, msg)
+	if !ok {
+		return
+	}
+	m.hangupAs(call, client.UserID())
+}
+
+// hangupAs завершает звонок от имени участника по его текущему состоянию.
+// Если звонок успели принять, пока решали, — повторяем уже как разговор
+func (m *callManager) hangupAs(call models.Call, userID string) {
+	for {
+		m.mu.Lock()
+		ac, ok := m.calls[call.ID]
+		status := ""
+		if ok {
+			status = ac.call.Status
+		}
+		m.mu.Unlock()
+		if !ok {
+			return
+		}
+
+		var done bool
+		switch {
+		case status == "answered":
+			done = m.finish(call.ID, "answered", "ended", "hangup", "")
+		case call.CallerID == userID:
+			done = m.finish(call.ID, "ringing", "cancelled", "cancelled", "")
+		default:
+			done = m.finish(call.ID, "ringing", "declined", "declined", "")
+		}
+		if done {
+			return
+		}
+	}
+}
+
+// relay webrtc:offer/answer/ice — пересылает сигналинг только участнику звонка.
+// Без callId сигналинг не пересылается: звонок начинается только через call:invite
+func (m *callManager) relay(client *websocket.Client, msg map[string]interface{}) {
+	callID, ok := msg["callId"].(string)
+	if !ok {
+		m.sendError(client, "", "call_id_required")
+		return
+	}
+
+	m.mu.Lock()
+	ac, found := m.calls[callID]
+	if !found {
+		m.mu.Unlock()
+		m.sendError(client, callID, "not_found")
+		return
+	}
+	var toUser, toClient string
+	switch client.UserID() {
+	case ac.call.CallerID:
+		toUser, toClient = ac.call.ReceiverID, ac.calleeClientID
+	case ac.call.ReceiverID:
+		toUser, toClient = ac.call.CallerID, ac.callerClientID
+	default:
+		m.mu.Unlock()
+		m.sendError(client, callID, "forbidden")
+		return
+	}
+	m.mu.Unlock()
+
+	msg["from"] = client.UserID()
+	msg["to"] = toUser
+	data, _ := json.Marshal(msg)
+	if toClient != "" {
+		m.hub.SendToClient(toClient, data)
+	} else {
+		m.hub.SendToUser(toUser, data)
+	}
+}
+
+// disconnected завершает звонки, чье устройство отключилось
+func (m *callManager) disconnected(userID, clientID string, lastConnection bool) {
+	m.mu.Lock()
+	var dropped []models.Call
+	for _, ac := range m.calls {
+		switch {
+		case ac.call.CallerID == userID && (ac.callerClientID == clientID || lastConnection):
+			dropped = append(dropped, ac.call)
+		case ac.call.ReceiverID == userID && ac.calleeClientID == clientID:
+			dropped = append(dropped, ac.call)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, call := range dropped {
+		m.hangupAs(call, userID)
+	}
+}
+
+// GetActiveCalls активные звонки пользователя (для восстановления после переподключения)
+func GetActiveCalls(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var active []models.Call
+		db.Where("(caller_id = ? OR receiver_id = ?) AND status IN ?", userIDStr, userIDStr, []string{"ringing", "answered"}).
+			Order("started_at DESC").Find(&active)
+
+		result := make([]gin.H, len(active))
+		for i, call := range active {
+			result[i] = callPayload(call)
+		}
+		c.JSON(http.StatusOK, gin.H{"calls": result})
+	}
+}
@@ -89,7 +89,7 @@ func CreateCall(db *gorm.DB) gin.HandlerFunc {
 				"receiver": gin.H{
 					"id":       call.Receiver.ID,
 					"username": call.Receiver.Username,
-					"avatarUrl": call.Receiver.AvatarURL,
+					"avatarUrl": visibleAvatar(db, userIDStr, call.Receiver),
 				},
 			},
 		})
@@ -130,6 +130,11 @@ func GetCallHistory(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		userIDs := make([]string, 0, len(calls)*2)
+		for _, call := range calls {
+			userIDs = append(userIDs, call.CallerID, call.ReceiverID)
+		}
+		view := newPrivacyView(db, userIDStr, userIDs)
 		result := make([]gin.H, len(calls))
 		for i, call := range calls {
 			var endedAtInt *int64
@@ -151,12 +156,12 @@ func GetCallHistory(db *gorm.DB) gin.HandlerFunc {
 				"caller": gin.H{
 					"id":       call.Caller.ID,
 					"username": call.Caller.Username,
-					"avatarUrl": call.Caller.AvatarURL,
+					"avatarUrl": view.avatar(call.Caller),
 				},
 				"receiver": gin.H{
 					"id":       call.Receiver.ID,
 					"username": call.Receiver.Username,
-					"avatarUrl": call.Receiver.AvatarURL,
+					"avatarUrl": view.avatar(call.Receiver),
 				},
 			}
 		}
@@ -185,6 +190,11 @@ func GetMissedCalls(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		callerIDs := make([]string, len(calls))
+		for i, call := range calls {
+			callerIDs[i] = call.CallerID
+		}
+		callers := newPrivacyView(db, userIDStr, callerIDs)
 		result := make([]gin.H, len(calls))
 		for i, call := range calls {
 			result[i] = gin.H{
@@ -201,7 +211,7 @@ func GetMissedCalls(db *gorm.DB) gin.HandlerFunc {
 				"caller": gin.H{
 					"id":       call.Caller.ID,
 					"username": call.Caller.Username,
-					"avatarUrl": call.Caller.AvatarURL,
+					"avatarUrl": callers.avatar(call.Caller),
 				},
 				"receiver": gin.H{
 					"id":       "",
@@ -238,77 +248,3 @@ func MarkCallAsRead(db *gorm.DB) gin.HandlerFunc {
 		c.JSON(http.StatusOK, gin.H{"ok": true})
 	}
 }
-
-// UploadCallRecording загружает запись звонка
-func UploadCallRecording(db *gorm.DB) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userID, _ := c.Get("userID")
-		userIDStr, ok := userID.(string)
-		if !ok {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
-			return
-		}
-
-		file, err := c.FormFile("file")
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
-			return
-		}
-
-		chatID := c.PostForm("chatId")
-		otherUserId := c.PostForm("otherUserId")
-		durationStr := c.PostForm("duration")
-		duration := 0
-		if durationStr != "" {
-			// Простой парсинг int
-			for _, char := range durationStr {
-				if char >= '0' && char <= '9' {
-					duration = duration*10 + int(char-'0')
-				} else {
-					break
-				}
-			}
-		}
-
-		// Сохраняем файл
-		filename := uuid.New().String() + ".webm"
-		filepath := "./uploads/call-recordings/" + filename
-		if err := c.SaveUploadedFile(file, filepath); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
-			return
-		}
-
-		recordingURL := "/uploads/call-recordings/" + filename
-
-		// Обновляем или создаем запись о звонке
-		var call models.Call
-		if err := db.Where("chat_id = ? AND ((caller_id = ? AND receiver_id = ?) OR (caller_id = ? AND receiver_id = ?))", 
-			chatID, userIDStr, otherUserId, otherUserId, userIDStr).
-			Order("started_at DESC").
-			First(&call).Error; err == nil {
-			// Обновляем существующий звонок
-			call.RecordingURL = recordingURL
-			call.Duration = duration
-			db.Save(&call)
-		} else {
-			// Создаем новый
-			call = models.Call{
-				ID:           uuid.New().String(),
-				ChatID:       chatID,
-				CallerID:     userIDStr,
-				ReceiverID:   otherUserId,
-				Type:         "video", // По умолчанию, можно определить из контекста
-				Status:       "completed",
-				Duration:     duration,
-				StartedAt:    time.Now(),
-				RecordingURL: recordingURL,
-			}
-			db.Create(&call)
-		}
-
-		c.JSON(http.StatusOK, gin.H{
-			"recordingUrl": recordingURL,
-			"callId":       call.ID,
-		})
-	}
-}
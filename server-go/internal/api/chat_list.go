@@ -0,0 +1,227 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"safegram-server/internal/models"
+)
+
+// chatActivitySQL момент последней активности чата — ключ сортировки списка чатов
+const chatActivitySQL = "COALESCE(s.last_message_at, c.created_at)"
+
+// refreshChatSummary пересчитывает сводку чата по последнему видимому сообщению
+func refreshChatSummary(db *gorm.DB, chatID string) {
+	summary := models.ChatSummary{ChatID: chatID, UpdatedAt: time.Now()}
+	var last models.Message
+	if err := db.Select("id", "created_at").
+		Where("chat_id = ? AND deleted_at IS NULL AND moderation_status = 'approved'", chatID).
+		Where("COALESCE(thread_id, '') = ''").
+		Order("created_at DESC").
+		First(&last).Error; err == nil {
+		summary.LastMessageID = last.ID
+		summary.LastMessageAt = &last.CreatedAt
+	}
+	db.Save(&summary)
+}
+
+// chatListFilter условия отбора чатов в списке пользователя
+type chatListFilter struct {
+	Archived   string   // exclude | include | only
+	Types      []string // dm, group, channel (пусто — все)
+	UnreadOnly bool
+	IncludeIDs []string // явный список чатов (пусто — без ограничения)
+	ExcludeIDs []string
+	Folder     *models.ChatFolder
+}
+
+func (f chatListFilter) apply(query *gorm.DB) *gorm.DB {
+	switch f.Archived {
+	case "only":
+		query = query.Where("m.archived_at IS NOT NULL")
+	case "include":
+	default:
+		query = query.Where("m.archived_at IS NULL")
+	}
+	if len(f.Types) > 0 {
+		query = query.Where("c.type IN ?", f.Types)
+	}
+	if f.UnreadOnly {
+		query = query.Where("m.unread_count > 0")
+	}
+	if len(f.IncludeIDs) > 0 {
+		query = query.Where("m.chat_id IN ?", f.IncludeIDs)
+	}
+	if len(f.ExcludeIDs) > 0 {
+		query = query.Where("m.chat_id NOT IN ?", f.ExcludeIDs)
+	}
+	if f.Folder != nil {
+		condition, args := folderCondition(*f.Folder)
+		query = query.Where(condition, args...)
+	}
+	return query
+}
+
+// chatListRow строка списка чатов до загрузки подробностей
+type chatListRow struct {
+	ChatID        string
+	ActivityAt    time.Time
+	LastMessageID string
+	PinOrder      int
+}
+
+// chatScope участие пользователя в чатах (m), сами чаты (c) и их сводки (s) с учетом фильтра
+func chatScope(db *gorm.DB, userID string, filter chatListFilter) *gorm.DB {
+	query := db.Table("chat_members m").
+		Joins("JOIN chats c ON c.id = m.chat_id AND c.deleted_at IS NULL").
+		Joins("LEFT JOIN chat_summaries s ON s.chat_id = m.chat_id").
+		Where("m.user_id = ? AND m.deleted_at IS NULL", userID)
+	return filter.apply(query)
+}
+
+// chatListQuery чаты пользователя вместе со сводками одним запросом
+func chatListQuery(db *gorm.DB, userID string, filter chatListFilter) *gorm.DB {
+	return chatScope(db, userID, filter).
+		Select("m.chat_id, " + chatActivitySQL + " AS activity_at, COALESCE(s.last_message_id, '') AS last_message_id, m.pin_order")
+}
+
+// chatChangedSince чаты, изменившиеся после since: новые сообщения, настройки
+// участника, данные чата или состав участников
+func chatChangedSince(query *gorm.DB, since time.Time) *gorm.DB {
+	return query.Where(`(m.updated_at > ? OR s.updated_at > ? OR c.updated_at > ?
+		OR EXISTS (SELECT 1 FROM chat_members x WHERE x.chat_id = m.chat_id AND (x.joined_at > ? OR x.deleted_at > ?)))`,
+		since, since, since, since, since)
+}
+
+// encodeChatCursor курсор страницы списка: позиция последнего отданного чата
+func encodeChatCursor(row chatListRow) string {
+	raw := strconv.FormatInt(row.ActivityAt.UnixMicro(), 10) + "|" + row.ChatID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeChatCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return time.Time{}, "", errors.New("invalid cursor")
+	}
+	micros, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	return time.UnixMicro(micros), parts[1], nil
+}
+
+// chatListItem элемент списка чатов
+type chatListItem struct {
+	models.Chat
+	Members           []chatMemberView `json:"members,omitempty"` // Профили участников по правилам приватности
+	LastMessage       *messageView     `json:"lastMessage,omitempty"`
+	ArchivedAt        *int64           `json:"archivedAt,omitempty"` // Timestamp архивирования для текущего пользователя
+	UnreadCount       int              `json:"unreadCount"`          // Количество непрочитанных сообщений
+	UnreadMentions    int              `json:"unreadMentions"`
+	LastReadMessageID string           `json:"lastReadMessageId,omitempty"`
+	Pinned            bool             `json:"pinned"`
+	PinOrder          int              `json:"pinOrder,omitempty"`
+}
+
+// loadChatListItems загружает чаты, участие пользователя и последние сообщения
+// для страницы списка фиксированным числом запросов
+func loadChatListItems(db *gorm.DB, userID string, rows []chatListRow) ([]chatListItem, error) {
+	items := make([]chatListItem, 0, len(rows))
+	if len(rows) == 0 {
+		return items, nil
+	}
+
+	chatIDs := make([]string, len(rows))
+	lastIDs := make([]string, 0, len(rows))
+	for i, row := range rows {
+		chatIDs[i] = row.ChatID
+		if row.LastMessageID != "" {
+			lastIDs = append(lastIDs, row.LastMessageID)
+		}
+	}
+
+	var chats []models.Chat
+	if err := db.Where("id IN ?", chatIDs).
+		Preload("Members").
+		Preload("Members.User").
+		Find(&chats).Error; err != nil {
+		return nil, err
+	}
+	var memberIDs []string
+	for _, chat := range chats {
+		for _, member := range chat.Members {
+			memberIDs = append(memberIDs, member.UserID)
+		}
+	}
+	// Участники видны в списке вместе с профилем — по правилам приватности
+	view := newPrivacyView(db, userID, memberIDs)
+	view.presence = presenceAmong(memberIDs)
+	chatByID := make(map[string]models.Chat, len(chats))
+	for _, chat := range chats {
+		chatByID[chat.ID] = chat
+	}
+
+	var members []models.ChatMember
+	db.Where("chat_id IN ? AND user_id = ?", chatIDs, userID).Find(&members)
+	memberByChat := make(map[string]models.ChatMember, len(members))
+	for _, member := range members {
+		memberByChat[member.ChatID] = member
+	}
+
+	lastByID := make(map[string]*messageView, len(lastIDs))
+	if len(lastIDs) > 0 {
+		var messages []models.Message
+		db.Where("id IN ?", lastIDs).Preload("Sender").Find(&messages)
+		views := messageViews(db, userID, messages)
+		for i := range views {
+			lastByID[views[i].ID] = &views[i]
+		}
+	}
+
+	for _, row := range rows {
+		chat, ok := chatByID[row.ChatID]
+		if !ok {
+			continue
+		}
+		member := memberByChat[row.ChatID]
+		item := chatListItem{
+			Chat:              chat,
+			Members:           view.members(chat.Members),
+			LastMessage:       lastByID[row.LastMessageID],
+			UnreadCount:       member.UnreadCount, // Счетчик поддерживается курсором прочтения
+			UnreadMentions:    member.UnreadMentions,
+			LastReadMessageID: member.LastReadMessageID,
+			Pinned:            member.PinOrder > 0,
+			PinOrder:          member.PinOrder,
+		}
+		if member.ArchivedAt != nil {
+			timestamp := member.ArchivedAt.Unix() * 1000
+			item.ArchivedAt = &timestamp
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// removedChatsSince чаты, из которых пользователь вышел или которые удалены после since
+func removedChatsSince(db *gorm.DB, userID string, since time.Time) []string {
+	var ids []string
+	db.Raw(`SELECT d.chat_id FROM chat_members d WHERE d.user_id = ? AND d.deleted_at > ?
+			AND NOT EXISTS (SELECT 1 FROM chat_members a WHERE a.chat_id = d.chat_id AND a.user_id = d.user_id AND a.deleted_at IS NULL)
+		UNION SELECT c.id FROM chats c JOIN chat_members m ON m.chat_id = c.id
+			WHERE m.user_id = ? AND c.deleted_at > ?`,
+		userID, since, userID, since).Scan(&ids)
+	if ids == nil {
+		ids = []string{}
+	}
+	return ids
+}
@@ -3,19 +3,15 @@ package api
 import (
 	"encoding/json"
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"safegram-server/internal/authz"
 	"safegram-server/internal/models"
 	"safegram-server/internal/websocket"
 )
 
-func isChatModerator(role string) bool {
-	return role == "owner" || role == "admin" || role == "moderator"
-}
-
 // GetChatModerationSettings получить настройки автомодерации (модераторы)
 func GetChatModerationSettings(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -39,11 +35,11 @@ func GetChatModerationSettings(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusOK, gin.H{"settings": gin.H{"chatId": chatID, "enabled": false}})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"settings": settings, "canEdit": isChatModerator(member.Role)})
+		c.JSON(http.StatusOK, gin.H{"settings": settings, "canEdit": authz.Can(userIDStr, authz.Chat(chatID), authz.ManageModeration)})
 	}
 }
 
-// UpdateChatModerationSettings обновить настройки (owner/admin/moderator)
+// UpdateChatModerationSettings обновить настройки (manage_moderation)
 func UpdateChatModerationSettings(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		chatID := c.Param("id")
@@ -54,12 +50,7 @@ func UpdateChatModerationSettings(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var member models.ChatMember
-		if err := db.Where("chat_id = ? AND user_id = ?", chatID, userIDStr).First(&member).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
-		}
-		if !isChatModerator(member.Role) {
+		if !authz.Can(userIDStr, authz.Chat(chatID), authz.ManageModeration) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
@@ -88,9 +79,10 @@ func UpdateChatModerationSettings(db *gorm.DB) gin.HandlerFunc {
 			settings.BanMinutes = req.BanMinutes
 		}
 		settings.QueueOnViolation = req.QueueOnViolation
+		settings.DryRun = req.DryRun
 
 		db.Save(&settings)
-		logModeration(db, chatID, "", userIDStr, "moderation_settings_update", "", "", gin.H{"enabled": settings.Enabled})
+		logModeration(db, chatID, "", userIDStr, "moderation_settings_update", "", "", gin.H{"enabled": settings.Enabled, "dryRun": settings.DryRun})
 		c.JSON(http.StatusOK, gin.H{"settings": settings})
 	}
 }
@@ -106,12 +98,7 @@ func GetModerationQueue(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var member models.ChatMember
-		if err := db.Where("chat_id = ? AND user_id = ?", chatID, userIDStr).First(&member).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
-		}
-		if !isChatModerator(member.Role) {
+		if !authz.Can(userIDStr, authz.Chat(chatID), authz.ManageMessages) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
@@ -122,8 +109,7 @@ func GetModerationQueue(db *gorm.DB) gin.HandlerFunc {
 			Order("created_at ASC").
 			Limit(200).
 			Find(&messages)
-
-		c.JSON(http.StatusOK, gin.H{"messages": messages})
+		c.JSON(http.StatusOK, gin.H{"messages": messageViews(db, userIDStr, messages)})
 	}
 }
 
@@ -144,12 +130,7 @@ func ApproveMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 			return
 		}
 
-		var member models.ChatMember
-		if err := db.Where("chat_id = ? AND user_id = ?", msg.ChatID, userIDStr).First(&member).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
-		}
-		if !isChatModerator(member.Role) {
+		if !authz.Can(userIDStr, authz.Chat(msg.ChatID), authz.ManageMessages) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
@@ -157,31 +138,40 @@ func ApproveMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 		msg.ModerationStatus = "approved"
 		msg.ModerationReason = ""
 		db.Save(&msg)
+		bumpUnread(db, msg)
+		refreshChatSummary(db, msg.ChatID)
+		refreshThreadSummary(db, wsHub, msg.ThreadID)
 
-		// WS broadcast (как обычное сообщение)
-		response := gin.H{
-			"id":               msg.ID,
-			"chatId":           msg.ChatID,
-			"senderId":         msg.SenderID,
-			"text":             msg.Text,
-			"ciphertext":       msg.Ciphertext,
-			"moderationStatus": msg.ModerationStatus,
-			"createdAt":        msg.CreatedAt,
-			"sender": gin.H{
-				"id":       msg.Sender.ID,
-				"username": msg.Sender.Username,
-				"avatarUrl": msg.Sender.AvatarURL,
-			},
-		}
-		wsMessage := gin.H{"type": "message", "data": response}
-		b, _ := json.Marshal(wsMessage)
-		wsHub.BroadcastToChat(msg.ChatID, b)
+		broadcastApprovedMessage(db, wsHub, msg)
+		go attachLinkPreview(db, wsHub, msg)
 
 		logModeration(db, msg.ChatID, "", userIDStr, "moderation_approve", "", msg.ID, nil)
 		c.JSON(http.StatusOK, gin.H{"ok": true})
 	}
 }
 
+// broadcastApprovedMessage рассылает одобренное сообщение участникам чата (как обычное сообщение)
+func broadcastApprovedMessage(db *gorm.DB, wsHub *websocket.Hub, msg models.Message) {
+	response := gin.H{
+		"id":               msg.ID,
+		"chatId":           msg.ChatID,
+		"threadId":         msg.ThreadID,
+		"senderId":         msg.SenderID,
+		"text":             msg.Text,
+		"ciphertext":       msg.Ciphertext,
+		"moderationStatus": msg.ModerationStatus,
+		"createdAt":        msg.CreatedAt,
+		"sender": gin.H{
+			"id":        msg.Sender.ID,
+			"username":  msg.Sender.Username,
+			"avatarUrl": publicAvatar(msg.Sender),
+		},
+	}
+	wsMessage := gin.H{"type": "message", "data": response}
+	b, _ := json.Marshal(wsMessage)
+	broadcastMessageEvent(db, wsHub, msg, b)
+}
+
 // RejectMessage отклонить сообщение
 func RejectMessage(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -202,12 +192,7 @@ func RejectMessage(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var member models.ChatMember
-		if err := db.Where("chat_id = ? AND user_id = ?", msg.ChatID, userIDStr).First(&member).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
-		}
-		if !isChatModerator(member.Role) {
+		if !authz.Can(userIDStr, authz.Chat(msg.ChatID), authz.ManageMessages) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
@@ -222,7 +207,7 @@ func RejectMessage(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// BanUser временный бан пользователя в чате (модераторы)
+// BanUser временный бан пользователя в чате (ban_members)
 func BanUser(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		chatID := c.Param("id")
@@ -233,12 +218,7 @@ func BanUser(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var member models.ChatMember
-		if err := db.Where("chat_id = ? AND user_id = ?", chatID, actorID).First(&member).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
-		}
-		if !isChatModerator(member.Role) {
+		if !authz.Can(actorID, authz.Chat(chatID), authz.BanMembers) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
@@ -253,27 +233,22 @@ func BanUser(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Банить можно только участников ниже себя в иерархии
+		if authz.IsMember(req.UserID, authz.Chat(chatID)) && !authz.Outranks(actorID, req.UserID, authz.Chat(chatID)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "role_hierarchy"})
+			return
+		}
+
 		mins := req.Minutes
 		if mins <= 0 {
 			mins = 10
 		}
-		exp := time.Now().Add(time.Duration(mins) * time.Minute)
-		_ = db.Create(&models.ChatBan{
-			ID:        uuid.New().String(),
-			ChatID:    chatID,
-			UserID:    req.UserID,
-			ActorID:   actorID,
-			Reason:    req.Reason,
-			ExpiresAt: &exp,
-		}).Error
-
-		logMemberEvent(db, "chat", chatID, req.UserID, actorID, "ban", gin.H{"expiresAt": exp, "reason": req.Reason})
-		logModeration(db, chatID, "", actorID, "ban", req.UserID, "", gin.H{"expiresAt": exp, "reason": req.Reason})
+		exp := banChatMember(db, chatID, req.UserID, actorID, req.Reason, mins)
 		c.JSON(http.StatusOK, gin.H{"ok": true, "expiresAt": exp})
 	}
 }
 
-// UnbanUser снимает бан (модераторы)
+// UnbanUser снимает бан (ban_members)
 func UnbanUser(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		chatID := c.Param("id")
@@ -284,12 +259,7 @@ func UnbanUser(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var member models.ChatMember
-		if err := db.Where("chat_id = ? AND user_id = ?", chatID, actorID).First(&member).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
-		}
-		if !isChatModerator(member.Role) {
+		if !authz.Can(actorID, authz.Chat(chatID), authz.BanMembers) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
@@ -307,8 +277,47 @@ func UnbanUser(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// GetModerationLogs логи модерации для чата
-func GetModerationLogs(db *gorm.DB) gin.HandlerFunc {
+// WarnUser предупреждение участнику с эскалацией по порогу (moderate_members)
+func WarnUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chatID := c.Param("id")
+		userID, _ := c.Get("userID")
+		actorID, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if !authz.Can(actorID, authz.Chat(chatID), authz.ModerateMembers) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var req struct {
+			UserID string `json:"userId" binding:"required"`
+			Reason string `json:"reason"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		if !authz.IsMember(req.UserID, authz.Chat(chatID)) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_member"})
+			return
+		}
+		if !authz.Outranks(actorID, req.UserID, authz.Chat(chatID)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "role_hierarchy"})
+			return
+		}
+
+		applyWarning(db, nil, chatID, req.UserID, actorID, req.Reason)
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// GetChatWarnings предупреждения в чате (moderate_members); ?userId= — по участнику
+func GetChatWarnings(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		chatID := c.Param("id")
 		userID, _ := c.Get("userID")
@@ -318,12 +327,102 @@ func GetModerationLogs(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var member models.ChatMember
-		if err := db.Where("chat_id = ? AND user_id = ?", chatID, userIDStr).First(&member).Error; err != nil {
+		if !authz.Can(userIDStr, authz.Chat(chatID), authz.ModerateMembers) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		query := db.Where("chat_id = ?", chatID)
+		if target := c.Query("userId"); target != "" {
+			query = query.Where("user_id = ?", target)
+		}
+		var warnings []models.ChatWarning
+		query.Order("created_at DESC").Limit(300).Find(&warnings)
+		c.JSON(http.StatusOK, gin.H{"warnings": warnings})
+	}
+}
+
+// MuteUser запрет писать в чат на время (moderate_members)
+func MuteUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chatID := c.Param("id")
+		userID, _ := c.Get("userID")
+		actorID, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if !authz.Can(actorID, authz.Chat(chatID), authz.ModerateMembers) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
-		if !isChatModerator(member.Role) {
+
+		var req struct {
+			UserID  string `json:"userId" binding:"required"`
+			Minutes int    `json:"minutes"`
+			Reason  string `json:"reason"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		if authz.IsMember(req.UserID, authz.Chat(chatID)) && !authz.Outranks(actorID, req.UserID, authz.Chat(chatID)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "role_hierarchy"})
+			return
+		}
+
+		mins := req.Minutes
+		if mins <= 0 {
+			mins = 10
+		}
+		exp := muteChatMember(db, chatID, req.UserID, actorID, req.Reason, mins)
+		c.JSON(http.StatusOK, gin.H{"ok": true, "expiresAt": exp})
+	}
+}
+
+// UnmuteUser снимает мут (moderate_members)
+func UnmuteUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chatID := c.Param("id")
+		userID, _ := c.Get("userID")
+		actorID, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if !authz.Can(actorID, authz.Chat(chatID), authz.ModerateMembers) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var req struct{ UserID string `json:"userId" binding:"required"` }
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		db.Where("chat_id = ? AND user_id = ?", chatID, req.UserID).Delete(&models.ChatMute{})
+		logMemberEvent(db, "chat", chatID, req.UserID, actorID, "unmute", nil)
+		logModeration(db, chatID, "", actorID, "unmute", req.UserID, "", nil)
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// GetModerationLogs логи модерации для чата
+func GetModerationLogs(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chatID := c.Param("id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if !authz.Can(userIDStr, authz.Chat(chatID), authz.ViewAuditLog) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
@@ -10,7 +10,9 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"safegram-server/internal/authz"
 	"safegram-server/internal/models"
+	"safegram-server/internal/websocket"
 )
 
 func stringPtr(s string) *string {
@@ -26,7 +28,10 @@ func parseInt(s string) int {
 	return val
 }
 
-// GetChats возвращает список чатов пользователя
+// GetChats возвращает список чатов пользователя: сначала закрепленные (на первой странице),
+// затем остальные по последней активности с курсорной пагинацией.
+// Параметры: archived=exclude|include|only (includeArchived=true — include), types=dm,group,channel,
+// unread=true, folderId, limit, cursor, since (мс) — только чаты, изменившиеся после момента, и удаленные
 func GetChats(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, _ := c.Get("userID")
@@ -35,88 +40,100 @@ func GetChats(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
 			return
 		}
+		syncedAt := time.Now()
 
-		// Получаем параметр includeArchived для фильтрации
-		includeArchived := c.Query("includeArchived") == "true"
-		
-		query := db.Where("user_id = ?", userIDStr)
-		if !includeArchived {
-			// Исключаем заархивированные чаты
-			query = query.Where("archived_at IS NULL")
+		filter := chatListFilter{Archived: c.DefaultQuery("archived", "exclude")}
+		if c.Query("includeArchived") == "true" {
+			filter.Archived = "include"
 		}
-		
-		var members []models.ChatMember
-		if err := query.Find(&members).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
-			return
+		if types := c.Query("types"); types != "" {
+			filter.Types = strings.Split(types, ",")
+		}
+		filter.UnreadOnly = c.Query("unread") == "true"
+		if folderID := c.Query("folderId"); folderID != "" {
+			var folder models.ChatFolder
+			if err := db.Where("id = ? AND user_id = ?", folderID, userIDStr).First(&folder).Error; err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+				return
+			}
+			filter.Folder = &folder
+			// Архивные чаты в папке определяются ее правилами
+			if c.Query("archived") == "" && c.Query("includeArchived") == "" {
+				filter.Archived = "include"
+			}
 		}
 
-		chatIDs := make([]string, len(members))
-		for i, m := range members {
-			chatIDs[i] = m.ChatID
+		limit := 100
+		if parsedLimit := parseInt(c.Query("limit")); parsedLimit > 0 && parsedLimit <= 500 {
+			limit = parsedLimit
 		}
 
-		var chats []models.Chat
-		if err := db.Where("id IN ?", chatIDs).
-			Preload("Members").
-			Preload("Members.User").
-			Find(&chats).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
-			return
+		// Дельта-режим: архивация тоже изменение, поэтому архивные не отбрасываются
+		var since *time.Time
+		if sinceMs := c.Query("since"); sinceMs != "" {
+			ms, err := strconv.ParseInt(sinceMs, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+				return
+			}
+			t := time.UnixMilli(ms)
+			since = &t
+			if c.Query("archived") == "" {
+				filter.Archived = "include"
+			}
 		}
 
-		// Загружаем последние сообщения для каждого чата и информацию об архивировании
-		type ChatWithLastMessage struct {
-			models.Chat
-			LastMessage *models.Message `json:"lastMessage,omitempty"`
-			ArchivedAt  *int64          `json:"archivedAt,omitempty"` // Timestamp архивирования для текущего пользователя
-			UnreadCount int             `json:"unreadCount"`           // Количество непрочитанных сообщений
+		listQuery := func() *gorm.DB {
+			query := chatListQuery(db, userIDStr, filter)
+			if since != nil {
+				query = chatChangedSince(query, *since)
+			}
+			return query
 		}
-		
-		result := make([]ChatWithLastMessage, len(chats))
-		for i, chat := range chats {
-			var lastMessage models.Message
-			err := db.Where("chat_id = ? AND deleted_at IS NULL", chat.ID).
-				Order("created_at DESC").
-				Limit(1).
-				Preload("Sender").
-				First(&lastMessage).Error
-			
-			// Получаем информацию об архивировании для текущего пользователя
-			var member models.ChatMember
-			var archivedAt *int64
-			if err := db.Where("chat_id = ? AND user_id = ?", chat.ID, userIDStr).First(&member).Error; err == nil {
-				if member.ArchivedAt != nil {
-					timestamp := member.ArchivedAt.Unix() * 1000
-					archivedAt = &timestamp
-				}
+
+		rows := make([]chatListRow, 0)
+		cursor := c.Query("cursor")
+		if cursor == "" {
+			// Закрепленные чаты целиком идут в начале первой страницы
+			if err := listQuery().Where("m.pin_order > 0").Order("m.pin_order ASC").Scan(&rows).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+				return
 			}
-			
-			// Подсчитываем непрочитанные сообщения
-			// Непрочитанными считаются сообщения, для которых нет записи в MessageReadReceipt
-			var unreadCount int64
-			subquery := db.Model(&models.MessageReadReceipt{}).
-				Select("message_id").
-				Where("user_id = ?", userIDStr)
-			db.Model(&models.Message{}).
-				Where("chat_id = ? AND deleted_at IS NULL AND sender_id != ? AND id NOT IN (?)", 
-					chat.ID, userIDStr, subquery).
-				Count(&unreadCount)
-			
-			result[i] = ChatWithLastMessage{
-				Chat:        chat,
-				LastMessage: func() *models.Message {
-					if err == nil && lastMessage.ID != "" {
-						return &lastMessage
-					}
-					return nil
-				}(),
-				ArchivedAt:  archivedAt,
-				UnreadCount: int(unreadCount),
+		}
+
+		page := listQuery().Where("m.pin_order = 0")
+		if cursor != "" {
+			activityAt, chatID, err := decodeChatCursor(cursor)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_cursor"})
+				return
 			}
+			page = page.Where("("+chatActivitySQL+", m.chat_id) < (?, ?)", activityAt, chatID)
+		}
+		var pageRows []chatListRow
+		if err := page.Order(chatActivitySQL + " DESC, m.chat_id DESC").Limit(limit + 1).Scan(&pageRows).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		response := gin.H{"syncedAt": syncedAt.UnixMilli()}
+		if len(pageRows) > limit {
+			pageRows = pageRows[:limit]
+			response["nextCursor"] = encodeChatCursor(pageRows[limit-1])
+		}
+		rows = append(rows, pageRows...)
+
+		items, err := loadChatListItems(db, userIDStr, rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		response["chats"] = items
+		if since != nil {
+			response["removed"] = removedChatsSince(db, userIDStr, *since)
 		}
 
-		c.JSON(http.StatusOK, gin.H{"chats": result})
+		c.JSON(http.StatusOK, response)
 	}
 }
 
@@ -141,6 +158,19 @@ func CreateChat(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Блокировки и правило «кто может добавлять меня в группы»
+		if req.Type == "dm" {
+			for _, memberID := range req.MemberIDs {
+				if usersBlocked(db, userIDStr, memberID) {
+					c.JSON(http.StatusForbidden, gin.H{"error": "blocked"})
+					return
+				}
+			}
+		} else if denied := groupAddDenied(db, userIDStr, req.MemberIDs); len(denied) > 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "privacy_restricted", "userIds": denied})
+			return
+		}
+
 		chat := models.Chat{
 			ID:        uuid.New().String(),
 			Type:      req.Type,
@@ -177,6 +207,30 @@ func CreateChat(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+// findOrCreateDM личный чат двух пользователей; создается, если его еще нет
+func findOrCreateDM(db *gorm.DB, userID, otherID string) (models.Chat, error) {
+	var chat models.Chat
+	err := db.Joins("JOIN chat_members a ON a.chat_id = chats.id AND a.user_id = ? AND a.deleted_at IS NULL", userID).
+		Joins("JOIN chat_members b ON b.chat_id = chats.id AND b.user_id = ? AND b.deleted_at IS NULL", otherID).
+		Where("chats.type = ?", "dm").
+		First(&chat).Error
+	if err == nil {
+		return chat, nil
+	}
+
+	chat = models.Chat{ID: uuid.New().String(), Type: "dm", CreatedBy: userID}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&chat).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.ChatMember{ID: uuid.New().String(), ChatID: chat.ID, UserID: userID, Role: "member"}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ChatMember{ID: uuid.New().String(), ChatID: chat.ID, UserID: otherID, Role: "member"}).Error
+	})
+	return chat, err
+}
+
 // GetChat возвращает информацию о чате
 func GetChat(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -206,7 +260,7 @@ func GetChat(db *gorm.DB) gin.HandlerFunc {
 }
 
 // GetMessages возвращает сообщения чата
-func GetMessages(db *gorm.DB) gin.HandlerFunc {
+func GetMessages(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		chatID := c.Param("id")
 		userID, _ := c.Get("userID")
@@ -222,6 +276,11 @@ func GetMessages(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
+		perms := authz.Permissions(userIDStr, authz.Chat(chatID))
+		if !perms.Has(authz.ViewChannel | authz.ReadHistory) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
 
 		// Пагинация
 		limit := 100
@@ -235,21 +294,42 @@ func GetMessages(db *gorm.DB) gin.HandlerFunc {
 			offset = parseInt(offsetStr)
 		}
 		beforeID := c.Query("before") // ID сообщения, до которого загружать
+		// around — ID сообщения, вокруг которого загружать страницу (переход к сообщению);
+		// around=mention — к первому непрочитанному упоминанию текущего пользователя
+		aroundID := c.Query("around")
+		if aroundID == "mention" {
+			aroundID = firstUnreadMention(db, chatID, userIDStr)
+		}
 
 		var messages []models.Message
-		query := db.Where("chat_id = ? AND deleted_at IS NULL", chatID).
-			Preload("Sender").
-			Preload("Reactions").
-			Preload("Reactions.User").
-			Order("created_at DESC").
-			Limit(limit)
-
-		// Фильтрация мод-очереди: обычные участники видят только approved и свои pending/rejected
-		if member.Role != "owner" && member.Role != "admin" && member.Role != "moderator" {
-			query = query.Where("(moderation_status = 'approved' OR sender_id = ?)", userIDStr)
-		}
-		
-		if beforeID != "" {
+		baseQuery := func() *gorm.DB {
+			// Ответы в тредах не входят в ленту чата — они загружаются через /threads/:id/messages
+			query := db.Where("chat_id = ? AND deleted_at IS NULL AND (thread_id IS NULL OR thread_id = '')", chatID).
+				Where(notHiddenSQL, userIDStr).
+				Preload("Sender")
+			// Фильтрация мод-очереди: обычные участники видят только approved и свои pending/rejected
+			if !perms.Has(authz.ManageMessages) {
+				query = query.Where("(moderation_status = 'approved' OR sender_id = ?)", userIDStr)
+			}
+			return query
+		}
+		query := baseQuery().Order("created_at DESC").Limit(limit)
+
+		var anchor models.Message
+		var newer []models.Message
+		if aroundID != "" && db.First(&anchor, "id = ? AND chat_id = ?", aroundID, chatID).Error == nil {
+			// Половина страницы до якоря (включая его), половина после
+			query = query.Where("created_at <= ?", anchor.CreatedAt).Limit(limit/2 + 1)
+			if after := limit - limit/2 - 1; after > 0 {
+				if err := baseQuery().Where("created_at > ?", anchor.CreatedAt).
+					Order("created_at ASC").
+					Limit(after).
+					Find(&newer).Error; err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+					return
+				}
+			}
+		} else if beforeID != "" {
 			// Загружаем сообщения до указанного ID
 			var beforeMessage models.Message
 			if err := db.First(&beforeMessage, "id = ?", beforeID).Error; err == nil {
@@ -268,22 +348,27 @@ func GetMessages(db *gorm.DB) gin.HandlerFunc {
 		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
 			messages[i], messages[j] = messages[j], messages[i]
 		}
+		messages = append(messages, newer...)
+
+		// Статусы прочтения выводятся из курсоров: своего и (в личном чате) собеседника
+		peerID := dmPeer(db, chatID, userIDStr)
+		cursorUsers := []string{userIDStr}
+		if peerID != "" {
+			cursorUsers = append(cursorUsers, peerID)
+		}
+		cursors := memberCursors(db, chatID, cursorUsers)
+		own, peer := cursors[userIDStr], cursors[peerID]
 
-		// Получаем статусы прочтения для всех сообщений текущим пользователем
+		// Сводки тредов под корневыми сообщениями
+		threads := rootThreads(db, messages, userIDStr)
+
+		// Сводки реакций вместо всех строк message_reactions
 		messageIDs := make([]string, len(messages))
 		for i, msg := range messages {
 			messageIDs[i] = msg.ID
 		}
-		
-		var readReceipts []models.MessageReadReceipt
-		if len(messageIDs) > 0 {
-			db.Where("message_id IN ? AND user_id = ?", messageIDs, userIDStr).Find(&readReceipts)
-		}
-		
-		readMap := make(map[string]bool)
-		for _, receipt := range readReceipts {
-			readMap[receipt.MessageID] = true
-		}
+		reactions := reactionSummaries(db, messageIDs, userIDStr)
+		senders := senderPrivacyView(db, userIDStr, messages)
 
 		// Формируем ответ с информацией о replyToMessage и новых типах
 		result := make([]gin.H, len(messages))
@@ -304,38 +389,18 @@ func GetMessages(db *gorm.DB) gin.HandlerFunc {
 				"gifUrl":        msg.GifURL,
 				"locationLat":   msg.LocationLat,
 				"locationLon":    msg.LocationLon,
+				"mentions":      messageMentions(msg),
+				"entities":      messageEntities(msg),
+				"preview":       messagePreview(msg),
 				"createdAt":     msg.CreatedAt,
 			}
 			
 			// Загружаем опрос если есть
 			if msg.PollID != "" {
 				var poll models.Poll
-				if err := db.Preload("Options").Preload("Votes").Preload("Votes.User").First(&poll, "id = ?", msg.PollID).Error; err == nil {
-					totalVotes := int64(len(poll.Votes))
-					optionsWithVotes := make([]gin.H, 0)
-					for _, opt := range poll.Options {
-						voteCount := int64(0)
-						voters := make([]string, 0)
-						for _, vote := range poll.Votes {
-							if vote.OptionID == opt.ID {
-								voteCount++
-								voters = append(voters, vote.UserID)
-							}
-						}
-						optionsWithVotes = append(optionsWithVotes, gin.H{
-							"id":     opt.ID,
-							"text":   opt.Text,
-							"votes":  voteCount,
-							"voters": voters,
-						})
-					}
+				if err := db.First(&poll, "id = ?", msg.PollID).Error; err == nil {
 					msgData["pollId"] = poll.ID
-					msgData["poll"] = gin.H{
-						"id":         poll.ID,
-						"question":   poll.Question,
-						"options":    optionsWithVotes,
-						"totalVotes": totalVotes,
-					}
+					msgData["poll"] = pollPayload(db, poll, userIDStr)
 				}
 			}
 			
@@ -359,12 +424,9 @@ func GetMessages(db *gorm.DB) gin.HandlerFunc {
 				}
 			}
 			
-			// Парсим историю редактирования
-			if msg.EditHistoryJSON != "" {
-				var editHistory []gin.H
-				if err := json.Unmarshal([]byte(msg.EditHistoryJSON), &editHistory); err == nil {
-					msgData["editHistory"] = editHistory
-				}
+			// Прежние версии загружаются через /messages/:id/revisions
+			if msg.RevisionCount > 0 {
+				msgData["revisionCount"] = msg.RevisionCount
 			}
 			if msg.EditedAt != nil {
 				msgData["editedAt"] = msg.EditedAt
@@ -379,7 +441,7 @@ func GetMessages(db *gorm.DB) gin.HandlerFunc {
 				msgData["sender"] = gin.H{
 					"id":       msg.Sender.ID,
 					"username": msg.Sender.Username,
-					"avatarUrl": msg.Sender.AvatarURL,
+					"avatarUrl": senders.avatar(msg.Sender),
 				}
 			}
 
@@ -394,21 +456,57 @@ func GetMessages(db *gorm.DB) gin.HandlerFunc {
 						"sender": gin.H{
 							"id":       replyMsg.Sender.ID,
 							"username": replyMsg.Sender.Username,
-							"avatarUrl": replyMsg.Sender.AvatarURL,
+							"avatarUrl": visibleAvatar(db, userIDStr, replyMsg.Sender),
 						},
 					}
 				}
 			}
 
-			// Добавляем статус прочтения (только для сообщений не от текущего пользователя)
+			// Ответ на историю цитирует ее (если история еще существует)
+			if msg.StoryID != "" {
+				var story models.Story
+				if err := db.First(&story, "id = ?", msg.StoryID).Error; err == nil {
+					msgData["storyId"] = msg.StoryID
+					msgData["story"] = storyQuote(story)
+				} else {
+					msgData["storyId"] = msg.StoryID
+					msgData["story"] = gin.H{"id": msg.StoryID, "deleted": true}
+				}
+			}
+
+			// Добавляем статус прочтения: чужие — прочитаны ли текущим пользователем,
+			// свои в личном чате — sent | delivered | read по курсорам собеседника
 			if msg.SenderID != userIDStr {
-				msgData["isRead"] = readMap[msg.ID]
+				msgData["isRead"] = own.hasRead(msg)
+			} else if peerID != "" {
+				msgData["status"] = messageStatus(peer, msg)
+			}
+			if thread, ok := threads[msg.ID]; ok {
+				msgData["thread"] = thread
+			}
+			if summary, ok := reactions[msg.ID]; ok {
+				msgData["reactions"] = summary
 			}
 
 			result[i] = msgData
 		}
 
-		c.JSON(http.StatusOK, gin.H{"messages": result})
+		// Загруженные сообщения доставлены текущему пользователю
+		for i := len(messages) - 1; i >= 0; i-- {
+			if messages[i].SenderID == userIDStr || messages[i].ModerationStatus != "approved" {
+				continue
+			}
+			if advanceDeliveredCursor(db, chatID, userIDStr, messages[i]) && peerID != "" {
+				notifyDelivered(wsHub, peerID, chatID, userIDStr, messages[i])
+			}
+			break
+		}
+
+		response := gin.H{"messages": result}
+		if anchor.ID != "" {
+			response["anchorId"] = anchor.ID
+		}
+		c.JSON(http.StatusOK, response)
 	}
 }
 
@@ -601,7 +699,7 @@ func DeleteChat(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// Проверяем, является ли пользователь владельцем чата или админом платформы
-		isOwner := member.Role == "owner"
+		isOwner := authz.IsOwner(userIDStr, authz.Chat(chatID))
 		var user models.User
 		if err := db.First(&user, "id = ?", userIDStr).Error; err == nil {
 			roles := user.ParseRoles()
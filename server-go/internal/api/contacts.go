@@ -0,0 +1,319 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"safegram-server/internal/models"
+)
+
+// maxContacts ограничение размера списка контактов
+const maxContacts = 5000
+
+// contactsResponse контакты владельца с учетом приватности
+func contactsResponse(db *gorm.DB, ownerID string, contacts []models.Contact) []gin.H {
+	users := make([]models.User, 0, len(contacts))
+	for _, contact := range contacts {
+		if contact.Contact.ID != "" {
+			users = append(users, contact.Contact)
+		}
+	}
+	return publicUsers(db, ownerID, users)
+}
+
+// addContacts добавляет пользователей в контакты, пропуская себя и уже добавленных
+func addContacts(db *gorm.DB, ownerID string, userIDs []string, nickname string) ([]models.Contact, error) {
+	var count int64
+	db.Model(&models.Contact{}).Where("owner_id = ?", ownerID).Count(&count)
+
+	added := make([]models.Contact, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if userID == ownerID || count >= maxContacts {
+			continue
+		}
+		var existing int64
+		db.Model(&models.Contact{}).Where("owner_id = ? AND contact_id = ?", ownerID, userID).Count(&existing)
+		if existing > 0 {
+			continue
+		}
+		contact := models.Contact{OwnerID: ownerID, ContactID: userID, Nickname: nickname}
+		if err := db.Create(&contact).Error; err != nil {
+			return added, err
+		}
+		added = append(added, contact)
+		count++
+	}
+	return added, nil
+}
+
+// GetContacts возвращает контакты текущего пользователя
+func GetContacts(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var contacts []models.Contact
+		if err := db.Where("owner_id = ?", userIDStr).Preload("Contact").Order("created_at ASC").Find(&contacts).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"contacts": contactsResponse(db, userIDStr, contacts)})
+	}
+}
+
+// AddContact добавляет пользователя в контакты по id или имени пользователя
+func AddContact(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var req struct {
+			UserID   string `json:"userId"`
+			Username string `json:"username"`
+			Nickname string `json:"nickname"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || (req.UserID == "" && req.Username == "") || len([]rune(req.Nickname)) > 64 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		var user models.User
+		query := db.Where("id = ?", req.UserID)
+		if req.UserID == "" {
+			query = db.Where("LOWER(username) = ?", strings.ToLower(strings.TrimPrefix(req.Username, "@")))
+		}
+		if err := query.First(&user).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		if user.ID == userIDStr {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "self_contact"})
+			return
+		}
+
+		if _, err := addContacts(db, userIDStr, []string{user.ID}, strings.TrimSpace(req.Nickname)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		view := newPrivacyView(db, userIDStr, []string{user.ID})
+		if !view.isContact(user.ID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "too_many_contacts"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"contact": view.publicUser(user)})
+	}
+}
+
+// UpdateContact меняет имя контакта
+func UpdateContact(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var req struct {
+			Nickname string `json:"nickname"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || len([]rune(req.Nickname)) > 64 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		result := db.Model(&models.Contact{}).
+			Where("owner_id = ? AND contact_id = ?", userIDStr, c.Param("id")).
+			Update("nickname", strings.TrimSpace(req.Nickname))
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// RemoveContact удаляет пользователя из контактов
+func RemoveContact(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		db.Where("owner_id = ? AND contact_id = ?", userIDStr, c.Param("id")).Delete(&models.Contact{})
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// ImportContacts добавляет в контакты найденных по именам пользователей
+// и по SHA-256 (hex) от адреса почты в нижнем регистре
+func ImportContacts(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var req struct {
+			Usernames   []string `json:"usernames"`
+			EmailHashes []string `json:"emailHashes"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || len(req.Usernames)+len(req.EmailHashes) == 0 ||
+			len(req.Usernames)+len(req.EmailHashes) > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		found := make(map[string]bool)
+		var userIDs []string
+		if len(req.Usernames) > 0 {
+			usernames := make([]string, len(req.Usernames))
+			for i, username := range req.Usernames {
+				usernames[i] = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(username), "@"))
+			}
+			var ids []string
+			db.Model(&models.User{}).Where("LOWER(username) IN ?", usernames).Pluck("id", &ids)
+			userIDs = append(userIDs, ids...)
+		}
+		if len(req.EmailHashes) > 0 {
+			hashes := make([]string, len(req.EmailHashes))
+			for i, hash := range req.EmailHashes {
+				hashes[i] = strings.ToLower(strings.TrimSpace(hash))
+			}
+			var ids []string
+			db.Model(&models.User{}).
+				Where("email IS NOT NULL AND encode(sha256(convert_to(LOWER(TRIM(email)), 'UTF8')), 'hex') IN ?", hashes).
+				Pluck("id", &ids)
+			userIDs = append(userIDs, ids...)
+		}
+
+		unique := make([]string, 0, len(userIDs))
+		for _, id := range userIDs {
+			if !found[id] {
+				found[id] = true
+				unique = append(unique, id)
+			}
+		}
+
+		added, err := addContacts(db, userIDStr, unique, "")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var contacts []models.Contact
+		if len(unique) > 0 {
+			db.Where("owner_id = ? AND contact_id IN ?", userIDStr, unique).Preload("Contact").Find(&contacts)
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"added":    len(added),
+			"matched":  len(unique),
+			"contacts": contactsResponse(db, userIDStr, contacts),
+		})
+	}
+}
+
+// GetBlockedUsers возвращает заблокированных пользователей
+func GetBlockedUsers(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var blocks []models.UserBlock
+		db.Where("blocker_id = ?", userIDStr).Preload("Blocked").Order("created_at DESC").Find(&blocks)
+
+		result := make([]gin.H, 0, len(blocks))
+		for _, block := range blocks {
+			if block.Blocked.ID == "" {
+				continue
+			}
+			result = append(result, gin.H{
+				"id":        block.Blocked.ID,
+				"username":  block.Blocked.Username,
+				"blockedAt": block.CreatedAt.Unix() * 1000,
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{"users": result})
+	}
+}
+
+// BlockContact блокирует пользователя: он не может писать в личку, звонить и добавлять в группы
+func BlockContact(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var req struct {
+			UserID string `json:"userId" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+		if req.UserID == userIDStr {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "self_block"})
+			return
+		}
+
+		var count int64
+		db.Model(&models.User{}).Where("id = ?", req.UserID).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+
+		var existing models.UserBlock
+		if err := db.Where("blocker_id = ? AND blocked_id = ?", userIDStr, req.UserID).First(&existing).Error; err != nil {
+			block := models.UserBlock{BlockerID: userIDStr, BlockedID: req.UserID}
+			if err := db.Create(&block).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+				return
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// UnblockContact снимает блокировку
+func UnblockContact(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		db.Where("blocker_id = ? AND blocked_id = ?", userIDStr, c.Param("id")).Delete(&models.UserBlock{})
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
@@ -0,0 +1,296 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"safegram-server/internal/authz"
+	"safegram-server/internal/models"
+)
+
+const (
+	maxCustomEmojiSize     = 256 * 1024
+	maxCustomEmojiPerScope = 50
+	maxEmojiRunes          = 16 // Самые длинные ZWJ-последовательности (семьи, флаги регионов) короче
+)
+
+var customEmojiName = regexp.MustCompile(`^[a-zA-Z0-9_]{2,32}$`)
+
+// emojiRanges диапазоны кодовых точек, которые сами по себе являются эмодзи
+var emojiRanges = [][2]rune{
+	{0x00A9, 0x00A9}, {0x00AE, 0x00AE}, {0x203C, 0x203C}, {0x2049, 0x2049},
+	{0x2122, 0x2122}, {0x2139, 0x2139}, {0x2194, 0x21AA}, {0x231A, 0x23FF},
+	{0x24C2, 0x24C2}, {0x25AA, 0x25FE}, {0x2600, 0x27BF}, {0x2934, 0x2935},
+	{0x2B05, 0x2B55}, {0x3030, 0x3030}, {0x303D, 0x303D}, {0x3297, 0x3299},
+	{0x1F000, 0x1FAFF},
+}
+
+func inEmojiRange(r rune) bool {
+	for _, rng := range emojiRanges {
+		if r >= rng[0] && r <= rng[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmoji проверяет, что строка — ровно один эмодзи Unicode: одиночный символ,
+// ZWJ-последовательность, флаг, keycap или эмодзи с тоном кожи
+func isEmoji(s string) bool {
+	if s == "" || !utf8.ValidString(s) || utf8.RuneCountInString(s) > maxEmojiRunes {
+		return false
+	}
+	const zwj = 0x200D
+	keycap := strings.ContainsRune(s, 0x20E3)
+	symbols, regional, prev := 0, false, rune(0)
+	for _, r := range s {
+		switch {
+		case r == zwj || r == 0xFE0E || r == 0xFE0F || r == 0x20E3 || r >= 0xE0020 && r <= 0xE007F:
+			// Соединитель, селекторы вариантов, keycap и теги флагов не начинают новый символ
+		case r >= 0x1F3FB && r <= 0x1F3FF && prev != 0:
+			// Модификатор тона кожи
+		case r >= 0x1F1E6 && r <= 0x1F1FF:
+			// Флаг страны — пара региональных индикаторов
+			if !regional {
+				symbols++
+			}
+			regional = !regional
+		case keycap && (r == '#' || r == '*' || r >= '0' && r <= '9'), inEmojiRange(r):
+			if prev != zwj {
+				symbols++
+			}
+		default:
+			return false
+		}
+		prev = r
+	}
+	return symbols == 1
+}
+
+// emojiScope область пользовательских эмодзи чата: сервер для каналов, иначе сам чат
+func emojiScope(db *gorm.DB, chatID string) (string, string) {
+	if serverID := serverIDForChat(db, chatID); serverID != "" {
+		return "server", serverID
+	}
+	return "chat", chatID
+}
+
+// customEmojiForChat пользовательский эмодзи, доступный в чате
+func customEmojiForChat(db *gorm.DB, chatID, emojiID string) (models.CustomEmoji, bool) {
+	scopeType, scopeID := emojiScope(db, chatID)
+	var emoji models.CustomEmoji
+	err := db.First(&emoji, "id = ? AND scope_type = ? AND scope_id = ?", emojiID, scopeType, scopeID).Error
+	return emoji, err == nil
+}
+
+func customEmojiPayload(emoji models.CustomEmoji) gin.H {
+	return gin.H{
+		"id":       emoji.ID,
+		"name":     emoji.Name,
+		"url":      emoji.URL,
+		"animated": emoji.Animated,
+	}
+}
+
+// UploadCustomEmoji загружает пользовательский эмодзи сервера или группы (multipart: name, file)
+func UploadCustomEmoji(db *gorm.DB, scopeType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopeID := c.Param("id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		// У каналов сервера общий набор эмодзи сервера
+		if scopeType == "chat" && serverIDForChat(db, scopeID) != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "use_server_emoji"})
+			return
+		}
+		if !validRoleScope(db, scopeType, scopeID) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		scope := authz.Scope{Type: scopeType, ID: scopeID}
+		if !authz.Can(userIDStr, scope, authz.ManageEmoji) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		name := c.PostForm("name")
+		if !customEmojiName.MatchString(name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_name"})
+			return
+		}
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "detail": "No file provided"})
+			return
+		}
+		if file.Size > maxCustomEmojiSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "detail": "File too large", "max": maxCustomEmojiSize})
+			return
+		}
+		ext := strings.ToLower(filepath.Ext(file.Filename))
+		if ext != ".png" && ext != ".gif" && ext != ".webp" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "detail": "Invalid file type"})
+			return
+		}
+
+		var count int64
+		db.Model(&models.CustomEmoji{}).Where("scope_type = ? AND scope_id = ?", scopeType, scopeID).Count(&count)
+		if count >= maxCustomEmojiPerScope {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "emoji_limit_reached", "max": maxCustomEmojiPerScope})
+			return
+		}
+		var existing models.CustomEmoji
+		if err := db.Where("scope_type = ? AND scope_id = ? AND name = ?", scopeType, scopeID, name).First(&existing).Error; err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "name_taken"})
+			return
+		}
+
+		emoji := models.CustomEmoji{
+			ID:        uuid.New().String(),
+			ScopeType: scopeType,
+			ScopeID:   scopeID,
+			Name:      name,
+			Animated:  ext == ".gif",
+			CreatedBy: userIDStr,
+		}
+		filename := emoji.ID + ext
+		path := filepath.Join(uploadsDir, "emoji", filename)
+		if err := c.SaveUploadedFile(file, path); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		emoji.URL = "/uploads/emoji/" + filename
+		if err := db.Create(&emoji).Error; err != nil {
+			os.Remove(path)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		logScopeModeration(db, scopeType, scopeID, userIDStr, "emoji_created", "", gin.H{"emojiId": emoji.ID, "name": emoji.Name})
+
+		c.JSON(http.StatusOK, customEmojiPayload(emoji))
+	}
+}
+
+// GetCustomEmoji список пользовательских эмодзи сервера или группы со статистикой
+// использования в реакциях. sort=usage — сначала самые популярные
+func GetCustomEmoji(db *gorm.DB, scopeType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopeID := c.Param("id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if !validRoleScope(db, scopeType, scopeID) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		scope := authz.Scope{Type: scopeType, ID: scopeID}
+		if !authz.IsMember(userIDStr, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var emojis []models.CustomEmoji
+		if err := db.Where("scope_type = ? AND scope_id = ?", scopeType, scopeID).Order("name ASC").Find(&emojis).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		type usage struct {
+			CustomEmojiID string
+			Uses          int64
+			LastUsedAt    *time.Time
+		}
+		usageByID := make(map[string]usage, len(emojis))
+		if len(emojis) > 0 {
+			ids := make([]string, len(emojis))
+			for i, emoji := range emojis {
+				ids[i] = emoji.ID
+			}
+			var rows []usage
+			db.Model(&models.MessageReaction{}).
+				Select("custom_emoji_id, COUNT(*) AS uses, MAX(created_at) AS last_used_at").
+				Where("custom_emoji_id IN ?", ids).
+				Group("custom_emoji_id").
+				Scan(&rows)
+			for _, row := range rows {
+				usageByID[row.CustomEmojiID] = row
+			}
+		}
+		if c.Query("sort") == "usage" {
+			sort.SliceStable(emojis, func(i, j int) bool {
+				return usageByID[emojis[i].ID].Uses > usageByID[emojis[j].ID].Uses
+			})
+		}
+
+		result := make([]gin.H, len(emojis))
+		for i, emoji := range emojis {
+			item := customEmojiPayload(emoji)
+			item["createdBy"] = emoji.CreatedBy
+			item["createdAt"] = emoji.CreatedAt
+			item["uses"] = usageByID[emoji.ID].Uses
+			item["lastUsedAt"] = usageByID[emoji.ID].LastUsedAt
+			result[i] = item
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"emoji":     result,
+			"max":       maxCustomEmojiPerScope,
+			"canManage": authz.Can(userIDStr, scope, authz.ManageEmoji),
+		})
+	}
+}
+
+// DeleteCustomEmoji удаляет пользовательский эмодзи (автор или право manage_emoji).
+// Уже поставленные реакции остаются и показываются по имени
+func DeleteCustomEmoji(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var emoji models.CustomEmoji
+		if err := db.First(&emoji, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		scope := authz.Scope{Type: emoji.ScopeType, ID: emoji.ScopeID}
+		allowed := authz.Can(userIDStr, scope, authz.ManageEmoji) ||
+			emoji.CreatedBy == userIDStr && authz.IsMember(userIDStr, scope)
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		if err := db.Delete(&emoji).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		os.Remove(filepath.Join(uploadsDir, "emoji", filepath.Base(emoji.URL)))
+
+		logScopeModeration(db, emoji.ScopeType, emoji.ScopeID, userIDStr, "emoji_deleted", "", gin.H{"emojiId": emoji.ID, "name": emoji.Name})
+
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
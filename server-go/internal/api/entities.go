@@ -0,0 +1,581 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"html"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/gin-gonic/gin"
+	"safegram-server/internal/models"
+)
+
+// Типы сущностей форматирования
+const (
+	entityBold          = "bold"
+	entityItalic        = "italic"
+	entityCode          = "code"
+	entityPre           = "pre"
+	entitySpoiler       = "spoiler"
+	entityStrikethrough = "strikethrough"
+	entityLink          = "link"
+	entityMention       = "mention" // только от сервера, см. parseMentions
+)
+
+// Ограничения форматированного текста
+const (
+	maxMessageTextLength = 4096 // UTF-16 code units
+	maxMessageEntities   = 100
+	maxEntityURLLength   = 2048
+)
+
+var preLanguagePattern = regexp.MustCompile(`^[A-Za-z0-9_+#.\-]{1,32}$`)
+
+// textEntity диапазон форматирования текста; offset и length — в UTF-16 code units, как у упоминаний
+type textEntity struct {
+	Type     string `json:"type"`
+	Offset   int    `json:"offset"`
+	Length   int    `json:"length"`
+	Language string `json:"language,omitempty"` // pre
+	URL      string `json:"url,omitempty"`      // link
+	Mention  string `json:"mention,omitempty"`  // mention: user | role | everyone | here
+	UserID   string `json:"userId,omitempty"`
+	RoleID   string `json:"roleId,omitempty"`
+}
+
+func (e textEntity) end() int {
+	return e.Offset + e.Length
+}
+
+// isCode внутри code и pre другое форматирование не допускается
+func (e textEntity) isCode() bool {
+	return e.Type == entityCode || e.Type == entityPre
+}
+
+// Парные маркеры markdown: **жирный**, __курсив__, ~~зачеркнутый~~, ||спойлер||
+var markdownMarkers = map[string]string{
+	"**": entityBold,
+	"__": entityItalic,
+	"~~": entityStrikethrough,
+	"||": entitySpoiler,
+}
+
+var markdownMarkerByType = map[string]string{
+	entityBold:          "**",
+	entityItalic:        "__",
+	entityStrikethrough: "~~",
+	entitySpoiler:       "||",
+}
+
+// markdownSpecial символы, которые можно экранировать обратной косой чертой
+const markdownSpecial = "\\*_~|`[]()"
+
+// sortEntities упорядочивает сущности: по началу, внешние раньше вложенных
+func sortEntities(entities []textEntity) {
+	sort.SliceStable(entities, func(i, j int) bool {
+		if entities[i].Offset != entities[j].Offset {
+			return entities[i].Offset < entities[j].Offset
+		}
+		return entities[i].Length > entities[j].Length
+	})
+}
+
+// validURL ссылка из сущности: только http(s) и mailto
+func validURL(raw string) bool {
+	if raw == "" || len(raw) > maxEntityURLLength || strings.ContainsAny(raw, " \t\n") {
+		return false
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https":
+		return parsed.Host != ""
+	case "mailto":
+		return parsed.Opaque != ""
+	}
+	return false
+}
+
+// validateEntities проверяет сущности клиента: типы, границы (не разрезая суррогатные пары)
+// и вложенность — диапазоны либо вложены, либо не пересекаются
+func validateEntities(text string, entities []textEntity) ([]textEntity, error) {
+	if len(entities) > maxMessageEntities {
+		return nil, errors.New("too_many_entities")
+	}
+	units := utf16.Encode([]rune(text))
+	splitsRune := func(pos int) bool {
+		return pos > 0 && pos < len(units) && units[pos] >= 0xDC00 && units[pos] <= 0xDFFF
+	}
+
+	result := make([]textEntity, 0, len(entities))
+	for _, e := range entities {
+		switch e.Type {
+		case entityBold, entityItalic, entityCode, entitySpoiler, entityStrikethrough:
+			if e.Language != "" || e.URL != "" {
+				return nil, errors.New("unexpected_entity_field")
+			}
+		case entityPre:
+			if e.Language != "" && !preLanguagePattern.MatchString(e.Language) {
+				return nil, errors.New("invalid_language")
+			}
+		case entityLink:
+			if !validURL(e.URL) {
+				return nil, errors.New("invalid_url")
+			}
+		default:
+			return nil, errors.New("unknown_entity_type")
+		}
+		if e.Offset < 0 || e.Length <= 0 || e.end() > len(units) || splitsRune(e.Offset) || splitsRune(e.end()) {
+			return nil, errors.New("invalid_range")
+		}
+		e.Mention, e.UserID, e.RoleID = "", "", ""
+		result = append(result, e)
+	}
+
+	sortEntities(result)
+	stack := make([]textEntity, 0)
+	for _, e := range result {
+		for len(stack) > 0 && stack[len(stack)-1].end() <= e.Offset {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) > 0 {
+			parent := stack[len(stack)-1]
+			if e.end() > parent.end() {
+				return nil, errors.New("overlapping_entities")
+			}
+			if parent.isCode() {
+				return nil, errors.New("entity_inside_code")
+			}
+		}
+		stack = append(stack, e)
+	}
+	return result, nil
+}
+
+// mdNode элемент разобранного markdown: литерал, парный маркер или готовый code/pre
+type mdNode struct {
+	text    string
+	marker  string // открывающий маркер; "" — литерал или атом
+	typ     string
+	matched bool
+	open    int // для закрывающего узла: индекс открывающего, иначе -1
+	closing bool
+	url     string
+	atom    *textEntity
+}
+
+// scanCode содержимое `кода` до неэкранированного обратного апострофа
+func scanCode(runes []rune, i int, fence string) (string, int, bool) {
+	var sb strings.Builder
+	fenceRunes := []rune(fence)
+	for i < len(runes) {
+		if runes[i] == '\\' && i+1 < len(runes) && (runes[i+1] == '`' || runes[i+1] == '\\') {
+			sb.WriteRune(runes[i+1])
+			i += 2
+			continue
+		}
+		if hasRunePrefix(runes, i, fenceRunes) {
+			return sb.String(), i + len(fenceRunes), true
+		}
+		sb.WriteRune(runes[i])
+		i++
+	}
+	return "", 0, false
+}
+
+// scanLinkURL адрес ссылки после "](" до неэкранированной ")"
+func scanLinkURL(runes []rune, i int) (string, int, bool) {
+	var sb strings.Builder
+	for i < len(runes) {
+		switch r := runes[i]; {
+		case r == '\\' && i+1 < len(runes) && (runes[i+1] == ')' || runes[i+1] == '\\'):
+			sb.WriteRune(runes[i+1])
+			i += 2
+		case r == ')':
+			return sb.String(), i + 1, true
+		case r == ' ' || r == '\n' || r == '\t':
+			return "", 0, false
+		default:
+			sb.WriteRune(r)
+			i++
+		}
+	}
+	return "", 0, false
+}
+
+func hasRunePrefix(runes []rune, i int, prefix []rune) bool {
+	if i+len(prefix) > len(runes) {
+		return false
+	}
+	for k, r := range prefix {
+		if runes[i+k] != r {
+			return false
+		}
+	}
+	return true
+}
+
+// parseMarkdown разбирает подмножество markdown в текст и сущности:
+// **жирный**, __курсив__, ~~зачеркнутый~~, ||спойлер||, `код`, ```язык\nблок```, [текст](url)
+// и экранирование \. Непарные маркеры остаются текстом. renderMarkdown — обратное преобразование
+func parseMarkdown(source string) (string, []textEntity) {
+	runes := []rune(source)
+	nodes := make([]mdNode, 0)
+	stack := make([]int, 0) // индексы открывающих узлов
+	literal := func(s string) {
+		nodes = append(nodes, mdNode{text: s, open: -1})
+	}
+	// closeMarker закрывает ближайший открытый маркер; открытые поверх него остаются текстом
+	closeMarker := func(marker, linkURL string) bool {
+		for k := len(stack) - 1; k >= 0; k-- {
+			if nodes[stack[k]].marker != marker {
+				continue
+			}
+			opener := stack[k]
+			nodes[opener].matched = true
+			nodes = append(nodes, mdNode{typ: nodes[opener].typ, open: opener, closing: true, url: linkURL})
+			stack = stack[:k]
+			return true
+		}
+		return false
+	}
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes) && strings.ContainsRune(markdownSpecial, runes[i+1]):
+			literal(string(runes[i+1]))
+			i += 2
+		case hasRunePrefix(runes, i, []rune("```")):
+			// Первая строка блока — язык, если похожа на него
+			start, language := i+3, ""
+			lineEnd := start
+			for lineEnd < len(runes) && runes[lineEnd] != '\n' {
+				lineEnd++
+			}
+			if line := string(runes[start:lineEnd]); lineEnd < len(runes) && (line == "" || preLanguagePattern.MatchString(line)) {
+				language = line
+				start = lineEnd + 1
+			}
+			content, next, ok := scanCode(runes, start, "```")
+			if !ok {
+				literal("```")
+				i += 3
+				continue
+			}
+			nodes = append(nodes, mdNode{text: content, open: -1, atom: &textEntity{Type: entityPre, Language: language}})
+			i = next
+		case r == '`':
+			content, next, ok := scanCode(runes, i+1, "`")
+			if !ok {
+				literal("`")
+				i++
+				continue
+			}
+			nodes = append(nodes, mdNode{text: content, open: -1, atom: &textEntity{Type: entityCode}})
+			i = next
+		case i+1 < len(runes) && markdownMarkers[string(runes[i:i+2])] != "":
+			marker := string(runes[i : i+2])
+			if !closeMarker(marker, "") {
+				nodes = append(nodes, mdNode{marker: marker, typ: markdownMarkers[marker], open: -1})
+				stack = append(stack, len(nodes)-1)
+			}
+			i += 2
+		case r == '[':
+			nodes = append(nodes, mdNode{marker: "[", typ: entityLink, open: -1})
+			stack = append(stack, len(nodes)-1)
+			i++
+		case r == ']' && i+1 < len(runes) && runes[i+1] == '(':
+			linkURL, next, ok := scanLinkURL(runes, i+2)
+			if ok && validURL(linkURL) && closeMarker("[", linkURL) {
+				i = next
+				continue
+			}
+			literal("]")
+			i++
+		default:
+			literal(string(r))
+			i++
+		}
+	}
+
+	var out strings.Builder
+	pos := 0
+	write := func(s string) {
+		out.WriteString(s)
+		pos += utf16Len(s)
+	}
+	starts := make(map[int]int)
+	entities := make([]textEntity, 0)
+	for idx, node := range nodes {
+		switch {
+		case node.atom != nil:
+			start := pos
+			write(node.text)
+			if pos > start {
+				entity := *node.atom
+				entity.Offset, entity.Length = start, pos-start
+				entities = append(entities, entity)
+			}
+		case node.closing:
+			if start := starts[node.open]; pos > start {
+				entities = append(entities, textEntity{Type: node.typ, Offset: start, Length: pos - start, URL: node.url})
+			}
+		case node.marker != "" && node.matched:
+			starts[idx] = pos
+		case node.marker != "":
+			write(node.marker)
+		default:
+			write(node.text)
+		}
+	}
+	sortEntities(entities)
+	return out.String(), entities
+}
+
+// nestEntities оставляет сущности в пределах текста, которые корректно вложены друг в друга
+func nestEntities(text string, entities []textEntity) []textEntity {
+	length := utf16Len(text)
+	sorted := make([]textEntity, 0, len(entities))
+	for _, e := range entities {
+		if e.Offset >= 0 && e.Length > 0 && e.end() <= length {
+			sorted = append(sorted, e)
+		}
+	}
+	sortEntities(sorted)
+	result := make([]textEntity, 0, len(sorted))
+	stack := make([]textEntity, 0)
+	for _, e := range sorted {
+		for len(stack) > 0 && stack[len(stack)-1].end() <= e.Offset {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) > 0 && (e.end() > stack[len(stack)-1].end() || stack[len(stack)-1].isCode()) {
+			continue
+		}
+		result = append(result, e)
+		stack = append(stack, e)
+	}
+	return result
+}
+
+// walkEntities обходит текст по границам сущностей: segment получает куски текста
+// (code — внутри code/pre), open и close — начало и конец каждой сущности
+func walkEntities(text string, entities []textEntity, segment func(s string, code bool), open, close func(textEntity)) {
+	units := utf16.Encode([]rune(text))
+	stack := make([]textEntity, 0)
+	pos := 0
+	emit := func(to int) {
+		if to > pos {
+			segment(string(utf16.Decode(units[pos:to])), len(stack) > 0 && stack[len(stack)-1].isCode())
+			pos = to
+		}
+	}
+	pop := func() {
+		top := stack[len(stack)-1]
+		emit(top.end())
+		close(top)
+		stack = stack[:len(stack)-1]
+	}
+	for _, e := range nestEntities(text, entities) {
+		for len(stack) > 0 && stack[len(stack)-1].end() <= e.Offset {
+			pop()
+		}
+		emit(e.Offset)
+		open(e)
+		stack = append(stack, e)
+	}
+	for len(stack) > 0 {
+		pop()
+	}
+	emit(len(units))
+}
+
+// escapeMarkdown экранирует текст так, чтобы parseMarkdown вернул его без изменений.
+// Одиночные *, _, ~, | внутри куска маркером стать не могут и остаются как есть
+func escapeMarkdown(s string, code bool) string {
+	runes := []rune(s)
+	var sb strings.Builder
+	for i, r := range runes {
+		switch {
+		case code:
+			if r == '`' || r == '\\' {
+				sb.WriteByte('\\')
+			}
+		case r == '\\' || r == '`' || r == '[' || r == ']':
+			sb.WriteByte('\\')
+		case strings.ContainsRune("*_~|", r) &&
+			(i == 0 || i == len(runes)-1 || runes[i-1] == r || runes[i+1] == r):
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// renderMarkdown собирает markdown из текста и сущностей форматирования
+func renderMarkdown(text string, entities []textEntity) string {
+	var sb strings.Builder
+	walkEntities(text, entities,
+		func(s string, code bool) {
+			sb.WriteString(escapeMarkdown(s, code))
+		},
+		func(e textEntity) {
+			switch e.Type {
+			case entityCode:
+				sb.WriteString("`")
+			case entityPre:
+				sb.WriteString("```" + e.Language + "\n")
+			case entityLink:
+				sb.WriteString("[")
+			default:
+				sb.WriteString(markdownMarkerByType[e.Type])
+			}
+		},
+		func(e textEntity) {
+			switch e.Type {
+			case entityCode:
+				sb.WriteString("`")
+			case entityPre:
+				sb.WriteString("```")
+			case entityLink:
+				linkURL := strings.NewReplacer(`\`, `\\`, `)`, `\)`).Replace(e.URL)
+				sb.WriteString("](" + linkURL + ")")
+			default:
+				sb.WriteString(markdownMarkerByType[e.Type])
+			}
+		})
+	return sb.String()
+}
+
+// renderHTML HTML-представление текста с форматированием и упоминаниями
+func renderHTML(text string, entities []textEntity) string {
+	var sb strings.Builder
+	walkEntities(text, entities,
+		func(s string, code bool) {
+			sb.WriteString(html.EscapeString(s))
+		},
+		func(e textEntity) {
+			switch e.Type {
+			case entityBold:
+				sb.WriteString("<b>")
+			case entityItalic:
+				sb.WriteString("<i>")
+			case entityStrikethrough:
+				sb.WriteString("<s>")
+			case entitySpoiler:
+				sb.WriteString(`<span class="spoiler">`)
+			case entityCode:
+				sb.WriteString("<code>")
+			case entityPre:
+				if e.Language != "" {
+					sb.WriteString(`<pre><code class="language-` + html.EscapeString(e.Language) + `">`)
+				} else {
+					sb.WriteString("<pre><code>")
+				}
+			case entityLink:
+				sb.WriteString(`<a href="` + html.EscapeString(e.URL) + `" rel="noopener noreferrer">`)
+			case entityMention:
+				sb.WriteString(`<span class="mention mention-` + html.EscapeString(e.Mention) + `">`)
+			}
+		},
+		func(e textEntity) {
+			switch e.Type {
+			case entityBold:
+				sb.WriteString("</b>")
+			case entityItalic:
+				sb.WriteString("</i>")
+			case entityStrikethrough:
+				sb.WriteString("</s>")
+			case entitySpoiler, entityMention:
+				sb.WriteString("</span>")
+			case entityCode:
+				sb.WriteString("</code>")
+			case entityPre:
+				sb.WriteString("</code></pre>")
+			case entityLink:
+				sb.WriteString("</a>")
+			}
+		})
+	return sb.String()
+}
+
+// formatMessageText приводит текст запроса к хранимому виду: при parseMode=markdown
+// разбирает разметку, иначе проверяет переданные сущности. Ненулевой gin.H — ответ с ошибкой
+func formatMessageText(text, parseMode string, entities []textEntity) (string, []textEntity, gin.H) {
+	switch parseMode {
+	case "markdown":
+		text, entities = parseMarkdown(text)
+	case "", "plain":
+	default:
+		return "", nil, gin.H{"error": "invalid_parse_mode"}
+	}
+	if length := utf16Len(text); length > maxMessageTextLength {
+		return "", nil, gin.H{"error": "text_too_long", "maxLength": maxMessageTextLength}
+	}
+	entities, err := validateEntities(text, entities)
+	if err != nil {
+		return "", nil, gin.H{"error": "invalid_entities", "detail": err.Error()}
+	}
+	return text, entities, nil
+}
+
+// maskCode заменяет содержимое code/pre пробелами той же длины в UTF-16,
+// чтобы @имя в коде не считалось упоминанием
+func maskCode(text string, entities []textEntity) string {
+	units := utf16.Encode([]rune(text))
+	masked := false
+	for _, e := range entities {
+		if !e.isCode() || e.end() > len(units) {
+			continue
+		}
+		for k := e.Offset; k < e.end(); k++ {
+			units[k] = ' '
+		}
+		masked = true
+	}
+	if !masked {
+		return text
+	}
+	return string(utf16.Decode(units))
+}
+
+// encodeEntities JSON сущностей для Message.EntitiesJSON
+func encodeEntities(entities []textEntity) string {
+	if len(entities) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(entities)
+	return string(data)
+}
+
+// messageFormatting сущности форматирования сообщения (без упоминаний)
+func messageFormatting(message models.Message) []textEntity {
+	entities := make([]textEntity, 0)
+	if message.EntitiesJSON != "" {
+		json.Unmarshal([]byte(message.EntitiesJSON), &entities)
+	}
+	return entities
+}
+
+// messageEntities форматирование и упоминания сообщения единым списком
+func messageEntities(message models.Message) []textEntity {
+	entities := messageFormatting(message)
+	for _, mention := range messageMentions(message) {
+		entities = append(entities, textEntity{
+			Type:    entityMention,
+			Offset:  mention.Offset,
+			Length:  mention.Length,
+			Mention: mention.Type,
+			UserID:  mention.UserID,
+			RoleID:  mention.RoleID,
+		})
+	}
+	sortEntities(entities)
+	return entities
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func sameEntities(got, want []textEntity) bool {
+	if len(got) == 0 && len(want) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(got, want)
+}
+
+func TestParseMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		text     string
+		entities []textEntity
+	}{
+		{"жирный", "**bold** text", "bold text", []textEntity{{Type: entityBold, Offset: 0, Length: 4}}},
+		{"смещение после эмодзи в UTF-16", "😀 **hi**", "😀 hi", []textEntity{{Type: entityBold, Offset: 3, Length: 2}}},
+		{"длина эмодзи в UTF-16", "||😀||", "😀", []textEntity{{Type: entitySpoiler, Offset: 0, Length: 2}}},
+		{"вложенные, внешний первым", "**a __b__**", "a b", []textEntity{
+			{Type: entityBold, Offset: 0, Length: 3},
+			{Type: entityItalic, Offset: 2, Length: 1},
+		}},
+		{"код без разметки внутри", "`a*b*`", "a*b*", []textEntity{{Type: entityCode, Offset: 0, Length: 4}}},
+		{"блок кода с языком", "```go\nfmt```", "fmt", []textEntity{{Type: entityPre, Offset: 0, Length: 3, Language: "go"}}},
+		{"ссылка", "[site](https://example.com)", "site", []textEntity{{Type: entityLink, Offset: 0, Length: 4, URL: "https://example.com"}}},
+		{"недопустимая ссылка остается текстом", "[x](javascript:alert)", "[x](javascript:alert)", nil},
+		{"непарный маркер", "**unclosed", "**unclosed", nil},
+		{"экранирование", `\*\*not\*\*`, "**not**", nil},
+		{"пустой маркер не дает сущности", "****", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := parseMarkdown(tt.source)
+			if text != tt.text {
+				t.Errorf("text = %q, want %q", text, tt.text)
+			}
+			if !sameEntities(entities, tt.entities) {
+				t.Errorf("entities = %+v, want %+v", entities, tt.entities)
+			}
+		})
+	}
+}
+
+func TestValidateEntities(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		entities []textEntity
+		wantErr  string
+	}{
+		{"корректная", "hello", []textEntity{{Type: entityBold, Offset: 0, Length: 5}}, ""},
+		{"вложенная", "hello", []textEntity{{Type: entityItalic, Offset: 1, Length: 2}, {Type: entityBold, Offset: 0, Length: 5}}, ""},
+		{"эмодзи целиком", "a😀", []textEntity{{Type: entityBold, Offset: 1, Length: 2}}, ""},
+		{"за концом текста", "hello", []textEntity{{Type: entityBold, Offset: 0, Length: 6}}, "invalid_range"},
+		{"пустая длина", "hello", []textEntity{{Type: entityBold, Offset: 1, Length: 0}}, "invalid_range"},
+		{"отрицательное смещение", "hello", []textEntity{{Type: entityBold, Offset: -1, Length: 2}}, "invalid_range"},
+		{"разрезает суррогатную пару", "a😀", []textEntity{{Type: entityBold, Offset: 2, Length: 1}}, "invalid_range"},
+		{"пересекаются", "hello", []textEntity{{Type: entityBold, Offset: 0, Length: 3}, {Type: entityItalic, Offset: 2, Length: 3}}, "overlapping_entities"},
+		{"внутри кода", "hello", []textEntity{{Type: entityCode, Offset: 0, Length: 5}, {Type: entityBold, Offset: 1, Length: 2}}, "entity_inside_code"},
+		{"неизвестный тип", "hello", []textEntity{{Type: "underline", Offset: 0, Length: 5}}, "unknown_entity_type"},
+		{"упоминания ставит только сервер", "hello", []textEntity{{Type: entityMention, Offset: 0, Length: 5}}, "unknown_entity_type"},
+		{"ссылка без схемы http", "hello", []textEntity{{Type: entityLink, Offset: 0, Length: 5, URL: "javascript:alert(1)"}}, "invalid_url"},
+		{"лишнее поле", "hello", []textEntity{{Type: entityBold, Offset: 0, Length: 5, URL: "https://example.com"}}, "unexpected_entity_field"},
+		{"недопустимый язык", "hello", []textEntity{{Type: entityPre, Offset: 0, Length: 5, Language: "go lang"}}, "invalid_language"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := validateEntities(tt.text, tt.entities)
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.wantErr {
+				t.Errorf("validateEntities() error = %q, want %q", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateEntitiesSorts(t *testing.T) {
+	entities, err := validateEntities("hello world", []textEntity{
+		{Type: entityItalic, Offset: 6, Length: 5},
+		{Type: entityCode, Offset: 0, Length: 5, UserID: "user"},
+	})
+	if err != nil {
+		t.Fatalf("validateEntities() error = %v", err)
+	}
+	want := []textEntity{
+		{Type: entityCode, Offset: 0, Length: 5},
+		{Type: entityItalic, Offset: 6, Length: 5},
+	}
+	if !reflect.DeepEqual(entities, want) {
+		t.Errorf("entities = %+v, want %+v", entities, want)
+	}
+}
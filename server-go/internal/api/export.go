@@ -2,7 +2,9 @@ package api
 
 import (
 	"encoding/json"
+	"html"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -44,10 +46,14 @@ func ExportChat(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		format := c.Query("format") // json, txt
+		format := c.Query("format") // json, txt, html
 		if format == "" {
 			format = "json"
 		}
+		if format != "json" && format != "txt" && format != "html" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_format"})
+			return
+		}
 
 		// Загружаем чат
 		var chat models.Chat
@@ -85,8 +91,9 @@ func ExportChat(db *gorm.DB) gin.HandlerFunc {
 				timestamp := msg.CreatedAt.Format("2006-01-02 15:04:05")
 				sb.WriteString("[" + timestamp + "] " + senderName + ":\n")
 
+				// Форматирование сохраняется в виде markdown
 				if msg.Text != "" {
-					sb.WriteString(msg.Text + "\n")
+					sb.WriteString(renderMarkdown(msg.Text, messageFormatting(msg)) + "\n")
 				}
 
 				if msg.AttachmentURL != "" {
@@ -114,6 +121,12 @@ func ExportChat(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		if format == "html" {
+			c.Header("Content-Disposition", `attachment; filename="chat_`+chatID+`_`+time.Now().Format("20060102")+`.html"`)
+			c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(exportChatHTML(chat, messages)))
+			return
+		}
+
 		// Экспорт в JSON
 		exportData := gin.H{
 			"chat": gin.H{
@@ -128,6 +141,7 @@ func ExportChat(db *gorm.DB) gin.HandlerFunc {
 			"messages": make([]gin.H, len(messages)),
 		}
 
+		senders := senderPrivacyView(db, userIDStr, messages)
 		for i, msg := range messages {
 			msgData := gin.H{
 				"id":        msg.ID,
@@ -136,11 +150,15 @@ func ExportChat(db *gorm.DB) gin.HandlerFunc {
 				"createdAt": msg.CreatedAt.Unix() * 1000,
 			}
 
+			if entities := messageEntities(msg); len(entities) > 0 {
+				msgData["entities"] = entities
+			}
+
 			if msg.Sender.ID != "" {
 				msgData["sender"] = gin.H{
 					"id":       msg.Sender.ID,
 					"username": msg.Sender.Username,
-					"avatarUrl": msg.Sender.AvatarURL,
+					"avatarUrl": senders.avatar(msg.Sender),
 				}
 			}
 
@@ -187,3 +205,65 @@ func ExportChat(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+// exportChatHTML HTML-документ с историей чата: текст с форматированием и упоминаниями,
+// вложения и реакции
+func exportChatHTML(chat models.Chat, messages []models.Message) string {
+	var sb strings.Builder
+	sb.WriteString("<!DOCTYPE html>\n<html lang=\"ru\">\n<head>\n<meta charset=\"utf-8\">\n")
+	sb.WriteString("<title>" + html.EscapeString(chat.Name) + "</title>\n")
+	sb.WriteString(`<style>
+body { font-family: sans-serif; max-width: 800px; margin: 0 auto; padding: 16px; }
+.message { margin-bottom: 16px; }
+.meta { color: #888; font-size: 12px; }
+.text { white-space: pre-wrap; }
+.spoiler { background: #ccc; color: #ccc; }
+.spoiler:hover { color: inherit; }
+.mention { color: #2a7ae2; }
+pre { background: #f4f4f4; padding: 8px; overflow-x: auto; }
+</style>
+</head>
+<body>
+`)
+	sb.WriteString("<h1>" + html.EscapeString(chat.Name) + "</h1>\n")
+	sb.WriteString("<p class=\"meta\">Тип: " + html.EscapeString(chat.Type) + " · Дата экспорта: " + time.Now().Format("2006-01-02 15:04:05") + "</p>\n")
+
+	for _, msg := range messages {
+		senderName := "Неизвестный"
+		if msg.Sender.ID != "" {
+			senderName = msg.Sender.Username
+		}
+		sb.WriteString("<div class=\"message\" id=\"" + html.EscapeString(msg.ID) + "\">\n")
+		sb.WriteString("<div class=\"meta\"><b>" + html.EscapeString(senderName) + "</b> " + msg.CreatedAt.Format("2006-01-02 15:04:05"))
+		if msg.EditedAt != nil {
+			sb.WriteString(" (изменено)")
+		}
+		sb.WriteString("</div>\n")
+
+		if msg.Text != "" {
+			sb.WriteString("<div class=\"text\">" + renderHTML(msg.Text, messageEntities(msg)) + "</div>\n")
+		}
+		if msg.AttachmentURL != "" {
+			escaped := html.EscapeString(msg.AttachmentURL)
+			sb.WriteString("<div>📎 <a href=\"" + escaped + "\">" + escaped + "</a></div>\n")
+		}
+		if len(msg.Reactions) > 0 {
+			counts := make(map[string]int)
+			order := make([]string, 0)
+			for _, r := range msg.Reactions {
+				if counts[r.Emoji] == 0 {
+					order = append(order, r.Emoji)
+				}
+				counts[r.Emoji]++
+			}
+			parts := make([]string, len(order))
+			for i, emoji := range order {
+				parts[i] = html.EscapeString(emoji) + " " + strconv.Itoa(counts[emoji])
+			}
+			sb.WriteString("<div class=\"meta\">Реакции: " + strings.Join(parts, ", ") + "</div>\n")
+		}
+		sb.WriteString("</div>\n")
+	}
+
+	sb.WriteString("</body>\n</html>\n")
+	return sb.String()
+}
@@ -0,0 +1,520 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"safegram-server/internal/models"
+	"safegram-server/internal/websocket"
+)
+
+const (
+	maxChatFolders     = 20
+	maxFolderChats     = 200 // Размер явных списков включения и исключения
+	maxFolderNameRunes = 32
+	maxPinnedChats     = 10
+)
+
+// chatMutedSQL звук чата отключен у участника m: настройка чата, а если ее нет — сервера
+const chatMutedSQL = `COALESCE(
+	(SELECT p.level = 'none' OR COALESCE(p.muted_until > NOW(), false) FROM notification_preferences p
+		WHERE p.user_id = m.user_id AND p.scope_type = 'chat' AND p.scope_id = m.chat_id),
+	(SELECT p.level = 'none' OR COALESCE(p.muted_until > NOW(), false) FROM notification_preferences p
+		JOIN channels ch ON ch.server_id = p.scope_id
+		WHERE ch.chat_id = m.chat_id AND p.user_id = m.user_id AND p.scope_type = 'server' LIMIT 1),
+	false)`
+
+func folderList(raw string) []string {
+	var list []string
+	if raw != "" {
+		json.Unmarshal([]byte(raw), &list)
+	}
+	return list
+}
+
+func encodeFolderList(list []string) string {
+	if len(list) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(list)
+	return string(data)
+}
+
+// folderCondition условие попадания чата в папку (алиасы m — участие, c — чат)
+func folderCondition(folder models.ChatFolder) (string, []interface{}) {
+	var args []interface{}
+	byType := "FALSE"
+	if types := folderList(folder.IncludeTypes); len(types) > 0 {
+		byType = "(c.type IN ?"
+		args = append(args, types)
+		if !folder.IncludeArchived {
+			byType += " AND m.archived_at IS NULL"
+		}
+		byType += ")"
+	}
+
+	condition := "(" + byType
+	if include := folderList(folder.IncludeChatIDs); len(include) > 0 {
+		condition += " OR m.chat_id IN ?"
+		args = append(args, include)
+	}
+	condition += ")"
+	if exclude := folderList(folder.ExcludeChatIDs); len(exclude) > 0 {
+		condition += " AND m.chat_id NOT IN ?"
+		args = append(args, exclude)
+	}
+	if folder.ExcludeMuted {
+		condition += " AND NOT " + chatMutedSQL
+	}
+	if folder.ExcludeRead {
+		condition += " AND m.unread_count > 0"
+	}
+	return condition, args
+}
+
+func folderPayload(folder models.ChatFolder) gin.H {
+	nonNil := func(list []string) []string {
+		if list == nil {
+			return []string{}
+		}
+		return list
+	}
+	return gin.H{
+		"id":              folder.ID,
+		"name":            folder.Name,
+		"emoji":           folder.Emoji,
+		"position":        folder.Position,
+		"includeTypes":    nonNil(folderList(folder.IncludeTypes)),
+		"includeChatIds":  nonNil(folderList(folder.IncludeChatIDs)),
+		"excludeChatIds":  nonNil(folderList(folder.ExcludeChatIDs)),
+		"excludeMuted":    folder.ExcludeMuted,
+		"excludeRead":     folder.ExcludeRead,
+		"includeArchived": folder.IncludeArchived,
+		"updatedAt":       folder.UpdatedAt,
+	}
+}
+
+// folderBadge число непрочитанных чатов и сообщений в папке
+func folderBadge(db *gorm.DB, userID string, folder models.ChatFolder) gin.H {
+	var badge struct {
+		Chats    int64
+		Messages int64
+	}
+	chatScope(db, userID, chatListFilter{Archived: "include", Folder: &folder}).
+		Where("m.unread_count > 0").
+		Select("COUNT(*) AS chats, COALESCE(SUM(m.unread_count), 0) AS messages").
+		Scan(&badge)
+	return gin.H{"unreadChats": badge.Chats, "unreadCount": badge.Messages}
+}
+
+func userChatFolders(db *gorm.DB, userID string) []models.ChatFolder {
+	var folders []models.ChatFolder
+	db.Where("user_id = ?", userID).Order("position ASC, created_at ASC").Find(&folders)
+	return folders
+}
+
+// broadcastChatFolders рассылает определения папок на все устройства пользователя
+func broadcastChatFolders(db *gorm.DB, wsHub *websocket.Hub, userID string) {
+	folders := userChatFolders(db, userID)
+	result := make([]gin.H, len(folders))
+	for i, folder := range folders {
+		result[i] = folderPayload(folder)
+	}
+	wsHub.SendToUser(userID, wsEvent("chatFolders:update", gin.H{"folders": result}))
+}
+
+// pinnedChatIDs закрепленные чаты пользователя по порядку
+func pinnedChatIDs(db *gorm.DB, userID string) []string {
+	ids := make([]string, 0)
+	db.Model(&models.ChatMember{}).Where("user_id = ? AND pin_order > 0", userID).Order("pin_order ASC").Pluck("chat_id", &ids)
+	return ids
+}
+
+func broadcastPinnedChats(db *gorm.DB, wsHub *websocket.Hub, userID string) {
+	wsHub.SendToUser(userID, wsEvent("chat:pins", gin.H{"chatIds": pinnedChatIDs(db, userID)}))
+}
+
+// folderChatIDs оставляет только уникальные чаты, в которых пользователь состоит
+func folderChatIDs(db *gorm.DB, userID string, ids []string) []string {
+	if len(ids) == 0 {
+		return nil
+	}
+	var member []string
+	db.Model(&models.ChatMember{}).Where("user_id = ? AND chat_id IN ?", userID, ids).Pluck("chat_id", &member)
+	allowed := make(map[string]bool, len(member))
+	for _, id := range member {
+		allowed[id] = true
+	}
+	result := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if allowed[id] {
+			result = append(result, id)
+			delete(allowed, id)
+		}
+	}
+	return result
+}
+
+// chatFolderRequest поля папки; nil — не менять (при создании — значение по умолчанию)
+type chatFolderRequest struct {
+	Name            *string   `json:"name"`
+	Emoji           *string   `json:"emoji"`
+	IncludeTypes    *[]string `json:"includeTypes"`
+	IncludeChatIDs  *[]string `json:"includeChatIds"`
+	ExcludeChatIDs  *[]string `json:"excludeChatIds"`
+	ExcludeMuted    *bool     `json:"excludeMuted"`
+	ExcludeRead     *bool     `json:"excludeRead"`
+	IncludeArchived *bool     `json:"includeArchived"`
+}
+
+// applyTo переносит поля запроса в папку; возвращает код ошибки или пустую строку
+func (req chatFolderRequest) applyTo(db *gorm.DB, userID string, folder *models.ChatFolder) string {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || len([]rune(name)) > maxFolderNameRunes {
+			return "invalid_name"
+		}
+		folder.Name = name
+	}
+	if req.Emoji != nil {
+		if len([]rune(*req.Emoji)) > 8 {
+			return "bad_request"
+		}
+		folder.Emoji = *req.Emoji
+	}
+	if req.IncludeTypes != nil {
+		seen := make(map[string]bool)
+		types := make([]string, 0, len(*req.IncludeTypes))
+		for _, chatType := range *req.IncludeTypes {
+			if chatType != "dm" && chatType != "group" && chatType != "channel" {
+				return "invalid_type"
+			}
+			if !seen[chatType] {
+				seen[chatType] = true
+				types = append(types, chatType)
+			}
+		}
+		folder.IncludeTypes = encodeFolderList(types)
+	}
+	if req.IncludeChatIDs != nil {
+		if len(*req.IncludeChatIDs) > maxFolderChats {
+			return "too_many_chats"
+		}
+		folder.IncludeChatIDs = encodeFolderList(folderChatIDs(db, userID, *req.IncludeChatIDs))
+	}
+	if req.ExcludeChatIDs != nil {
+		if len(*req.ExcludeChatIDs) > maxFolderChats {
+			return "too_many_chats"
+		}
+		folder.ExcludeChatIDs = encodeFolderList(folderChatIDs(db, userID, *req.ExcludeChatIDs))
+	}
+	if req.ExcludeMuted != nil {
+		folder.ExcludeMuted = *req.ExcludeMuted
+	}
+	if req.ExcludeRead != nil {
+		folder.ExcludeRead = *req.ExcludeRead
+	}
+	if req.IncludeArchived != nil {
+		folder.IncludeArchived = *req.IncludeArchived
+	}
+
+	if len(folderList(folder.IncludeTypes)) == 0 && len(folderList(folder.IncludeChatIDs)) == 0 {
+		return "empty_folder"
+	}
+	return ""
+}
+
+// GetChatFolders возвращает папки пользователя со счетчиками непрочитанного и закрепленные чаты
+func GetChatFolders(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		folders := userChatFolders(db, userIDStr)
+		result := make([]gin.H, len(folders))
+		for i, folder := range folders {
+			payload := folderPayload(folder)
+			payload["badge"] = folderBadge(db, userIDStr, folder)
+			result[i] = payload
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"folders":       result,
+			"pinnedChatIds": pinnedChatIDs(db, userIDStr),
+		})
+	}
+}
+
+// CreateChatFolder создает папку
+func CreateChatFolder(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var req chatFolderRequest
+		if err := c.ShouldBindJSON(&req); err != nil || req.Name == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		var count int64
+		db.Model(&models.ChatFolder{}).Where("user_id = ?", userIDStr).Count(&count)
+		if count >= maxChatFolders {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "too_many_folders"})
+			return
+		}
+
+		folder := models.ChatFolder{
+			ID:       uuid.New().String(),
+			UserID:   userIDStr,
+			Position: int(count),
+		}
+		if code := req.applyTo(db, userIDStr, &folder); code != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": code})
+			return
+		}
+		if err := db.Create(&folder).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		broadcastChatFolders(db, wsHub, userIDStr)
+		payload := folderPayload(folder)
+		payload["badge"] = folderBadge(db, userIDStr, folder)
+		c.JSON(http.StatusOK, gin.H{"folder": payload})
+	}
+}
+
+// UpdateChatFolder меняет название и правила папки
+func UpdateChatFolder(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var folder models.ChatFolder
+		if err := db.Where("id = ? AND user_id = ?", c.Param("id"), userIDStr).First(&folder).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+
+		var req chatFolderRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+		if code := req.applyTo(db, userIDStr, &folder); code != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": code})
+			return
+		}
+		if err := db.Save(&folder).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		broadcastChatFolders(db, wsHub, userIDStr)
+		payload := folderPayload(folder)
+		payload["badge"] = folderBadge(db, userIDStr, folder)
+		c.JSON(http.StatusOK, gin.H{"folder": payload})
+	}
+}
+
+// DeleteChatFolder удаляет папку (чаты остаются в списке)
+func DeleteChatFolder(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		result := db.Where("id = ? AND user_id = ?", c.Param("id"), userIDStr).Delete(&models.ChatFolder{})
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+
+		broadcastChatFolders(db, wsHub, userIDStr)
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// ReorderChatFolders задает порядок папок: folderIds — все папки пользователя
+func ReorderChatFolders(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var req struct {
+			FolderIDs []string `json:"folderIds" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		folders := userChatFolders(db, userIDStr)
+		owned := make(map[string]bool, len(folders))
+		for _, folder := range folders {
+			owned[folder.ID] = true
+		}
+		if len(req.FolderIDs) != len(folders) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "folders_mismatch"})
+			return
+		}
+		for _, id := range req.FolderIDs {
+			if !owned[id] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "folders_mismatch"})
+				return
+			}
+			delete(owned, id)
+		}
+
+		for position, id := range req.FolderIDs {
+			db.Model(&models.ChatFolder{}).Where("id = ?", id).Update("position", position)
+		}
+
+		broadcastChatFolders(db, wsHub, userIDStr)
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// PinChat закрепляет чат в начале списка
+func PinChat(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chatID := c.Param("id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var member models.ChatMember
+		if err := db.Where("chat_id = ? AND user_id = ?", chatID, userIDStr).First(&member).Error; err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		if member.PinOrder > 0 {
+			c.JSON(http.StatusOK, gin.H{"ok": true, "pinnedChatIds": pinnedChatIDs(db, userIDStr)})
+			return
+		}
+
+		var pinned int64
+		db.Model(&models.ChatMember{}).Where("user_id = ? AND pin_order > 0", userIDStr).Count(&pinned)
+		if pinned >= maxPinnedChats {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "too_many_pinned"})
+			return
+		}
+
+		// Новый закрепленный чат встает первым
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.ChatMember{}).
+				Where("user_id = ? AND pin_order > 0", userIDStr).
+				Update("pin_order", gorm.Expr("pin_order + 1")).Error; err != nil {
+				return err
+			}
+			return tx.Model(&member).Update("pin_order", 1).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		broadcastPinnedChats(db, wsHub, userIDStr)
+		c.JSON(http.StatusOK, gin.H{"ok": true, "pinnedChatIds": pinnedChatIDs(db, userIDStr)})
+	}
+}
+
+// UnpinChat открепляет чат
+func UnpinChat(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chatID := c.Param("id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		result := db.Model(&models.ChatMember{}).
+			Where("chat_id = ? AND user_id = ? AND pin_order > 0", chatID, userIDStr).
+			Update("pin_order", 0)
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		if result.RowsAffected > 0 {
+			broadcastPinnedChats(db, wsHub, userIDStr)
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true, "pinnedChatIds": pinnedChatIDs(db, userIDStr)})
+	}
+}
+
+// ReorderPinnedChats задает порядок закрепленных чатов: chatIds — все закрепленные
+func ReorderPinnedChats(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var req struct {
+			ChatIDs []string `json:"chatIds" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		current := pinnedChatIDs(db, userIDStr)
+		pinned := make(map[string]bool, len(current))
+		for _, id := range current {
+			pinned[id] = true
+		}
+		if len(req.ChatIDs) != len(current) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "pins_mismatch"})
+			return
+		}
+		for _, id := range req.ChatIDs {
+			if !pinned[id] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "pins_mismatch"})
+				return
+			}
+			delete(pinned, id)
+		}
+
+		for i, id := range req.ChatIDs {
+			db.Model(&models.ChatMember{}).Where("chat_id = ? AND user_id = ?", id, userIDStr).Update("pin_order", i+1)
+		}
+
+		broadcastPinnedChats(db, wsHub, userIDStr)
+		c.JSON(http.StatusOK, gin.H{"ok": true, "pinnedChatIds": req.ChatIDs})
+	}
+}
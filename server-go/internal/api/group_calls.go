@@ -34,6 +34,11 @@ func CreateGroupCall(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		if code, expiresAt, restricted := serverRestriction(db, req.ChatID, userIDStr); restricted {
+			c.JSON(http.StatusForbidden, gin.H{"error": code, "expiresAt": expiresAt})
+			return
+		}
+
 		startedAt := time.Unix(req.StartedAt/1000, 0)
 		var endedAt *time.Time
 		if req.EndedAt != nil && *req.EndedAt > 0 {
@@ -49,6 +54,8 @@ func CreateGroupCall(db *gorm.DB) gin.HandlerFunc {
 				existingCall.Status = "ended"
 				existingCall.EndedAt = endedAt
 				db.Save(&existingCall)
+				stopCallRecordings(db, nil, existingCall.ID)
+				closeSFURoom(existingCall.ID)
 			}
 			c.JSON(http.StatusOK, gin.H{"call": existingCall})
 			return
@@ -80,6 +87,14 @@ func CreateGroupCall(db *gorm.DB) gin.HandlerFunc {
 
 		// Загружаем полную информацию
 		db.Preload("Starter").Preload("Participants").Preload("Participants.User").First(&call, "id = ?", call.ID)
+		participantIDs := make([]string, len(call.Participants))
+		for i, p := range call.Participants {
+			participantIDs[i] = p.UserID
+		}
+		view := newPrivacyView(db, userIDStr, participantIDs)
+		for i := range call.Participants {
+			call.Participants[i].User.AvatarURL = view.avatar(call.Participants[i].User)
+		}
 
 		c.JSON(http.StatusOK, gin.H{"call": call})
 	}
@@ -120,6 +135,28 @@ func GetGroupCallHistory(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Звонки, проведенные как запланированные встречи
+		callIDs := make([]string, len(calls))
+		for i, call := range calls {
+			callIDs[i] = call.ID
+		}
+		meetingByCall := make(map[string]string)
+		if len(callIDs) > 0 {
+			var meetings []models.Meeting
+			db.Select("id", "group_call_id").Where("group_call_id IN ?", callIDs).Find(&meetings)
+			for _, meeting := range meetings {
+				meetingByCall[*meeting.GroupCallID] = meeting.ID
+			}
+		}
+
+		userIDs := make([]string, 0, len(calls))
+		for _, call := range calls {
+			userIDs = append(userIDs, call.StartedBy)
+			for _, p := range call.Participants {
+				userIDs = append(userIDs, p.UserID)
+			}
+		}
+		view := newPrivacyView(db, userIDStr, userIDs)
 		result := make([]gin.H, len(calls))
 		for i, call := range calls {
 			participantsData := make([]gin.H, len(call.Participants))
@@ -137,7 +174,7 @@ func GetGroupCallHistory(db *gorm.DB) gin.HandlerFunc {
 					"user": gin.H{
 						"id":       p.User.ID,
 						"username": p.User.Username,
-						"avatarUrl": p.User.AvatarURL,
+						"avatarUrl": view.avatar(p.User),
 					},
 				}
 			}
@@ -158,10 +195,11 @@ func GetGroupCallHistory(db *gorm.DB) gin.HandlerFunc {
 				"endedAt":      endedAtInt,
 				"recordingUrl": call.RecordingURL,
 				"participants": participantsData,
+				"meetingId":    meetingByCall[call.ID],
 				"starter": gin.H{
 					"id":       call.Starter.ID,
 					"username": call.Starter.Username,
-					"avatarUrl": call.Starter.AvatarURL,
+					"avatarUrl": view.avatar(call.Starter),
 				},
 			}
 		}
@@ -6,6 +6,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"safegram-server/internal/authz"
 	"safegram-server/internal/models"
 )
 
@@ -57,7 +58,7 @@ func GetGroupKey(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// InitializeGroupKey инициализирует групповой ключ (только для owner/admin)
+// InitializeGroupKey инициализирует групповой ключ (manage_keys)
 func InitializeGroupKey(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		chatID := c.Param("id")
@@ -68,14 +69,8 @@ func InitializeGroupKey(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Проверяем права (только owner/admin)
-		var member models.ChatMember
-		if err := db.Where("chat_id = ? AND user_id = ?", chatID, userIDStr).First(&member).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
-		}
-
-		if member.Role != "owner" && member.Role != "admin" {
+		// Проверяем права на управление ключами
+		if !authz.Can(userIDStr, authz.Chat(chatID), authz.ManageKeys) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient_permissions"})
 			return
 		}
@@ -150,14 +145,8 @@ func UpdateGroupKey(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Проверяем права (только owner/admin)
-		var member models.ChatMember
-		if err := db.Where("chat_id = ? AND user_id = ?", chatID, userIDStr).First(&member).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
-		}
-
-		if member.Role != "owner" && member.Role != "admin" {
+		// Проверяем права на управление ключами
+		if !authz.Can(userIDStr, authz.Chat(chatID), authz.ManageKeys) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient_permissions"})
 			return
 		}
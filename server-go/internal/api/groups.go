@@ -6,6 +6,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"safegram-server/internal/authz"
 	"safegram-server/internal/models"
 )
 
@@ -139,14 +140,8 @@ func AddGroupMember(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Проверяем права (owner или admin)
-		var member models.ChatMember
-		if err := db.Where("chat_id = ? AND user_id = ?", groupID, userIDStr).First(&member).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
-		}
-
-		if member.Role != "owner" && member.Role != "admin" {
+		// Проверяем право приглашать участников
+		if !authz.Can(userIDStr, authz.Chat(groupID), authz.InviteMembers) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
@@ -166,6 +161,10 @@ func AddGroupMember(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "already_member"})
 			return
 		}
+		if code := interactionDenied(db, userIDStr, req.UserID, groupAddRule); code != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": code})
+			return
+		}
 
 		newMember := models.ChatMember{
 			ID:     uuid.New().String(),
@@ -193,14 +192,9 @@ func RemoveGroupMember(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Проверяем права
-		var member models.ChatMember
-		if err := db.Where("chat_id = ? AND user_id = ?", groupID, userIDStr).First(&member).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
-		}
-
-		if member.Role != "owner" && member.Role != "admin" {
+		// Проверяем право исключать участников
+		scope := authz.Chat(groupID)
+		if !authz.Can(userIDStr, scope, authz.KickMembers) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
@@ -217,6 +211,12 @@ func RemoveGroupMember(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Исключать можно только участников ниже себя в иерархии
+		if !authz.Outranks(userIDStr, memberUserID, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "role_hierarchy"})
+			return
+		}
+
 		db.Delete(&targetMember)
 		logMemberEvent(db, "chat", groupID, memberUserID, userIDStr, "remove", gin.H{
 			"prevRole": targetMember.Role,
@@ -236,14 +236,8 @@ func UpdateGroup(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Проверяем права (owner или admin)
-		var member models.ChatMember
-		if err := db.Where("chat_id = ? AND user_id = ?", groupID, userIDStr).First(&member).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
-		}
-
-		if member.Role != "owner" && member.Role != "admin" {
+		// Проверяем право изменять настройки группы
+		if !authz.Can(userIDStr, authz.Chat(groupID), authz.ManageSettings) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
@@ -276,7 +270,7 @@ func UpdateGroup(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// BulkAddGroupMembers массовое добавление участников в группу (owner/admin)
+// BulkAddGroupMembers массовое добавление участников в группу (invite_members)
 func BulkAddGroupMembers(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		groupID := c.Param("id")
@@ -287,13 +281,8 @@ func BulkAddGroupMembers(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Проверяем права
-		var member models.ChatMember
-		if err := db.Where("chat_id = ? AND user_id = ?", groupID, userIDStr).First(&member).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
-		}
-		if member.Role != "owner" && member.Role != "admin" {
+		// Проверяем право приглашать участников
+		if !authz.Can(userIDStr, authz.Chat(groupID), authz.InviteMembers) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
@@ -306,9 +295,16 @@ func BulkAddGroupMembers(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Пользователей, запретивших добавлять себя, пропускаем
+		denied := groupAddDenied(db, userIDStr, req.UserIDs)
+		deniedSet := make(map[string]bool, len(denied))
+		for _, uid := range denied {
+			deniedSet[uid] = true
+		}
+
 		added := 0
 		for _, uid := range req.UserIDs {
-			if uid == "" {
+			if uid == "" || deniedSet[uid] {
 				continue
 			}
 			var existing models.ChatMember
@@ -327,11 +323,11 @@ func BulkAddGroupMembers(db *gorm.DB) gin.HandlerFunc {
 			}
 		}
 
-		c.JSON(http.StatusOK, gin.H{"ok": true, "added": added})
+		c.JSON(http.StatusOK, gin.H{"ok": true, "added": added, "restricted": denied})
 	}
 }
 
-// SetGroupMemberRole меняет роль участника (owner/admin)
+// SetGroupMemberRole меняет встроенную роль участника (manage_roles)
 func SetGroupMemberRole(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		groupID := c.Param("id")
@@ -343,13 +339,9 @@ func SetGroupMemberRole(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Проверяем права
-		var member models.ChatMember
-		if err := db.Where("chat_id = ? AND user_id = ?", groupID, userIDStr).First(&member).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
-		}
-		if member.Role != "owner" && member.Role != "admin" {
+		// Проверяем право управлять ролями
+		scope := authz.Chat(groupID)
+		if !authz.Can(userIDStr, scope, authz.ManageRoles) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
@@ -362,7 +354,8 @@ func SetGroupMemberRole(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		allowed := map[string]bool{"owner": true, "admin": true, "moderator": true, "member": true}
+		// Владение передается отдельно — здесь его не выдают и не снимают
+		allowed := map[string]bool{"admin": true, "moderator": true, "member": true}
 		if !allowed[req.Role] {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
 			return
@@ -374,9 +367,14 @@ func SetGroupMemberRole(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Нельзя менять роль владельца не владельцем
-		if target.Role == "owner" && member.Role != "owner" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		if target.Role == "owner" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "role_hierarchy"})
+			return
+		}
+		// Иерархия: менять роль можно только тем, кто ниже, и только на роль ниже своей
+		if !authz.IsOwner(userIDStr, scope) &&
+			(!authz.Outranks(userIDStr, targetUserID, scope) || authz.BuiltinPosition(req.Role) >= authz.Rank(userIDStr, scope)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "role_hierarchy"})
 			return
 		}
 
@@ -4,14 +4,275 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"safegram-server/internal/authz"
 	"safegram-server/internal/models"
 )
 
-// GenerateInviteLink генерирует ссылку для приглашения в группу/канал
+func newInviteCode() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func inviteScope(scopeType, scopeID string) authz.Scope {
+	if scopeType == "server" {
+		return authz.Server(scopeID)
+	}
+	return authz.Chat(scopeID)
+}
+
+func inviteURL(inv models.Invite) string {
+	if inv.ScopeType == "server" {
+		return "/app/servers/join/" + inv.Code
+	}
+	return "/app/join/" + inv.Code
+}
+
+func inviteResponse(inv models.Invite) gin.H {
+	return gin.H{
+		"id":               inv.ID,
+		"code":             inv.Code,
+		"url":              inviteURL(inv),
+		"scopeType":        inv.ScopeType,
+		"scopeId":          inv.ScopeID,
+		"name":             inv.Name,
+		"creatorId":        inv.CreatorID,
+		"expiresAt":        inv.ExpiresAt,
+		"maxUses":          inv.MaxUses,
+		"uses":             inv.Uses,
+		"requiresApproval": inv.RequiresApproval,
+		"revokedAt":        inv.RevokedAt,
+		"createdAt":        inv.CreatedAt,
+		"status":           inviteStatus(inv),
+	}
+}
+
+// inviteStatus "active" | "revoked" | "expired" | "exhausted"
+func inviteStatus(inv models.Invite) string {
+	if inv.RevokedAt != nil {
+		return "revoked"
+	}
+	if inv.ExpiresAt != nil && time.Now().After(*inv.ExpiresAt) {
+		return "expired"
+	}
+	if inv.MaxUses > 0 && inv.Uses >= inv.MaxUses {
+		return "exhausted"
+	}
+	return "active"
+}
+
+// createInvite создает приглашение в области
+func createInvite(db *gorm.DB, scopeType, scopeID, creatorID, name string, expiresAt *time.Time, maxUses int, requiresApproval bool) (models.Invite, error) {
+	inv := models.Invite{
+		ID:               uuid.New().String(),
+		Code:             newInviteCode(),
+		ScopeType:        scopeType,
+		ScopeID:          scopeID,
+		Name:             name,
+		CreatorID:        creatorID,
+		ExpiresAt:        expiresAt,
+		MaxUses:          maxUses,
+		RequiresApproval: requiresApproval,
+	}
+	return inv, db.Create(&inv).Error
+}
+
+// findInvite ищет приглашение по коду. Старые ссылки из chats.invite_link /
+// servers.invite_link переносятся в таблицу invites при первом использовании.
+func findInvite(db *gorm.DB, code, scopeType string) (models.Invite, bool) {
+	var inv models.Invite
+	if err := db.Where("code = ? AND scope_type = ?", code, scopeType).First(&inv).Error; err == nil {
+		return inv, true
+	}
+
+	inv = models.Invite{ID: uuid.New().String(), Code: code, ScopeType: scopeType}
+	switch scopeType {
+	case "chat":
+		var chat models.Chat
+		if err := db.Where("invite_link = ? AND type IN (?, ?)", code, "group", "channel").First(&chat).Error; err != nil {
+			return inv, false
+		}
+		inv.ScopeID, inv.CreatorID = chat.ID, chat.CreatedBy
+	case "server":
+		var server models.Server
+		if err := db.Where("invite_link = ?", code).First(&server).Error; err != nil {
+			return inv, false
+		}
+		inv.ScopeID, inv.CreatorID = server.ID, server.OwnerID
+	default:
+		return inv, false
+	}
+	if err := db.Create(&inv).Error; err != nil {
+		return inv, false
+	}
+	return inv, true
+}
+
+// consumeInvite атомарно увеличивает счетчик использований с учетом лимита, срока и отзыва
+func consumeInvite(db *gorm.DB, inv *models.Invite) bool {
+	res := db.Model(&models.Invite{}).
+		Where("id = ? AND (max_uses = 0 OR uses < max_uses)", inv.ID).
+		Where("revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", time.Now()).
+		UpdateColumn("uses", gorm.Expr("uses + 1"))
+	if res.Error != nil || res.RowsAffected == 0 {
+		return false
+	}
+	inv.Uses++
+	return true
+}
+
+func inviteJoinDetails(inv models.Invite) gin.H {
+	return gin.H{
+		"via":        "invite_link",
+		"inviteId":   inv.ID,
+		"inviteName": inv.Name,
+		"code":       inv.Code,
+		"creatorId":  inv.CreatorID,
+	}
+}
+
+// joinViaInvite добавляет пользователя в группу/сервер и записывает использованную ссылку
+func joinViaInvite(db *gorm.DB, inv models.Invite, userID, actorID string) error {
+	if inv.ScopeType == "server" {
+		if err := addServerMember(db, inv.ScopeID, userID); err != nil {
+			return err
+		}
+	} else {
+		member := models.ChatMember{
+			ID:     uuid.New().String(),
+			ChatID: inv.ScopeID,
+			UserID: userID,
+			Role:   "member",
+		}
+		if err := db.Create(&member).Error; err != nil {
+			return err
+		}
+	}
+	logMemberEvent(db, inv.ScopeType, inv.ScopeID, userID, actorID, "join", inviteJoinDetails(inv))
+	return nil
+}
+
+// joinRestriction проверяет баны в области (код ошибки или "")
+func joinRestriction(db *gorm.DB, scopeType, scopeID, userID string) string {
+	if scopeType == "server" {
+		if _, banned := activeServerBan(db, scopeID, userID); banned {
+			return "server_banned"
+		}
+		return ""
+	}
+	var ban models.ChatBan
+	if err := db.Where("chat_id = ? AND user_id = ? AND (expires_at IS NULL OR expires_at > ?)", scopeID, userID, time.Now()).
+		First(&ban).Error; err == nil {
+		return "banned"
+	}
+	return ""
+}
+
+// useInvite общий сценарий вступления по коду приглашения
+func useInvite(c *gin.Context, db *gorm.DB, scopeType, code string) {
+	userID, _ := c.Get("userID")
+	userIDStr, ok := userID.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	inv, found := findInvite(db, code, scopeType)
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "invalid_link"})
+		return
+	}
+
+	var scopeObj any
+	if scopeType == "server" {
+		var server models.Server
+		if err := db.First(&server, "id = ?", inv.ScopeID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invalid_link"})
+			return
+		}
+		scopeObj = server
+	} else {
+		var chat models.Chat
+		if err := db.First(&chat, "id = ?", inv.ScopeID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invalid_link"})
+			return
+		}
+		scopeObj = chat
+	}
+	result := func(joined bool) gin.H {
+		message := "already_member"
+		if joined {
+			message = "joined"
+		}
+		if scopeType == "chat" {
+			message = "Вы уже участник этого чата"
+			if joined {
+				message = "Вы успешно присоединились к чату"
+			}
+		}
+		return gin.H{scopeType: scopeObj, "message": message}
+	}
+
+	if authz.IsMember(userIDStr, inviteScope(scopeType, inv.ScopeID)) {
+		c.JSON(http.StatusOK, result(false))
+		return
+	}
+	if status := inviteStatus(inv); status != "active" {
+		c.JSON(http.StatusGone, gin.H{"error": "invite_" + status})
+		return
+	}
+	if code := joinRestriction(db, scopeType, inv.ScopeID, userIDStr); code != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": code})
+		return
+	}
+
+	if inv.RequiresApproval {
+		var req struct {
+			Message string `json:"message"`
+		}
+		_ = c.ShouldBindJSON(&req)
+
+		var existing models.JoinRequest
+		if err := db.Where("scope_type = ? AND scope_id = ? AND user_id = ? AND status = ?", scopeType, inv.ScopeID, userIDStr, "pending").
+			First(&existing).Error; err == nil {
+			c.JSON(http.StatusAccepted, gin.H{"status": "pending", "request": existing})
+			return
+		}
+		jr := models.JoinRequest{
+			ID:        uuid.New().String(),
+			InviteID:  inv.ID,
+			ScopeType: scopeType,
+			ScopeID:   inv.ScopeID,
+			UserID:    userIDStr,
+			Message:   req.Message,
+			Status:    "pending",
+		}
+		if err := db.Create(&jr).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		logMemberEvent(db, scopeType, inv.ScopeID, userIDStr, userIDStr, "join_request", inviteJoinDetails(inv))
+		c.JSON(http.StatusAccepted, gin.H{"status": "pending", "request": jr})
+		return
+	}
+
+	if !consumeInvite(db, &inv) {
+		c.JSON(http.StatusGone, gin.H{"error": "invite_exhausted"})
+		return
+	}
+	if err := joinViaInvite(db, inv, userIDStr, userIDStr); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+	c.JSON(http.StatusOK, result(true))
+}
+
+// GenerateInviteLink создает новую ссылку-приглашение в группу/канал (совместимость со старым API)
 func GenerateInviteLink(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		chatID := c.Param("id")
@@ -22,39 +283,28 @@ func GenerateInviteLink(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Проверяем права (только owner/admin могут создавать ссылки)
-		var member models.ChatMember
-		if err := db.Where("chat_id = ? AND user_id = ?", chatID, userIDStr).First(&member).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
-		}
-
-		if member.Role != "owner" && member.Role != "admin" {
+		// Проверяем право приглашать участников
+		if !authz.Can(userIDStr, authz.Chat(chatID), authz.InviteMembers) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient_permissions"})
 			return
 		}
 
-		// Генерируем уникальную ссылку
-		bytes := make([]byte, 16)
-		rand.Read(bytes)
-		inviteLink := base64.URLEncoding.EncodeToString(bytes)
-
-		// Сохраняем ссылку в чат
 		var chat models.Chat
 		if err := db.First(&chat, "id = ?", chatID).Error; err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
 			return
 		}
 
-		chat.InviteLink = inviteLink
-		if err := db.Save(&chat).Error; err != nil {
+		inv, err := createInvite(db, "chat", chatID, userIDStr, "", nil, 0, false)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
 			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"inviteLink": inviteLink,
-			"url":        "/app/join/" + inviteLink,
+			"inviteLink": inv.Code,
+			"url":        inviteURL(inv),
+			"invite":     inviteResponse(inv),
 		})
 	}
 }
@@ -62,7 +312,49 @@ func GenerateInviteLink(db *gorm.DB) gin.HandlerFunc {
 // JoinByInviteLink присоединение к чату по ссылке
 func JoinByInviteLink(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		inviteLink := c.Param("link")
+		useInvite(c, db, "chat", c.Param("link"))
+	}
+}
+
+// GetInvitePreview информация о приглашении до вступления
+func GetInvitePreview(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var inv models.Invite
+		if err := db.Where("code = ?", c.Param("code")).First(&inv).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invalid_link"})
+			return
+		}
+
+		preview := gin.H{
+			"scopeType":        inv.ScopeType,
+			"name":             inv.Name,
+			"requiresApproval": inv.RequiresApproval,
+			"expiresAt":        inv.ExpiresAt,
+			"status":           inviteStatus(inv),
+		}
+		var memberCount int64
+		if inv.ScopeType == "server" {
+			var server models.Server
+			if err := db.First(&server, "id = ?", inv.ScopeID).Error; err == nil {
+				preview["server"] = gin.H{"id": server.ID, "name": server.Name, "description": server.Description, "iconUrl": server.IconURL}
+			}
+			db.Model(&models.ServerMember{}).Where("server_id = ?", inv.ScopeID).Count(&memberCount)
+		} else {
+			var chat models.Chat
+			if err := db.First(&chat, "id = ?", inv.ScopeID).Error; err == nil {
+				preview["chat"] = gin.H{"id": chat.ID, "type": chat.Type, "name": chat.Name, "description": chat.Description, "avatarUrl": chat.AvatarURL}
+			}
+			db.Model(&models.ChatMember{}).Where("chat_id = ?", inv.ScopeID).Count(&memberCount)
+		}
+		preview["memberCount"] = memberCount
+		c.JSON(http.StatusOK, gin.H{"invite": preview})
+	}
+}
+
+// GetInvites список приглашений группы/сервера (invite_members)
+func GetInvites(db *gorm.DB, scopeType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopeID := c.Param("id")
 		userID, _ := c.Get("userID")
 		userIDStr, ok := userID.(string)
 		if !ok {
@@ -70,39 +362,279 @@ func JoinByInviteLink(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Находим чат по ссылке
-		var chat models.Chat
-		if err := db.Where("invite_link = ? AND type IN (?, ?)", inviteLink, "group", "channel").First(&chat).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "invalid_link"})
+		if !authz.Can(userIDStr, inviteScope(scopeType, scopeID), authz.InviteMembers) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		query := db.Where("scope_type = ? AND scope_id = ?", scopeType, scopeID)
+		if c.Query("all") != "true" {
+			query = query.Where("revoked_at IS NULL")
+		}
+		var invites []models.Invite
+		query.Order("created_at DESC").Limit(200).Find(&invites)
+
+		result := make([]gin.H, 0, len(invites))
+		for _, inv := range invites {
+			result = append(result, inviteResponse(inv))
+		}
+		c.JSON(http.StatusOK, gin.H{"invites": result})
+	}
+}
+
+// CreateInvite создает именованное приглашение (invite_members)
+func CreateInvite(db *gorm.DB, scopeType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopeID := c.Param("id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
 			return
 		}
 
-		// Проверяем, не является ли пользователь уже участником
-		var existingMember models.ChatMember
-		if err := db.Where("chat_id = ? AND user_id = ?", chat.ID, userIDStr).First(&existingMember).Error; err == nil {
-			c.JSON(http.StatusOK, gin.H{
-				"chat": chat,
-				"message": "Вы уже участник этого чата",
-			})
+		if !authz.Can(userIDStr, inviteScope(scopeType, scopeID), authz.InviteMembers) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
 
-		// Добавляем пользователя как участника
-		member := models.ChatMember{
-			ID:     uuid.New().String(),
-			ChatID: chat.ID,
-			UserID: userIDStr,
-			Role:   "member",
+		var req struct {
+			Name             string `json:"name"`
+			ExpiresInMinutes int    `json:"expiresInMinutes"` // 0 — бессрочно
+			MaxUses          int    `json:"maxUses"`          // 0 — без ограничений
+			RequiresApproval bool   `json:"requiresApproval"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+		if req.ExpiresInMinutes < 0 || req.MaxUses < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
 		}
 
-		if err := db.Create(&member).Error; err != nil {
+		var expiresAt *time.Time
+		if req.ExpiresInMinutes > 0 {
+			t := time.Now().Add(time.Duration(req.ExpiresInMinutes) * time.Minute)
+			expiresAt = &t
+		}
+
+		inv, err := createInvite(db, scopeType, scopeID, userIDStr, req.Name, expiresAt, req.MaxUses, req.RequiresApproval)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		chatID, serverID := scopeID, ""
+		if scopeType == "server" {
+			chatID, serverID = "", scopeID
+		}
+		logModeration(db, chatID, serverID, userIDStr, "invite_create", "", "", gin.H{"inviteId": inv.ID, "name": inv.Name})
+		c.JSON(http.StatusCreated, gin.H{"invite": inviteResponse(inv)})
+	}
+}
+
+// RevokeInvite отзывает приглашение (создатель или manage_settings)
+func RevokeInvite(db *gorm.DB, scopeType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopeID := c.Param("id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var inv models.Invite
+		if err := db.Where("id = ? AND scope_type = ? AND scope_id = ?", c.Param("inviteId"), scopeType, scopeID).First(&inv).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+
+		if inv.CreatorID != userIDStr && !authz.Can(userIDStr, inviteScope(scopeType, scopeID), authz.ManageSettings) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		if inv.RevokedAt == nil {
+			now := time.Now()
+			inv.RevokedAt = &now
+			inv.RevokedBy = userIDStr
+			db.Model(&inv).Updates(map[string]interface{}{"revoked_at": now, "revoked_by": userIDStr})
+
+			// Нерассмотренные заявки по отозванной ссылке отклоняются
+			db.Model(&models.JoinRequest{}).Where("invite_id = ? AND status = ?", inv.ID, "pending").
+				Updates(map[string]interface{}{"status": "rejected", "reviewer_id": userIDStr, "reviewed_at": now})
+		}
+
+		chatID, serverID := scopeID, ""
+		if scopeType == "server" {
+			chatID, serverID = "", scopeID
+		}
+		logModeration(db, chatID, serverID, userIDStr, "invite_revoke", "", "", gin.H{"inviteId": inv.ID, "name": inv.Name})
+		c.JSON(http.StatusOK, gin.H{"invite": inviteResponse(inv)})
+	}
+}
+
+// GetInviteStats статистика вступлений по ссылке (invite_members)
+func GetInviteStats(db *gorm.DB, scopeType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopeID := c.Param("id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
 			return
 		}
 
+		if !authz.Can(userIDStr, inviteScope(scopeType, scopeID), authz.InviteMembers) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var inv models.Invite
+		if err := db.Where("id = ? AND scope_type = ? AND scope_id = ?", c.Param("inviteId"), scopeType, scopeID).First(&inv).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+
+		type statusCount struct {
+			Status string
+			Count  int64
+		}
+		var counts []statusCount
+		db.Model(&models.JoinRequest{}).Select("status, COUNT(*) AS count").
+			Where("invite_id = ?", inv.ID).Group("status").Scan(&counts)
+		requests := gin.H{"pending": 0, "approved": 0, "rejected": 0}
+		for _, sc := range counts {
+			requests[sc.Status] = sc.Count
+		}
+
+		// Вступления по ссылке из истории участников (details.inviteId)
+		var joins []models.MemberEvent
+		db.Where("scope_type = ? AND scope_id = ? AND action = ? AND details::jsonb ->> 'inviteId' = ?", scopeType, scopeID, "join", inv.ID).
+			Order("created_at DESC").Limit(100).Find(&joins)
+
+		var stillMembers int64
+		if len(joins) > 0 {
+			userIDs := make([]string, 0, len(joins))
+			for _, j := range joins {
+				userIDs = append(userIDs, j.UserID)
+			}
+			if scopeType == "server" {
+				db.Model(&models.ServerMember{}).Where("server_id = ? AND user_id IN ?", scopeID, userIDs).Count(&stillMembers)
+			} else {
+				db.Model(&models.ChatMember{}).Where("chat_id = ? AND user_id IN ?", scopeID, userIDs).Count(&stillMembers)
+			}
+		}
+
 		c.JSON(http.StatusOK, gin.H{
-			"chat": chat,
-			"message": "Вы успешно присоединились к чату",
+			"invite":       inviteResponse(inv),
+			"uses":         inv.Uses,
+			"requests":     requests,
+			"recentJoins":  joins,
+			"stillMembers": stillMembers,
 		})
 	}
 }
+
+// GetJoinRequests очередь заявок на вступление (invite_members)
+func GetJoinRequests(db *gorm.DB, scopeType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopeID := c.Param("id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if !authz.Can(userIDStr, inviteScope(scopeType, scopeID), authz.InviteMembers) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var requests []models.JoinRequest
+		db.Where("scope_type = ? AND scope_id = ? AND status = ?", scopeType, scopeID, c.DefaultQuery("status", "pending")).
+			Preload("User").
+			Order("created_at ASC").Limit(200).Find(&requests)
+		requesterIDs := make([]string, len(requests))
+		for i, jr := range requests {
+			requesterIDs[i] = jr.UserID
+		}
+		view := newPrivacyView(db, userIDStr, requesterIDs)
+		for i := range requests {
+			requests[i].User.AvatarURL = view.avatar(requests[i].User)
+		}
+		c.JSON(http.StatusOK, gin.H{"requests": requests})
+	}
+}
+
+// ReviewJoinRequest одобряет или отклоняет заявку (invite_members)
+// decision: "approved" | "rejected"
+func ReviewJoinRequest(db *gorm.DB, scopeType, decision string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopeID := c.Param("id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if !authz.Can(userIDStr, inviteScope(scopeType, scopeID), authz.InviteMembers) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var jr models.JoinRequest
+		if err := db.Where("id = ? AND scope_type = ? AND scope_id = ?", c.Param("requestId"), scopeType, scopeID).First(&jr).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		if jr.Status != "pending" {
+			c.JSON(http.StatusConflict, gin.H{"error": "already_reviewed"})
+			return
+		}
+
+		var inv models.Invite
+		invErr := db.First(&inv, "id = ?", jr.InviteID).Error
+
+		if decision == "approved" && !authz.IsMember(jr.UserID, inviteScope(scopeType, scopeID)) {
+			// Ссылку могли отозвать, она могла истечь или исчерпаться, пока заявка ждала
+			if invErr != nil {
+				c.JSON(http.StatusGone, gin.H{"error": "invalid_link"})
+				return
+			}
+			if status := inviteStatus(inv); status != "active" {
+				c.JSON(http.StatusGone, gin.H{"error": "invite_" + status})
+				return
+			}
+			if code := joinRestriction(db, scopeType, scopeID, jr.UserID); code != "" {
+				c.JSON(http.StatusForbidden, gin.H{"error": code})
+				return
+			}
+			if !consumeInvite(db, &inv) {
+				c.JSON(http.StatusGone, gin.H{"error": "invite_exhausted"})
+				return
+			}
+			if err := joinViaInvite(db, inv, jr.UserID, userIDStr); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+				return
+			}
+		}
+
+		now := time.Now()
+		jr.Status = decision
+		jr.ReviewerID = userIDStr
+		jr.ReviewedAt = &now
+		db.Save(&jr)
+
+		chatID, serverID := scopeID, ""
+		if scopeType == "server" {
+			chatID, serverID = "", scopeID
+		}
+		logModeration(db, chatID, serverID, userIDStr, "join_request_"+decision, jr.UserID, "", gin.H{"requestId": jr.ID, "inviteId": jr.InviteID})
+		c.JSON(http.StatusOK, gin.H{"request": jr})
+	}
+}
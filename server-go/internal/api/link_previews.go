@@ -0,0 +1,292 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"safegram-server/internal/authz"
+	"safegram-server/internal/config"
+	"safegram-server/internal/models"
+	"safegram-server/internal/redis"
+	"safegram-server/internal/unfurl"
+	"safegram-server/internal/websocket"
+)
+
+// Сроки хранения превью
+const (
+	linkPreviewCacheTTL  = 24 * time.Hour     // Redis
+	linkPreviewMaxAge    = 7 * 24 * time.Hour // Postgres: после этого ссылка загружается заново
+	linkPreviewRetryTTL  = time.Hour          // повтор после неудачной загрузки
+	linkPreviewParallels = 8                  // одновременных загрузок на сервер
+)
+
+var (
+	// previewFetcher загрузчик превью; nil — превью отключены настройкой LINK_PREVIEWS
+	previewFetcher     *unfurl.Fetcher
+	previewSlots       = make(chan struct{}, linkPreviewParallels)
+	previewLinkPattern = regexp.MustCompile(`https?://[^\s<>"'«»]+`)
+)
+
+// InitLinkPreviews включает загрузку превью ссылок
+func InitLinkPreviews(cfg *config.Config) {
+	if !cfg.LinkPreviews {
+		return
+	}
+	previewFetcher = unfurl.New(unfurl.Config{Timeout: cfg.LinkPreviewTimeout})
+}
+
+// trimLink убирает знаки препинания после ссылки в тексте; закрывающая скобка
+// остается, если она парная (как в ссылках на Википедию)
+func trimLink(link string) string {
+	for len(link) > 0 {
+		last := link[len(link)-1]
+		switch {
+		case strings.IndexByte(".,;:!?'\"", last) >= 0:
+		case last == ')' && strings.Count(link, "(") < strings.Count(link, ")"):
+		default:
+			return link
+		}
+		link = link[:len(link)-1]
+	}
+	return link
+}
+
+// firstLink первая ссылка сообщения: сущность link или адрес в тексте вне кода
+func firstLink(text string, entities []textEntity) string {
+	link, offset := "", -1
+	for _, e := range entities {
+		if e.Type == entityLink {
+			link, offset = e.URL, e.Offset
+			break
+		}
+	}
+	masked := maskCode(text, entities)
+	if loc := previewLinkPattern.FindStringIndex(masked); loc != nil {
+		if position := utf16Len(masked[:loc[0]]); offset < 0 || position < offset {
+			link = trimLink(masked[loc[0]:loc[1]])
+		}
+	}
+	if link == "" || strings.HasPrefix(link, "mailto:") || !validURL(link) {
+		return ""
+	}
+	return link
+}
+
+// normalizeLink ключ кэша: схема и хост в нижнем регистре, без фрагмента
+func normalizeLink(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	return u.String()
+}
+
+// linkPreviewsAllowed превью разрешены и в чате, и отправителем сообщения
+func linkPreviewsAllowed(db *gorm.DB, message models.Message) bool {
+	var chat models.Chat
+	if err := db.Select("id", "link_previews").First(&chat, "id = ?", message.ChatID).Error; err != nil || !chat.LinkPreviews {
+		return false
+	}
+	var sender models.User
+	if err := db.Select("id", "link_previews").First(&sender, "id = ?", message.SenderID).Error; err != nil {
+		return false
+	}
+	return sender.LinkPreviews
+}
+
+// cacheLinkPreview кладет превью в Redis; неудачи хранятся до повторной попытки
+func cacheLinkPreview(preview models.LinkPreview) {
+	ttl := linkPreviewCacheTTL
+	if preview.Status != "ok" {
+		ttl = linkPreviewRetryTTL - time.Since(preview.FetchedAt)
+		if ttl <= 0 {
+			return
+		}
+	}
+	data, _ := json.Marshal(preview)
+	redis.SetLinkPreview(preview.URLHash, string(data), ttl)
+}
+
+// linkPreviewFor превью ссылки из Redis, затем из Postgres, иначе загружает его; nil — превью нет
+func linkPreviewFor(db *gorm.DB, link string) *models.LinkPreview {
+	link = normalizeLink(link)
+	sum := sha256.Sum256([]byte(link))
+	hash := hex.EncodeToString(sum[:])
+	result := func(preview models.LinkPreview) *models.LinkPreview {
+		if preview.Status != "ok" {
+			return nil
+		}
+		return &preview
+	}
+
+	if data, err := redis.GetLinkPreview(hash); err == nil {
+		var cached models.LinkPreview
+		if json.Unmarshal([]byte(data), &cached) == nil {
+			return result(cached)
+		}
+	}
+
+	var stored models.LinkPreview
+	if err := db.First(&stored, "url_hash = ?", hash).Error; err == nil {
+		maxAge := linkPreviewMaxAge
+		if stored.Status != "ok" {
+			maxAge = linkPreviewRetryTTL
+		}
+		if time.Since(stored.FetchedAt) < maxAge {
+			cacheLinkPreview(stored)
+			return result(stored)
+		}
+	}
+
+	previewSlots <- struct{}{}
+	preview := fetchLinkPreview(hash, link)
+	<-previewSlots
+	db.Save(&preview)
+	cacheLinkPreview(preview)
+	return result(preview)
+}
+
+// fetchLinkPreview загружает метаданные и копирует картинку в uploads/previews,
+// чтобы клиенты не обращались к стороннему сайту напрямую
+func fetchLinkPreview(hash, link string) models.LinkPreview {
+	preview := models.LinkPreview{URLHash: hash, URL: link, Status: "failed", FetchedAt: time.Now()}
+	meta, err := previewFetcher.Fetch(context.Background(), link)
+	if err != nil {
+		return preview
+	}
+	preview.Status = "ok"
+	preview.Type = meta.Type
+	preview.SiteName = meta.SiteName
+	preview.Title = meta.Title
+	preview.Description = meta.Description
+
+	if meta.ImageURL != "" {
+		if data, contentType, err := previewFetcher.FetchImage(context.Background(), meta.ImageURL); err == nil {
+			ext := map[string]string{"image/jpeg": ".jpg", "image/png": ".png", "image/gif": ".gif", "image/webp": ".webp"}[contentType]
+			filename := hash + ext
+			if err := os.WriteFile(filepath.Join(uploadsDir, "previews", filename), data, 0644); err == nil {
+				preview.ImageURL = "/uploads/previews/" + filename
+			}
+		}
+	}
+	if preview.Type == "photo" && preview.ImageURL == "" {
+		preview.Status = "failed"
+	}
+	return preview
+}
+
+// messagePreview превью, прикрепленное к сообщению
+func messagePreview(message models.Message) *models.LinkPreview {
+	if message.PreviewJSON == "" {
+		return nil
+	}
+	var preview models.LinkPreview
+	if err := json.Unmarshal([]byte(message.PreviewJSON), &preview); err != nil {
+		return nil
+	}
+	return &preview
+}
+
+// attachLinkPreview прикрепляет к сообщению превью первой ссылки (или снимает его, если ссылки
+// больше нет) и рассылает message:updated. Вызывается в фоне после отправки и редактирования
+func attachLinkPreview(db *gorm.DB, wsHub *websocket.Hub, message models.Message) {
+	if previewFetcher == nil || message.Ciphertext != "" {
+		return
+	}
+	link := ""
+	if message.Text != "" && linkPreviewsAllowed(db, message) {
+		link = firstLink(message.Text, messageFormatting(message))
+	}
+	current := messagePreview(message)
+	if link == "" && current == nil {
+		return
+	}
+	if current != nil && link != "" && current.URL == normalizeLink(link) {
+		return
+	}
+
+	var preview *models.LinkPreview
+	if link != "" {
+		preview = linkPreviewFor(db, link)
+	}
+	previewJSON := ""
+	if preview != nil {
+		data, _ := json.Marshal(preview)
+		previewJSON = string(data)
+	}
+	if previewJSON == message.PreviewJSON {
+		return
+	}
+
+	// Пока загружалось превью, сообщение могли изменить или удалить
+	result := db.Model(&models.Message{}).
+		Where("id = ? AND text = ? AND deleted_at IS NULL", message.ID, message.Text).
+		Update("preview_json", previewJSON)
+	if result.RowsAffected == 0 {
+		return
+	}
+	broadcastMessageEvent(db, wsHub, message, wsEvent("message:updated", gin.H{
+		"id":      message.ID,
+		"chatId":  message.ChatID,
+		"preview": preview,
+	}))
+}
+
+// UpdateChatLinkPreviews включает или отключает превью ссылок в чате.
+// В личном чате это может сделать любой из собеседников
+func UpdateChatLinkPreviews(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		chatID := c.Param("id")
+		var chat models.Chat
+		if err := db.First(&chat, "id = ?", chatID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		allowed := authz.Can(userIDStr, authz.Chat(chatID), authz.ManageSettings)
+		if chat.Type == "dm" {
+			allowed = authz.IsMember(userIDStr, authz.Chat(chatID))
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var req struct {
+			Enabled *bool `json:"enabled" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		if err := db.Model(&chat).Update("link_previews", *req.Enabled).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		if chat.Type != "dm" {
+			logModeration(db, chatID, "", userIDStr, "link_previews_updated", "", "", gin.H{"enabled": *req.Enabled})
+		}
+		c.JSON(http.StatusOK, gin.H{"linkPreviews": *req.Enabled})
+	}
+}
@@ -0,0 +1,1047 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"safegram-server/internal/authz"
+	"safegram-server/internal/config"
+	"safegram-server/internal/email"
+	"safegram-server/internal/models"
+	"safegram-server/internal/websocket"
+)
+
+// guestPrefix префикс ID гостя встречи (sub в гостевом токене)
+const guestPrefix = "guest:"
+
+// meetingGuestTTL сколько гостевой токен действует после окончания встречи
+const meetingGuestTTL = 6 * time.Hour
+
+func isGuest(userID string) bool {
+	return strings.HasPrefix(userID, guestPrefix)
+}
+
+func hashMeetingSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func meetingLink(cfg *config.Config, meeting models.Meeting) string {
+	return strings.TrimRight(cfg.AppURL, "/") + "/meet/" + meeting.JoinCode
+}
+
+// meetingHost организатор или управляющий каналами чата
+func meetingHost(meeting models.Meeting, userID string) bool {
+	return meeting.CreatedBy == userID || authz.Can(userID, authz.Chat(meeting.ChatID), authz.ManageChannels)
+}
+
+// meetingVisible видит встречу: участник чата, приглашенный или допущенный из лобби
+func meetingVisible(db *gorm.DB, meeting models.Meeting, userID string) bool {
+	if meeting.CreatedBy == userID || authz.IsMember(userID, authz.Chat(meeting.ChatID)) {
+		return true
+	}
+	var count int64
+	db.Model(&models.MeetingInvitee{}).Where("meeting_id = ? AND user_id = ?", meeting.ID, userID).Count(&count)
+	if count > 0 {
+		return true
+	}
+	db.Model(&models.MeetingLobbyEntry{}).Where("meeting_id = ? AND user_id = ? AND status = ?", meeting.ID, userID, "admitted").Count(&count)
+	return count > 0
+}
+
+func meetingPayload(meeting models.Meeting, cfg *config.Config) gin.H {
+	return gin.H{
+		"id":              meeting.ID,
+		"chatId":          meeting.ChatID,
+		"channelId":       meeting.ChannelID,
+		"createdBy":       meeting.CreatedBy,
+		"title":           meeting.Title,
+		"description":     meeting.Description,
+		"startsAt":        meeting.StartsAt.Unix() * 1000,
+		"endsAt":          meeting.EndsAt.Unix() * 1000,
+		"status":          meeting.Status,
+		"joinCode":        meeting.JoinCode,
+		"joinUrl":         meetingLink(cfg, meeting),
+		"lobbyEnabled":    meeting.LobbyEnabled,
+		"guestsAllowed":   meeting.GuestsAllowed,
+		"reminderMinutes": meeting.ReminderMinutes,
+		"groupCallId":     meeting.GroupCallID,
+		"startedAt":       meeting.StartedAt,
+		"endedAt":         meeting.EndedAt,
+		"createdAt":       meeting.CreatedAt,
+	}
+}
+
+// meetingCalendarEvent событие .ics для встречи
+func meetingCalendarEvent(db *gorm.DB, cfg *config.Config, meeting models.Meeting, method string) email.CalendarEvent {
+	var organizer models.User
+	db.Select("id", "username", "email").First(&organizer, "id = ?", meeting.CreatedBy)
+	event := email.CalendarEvent{
+		UID:           meeting.ID + "@safegram",
+		Sequence:      meeting.Sequence,
+		Method:        method,
+		Title:         meeting.Title,
+		Description:   meeting.Description,
+		URL:           meetingLink(cfg, meeting),
+		Start:         meeting.StartsAt,
+		End:           meeting.EndsAt,
+		OrganizerName: organizer.Username,
+	}
+	if organizer.Email != nil {
+		event.OrganizerEmail = *organizer.Email
+	}
+	return event
+}
+
+// meetingEmailRecipient адрес и имя приглашенного для письма
+func meetingEmailRecipient(db *gorm.DB, invitee models.MeetingInvitee) (string, string) {
+	if invitee.UserID == nil {
+		return invitee.Email, invitee.Email
+	}
+	var user models.User
+	if err := db.Select("id", "username", "email").First(&user, "id = ?", *invitee.UserID).Error; err != nil || user.Email == nil {
+		return "", ""
+	}
+	return *user.Email, user.Username
+}
+
+// sendMeetingEmails рассылает .ics всем приглашенным с email (в фоне)
+func sendMeetingEmails(db *gorm.DB, cfg *config.Config, meeting models.Meeting, method string) {
+	var invitees []models.MeetingInvitee
+	db.Where("meeting_id = ?", meeting.ID).Find(&invitees)
+	if len(invitees) == 0 {
+		return
+	}
+
+	var inviter models.User
+	db.Select("id", "username").First(&inviter, "id = ?", meeting.CreatedBy)
+	event := meetingCalendarEvent(db, cfg, meeting, method)
+
+	go func() {
+		for _, invitee := range invitees {
+			to, name := meetingEmailRecipient(db, invitee)
+			if to == "" {
+				continue
+			}
+			if err := email.SendMeetingInvite(to, name, inviter.Username, event); err != nil {
+				log.Printf("Failed to send meeting invite to %s: %v", to, err)
+				continue
+			}
+			now := time.Now()
+			db.Model(&models.MeetingInvitee{}).Where("id = ?", invitee.ID).Update("email_sent_at", now)
+		}
+	}()
+}
+
+// notifyMeetingUsers рассылает событие организатору и приглашенным пользователям
+func notifyMeetingUsers(db *gorm.DB, wsHub *websocket.Hub, meeting models.Meeting, eventType string, push string) {
+	userIDs := []string{meeting.CreatedBy}
+	var invited []string
+	db.Model(&models.MeetingInvitee{}).Where("meeting_id = ? AND user_id IS NOT NULL", meeting.ID).Pluck("user_id", &invited)
+	userIDs = append(userIDs, invited...)
+
+	event := wsEvent(eventType, gin.H{"meetingId": meeting.ID, "chatId": meeting.ChatID, "title": meeting.Title, "startsAt": meeting.StartsAt.Unix() * 1000})
+	for _, userID := range userIDs {
+		if wsHub != nil {
+			wsHub.SendToUser(userID, event)
+		}
+		if push != "" && userID != meeting.CreatedBy {
+			SendPushNotification(db, userID, push, meeting.Title, map[string]interface{}{
+				"type": eventType, "meetingId": meeting.ID, "chatId": meeting.ChatID,
+			})
+		}
+	}
+}
+
+// loadMeeting встреча по :id, видимая пользователю
+func loadMeeting(c *gin.Context, db *gorm.DB, userID string) (models.Meeting, bool) {
+	var meeting models.Meeting
+	if err := db.First(&meeting, "id = ?", c.Param("id")).Error; err != nil || !meetingVisible(db, meeting, userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+		return meeting, false
+	}
+	return meeting, true
+}
+
+// addMeetingInvitees добавляет приглашенных: участников чата по ID и внешние адреса
+func addMeetingInvitees(db *gorm.DB, meeting models.Meeting, userIDs, emails []string) []models.MeetingInvitee {
+	var added []models.MeetingInvitee
+	for _, userID := range userIDs {
+		if userID == meeting.CreatedBy || !authz.IsMember(userID, authz.Chat(meeting.ChatID)) {
+			continue
+		}
+		var exists int64
+		db.Model(&models.MeetingInvitee{}).Where("meeting_id = ? AND user_id = ?", meeting.ID, userID).Count(&exists)
+		if exists > 0 {
+			continue
+		}
+		id := userID
+		invitee := models.MeetingInvitee{ID: uuid.New().String(), MeetingID: meeting.ID, UserID: &id, Response: "pending"}
+		if db.Create(&invitee).Error == nil {
+			added = append(added, invitee)
+		}
+	}
+	for _, address := range emails {
+		address = strings.ToLower(strings.TrimSpace(address))
+		if address == "" || !strings.Contains(address, "@") {
+			continue
+		}
+		var exists int64
+		db.Model(&models.MeetingInvitee{}).Where("meeting_id = ? AND email = ?", meeting.ID, address).Count(&exists)
+		if exists > 0 {
+			continue
+		}
+		invitee := models.MeetingInvitee{ID: uuid.New().String(), MeetingID: meeting.ID, Email: address, Response: "pending"}
+		if db.Create(&invitee).Error == nil {
+			added = append(added, invitee)
+		}
+	}
+	return added
+}
+
+// CreateMeeting планирует встречу в чате или голосовом канале сервера
+func CreateMeeting(db *gorm.DB, wsHub *websocket.Hub, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var req struct {
+			ChatID          string   `json:"chatId"`
+			ChannelID       string   `json:"channelId"`
+			Title           string   `json:"title" binding:"required"`
+			Description     string   `json:"description"`
+			StartsAt        int64    `json:"startsAt" binding:"required"` // мс
+			DurationMinutes int      `json:"durationMinutes"`
+			LobbyEnabled    bool     `json:"lobbyEnabled"`
+			GuestsAllowed   bool     `json:"guestsAllowed"`
+			ReminderMinutes *int     `json:"reminderMinutes"`
+			Invitees        []string `json:"invitees"` // ID пользователей
+			Emails          []string `json:"emails"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		// Встреча в канале сервера проходит в чате канала
+		if req.ChannelID != "" {
+			var channel models.Channel
+			if err := db.First(&channel, "id = ?", req.ChannelID).Error; err != nil || channel.ChatID == "" {
+				c.JSON(http.StatusNotFound, gin.H{"error": "channel_not_found"})
+				return
+			}
+			req.ChatID = channel.ChatID
+		}
+		if req.ChatID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+		if !authz.Can(userIDStr, authz.Chat(req.ChatID), authz.Connect) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		if code, expiresAt, restricted := serverRestriction(db, req.ChatID, userIDStr); restricted {
+			c.JSON(http.StatusForbidden, gin.H{"error": code, "expiresAt": expiresAt})
+			return
+		}
+
+		startsAt := time.UnixMilli(req.StartsAt)
+		if startsAt.Before(time.Now().Add(-time.Minute)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "starts_in_past"})
+			return
+		}
+		if req.DurationMinutes <= 0 {
+			req.DurationMinutes = 60
+		}
+		if req.DurationMinutes > 24*60 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "duration_too_long"})
+			return
+		}
+		reminder := 10
+		if req.ReminderMinutes != nil && *req.ReminderMinutes >= 0 {
+			reminder = *req.ReminderMinutes
+		}
+
+		meeting := models.Meeting{
+			ID:              uuid.New().String(),
+			ChatID:          req.ChatID,
+			ChannelID:       req.ChannelID,
+			CreatedBy:       userIDStr,
+			Title:           strings.TrimSpace(req.Title),
+			Description:     req.Description,
+			StartsAt:        startsAt,
+			EndsAt:          startsAt.Add(time.Duration(req.DurationMinutes) * time.Minute),
+			Status:          "scheduled",
+			JoinCode:        newInviteCode(),
+			LobbyEnabled:    req.LobbyEnabled,
+			GuestsAllowed:   req.GuestsAllowed,
+			ReminderMinutes: reminder,
+		}
+		if err := db.Create(&meeting).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		addMeetingInvitees(db, meeting, req.Invitees, req.Emails)
+		notifyMeetingUsers(db, wsHub, meeting, "meeting:invited", "Приглашение на встречу")
+		sendMeetingEmails(db, cfg, meeting, "REQUEST")
+		if wsHub != nil {
+			wsHub.BroadcastToChat(meeting.ChatID, wsEvent("meeting:scheduled", meetingPayload(meeting, cfg)))
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"meeting": meetingPayload(meeting, cfg)})
+	}
+}
+
+// GetMeetings предстоящие и идущие встречи пользователя (?chatId= — только в чате)
+func GetMeetings(db *gorm.DB, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		query := db.Model(&models.Meeting{}).Order("starts_at ASC").Limit(100)
+		if c.Query("past") == "true" {
+			query = query.Where("status IN ?", []string{"ended", "cancelled"}).Order("starts_at DESC")
+		} else {
+			query = query.Where("status IN ?", []string{"scheduled", "live"})
+		}
+
+		if chatID := c.Query("chatId"); chatID != "" {
+			if !authz.IsMember(userIDStr, authz.Chat(chatID)) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+				return
+			}
+			query = query.Where("chat_id = ?", chatID)
+		} else {
+			query = query.Where(
+				"chat_id IN (SELECT chat_id FROM chat_members WHERE user_id = ? AND deleted_at IS NULL) OR id IN (SELECT meeting_id FROM meeting_invitees WHERE user_id = ?)",
+				userIDStr, userIDStr,
+			)
+		}
+
+		var meetings []models.Meeting
+		if err := query.Find(&meetings).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		result := make([]gin.H, len(meetings))
+		for i, meeting := range meetings {
+			result[i] = meetingPayload(meeting, cfg)
+		}
+		c.JSON(http.StatusOK, gin.H{"meetings": result})
+	}
+}
+
+// GetMeeting встреча с приглашенными и историей группового звонка
+func GetMeeting(db *gorm.DB, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		meeting, found := loadMeeting(c, db, userIDStr)
+		if !found {
+			return
+		}
+
+		payload := meetingPayload(meeting, cfg)
+		var invitees []models.MeetingInvitee
+		db.Where("meeting_id = ?", meeting.ID).Order("created_at ASC").Find(&invitees)
+		// Внешние адреса видит только организатор
+		if !meetingHost(meeting, userIDStr) {
+			for i := range invitees {
+				invitees[i].Email = ""
+			}
+		}
+		payload["invitees"] = invitees
+
+		if meeting.GroupCallID != nil {
+			var call models.GroupCall
+			if err := db.Preload("Participants").First(&call, "id = ?", *meeting.GroupCallID).Error; err == nil {
+				payload["groupCall"] = call
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"meeting": payload})
+	}
+}
+
+// UpdateMeeting меняет встречу; приглашенным уходит обновленный .ics
+func UpdateMeeting(db *gorm.DB, wsHub *websocket.Hub, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		meeting, found := loadMeeting(c, db, userIDStr)
+		if !found {
+			return
+		}
+		if !meetingHost(meeting, userIDStr) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		if meeting.Status == "ended" || meeting.Status == "cancelled" {
+			c.JSON(http.StatusConflict, gin.H{"error": "meeting_closed"})
+			return
+		}
+
+		var req struct {
+			Title           *string  `json:"title"`
+			Description     *string  `json:"description"`
+			StartsAt        *int64   `json:"startsAt"`
+			DurationMinutes *int     `json:"durationMinutes"`
+			LobbyEnabled    *bool    `json:"lobbyEnabled"`
+			GuestsAllowed   *bool    `json:"guestsAllowed"`
+			ReminderMinutes *int     `json:"reminderMinutes"`
+			Invitees        []string `json:"invitees"` // добавить
+			Emails          []string `json:"emails"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		rescheduled := false
+		if req.Title != nil && strings.TrimSpace(*req.Title) != "" {
+			meeting.Title = strings.TrimSpace(*req.Title)
+		}
+		if req.Description != nil {
+			meeting.Description = *req.Description
+		}
+		duration := meeting.EndsAt.Sub(meeting.StartsAt)
+		if req.DurationMinutes != nil && *req.DurationMinutes > 0 && *req.DurationMinutes <= 24*60 {
+			duration = time.Duration(*req.DurationMinutes) * time.Minute
+			rescheduled = true
+		}
+		if req.StartsAt != nil && meeting.Status == "scheduled" {
+			meeting.StartsAt = time.UnixMilli(*req.StartsAt)
+			rescheduled = true
+		}
+		meeting.EndsAt = meeting.StartsAt.Add(duration)
+		if req.LobbyEnabled != nil {
+			meeting.LobbyEnabled = *req.LobbyEnabled
+		}
+		if req.GuestsAllowed != nil {
+			meeting.GuestsAllowed = *req.GuestsAllowed
+		}
+		if req.ReminderMinutes != nil && *req.ReminderMinutes >= 0 {
+			meeting.ReminderMinutes = *req.ReminderMinutes
+			rescheduled = true
+		}
+		if rescheduled {
+			meeting.ReminderSentAt = nil
+		}
+		meeting.Sequence++
+
+		if err := db.Select("*").Save(&meeting).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		// Новые приглашенные получают приглашение, остальные — обновление
+		added := addMeetingInvitees(db, meeting, req.Invitees, req.Emails)
+		for _, invitee := range added {
+			if invitee.UserID != nil && wsHub != nil {
+				wsHub.SendToUser(*invitee.UserID, wsEvent("meeting:invited", gin.H{"meetingId": meeting.ID, "chatId": meeting.ChatID, "title": meeting.Title}))
+			}
+		}
+		notifyMeetingUsers(db, wsHub, meeting, "meeting:updated", "")
+		sendMeetingEmails(db, cfg, meeting, "REQUEST")
+
+		c.JSON(http.StatusOK, gin.H{"meeting": meetingPayload(meeting, cfg)})
+	}
+}
+
+// CancelMeeting отменяет запланированную встречу
+func CancelMeeting(db *gorm.DB, wsHub *websocket.Hub, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		meeting, found := loadMeeting(c, db, userIDStr)
+		if !found {
+			return
+		}
+		if !meetingHost(meeting, userIDStr) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		if meeting.Status != "scheduled" {
+			c.JSON(http.StatusConflict, gin.H{"error": "meeting_not_scheduled"})
+			return
+		}
+
+		meeting.Status = "cancelled"
+		meeting.Sequence++
+		db.Model(&meeting).Updates(map[string]interface{}{"status": meeting.Status, "sequence": meeting.Sequence})
+		db.Model(&models.MeetingLobbyEntry{}).Where("meeting_id = ? AND status = ?", meeting.ID, "waiting").
+			Update("status", "denied")
+
+		notifyMeetingUsers(db, wsHub, meeting, "meeting:cancelled", "Встреча отменена")
+		sendMeetingEmails(db, cfg, meeting, "CANCEL")
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// RespondMeeting ответ приглашенного: accepted | declined
+func RespondMeeting(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var req struct {
+			Response string `json:"response" binding:"required,oneof=accepted declined"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		meeting, found := loadMeeting(c, db, userIDStr)
+		if !found {
+			return
+		}
+		res := db.Model(&models.MeetingInvitee{}).
+			Where("meeting_id = ? AND user_id = ?", meeting.ID, userIDStr).
+			Update("response", req.Response)
+		if res.RowsAffected == 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "not_invited"})
+			return
+		}
+		if wsHub != nil {
+			wsHub.SendToUser(meeting.CreatedBy, wsEvent("meeting:response", gin.H{"meetingId": meeting.ID, "userId": userIDStr, "response": req.Response}))
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// GetMeetingICS файл .ics для добавления в календарь
+func GetMeetingICS(db *gorm.DB, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		meeting, found := loadMeeting(c, db, userIDStr)
+		if !found {
+			return
+		}
+		method := "REQUEST"
+		if meeting.Status == "cancelled" {
+			method = "CANCEL"
+		}
+		c.Header("Content-Disposition", `attachment; filename="meeting.ics"`)
+		c.Data(http.StatusOK, "text/calendar; charset=utf-8", meetingCalendarEvent(db, cfg, meeting, method).ICS())
+	}
+}
+
+// startMeetingCall создает групповой звонок встречи
+func startMeetingCall(db *gorm.DB, wsHub *websocket.Hub, meeting *models.Meeting, userID string) error {
+	now := time.Now()
+	call := models.GroupCall{
+		ID:        uuid.New().String(),
+		ChatID:    meeting.ChatID,
+		StartedBy: userID,
+		Type:      "video",
+		Status:    "active",
+		StartedAt: now,
+	}
+	if err := db.Create(&call).Error; err != nil {
+		return err
+	}
+	meeting.Status = "live"
+	meeting.GroupCallID = &call.ID
+	meeting.StartedAt = &now
+	db.Model(meeting).Updates(map[string]interface{}{"status": "live", "group_call_id": call.ID, "started_at": now})
+
+	if wsHub != nil {
+		wsHub.BroadcastToChat(meeting.ChatID, wsEvent("meeting:started", gin.H{
+			"meetingId": meeting.ID, "chatId": meeting.ChatID, "title": meeting.Title, "roomId": call.ID,
+		}))
+		// Допущенным заранее сообщаем, куда подключаться
+		var admitted []string
+		db.Model(&models.MeetingLobbyEntry{}).Where("meeting_id = ? AND status = ?", meeting.ID, "admitted").
+			Pluck("COALESCE(user_id, 'guest:' || id)", &admitted)
+		for _, admittedID := range admitted {
+			wsHub.SendToUser(admittedID, wsEvent("meeting:started", gin.H{"meetingId": meeting.ID, "roomId": call.ID}))
+		}
+	}
+	return nil
+}
+
+// StartMeeting организатор начинает встречу: создается групповой звонок (комната SFU)
+func StartMeeting(db *gorm.DB, wsHub *websocket.Hub, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		meeting, found := loadMeeting(c, db, userIDStr)
+		if !found {
+			return
+		}
+		if !meetingHost(meeting, userIDStr) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		if meeting.Status != "scheduled" {
+			c.JSON(http.StatusConflict, gin.H{"error": "meeting_not_scheduled"})
+			return
+		}
+		if err := startMeetingCall(db, wsHub, &meeting, userIDStr); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"meeting": meetingPayload(meeting, cfg), "roomId": *meeting.GroupCallID})
+	}
+}
+
+// endMeeting завершает встречу и ее групповой звонок
+func endMeeting(db *gorm.DB, wsHub *websocket.Hub, meeting models.Meeting) {
+	now := time.Now()
+	db.Model(&meeting).Updates(map[string]interface{}{"status": "ended", "ended_at": now})
+	db.Model(&models.MeetingLobbyEntry{}).Where("meeting_id = ? AND status = ?", meeting.ID, "waiting").
+		Update("status", "left")
+	if meeting.GroupCallID != nil {
+		db.Model(&models.GroupCall{}).Where("id = ? AND status = ?", *meeting.GroupCallID, "active").
+			Updates(map[string]interface{}{"status": "ended", "ended_at": now})
+		stopCallRecordings(db, wsHub, *meeting.GroupCallID)
+		closeSFURoom(*meeting.GroupCallID)
+	}
+	if wsHub != nil {
+		wsHub.BroadcastToChat(meeting.ChatID, wsEvent("meeting:ended", gin.H{"meetingId": meeting.ID, "chatId": meeting.ChatID}))
+	}
+}
+
+// meetingCallEnded групповой звонок опустел — встреча окончена
+func meetingCallEnded(db *gorm.DB, wsHub *websocket.Hub, callID string) {
+	var meeting models.Meeting
+	if err := db.Where("group_call_id = ? AND status = ?", callID, "live").First(&meeting).Error; err == nil {
+		endMeeting(db, wsHub, meeting)
+	}
+}
+
+// EndMeeting организатор завершает встречу для всех
+func EndMeeting(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		meeting, found := loadMeeting(c, db, userIDStr)
+		if !found {
+			return
+		}
+		if !meetingHost(meeting, userIDStr) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		if meeting.Status != "live" {
+			c.JSON(http.StatusConflict, gin.H{"error": "meeting_not_live"})
+			return
+		}
+		endMeeting(db, wsHub, meeting)
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// meetingJoinState ответ на вход: статус допуска и комната, если встреча идет
+func meetingJoinState(meeting models.Meeting, entry *models.MeetingLobbyEntry) gin.H {
+	state := gin.H{"meetingId": meeting.ID, "meetingStatus": meeting.Status, "status": "admitted"}
+	if entry != nil {
+		state["status"] = entry.Status
+		state["entryId"] = entry.ID
+	}
+	if state["status"] == "admitted" && meeting.Status == "live" && meeting.GroupCallID != nil {
+		state["roomId"] = *meeting.GroupCallID
+	}
+	return state
+}
+
+// notifyMeetingLobby сообщает организаторам об изменении очереди
+func notifyMeetingLobby(wsHub *websocket.Hub, meeting models.Meeting, entry models.MeetingLobbyEntry) {
+	if wsHub == nil {
+		return
+	}
+	wsHub.SendToUser(meeting.CreatedBy, wsEvent("meeting:lobby", gin.H{"meetingId": meeting.ID, "entry": entry}))
+}
+
+// JoinMeeting вход пользователя по ссылке встречи. Участники чата входят сразу
+// (если лобби выключено), остальные ждут допуска организатора.
+func JoinMeeting(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var meeting models.Meeting
+		if err := db.First(&meeting, "join_code = ?", c.Param("code")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		if meeting.Status == "ended" || meeting.Status == "cancelled" {
+			c.JSON(http.StatusGone, gin.H{"error": "meeting_closed"})
+			return
+		}
+		if code, expiresAt, restricted := serverRestriction(db, meeting.ChatID, userIDStr); restricted {
+			c.JSON(http.StatusForbidden, gin.H{"error": code, "expiresAt": expiresAt})
+			return
+		}
+
+		if meetingHost(meeting, userIDStr) ||
+			(!meeting.LobbyEnabled && authz.Can(userIDStr, authz.Chat(meeting.ChatID), authz.Connect)) {
+			c.JSON(http.StatusOK, meetingJoinState(meeting, nil))
+			return
+		}
+
+		var entry models.MeetingLobbyEntry
+		err := db.Where("meeting_id = ? AND user_id = ? AND status IN ?", meeting.ID, userIDStr, []string{"waiting", "admitted"}).
+			First(&entry).Error
+		if err != nil {
+			entry = models.MeetingLobbyEntry{
+				ID:        uuid.New().String(),
+				MeetingID: meeting.ID,
+				UserID:    &userIDStr,
+				Status:    "waiting",
+			}
+			if err := db.Create(&entry).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+				return
+			}
+			notifyMeetingLobby(wsHub, meeting, entry)
+		}
+		c.JSON(http.StatusOK, meetingJoinState(meeting, &entry))
+	}
+}
+
+// GetMeetingPreview публичные сведения о встрече по ссылке (для гостей)
+func GetMeetingPreview(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var meeting models.Meeting
+		if err := db.First(&meeting, "join_code = ?", c.Param("code")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"meeting": gin.H{
+			"title":         meeting.Title,
+			"startsAt":      meeting.StartsAt.Unix() * 1000,
+			"endsAt":        meeting.EndsAt.Unix() * 1000,
+			"status":        meeting.Status,
+			"guestsAllowed": meeting.GuestsAllowed,
+		}})
+	}
+}
+
+// RequestGuestJoin гость без аккаунта становится в очередь лобби.
+// Секрет из ответа нужен, чтобы узнать решение организатора.
+func RequestGuestJoin(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Name string `json:"name" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+		name := strings.TrimSpace(req.Name)
+		if name == "" || len([]rune(name)) > 64 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_name"})
+			return
+		}
+
+		var meeting models.Meeting
+		if err := db.First(&meeting, "join_code = ?", c.Param("code")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		if !meeting.GuestsAllowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "guests_not_allowed"})
+			return
+		}
+		if meeting.Status == "ended" || meeting.Status == "cancelled" {
+			c.JSON(http.StatusGone, gin.H{"error": "meeting_closed"})
+			return
+		}
+
+		var waiting int64
+		db.Model(&models.MeetingLobbyEntry{}).Where("meeting_id = ? AND status = ?", meeting.ID, "waiting").Count(&waiting)
+		if waiting >= 200 {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "lobby_full"})
+			return
+		}
+
+		secret := newInviteCode()
+		entry := models.MeetingLobbyEntry{
+			ID:         uuid.New().String(),
+			MeetingID:  meeting.ID,
+			GuestName:  name,
+			SecretHash: hashMeetingSecret(secret),
+			Status:     "waiting",
+		}
+		if err := db.Create(&entry).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		notifyMeetingLobby(wsHub, meeting, entry)
+
+		state := meetingJoinState(meeting, &entry)
+		state["secret"] = secret
+		c.JSON(http.StatusCreated, state)
+	}
+}
+
+// GetGuestLobbyStatus гость узнает решение организатора; после допуска
+// получает гостевой токен для WebSocket и комнату SFU
+func GetGuestLobbyStatus(db *gorm.DB, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var meeting models.Meeting
+		if err := db.First(&meeting, "join_code = ?", c.Param("code")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		var entry models.MeetingLobbyEntry
+		if err := db.Where("id = ? AND meeting_id = ? AND user_id IS NULL", c.Param("entryId"), meeting.ID).First(&entry).Error; err != nil ||
+			entry.SecretHash != hashMeetingSecret(c.Query("secret")) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+
+		state := meetingJoinState(meeting, &entry)
+		if entry.Status == "admitted" && meeting.Status != "ended" && meeting.Status != "cancelled" {
+			expiresAt := meeting.EndsAt.Add(meetingGuestTTL)
+			if minExpiry := time.Now().Add(meetingGuestTTL); expiresAt.Before(minExpiry) {
+				expiresAt = minExpiry
+			}
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+				"sub":       guestPrefix + entry.ID,
+				"username":  entry.GuestName,
+				"guest":     true,
+				"meetingId": meeting.ID,
+				"exp":       expiresAt.Unix(),
+			})
+			tokenString, err := token.SignedString([]byte(cfg.JWTSecret))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+				return
+			}
+			state["token"] = tokenString
+			state["userId"] = guestPrefix + entry.ID
+		}
+		c.JSON(http.StatusOK, state)
+	}
+}
+
+// GetMeetingLobby очередь лобби для организатора
+func GetMeetingLobby(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		meeting, found := loadMeeting(c, db, userIDStr)
+		if !found {
+			return
+		}
+		if !meetingHost(meeting, userIDStr) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var entries []models.MeetingLobbyEntry
+		db.Where("meeting_id = ? AND status = ?", meeting.ID, "waiting").Order("created_at ASC").Find(&entries)
+
+		var userIDs []string
+		for _, entry := range entries {
+			if entry.UserID != nil {
+				userIDs = append(userIDs, *entry.UserID)
+			}
+		}
+		usernames := make(map[string]models.User)
+		if len(userIDs) > 0 {
+			var users []models.User
+			db.Where("id IN ?", userIDs).Find(&users)
+			for _, user := range users {
+				usernames[user.ID] = user
+			}
+		}
+		view := newPrivacyView(db, userIDStr, userIDs)
+
+		result := make([]gin.H, len(entries))
+		for i, entry := range entries {
+			item := gin.H{"id": entry.ID, "guest": entry.UserID == nil, "name": entry.GuestName, "createdAt": entry.CreatedAt}
+			if entry.UserID != nil {
+				user := usernames[*entry.UserID]
+				item["userId"] = user.ID
+				item["name"] = user.Username
+				item["avatarUrl"] = view.avatar(user)
+			}
+			result[i] = item
+		}
+		c.JSON(http.StatusOK, gin.H{"lobby": result})
+	}
+}
+
+// DecideMeetingLobby организатор допускает или отклоняет ожидающего
+func DecideMeetingLobby(db *gorm.DB, wsHub *websocket.Hub, admit bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		meeting, found := loadMeeting(c, db, userIDStr)
+		if !found {
+			return
+		}
+		if !meetingHost(meeting, userIDStr) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var entry models.MeetingLobbyEntry
+		if err := db.Where("id = ? AND meeting_id = ?", c.Param("entryId"), meeting.ID).First(&entry).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		if entry.Status != "waiting" && !(entry.Status == "admitted" && !admit) {
+			c.JSON(http.StatusConflict, gin.H{"error": "already_decided"})
+			return
+		}
+
+		now := time.Now()
+		entry.Status = "denied"
+		eventType := "meeting:denied"
+		if admit {
+			entry.Status = "admitted"
+			eventType = "meeting:admitted"
+		}
+		entry.DecidedBy = userIDStr
+		entry.DecidedAt = &now
+		db.Model(&entry).Updates(map[string]interface{}{"status": entry.Status, "decided_by": userIDStr, "decided_at": now})
+
+		// Отклоненный после допуска покидает звонок
+		participantID := guestPrefix + entry.ID
+		if entry.UserID != nil {
+			participantID = *entry.UserID
+		}
+		if !admit && meeting.GroupCallID != nil && sfuManager != nil {
+			sfuManager.Kick(*meeting.GroupCallID, participantID)
+		}
+		if wsHub != nil {
+			wsHub.SendToUser(participantID, wsEvent(eventType, meetingJoinState(meeting, &entry)))
+		}
+		notifyMeetingLobby(wsHub, meeting, entry)
+		c.JSON(http.StatusOK, gin.H{"entry": entry})
+	}
+}
+
+// meetingForCall встреча, идущая в групповом звонке
+func meetingForCall(db *gorm.DB, callID string) (models.Meeting, bool) {
+	var meeting models.Meeting
+	err := db.Where("group_call_id = ? AND status = ?", callID, "live").First(&meeting).Error
+	return meeting, err == nil
+}
+
+// meetingAdmitted может ли пользователь или гость подключиться к звонку встречи
+func meetingAdmitted(db *gorm.DB, meeting models.Meeting, userID string) bool {
+	if isGuest(userID) {
+		var count int64
+		db.Model(&models.MeetingLobbyEntry{}).
+			Where("id = ? AND meeting_id = ? AND status = ?", strings.TrimPrefix(userID, guestPrefix), meeting.ID, "admitted").
+			Count(&count)
+		return count > 0
+	}
+	if meetingHost(meeting, userID) {
+		return true
+	}
+	if !meeting.LobbyEnabled && authz.Can(userID, authz.Chat(meeting.ChatID), authz.Connect) {
+		return true
+	}
+	var count int64
+	db.Model(&models.MeetingLobbyEntry{}).
+		Where("meeting_id = ? AND user_id = ? AND status = ?", meeting.ID, userID, "admitted").
+		Count(&count)
+	return count > 0
+}
+
+// StartMeetingReminders раз в минуту напоминает о встречах, которые скоро начнутся
+func StartMeetingReminders(db *gorm.DB, wsHub *websocket.Hub, cfg *config.Config) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		now := time.Now()
+		var meetings []models.Meeting
+		db.Where("status = ? AND reminder_sent_at IS NULL AND starts_at > ? AND starts_at <= ? + reminder_minutes * interval '1 minute'",
+			"scheduled", now.Add(-time.Hour), now).
+			Find(&meetings)
+
+		for _, meeting := range meetings {
+			res := db.Model(&models.Meeting{}).
+				Where("id = ? AND reminder_sent_at IS NULL", meeting.ID).
+				Update("reminder_sent_at", now)
+			if res.RowsAffected == 0 {
+				continue
+			}
+			notifyMeetingUsers(db, wsHub, meeting, "meeting:reminder", "Скоро встреча")
+
+			var invitees []models.MeetingInvitee
+			db.Where("meeting_id = ? AND response <> ?", meeting.ID, "declined").Find(&invitees)
+			link := meetingLink(cfg, meeting)
+			startsAt := meeting.StartsAt.Format("02.01.2006 в 15:04 MST")
+			for _, invitee := range invitees {
+				if to, name := meetingEmailRecipient(db, invitee); to != "" {
+					if err := email.SendMeetingReminder(to, name, meeting.Title, startsAt, link); err != nil {
+						log.Printf("Failed to send meeting reminder to %s: %v", to, err)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"safegram-server/internal/authz"
+	"safegram-server/internal/models"
+	"safegram-server/internal/redis"
+)
+
+// Виды упоминаний
+const (
+	mentionUser     = "user"
+	mentionRole     = "role"
+	mentionEveryone = "everyone"
+	mentionHere     = "here"
+)
+
+// mentionPattern @имя, не являющееся частью слова или адреса почты
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@.])@([\p{L}\p{N}_][\p{L}\p{N}_.\-]{0,63})`)
+
+// mentionEntity упоминание в тексте; offset и length — в UTF-16 code units, как у клиентов
+type mentionEntity struct {
+	Type   string `json:"type"` // user | role | everyone | here
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	UserID string `json:"userId,omitempty"`
+	RoleID string `json:"roleId,omitempty"`
+}
+
+// parsedMentions упоминания сообщения и получатели: userID → вид упоминания
+type parsedMentions struct {
+	Entities   []mentionEntity
+	Recipients map[string]string
+}
+
+// utf16Len длина строки в UTF-16 code units
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+// mentionRank приоритет вида упоминания для получателя: прямое важнее массового
+func mentionRank(kind string) int {
+	switch kind {
+	case mentionUser:
+		return 3
+	case mentionRole:
+		return 2
+	case mentionHere:
+		return 1
+	}
+	return 0
+}
+
+// mentionMatch @имя в тексте: байтовые границы вместе с @ и имя в нижнем регистре
+type mentionMatch struct {
+	start, end int
+	name       string
+}
+
+// findMentions находит @имена в тексте; точки и дефисы в конце имени — пунктуация
+func findMentions(text string) []mentionMatch {
+	matches := mentionPattern.FindAllStringSubmatchIndex(text, -1)
+	found := make([]mentionMatch, 0, len(matches))
+	for _, m := range matches {
+		name := strings.TrimRight(text[m[2]:m[3]], ".-")
+		found = append(found, mentionMatch{start: m[2] - 1, end: m[2] + len(name), name: strings.ToLower(name)})
+	}
+	return found
+}
+
+// entity упоминание с границами в UTF-16 code units
+func (m mentionMatch) entity(text string) mentionEntity {
+	return mentionEntity{Offset: utf16Len(text[:m.start]), Length: utf16Len(text[m.start:m.end])}
+}
+
+// parseMentions находит упоминания участников, ролей и @everyone/@here (только с правом mention_everyone)
+func parseMentions(db *gorm.DB, chatID, senderID string, perms authz.Permission, text string) parsedMentions {
+	result := parsedMentions{Entities: make([]mentionEntity, 0), Recipients: make(map[string]string)}
+	found := findMentions(text)
+	if len(found) == 0 {
+		return result
+	}
+	names := make([]string, 0, len(found))
+	for _, m := range found {
+		names = append(names, m.name)
+	}
+
+	var users []models.User
+	db.Table("users").Select("users.id, users.username").
+		Joins("JOIN chat_members m ON m.user_id = users.id AND m.chat_id = ? AND m.deleted_at IS NULL", chatID).
+		Where("LOWER(users.username) IN ?", names).
+		Scan(&users)
+	userByName := make(map[string]string, len(users))
+	for _, user := range users {
+		userByName[strings.ToLower(user.Username)] = user.ID
+	}
+
+	scopeType, scopeID := "chat", chatID
+	if serverID := serverIDForChat(db, chatID); serverID != "" {
+		scopeType, scopeID = "server", serverID
+	}
+	var roles []models.Role
+	db.Where("scope_type = ? AND scope_id = ? AND is_default = ? AND LOWER(name) IN ?", scopeType, scopeID, false, names).Find(&roles)
+	roleByName := make(map[string]string, len(roles))
+	for _, role := range roles {
+		roleByName[strings.ToLower(role.Name)] = role.ID
+	}
+
+	canMentionAll := perms.Has(authz.MentionEveryone)
+	mentionedUsers := make([]string, 0)
+	mentionedRoles := make([]string, 0)
+	everyone, here := false, false
+	for _, m := range found {
+		entity := m.entity(text)
+		switch {
+		case (m.name == mentionEveryone || m.name == mentionHere) && canMentionAll:
+			entity.Type = m.name
+			everyone = everyone || m.name == mentionEveryone
+			here = here || m.name == mentionHere
+		case userByName[m.name] != "":
+			entity.Type = mentionUser
+			entity.UserID = userByName[m.name]
+			mentionedUsers = append(mentionedUsers, entity.UserID)
+		case roleByName[m.name] != "":
+			entity.Type = mentionRole
+			entity.RoleID = roleByName[m.name]
+			mentionedRoles = append(mentionedRoles, entity.RoleID)
+		default:
+			continue
+		}
+		result.Entities = append(result.Entities, entity)
+	}
+
+	add := func(userIDs []string, kind string) {
+		for _, id := range userIDs {
+			if id == senderID {
+				continue
+			}
+			if current, ok := result.Recipients[id]; !ok || mentionRank(kind) > mentionRank(current) {
+				result.Recipients[id] = kind
+			}
+		}
+	}
+
+	if everyone || here {
+		var memberIDs []string
+		db.Model(&models.ChatMember{}).Where("chat_id = ?", chatID).Pluck("user_id", &memberIDs)
+		if everyone {
+			add(memberIDs, mentionEveryone)
+		} else if online, err := redis.OnlineAmong(memberIDs); err == nil {
+			onlineIDs := make([]string, 0, len(online))
+			for id := range online {
+				onlineIDs = append(onlineIDs, id)
+			}
+			add(onlineIDs, mentionHere)
+		}
+	}
+	if len(mentionedRoles) > 0 {
+		var roleMembers []string
+		db.Model(&models.MemberRole{}).
+			Joins("JOIN chat_members m ON m.user_id = member_roles.user_id AND m.chat_id = ? AND m.deleted_at IS NULL", chatID).
+			Where("member_roles.role_id IN ?", mentionedRoles).
+			Distinct().
+			Pluck("member_roles.user_id", &roleMembers)
+		add(roleMembers, mentionRole)
+	}
+	add(mentionedUsers, mentionUser)
+	return result
+}
+
+// encodeMentions JSON сущностей для Message.MentionsJSON
+func encodeMentions(parsed parsedMentions) string {
+	if len(parsed.Entities) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(parsed.Entities)
+	return string(data)
+}
+
+// messageMentions сущности упоминаний сообщения
+func messageMentions(message models.Message) []mentionEntity {
+	entities := make([]mentionEntity, 0)
+	if message.MentionsJSON != "" {
+		json.Unmarshal([]byte(message.MentionsJSON), &entities)
+	}
+	return entities
+}
+
+// saveMentionRecipients заменяет получателей упоминаний сообщения
+func saveMentionRecipients(db *gorm.DB, message models.Message, parsed parsedMentions) error {
+	if err := db.Where("message_id = ?", message.ID).Delete(&models.MessageMention{}).Error; err != nil {
+		return err
+	}
+	if len(parsed.Recipients) == 0 {
+		return nil
+	}
+	rows := make([]models.MessageMention, 0, len(parsed.Recipients))
+	for userID, kind := range parsed.Recipients {
+		rows = append(rows, models.MessageMention{
+			ID:        uuid.New().String(),
+			MessageID: message.ID,
+			UserID:    userID,
+			ChatID:    message.ChatID,
+			Kind:      kind,
+			CreatedAt: message.CreatedAt,
+		})
+	}
+	return db.CreateInBatches(rows, 500).Error
+}
+
+// messageMentionKinds получатели упоминаний сообщения: userID → вид
+func messageMentionKinds(db *gorm.DB, messageID string) map[string]string {
+	var rows []models.MessageMention
+	db.Select("user_id", "kind").Where("message_id = ?", messageID).Find(&rows)
+	kinds := make(map[string]string, len(rows))
+	for _, row := range rows {
+		kinds[row.UserID] = row.Kind
+	}
+	return kinds
+}
+
+// unreadMentionsAfter непрочитанные упоминания пользователя в ленте чата после момента after
+func unreadMentionsAfter(db *gorm.DB, chatID, userID string, after time.Time) int64 {
+	var count int64
+	db.Table("message_mentions mm").
+		Joins("JOIN messages msg ON msg.id = mm.message_id").
+		Where("mm.chat_id = ? AND mm.user_id = ? AND msg.deleted_at IS NULL AND msg.moderation_status = 'approved' AND msg.created_at > ?", chatID, userID, after).
+		Where("COALESCE(msg.thread_id, '') = ''").
+		Count(&count)
+	return count
+}
+
+// firstUnreadMention самое раннее непрочитанное упоминание пользователя в чате ("" — нет)
+func firstUnreadMention(db *gorm.DB, chatID, userID string) string {
+	var ids []string
+	db.Table("message_mentions mm").
+		Joins("JOIN messages msg ON msg.id = mm.message_id AND msg.deleted_at IS NULL AND msg.moderation_status = 'approved'").
+		Joins("JOIN chat_members m ON m.chat_id = mm.chat_id AND m.user_id = mm.user_id AND m.deleted_at IS NULL").
+		Where("mm.chat_id = ? AND mm.user_id = ?", chatID, userID).
+		Where("msg.created_at > COALESCE((SELECT lr.created_at FROM messages lr WHERE lr.id = m.last_read_message_id), '-infinity'::timestamptz)").
+		Where("COALESCE(msg.thread_id, '') = ''").
+		Order("msg.created_at ASC").
+		Limit(1).
+		Pluck("mm.message_id", &ids)
+	if len(ids) == 0 {
+		return ""
+	}
+	return ids[0]
+}
+
+// GetMentions входящие упоминания текущего пользователя по всем чатам.
+// Параметры: unread=true, limit, before (мс) — упоминания раньше момента
+func GetMentions(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		limit := 50
+		if parsedLimit := parseInt(c.Query("limit")); parsedLimit > 0 && parsedLimit <= 200 {
+			limit = parsedLimit
+		}
+
+		// Упоминание в треде прочитано по курсору треда, в ленте — по курсору чата
+		const readPosition = "CASE WHEN COALESCE(msg.thread_id, '') = '' " +
+			"THEN COALESCE((SELECT lr.created_at FROM messages lr WHERE lr.id = m.last_read_message_id), '-infinity'::timestamptz) " +
+			"ELSE COALESCE((SELECT lr.created_at FROM messages lr WHERE lr.id = tf.last_read_message_id), '-infinity'::timestamptz) END"
+		query := db.Table("message_mentions mm").
+			Select("mm.id, mm.message_id, mm.chat_id, mm.kind, mm.created_at, msg.created_at <= "+readPosition+" AS is_read").
+			Joins("JOIN messages msg ON msg.id = mm.message_id AND msg.deleted_at IS NULL AND msg.moderation_status = 'approved'").
+			Joins("JOIN chat_members m ON m.chat_id = mm.chat_id AND m.user_id = mm.user_id AND m.deleted_at IS NULL").
+			Joins("LEFT JOIN thread_followers tf ON tf.thread_id = msg.thread_id AND tf.user_id = mm.user_id").
+			Where("mm.user_id = ?", userIDStr)
+		if c.Query("unread") == "true" {
+			query = query.Where("msg.created_at > " + readPosition)
+		}
+		if before := c.Query("before"); before != "" {
+			ms, err := strconv.ParseInt(before, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+				return
+			}
+			query = query.Where("mm.created_at < ?", time.UnixMilli(ms))
+		}
+
+		var rows []struct {
+			ID        string
+			MessageID string
+			ChatID    string
+			Kind      string
+			CreatedAt time.Time
+			IsRead    bool
+		}
+		if err := query.Order("mm.created_at DESC").Limit(limit).Scan(&rows).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		messageIDs := make([]string, len(rows))
+		chatIDs := make([]string, 0, len(rows))
+		for i, row := range rows {
+			messageIDs[i] = row.MessageID
+			chatIDs = append(chatIDs, row.ChatID)
+		}
+		messages := make(map[string]models.Message, len(rows))
+		chats := make(map[string]models.Chat)
+		var list []models.Message
+		if len(rows) > 0 {
+			db.Where("id IN ?", messageIDs).Preload("Sender").Find(&list)
+			for _, message := range list {
+				messages[message.ID] = message
+			}
+			var chatList []models.Chat
+			db.Select("id", "type", "name", "avatar_url").Where("id IN ?", chatIDs).Find(&chatList)
+			for _, chat := range chatList {
+				chats[chat.ID] = chat
+			}
+		}
+
+		senders := senderPrivacyView(db, userIDStr, list)
+		result := make([]gin.H, 0, len(rows))
+		for _, row := range rows {
+			message, ok := messages[row.MessageID]
+			if !ok {
+				continue
+			}
+			chat := chats[row.ChatID]
+			result = append(result, gin.H{
+				"id":        row.ID,
+				"kind":      row.Kind,
+				"isRead":    row.IsRead,
+				"createdAt": row.CreatedAt,
+				"chat": gin.H{
+					"id":        chat.ID,
+					"type":      chat.Type,
+					"name":      chat.Name,
+					"avatarUrl": chat.AvatarURL,
+				},
+				"message": gin.H{
+					"id":       message.ID,
+					"chatId":   message.ChatID,
+					"threadId": message.ThreadID,
+					"senderId": message.SenderID,
+					"text":     message.Text,
+					"mentions": messageMentions(message),
+					"entities": messageEntities(message),
+					"sender": gin.H{
+						"id":        message.Sender.ID,
+						"username":  message.Sender.Username,
+						"avatarUrl": senders.avatar(message.Sender),
+					},
+					"createdAt": message.CreatedAt,
+				},
+			})
+		}
+
+		response := gin.H{"mentions": result}
+		if len(rows) == limit {
+			response["nextBefore"] = rows[len(rows)-1].CreatedAt.UnixMilli()
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindMentions(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		want     []string
+		entities []mentionEntity // границы в UTF-16
+	}{
+		{"в начале текста", "@alice привет", []string{"alice"}, []mentionEntity{{Offset: 0, Length: 6}}},
+		{"регистр не важен", "hi @Bob", []string{"bob"}, []mentionEntity{{Offset: 3, Length: 4}}},
+		{"точка в конце — пунктуация", "спасибо, @bob.", []string{"bob"}, []mentionEntity{{Offset: 9, Length: 4}}},
+		{"дефис в конце — пунктуация", "@иван- смотри", []string{"иван"}, []mentionEntity{{Offset: 0, Length: 5}}},
+		{"точка внутри имени", "@john.doe", []string{"john.doe"}, []mentionEntity{{Offset: 0, Length: 9}}},
+		{"в скобках", "(@team)", []string{"team"}, []mentionEntity{{Offset: 1, Length: 5}}},
+		{"несколько", "@a и @b", []string{"a", "b"}, []mentionEntity{{Offset: 0, Length: 2}, {Offset: 5, Length: 2}}},
+		{"после эмодзи из суррогатной пары", "😀 @anna", []string{"anna"}, []mentionEntity{{Offset: 3, Length: 5}}},
+		{"адрес почты", "пиши на a@example.com", nil, nil},
+		{"часть слова", "foo_@bar", nil, nil},
+		{"двойной @", "@@admin", nil, nil},
+		{"без имени", "@ и всё", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found := findMentions(tt.text)
+			var names []string
+			var entities []mentionEntity
+			for _, m := range found {
+				if tt.text[m.start] != '@' {
+					t.Errorf("упоминание начинается с %q, а не с @", tt.text[m.start])
+				}
+				names = append(names, m.name)
+				entities = append(entities, m.entity(tt.text))
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("findMentions(%q) = %v, want %v", tt.text, names, tt.want)
+			}
+			if !reflect.DeepEqual(entities, tt.entities) {
+				t.Errorf("entities(%q) = %+v, want %+v", tt.text, entities, tt.entities)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"safegram-server/internal/authz"
+	"safegram-server/internal/models"
+	"safegram-server/internal/websocket"
+)
+
+const (
+	maxDeleteReasonLength = 500
+	maxMessageWindow      = 365 * 24 * 60 * 60 // Секунд: окно редактирования и удаления не больше года
+	maxTombstonesPage     = 500
+)
+
+// notHiddenSQL исключает сообщения, которые пользователь удалил только у себя
+const notHiddenSQL = "NOT EXISTS (SELECT 1 FROM hidden_messages h WHERE h.message_id = messages.id AND h.user_id = ?)"
+
+// messagePolicy окна редактирования и удаления чата
+func messagePolicy(db *gorm.DB, chatID string) models.Chat {
+	var chat models.Chat
+	db.Select("id", "edit_window", "delete_window").First(&chat, "id = ?", chatID)
+	return chat
+}
+
+// withinWindow сообщение, созданное в createdAt, еще в окне seconds (0 — без ограничения)
+func withinWindow(seconds int, createdAt time.Time) bool {
+	return seconds <= 0 || time.Since(createdAt) <= time.Duration(seconds)*time.Second
+}
+
+// saveRevision сохраняет текущую версию сообщения перед редактированием
+func saveRevision(tx *gorm.DB, message models.Message) error {
+	authoredAt := message.CreatedAt
+	if message.EditedAt != nil {
+		authoredAt = *message.EditedAt
+	}
+	return tx.Create(&models.MessageRevision{
+		ID:           uuid.New().String(),
+		MessageID:    message.ID,
+		Revision:     message.RevisionCount + 1,
+		ChatID:       message.ChatID,
+		Text:         message.Text,
+		EntitiesJSON: message.EntitiesJSON,
+		AuthoredAt:   authoredAt,
+	}).Error
+}
+
+// messageTombstone событие удаления сообщения у всех, достаточное для применения к локальной копии
+func messageTombstone(message models.Message) gin.H {
+	return gin.H{
+		"messageId":    message.ID,
+		"chatId":       message.ChatID,
+		"threadId":     message.ThreadID,
+		"deletedAt":    message.DeletedAt,
+		"deletedBy":    message.DeletedBy,
+		"deleteForAll": true,
+	}
+}
+
+// hideMessage скрывает сообщение у пользователя и сообщает об этом его устройствам
+func hideMessage(db *gorm.DB, wsHub *websocket.Hub, message models.Message, userID string) {
+	var existing models.HiddenMessage
+	if err := db.Where("user_id = ? AND message_id = ?", userID, message.ID).First(&existing).Error; err == nil {
+		return
+	}
+	hidden := models.HiddenMessage{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		MessageID: message.ID,
+		ChatID:    message.ChatID,
+	}
+	if err := db.Create(&hidden).Error; err != nil {
+		return
+	}
+	wsHub.SendToUser(userID, wsEvent("message:delete", gin.H{
+		"messageId":    message.ID,
+		"chatId":       message.ChatID,
+		"threadId":     message.ThreadID,
+		"deletedAt":    hidden.CreatedAt,
+		"deleteForAll": false,
+	}))
+}
+
+// GetMessageRevisions возвращает прежние версии сообщения и текущую.
+// История удаленного сообщения доступна только модераторам
+func GetMessageRevisions(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var message models.Message
+		if err := db.First(&message, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		perms := authz.Permissions(userIDStr, authz.Chat(message.ChatID))
+		if !perms.Has(authz.ViewChannel | authz.ReadHistory) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		moderator := perms.Has(authz.ManageMessages)
+		if (message.DeletedAt != nil || message.ModerationStatus != "approved" && message.SenderID != userIDStr) && !moderator {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+
+		var revisions []models.MessageRevision
+		if err := db.Where("message_id = ?", message.ID).Order("revision ASC").Find(&revisions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		result := make([]gin.H, len(revisions))
+		for i, revision := range revisions {
+			result[i] = gin.H{
+				"revision":   revision.Revision,
+				"text":       revision.Text,
+				"entities":   messageFormatting(models.Message{Text: revision.Text, EntitiesJSON: revision.EntitiesJSON}),
+				"authoredAt": revision.AuthoredAt,
+				"replacedAt": revision.CreatedAt,
+			}
+		}
+
+		current := gin.H{
+			"revision":   message.RevisionCount + 1,
+			"text":       message.Text,
+			"entities":   messageFormatting(message),
+			"authoredAt": message.CreatedAt,
+		}
+		if message.EditedAt != nil {
+			current["authoredAt"] = message.EditedAt
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"messageId": message.ID,
+			"revisions": result,
+			"current":   current,
+			"deletedAt": message.DeletedAt,
+		})
+	}
+}
+
+// UpdateChatMessagePolicy задает окна редактирования и удаления у всех (в секундах, 0 — без ограничения).
+// В личном чате это может сделать любой из собеседников
+func UpdateChatMessagePolicy(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		chatID := c.Param("id")
+		var chat models.Chat
+		if err := db.First(&chat, "id = ?", chatID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		allowed := authz.Can(userIDStr, authz.Chat(chatID), authz.ManageSettings)
+		if chat.Type == "dm" {
+			allowed = authz.IsMember(userIDStr, authz.Chat(chatID))
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var req struct {
+			EditWindow   *int `json:"editWindow"`
+			DeleteWindow *int `json:"deleteWindow"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		updates := make(map[string]interface{})
+		for column, value := range map[string]*int{"edit_window": req.EditWindow, "delete_window": req.DeleteWindow} {
+			if value == nil {
+				continue
+			}
+			if *value < 0 || *value > maxMessageWindow {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_window", "max": maxMessageWindow})
+				return
+			}
+			updates[column] = *value
+		}
+		if len(updates) > 0 {
+			if err := db.Model(&chat).Updates(updates).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+				return
+			}
+			if chat.Type != "dm" {
+				logModeration(db, chatID, "", userIDStr, "message_policy_updated", "", "", updates)
+			}
+			db.First(&chat, "id = ?", chatID)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"editWindow": chat.EditWindow, "deleteWindow": chat.DeleteWindow})
+	}
+}
+
+// GetChatTombstones надгробия для офлайн-синхронизации: сообщения, удаленные у всех
+// или скрытые текущим пользователем после since (мс), по возрастанию времени удаления
+func GetChatTombstones(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		chatID := c.Param("id")
+		if !authz.Can(userIDStr, authz.Chat(chatID), authz.ViewChannel|authz.ReadHistory) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		ms, err := strconv.ParseInt(c.Query("since"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "detail": "since is required"})
+			return
+		}
+		since := time.UnixMilli(ms)
+
+		var deleted []models.Message
+		db.Select("id", "chat_id", "thread_id", "deleted_at", "deleted_by").
+			Where("chat_id = ? AND deleted_at > ?", chatID, since).
+			Order("deleted_at ASC").Limit(maxTombstonesPage).Find(&deleted)
+		var hidden []models.HiddenMessage
+		db.Where("chat_id = ? AND user_id = ? AND created_at > ?", chatID, userIDStr, since).
+			Order("created_at ASC").Limit(maxTombstonesPage).Find(&hidden)
+
+		type tombstone struct {
+			at   time.Time
+			data gin.H
+		}
+		items := make([]tombstone, 0, len(deleted)+len(hidden))
+		for _, message := range deleted {
+			items = append(items, tombstone{*message.DeletedAt, messageTombstone(message)})
+		}
+		for _, h := range hidden {
+			items = append(items, tombstone{h.CreatedAt, gin.H{
+				"messageId":    h.MessageID,
+				"chatId":       h.ChatID,
+				"deletedAt":    h.CreatedAt,
+				"deleteForAll": false,
+			}})
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].at.Before(items[j].at) })
+		if len(items) > maxTombstonesPage {
+			items = items[:maxTombstonesPage]
+		}
+
+		result := make([]gin.H, len(items))
+		for i, item := range items {
+			result[i] = item.data
+		}
+		response := gin.H{"tombstones": result}
+		if len(items) == maxTombstonesPage {
+			response["nextSince"] = items[len(items)-1].at.UnixMilli()
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
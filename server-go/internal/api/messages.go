@@ -3,16 +3,39 @@ package api
 import (
 	"encoding/json"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"safegram-server/internal/authz"
 	"safegram-server/internal/models"
 	"safegram-server/internal/websocket"
 )
 
+// sendRestriction проверяет бан и мут в чате, бан и таймаут на сервере канала.
+// Возвращает тело ошибки или nil, если писать в чат можно
+func sendRestriction(db *gorm.DB, chatID, userID string) gin.H {
+	now := time.Now()
+	var activeBan models.ChatBan
+	if err := db.Where("chat_id = ? AND user_id = ? AND (expires_at IS NULL OR expires_at > ?)", chatID, userID, now).
+		First(&activeBan).Error; err == nil {
+		return gin.H{"error": "banned", "expiresAt": activeBan.ExpiresAt}
+	}
+
+	// Бан или таймаут на сервере действует во всех его каналах
+	if code, expiresAt, restricted := serverRestriction(db, chatID, userID); restricted {
+		return gin.H{"error": code, "expiresAt": expiresAt}
+	}
+
+	var activeMute models.ChatMute
+	if err := db.Where("chat_id = ? AND user_id = ? AND (expires_at IS NULL OR expires_at > ?)", chatID, userID, now).
+		First(&activeMute).Error; err == nil {
+		return gin.H{"error": "muted", "expiresAt": activeMute.ExpiresAt}
+	}
+	return nil
+}
+
 // CreateMessage создает новое сообщение
 func CreateMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -36,13 +59,10 @@ func CreateMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 			LocationLon   *float64 `json:"locationLon"`
 			ThreadID      string  `json:"threadId"`
 			ExpiresMs     *int64  `json:"expiresMs"` // Время жизни сообщения в миллисекундах
+			Entities      []textEntity `json:"entities"`  // Форматирование текста (offset/length в UTF-16)
+			ParseMode     string  `json:"parseMode"` // markdown — разобрать разметку в тексте
 			// Новые типы сообщений
-			Poll          *struct {
-				Question string   `json:"question"`
-				Options  []struct {
-					Text string `json:"text"`
-				} `json:"options"`
-			} `json:"poll,omitempty"`
+			Poll          *pollRequest `json:"poll,omitempty"`
 			CalendarEvent *struct {
 				Title       string `json:"title"`
 				StartTime   string `json:"startTime"`
@@ -86,49 +106,55 @@ func CreateMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
+		perms := authz.Permissions(userIDStr, authz.Chat(req.ChatID))
+		if !perms.Has(authz.SendMessages) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden", "detail": "cannot_send_messages"})
+			return
+		}
+		if dmBlocked(db, req.ChatID, userIDStr) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "blocked"})
+			return
+		}
+		if (req.AttachmentURL != "" || req.Document != nil) && !perms.Has(authz.AttachFiles) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden", "detail": "cannot_attach_files"})
+			return
+		}
 
-		// Проверяем активный бан в чате
-		now := time.Now()
-		var activeBan models.ChatBan
-		if err := db.Where("chat_id = ? AND user_id = ? AND (expires_at IS NULL OR expires_at > ?)", req.ChatID, userIDStr, now).
-			First(&activeBan).Error; err == nil {
-			c.JSON(http.StatusForbidden, gin.H{
-				"error":     "banned",
-				"expiresAt": activeBan.ExpiresAt,
-			})
+		if restriction := sendRestriction(db, req.ChatID, userIDStr); restriction != nil {
+			c.JSON(http.StatusForbidden, restriction)
 			return
 		}
 
-		// Настройки автомодерации
-		var modSettings models.ChatModerationSettings
-		hasModSettings := db.Where("chat_id = ?", req.ChatID).First(&modSettings).Error == nil
-		violation := ""
-		if hasModSettings && modSettings.Enabled {
-			maxMsgs := modSettings.MaxMsgsPer10s
-			if maxMsgs <= 0 {
-				maxMsgs = 8
+		// Ответ в тред: тред этого чата, в закрытый тред пишут только модераторы
+		if req.ThreadID != "" {
+			var thread models.Thread
+			if err := db.First(&thread, "id = ? AND chat_id = ?", req.ThreadID, req.ChatID).Error; err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "thread_not_found"})
+				return
 			}
-			var cnt int64
-			db.Model(&models.Message{}).
-				Where("chat_id = ? AND sender_id = ? AND created_at > ?", req.ChatID, userIDStr, now.Add(-10*time.Second)).
-				Count(&cnt)
-			if cnt >= int64(maxMsgs) {
-				violation = "spam"
+			if thread.LockedAt != nil && !perms.Has(authz.ManageMessages) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "thread_locked"})
+				return
 			}
+		}
 
-			// фильтр запрещенных слов работает только для незашифрованного текста
-			if violation == "" && req.Text != "" && modSettings.BannedWords != "" {
-				lower := strings.ToLower(req.Text)
-				for _, w := range strings.Split(modSettings.BannedWords, ",") {
-					w = strings.TrimSpace(strings.ToLower(w))
-					if w != "" && strings.Contains(lower, w) {
-						violation = "banned_word"
-						break
-					}
-				}
+		// Форматирование: разметка разбирается до автомодерации, чтобы проверялся итоговый текст
+		var entities []textEntity
+		if req.Text != "" && req.Ciphertext == "" {
+			var errBody gin.H
+			req.Text, entities, errBody = formatMessageText(req.Text, req.ParseMode, req.Entities)
+			if errBody != nil {
+				c.JSON(http.StatusBadRequest, errBody)
+				return
 			}
 		}
 
+		// Правила автомодерации (модераторы не проверяются)
+		var verdict automodVerdict
+		if !perms.Has(authz.ManageMessages) {
+			verdict = evaluateAutomod(db, req.ChatID, userIDStr, req.Text, time.Now())
+		}
+
 		// Если пересылка, загружаем исходное сообщение
 		var forwardFromChatID string
 		if req.ForwardFrom != "" {
@@ -142,27 +168,13 @@ func CreateMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 		var pollID string
 		
 		// Обработка опроса
-		if req.Poll != nil && req.Poll.Question != "" && len(req.Poll.Options) > 0 {
-			pollID = uuid.New().String()
-			poll := models.Poll{
-				ID:        pollID,
-				ChatID:    req.ChatID,
-				MessageID: messageID,
-				Question:  req.Poll.Question,
-				CreatedBy: userIDStr,
-			}
-			
-			// Создаем опции
-			for i, opt := range req.Poll.Options {
-				if opt.Text != "" {
-					poll.Options = append(poll.Options, models.PollOption{
-						ID:     uuid.New().String(),
-						PollID: pollID,
-						Text:   opt.Text,
-						Order:  i,
-					})
-				}
+		if req.Poll != nil {
+			poll, errBody := buildPoll(*req.Poll, req.ChatID, messageID, userIDStr)
+			if errBody != nil {
+				c.JSON(http.StatusBadRequest, errBody)
+				return
 			}
+			pollID = poll.ID
 			
 			if err := db.Create(&poll).Error; err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error", "detail": err.Error()})
@@ -223,65 +235,40 @@ func CreateMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 			message.ExpiresAt = &expiresAt
 		}
 
-		// Применяем автомодерацию (до сохранения)
-		if violation != "" && hasModSettings && modSettings.Enabled {
-			message.ModerationReason = violation
-			if modSettings.QueueOnViolation {
-				message.ModerationStatus = "pending"
-			} else {
-				message.ModerationStatus = "rejected"
-			}
+		// Форматирование и упоминания (текст зашифрованных сообщений серверу недоступен)
+		var mentions parsedMentions
+		if message.Text != "" && message.Ciphertext == "" {
+			message.EntitiesJSON = encodeEntities(entities)
+			mentions = parseMentions(db, req.ChatID, userIDStr, perms, maskCode(message.Text, entities))
+			message.MentionsJSON = encodeMentions(mentions)
+		}
 
-			// предупреждение
-			_ = db.Create(&models.ChatWarning{
-				ID:      uuid.New().String(),
-				ChatID:  req.ChatID,
-				UserID:  userIDStr,
-				ActorID: "",
-				Reason:  "automod:" + violation,
-			}).Error
-			logMemberEvent(db, "chat", req.ChatID, userIDStr, "", "warn", gin.H{"reason": violation})
-			logModeration(db, req.ChatID, "", "", "automod_violation", userIDStr, "", gin.H{"reason": violation})
-
-			// бан при пороге предупреждений
-			warnThreshold := modSettings.WarnThreshold
-			if warnThreshold <= 0 {
-				warnThreshold = 2
-			}
-			var warnCnt int64
-			db.Model(&models.ChatWarning{}).
-				Where("chat_id = ? AND user_id = ? AND created_at > ?", req.ChatID, userIDStr, now.Add(-24*time.Hour)).
-				Count(&warnCnt)
-			if warnCnt >= int64(warnThreshold) {
-				mins := modSettings.BanMinutes
-				if mins <= 0 {
-					mins = 10
-				}
-				exp := now.Add(time.Duration(mins) * time.Minute)
-				_ = db.Create(&models.ChatBan{
-					ID:        uuid.New().String(),
-					ChatID:    req.ChatID,
-					UserID:    userIDStr,
-					ActorID:   "",
-					Reason:    "automod_threshold",
-					ExpiresAt: &exp,
-				}).Error
-				logMemberEvent(db, "chat", req.ChatID, userIDStr, "", "ban", gin.H{"expiresAt": exp})
-				logModeration(db, req.ChatID, "", "", "automod_ban", userIDStr, "", gin.H{"expiresAt": exp})
-			}
-		} else {
-			if message.ModerationStatus == "" {
-				message.ModerationStatus = "approved"
-			}
+		// Применяем автомодерацию (до сохранения)
+		if verdict.Status != "" {
+			message.ModerationStatus = verdict.Status
+			message.ModerationReason = verdict.Reason
+		} else if message.ModerationStatus == "" {
+			message.ModerationStatus = "approved"
 		}
 
 		if err := db.Create(&message).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
 			return
 		}
+		if len(mentions.Recipients) > 0 {
+			saveMentionRecipients(db, message, mentions)
+		}
+		if len(verdict.Hits) > 0 {
+			applyAutomod(db, verdict, req.ChatID, userIDStr, message.ID)
+		}
+		if message.ModerationStatus == "approved" {
+			bumpUnread(db, message)
+			refreshChatSummary(db, message.ChatID)
+			refreshThreadSummary(db, wsHub, message.ThreadID)
+		}
 
 		// Загружаем полную информацию о сообщении
-		db.Preload("Sender").Preload("Reactions").First(&message, "id = ?", message.ID)
+		db.Preload("Sender").First(&message, "id = ?", message.ID)
 
 		// Загружаем информацию о сообщении, на которое отвечают
 		var replyToMessage *models.Message
@@ -296,32 +283,8 @@ func CreateMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 		var pollData gin.H
 		if message.PollID != "" {
 			var poll models.Poll
-			if err := db.Preload("Options").Preload("Votes").Preload("Votes.User").First(&poll, "id = ?", message.PollID).Error; err == nil {
-				// Подсчитываем голоса
-				totalVotes := int64(len(poll.Votes))
-				optionsWithVotes := make([]gin.H, 0)
-				for _, opt := range poll.Options {
-					voteCount := int64(0)
-					voters := make([]string, 0)
-					for _, vote := range poll.Votes {
-						if vote.OptionID == opt.ID {
-							voteCount++
-							voters = append(voters, vote.UserID)
-						}
-					}
-					optionsWithVotes = append(optionsWithVotes, gin.H{
-						"id":     opt.ID,
-						"text":   opt.Text,
-						"votes":  voteCount,
-						"voters": voters,
-					})
-				}
-				pollData = gin.H{
-					"id":         poll.ID,
-					"question":   poll.Question,
-					"options":    optionsWithVotes,
-					"totalVotes": totalVotes,
-				}
+			if err := db.First(&poll, "id = ?", message.PollID).Error; err == nil {
+				pollData = pollPayload(db, poll, userIDStr)
 			}
 		}
 		
@@ -355,6 +318,8 @@ func CreateMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 			"gifUrl":        message.GifURL,
 			"locationLat":   message.LocationLat,
 			"locationLon":    message.LocationLon,
+			"mentions":      messageMentions(message),
+			"entities":      messageEntities(message),
 			"createdAt":     message.CreatedAt,
 		}
 		
@@ -373,13 +338,6 @@ func CreateMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 			response["document"] = documentParsed
 		}
 		
-		// Добавляем историю редактирования (если есть)
-		if message.EditHistoryJSON != "" {
-			var editHistory []gin.H
-			if err := json.Unmarshal([]byte(message.EditHistoryJSON), &editHistory); err == nil {
-				response["editHistory"] = editHistory
-			}
-		}
 		if replyToMessage != nil {
 			response["replyToMessage"] = gin.H{
 				"id":       replyToMessage.ID,
@@ -388,7 +346,7 @@ func CreateMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 				"sender": gin.H{
 					"id":       replyToMessage.Sender.ID,
 					"username": replyToMessage.Sender.Username,
-					"avatarUrl": replyToMessage.Sender.AvatarURL,
+					"avatarUrl": publicAvatar(replyToMessage.Sender),
 				},
 			}
 		}
@@ -405,7 +363,7 @@ func CreateMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 			response["sender"] = gin.H{
 				"id":       message.Sender.ID,
 				"username": message.Sender.Username,
-				"avatarUrl": message.Sender.AvatarURL,
+				"avatarUrl": publicAvatar(message.Sender),
 			}
 		}
 
@@ -416,7 +374,7 @@ func CreateMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 				"data": response,
 			}
 			messageJSON, _ := json.Marshal(wsMessage)
-			wsHub.BroadcastToChat(req.ChatID, messageJSON)
+			broadcastMessageEvent(db, wsHub, message, messageJSON)
 
 			// Вебхуки: message.created
 			webhookPayload, _ := json.Marshal(gin.H{
@@ -427,48 +385,13 @@ func CreateMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 			go fireWebhooks(db, "chat", req.ChatID, "message.created", webhookPayload)
 		}
 
-		// Отправляем push-уведомления всем участникам чата (кроме отправителя)
+		// Уведомляем участников чата (кроме отправителя) с учетом их настроек
 		if message.ModerationStatus == "approved" {
-			go func() {
-			var members []models.ChatMember
-			if err := db.Where("chat_id = ? AND user_id != ?", req.ChatID, userIDStr).Find(&members).Error; err == nil {
-				for _, member := range members {
-					// Получаем информацию о чате для уведомления
-					var chat models.Chat
-					if err := db.First(&chat, "id = ?", req.ChatID).Error; err == nil {
-						chatName := chat.Name
-						if chat.Type == "dm" {
-							// Для DM получаем имя собеседника
-							var otherMember models.ChatMember
-							if err := db.Where("chat_id = ? AND user_id != ?", req.ChatID, member.UserID).First(&otherMember).Error; err == nil {
-								var otherUser models.User
-								if err := db.First(&otherUser, "id = ?", otherMember.UserID).Error; err == nil {
-									chatName = otherUser.Username
-								}
-							}
-						}
-						
-						title := chatName
-						if title == "" {
-							title = "SafeGram"
-						}
-						body := message.Text
-						if body == "" {
-							body = "Новое сообщение"
-						}
-						if len(body) > 100 {
-							body = body[:100] + "..."
-						}
-						
-						SendPushNotification(db, member.UserID, title, body, map[string]interface{}{
-							"chatId":    req.ChatID,
-							"messageId": message.ID,
-							"url":       "/chats/" + req.ChatID,
-						})
-					}
-				}
+			go notifyChatMessage(db, wsHub, message)
+			if message.ThreadID == "" {
+				go deliverToConnected(db, wsHub, message)
 			}
-			}()
+			go attachLinkPreview(db, wsHub, message)
 		}
 
 		if message.ModerationStatus == "pending" {
@@ -484,8 +407,8 @@ func CreateMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 	}
 }
 
-// AddReaction добавляет реакцию к сообщению
-func AddReaction(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+// EditMessage редактирует сообщение
+func EditMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		messageID := c.Param("id")
 		userID, _ := c.Get("userID")
@@ -496,7 +419,9 @@ func AddReaction(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 		}
 
 		var req struct {
-			Emoji string `json:"emoji" binding:"required"`
+			Text      string       `json:"text" binding:"required"`
+			Entities  []textEntity `json:"entities"`
+			ParseMode string       `json:"parseMode"`
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -504,106 +429,66 @@ func AddReaction(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 			return
 		}
 
-		// Проверяем существование сообщения
 		var message models.Message
-		if err := db.First(&message, "id = ?", messageID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+		if err := db.First(&message, "id = ? AND sender_id = ? AND deleted_at IS NULL", messageID, userIDStr).Error; err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
 
-		// Удаляем существующую реакцию этого пользователя
-		db.Where("message_id = ? AND user_id = ?", messageID, userIDStr).Delete(&models.MessageReaction{})
-
-		// Создаем новую реакцию
-		reaction := models.MessageReaction{
-			ID:        uuid.New().String(),
-			MessageID: messageID,
-			UserID:    userIDStr,
-			Emoji:     req.Emoji,
-		}
-
-		if err := db.Create(&reaction).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		// Окно редактирования чата (модераторов не ограничивает)
+		perms := authz.Permissions(userIDStr, authz.Chat(message.ChatID))
+		if !perms.Has(authz.ManageMessages) && !withinWindow(messagePolicy(db, message.ChatID).EditWindow, message.CreatedAt) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "edit_window_expired"})
 			return
 		}
 
-		// Формируем данные реакции для WebSocket
-		reactionData := gin.H{
-			"type": "reaction",
-			"data": gin.H{
-				"messageId": messageID,
-				"chatId":    message.ChatID,
-				"userId":    userIDStr,
-				"emoji":     req.Emoji,
-			},
-		}
-		reactionJSON, _ := json.Marshal(reactionData)
-		wsHub.BroadcastToChat(message.ChatID, reactionJSON)
-
-		c.JSON(http.StatusOK, reaction)
-	}
-}
-
-// EditMessage редактирует сообщение
-func EditMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		messageID := c.Param("id")
-		userID, _ := c.Get("userID")
-		userIDStr, ok := userID.(string)
-		if !ok {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
-			return
-		}
-
-		var req struct {
-			Text string `json:"text" binding:"required"`
-		}
-
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+		text, entities, errBody := formatMessageText(req.Text, req.ParseMode, req.Entities)
+		if errBody != nil {
+			c.JSON(http.StatusBadRequest, errBody)
 			return
 		}
-
-		var message models.Message
-		if err := db.First(&message, "id = ? AND sender_id = ?", messageID, userIDStr).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		if text == message.Text && encodeEntities(entities) == message.EntitiesJSON {
+			c.JSON(http.StatusOK, message)
 			return
 		}
 
 		now := time.Now()
-		
-		// Сохраняем историю редактирования
-		var editHistory []gin.H
-		if message.EditHistoryJSON != "" {
-			json.Unmarshal([]byte(message.EditHistoryJSON), &editHistory)
-		}
-		// Добавляем текущую версию в историю
-		editHistory = append(editHistory, gin.H{
-			"text":     message.Text,
-			"editedAt": message.EditedAt,
-		})
-		// Ограничиваем историю последними 10 версиями
-		if len(editHistory) > 10 {
-			editHistory = editHistory[len(editHistory)-10:]
-		}
-		editHistoryJSON, _ := json.Marshal(editHistory)
-		
-		message.Text = req.Text
+		previous := message
+		message.Text = text
+		message.EntitiesJSON = encodeEntities(entities)
 		message.EditedAt = &now
-		message.EditHistoryJSON = string(editHistoryJSON)
+		message.RevisionCount++
 
-		if err := db.Save(&message).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		// Упоминания пересчитываются по новому тексту, повторных уведомлений нет
+		mentions := parseMentions(db, message.ChatID, userIDStr, perms, maskCode(text, entities))
+		message.MentionsJSON = encodeMentions(mentions)
+
+		// Прежняя версия уходит в историю вместе с сохранением новой
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := saveRevision(tx, previous); err != nil {
+				return err
+			}
+			return tx.Save(&message).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "edit_conflict"})
 			return
 		}
+		saveMentionRecipients(db, message, mentions)
+		refreshChatSummary(db, message.ChatID)
+		refreshThreadSummary(db, wsHub, message.ThreadID)
 
 		// Формируем данные для WebSocket
 		editData := gin.H{
 			"id":           message.ID,
 			"chatId":       message.ChatID,
+			"threadId":     message.ThreadID,
 			"senderId":     message.SenderID,
 			"text":         message.Text,
 			"attachmentUrl": message.AttachmentURL,
+			"mentions":     messageMentions(message),
+			"entities":     messageEntities(message),
+			"revisionCount": message.RevisionCount,
 			"editedAt":     message.EditedAt,
 			"createdAt":    message.CreatedAt,
 		}
@@ -613,7 +498,8 @@ func EditMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 			"type": "message:update",
 			"data": editData,
 		})
-		wsHub.BroadcastToChat(message.ChatID, editJSON)
+		broadcastMessageEvent(db, wsHub, message, editJSON)
+		go attachLinkPreview(db, wsHub, message)
 
 		c.JSON(http.StatusOK, message)
 	}
@@ -630,14 +516,49 @@ func DeleteMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 			return
 		}
 
+		// scope: all — удалить у всех (по умолчанию), me — скрыть только у себя.
+		// reason — причина удаления модератором, попадает в журнал модерации
+		var req struct {
+			Scope  string `json:"scope"`
+			Reason string `json:"reason"`
+		}
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+				return
+			}
+		}
+		if req.Scope == "" {
+			req.Scope = "all"
+		}
+		if req.Scope != "all" && req.Scope != "me" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_scope"})
+			return
+		}
+		if len([]rune(req.Reason)) > maxDeleteReasonLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_reason"})
+			return
+		}
+
 		var message models.Message
-		if err := db.First(&message, "id = ?", messageID).Error; err != nil {
+		if err := db.First(&message, "id = ? AND deleted_at IS NULL", messageID).Error; err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
 			return
 		}
 
-		// Проверяем права (только отправитель или админ)
-		if message.SenderID != userIDStr {
+		if req.Scope == "me" {
+			if !authz.IsMember(userIDStr, authz.Chat(message.ChatID)) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+				return
+			}
+			hideMessage(db, wsHub, message, userIDStr)
+			c.JSON(http.StatusOK, gin.H{"ok": true, "scope": "me"})
+			return
+		}
+
+		// Проверяем права (отправитель, manage_messages в чате или админ платформы)
+		moderator := authz.Can(userIDStr, authz.Chat(message.ChatID), authz.ManageMessages)
+		if message.SenderID != userIDStr && !moderator {
 			// Проверяем, является ли пользователь админом
 			var user models.User
 			if err := db.First(&user, "id = ?", userIDStr).Error; err == nil {
@@ -659,30 +580,48 @@ func DeleteMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 			}
 		}
 
-		now := time.Now()
-		message.DeletedAt = &now
+		// Окно удаления у всех действует на собственные сообщения обычных участников
+		deletedBy := "moderator"
+		if message.SenderID == userIDStr {
+			deletedBy = "sender"
+			if !moderator && !withinWindow(messagePolicy(db, message.ChatID).DeleteWindow, message.CreatedAt) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "delete_window_expired"})
+				return
+			}
+		}
 
-		if err := db.Save(&message).Error; err != nil {
+		wasVisible := message.ModerationStatus == "approved"
+		now := time.Now()
+		result := db.Model(&models.Message{}).
+			Where("id = ? AND deleted_at IS NULL", message.ID).
+			Updates(map[string]interface{}{"deleted_at": now, "deleted_by": deletedBy})
+		if result.Error != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
 			return
 		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		message.DeletedAt = &now
+		message.DeletedBy = deletedBy
+		if wasVisible {
+			dropUnread(db, message)
+			refreshChatSummary(db, message.ChatID)
+			refreshThreadSummary(db, wsHub, message.ThreadID)
+		}
+		if deletedBy == "moderator" {
+			logModeration(db, message.ChatID, "", userIDStr, "message_delete", message.SenderID, message.ID, gin.H{"reason": req.Reason})
+		}
 
-		// Отправляем через WebSocket
-		deleteJSON, _ := json.Marshal(gin.H{
-			"type": "message:delete",
-			"data": gin.H{
-				"messageId": messageID,
-				"chatId":    message.ChatID,
-				"deleteForAll": true, // Пока всегда true, можно добавить в запрос
-			},
-		})
-		wsHub.BroadcastToChat(message.ChatID, deleteJSON)
+		// Надгробие: клиенты применяют его к локальной копии без перезагрузки истории
+		broadcastMessageEvent(db, wsHub, message, wsEvent("message:delete", messageTombstone(message)))
 
-		c.JSON(http.StatusOK, gin.H{"ok": true})
+		c.JSON(http.StatusOK, gin.H{"ok": true, "scope": "all", "tombstone": messageTombstone(message)})
 	}
 }
 
-// MarkMessageRead отмечает сообщение как прочитанное
+// MarkMessageRead двигает курсор прочтения текущего пользователя до сообщения
 func MarkMessageRead(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		messageID := c.Param("id")
@@ -695,7 +634,7 @@ func MarkMessageRead(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 
 		// Проверяем существование сообщения
 		var message models.Message
-		if err := db.First(&message, "id = ?", messageID).Error; err != nil {
+		if err := db.First(&message, "id = ? AND deleted_at IS NULL", messageID).Error; err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
 			return
 		}
@@ -707,43 +646,73 @@ func MarkMessageRead(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 			return
 		}
 
-		// Проверяем, не прочитано ли уже
-		var existingReceipt models.MessageReadReceipt
-		if err := db.Where("message_id = ? AND user_id = ?", messageID, userIDStr).First(&existingReceipt).Error; err == nil {
-			// Уже прочитано
-			c.JSON(http.StatusOK, existingReceipt)
+		// Ответ в треде двигает курсор треда, а не курсор чата
+		if message.ThreadID != "" {
+			advanced, err := advanceThreadCursor(db, message.ThreadID, userIDStr, message)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+				return
+			}
+			var follower models.ThreadFollower
+			db.Where("thread_id = ? AND user_id = ?", message.ThreadID, userIDStr).First(&follower)
+			if advanced {
+				wsHub.SendToUser(userIDStr, wsEvent("thread:read", gin.H{
+					"threadId":          message.ThreadID,
+					"chatId":            message.ChatID,
+					"lastReadMessageId": follower.LastReadMessageID,
+					"unreadCount":       follower.UnreadCount,
+				}))
+			}
+			c.JSON(http.StatusOK, gin.H{
+				"messageId":         messageID,
+				"chatId":            message.ChatID,
+				"threadId":          message.ThreadID,
+				"lastReadMessageId": follower.LastReadMessageID,
+				"unreadCount":       follower.UnreadCount,
+			})
 			return
 		}
 
-		// Создаем запись о прочтении
-		receipt := models.MessageReadReceipt{
-			ID:        uuid.New().String(),
-			MessageID: messageID,
-			UserID:    userIDStr,
-		}
-
-		if err := db.Create(&receipt).Error; err != nil {
+		advanced, err := advanceReadCursor(db, message.ChatID, userIDStr, message)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
 			return
 		}
+		db.Where("id = ?", member.ID).First(&member)
 
-		// Отправляем уведомление отправителю через WebSocket
-		readJSON, _ := json.Marshal(gin.H{
-			"type": "message:read",
-			"data": gin.H{
+		// Курсор сдвинулся — уведомляем отправителя и другие устройства читателя
+		if advanced {
+			readEvent := wsEvent("message:read", gin.H{
 				"messageId": messageID,
 				"chatId":    message.ChatID,
 				"userId":    userIDStr,
-				"readAt":    receipt.ReadAt,
-			},
-		})
-		wsHub.SendToUser(message.SenderID, readJSON)
+				"readAt":    member.LastReadAt,
+			})
+			if message.SenderID != userIDStr {
+				wsHub.SendToUser(message.SenderID, readEvent)
+			}
+			wsHub.SendToUser(userIDStr, wsEvent("chat:read", gin.H{
+				"chatId":            message.ChatID,
+				"userId":            userIDStr,
+				"lastReadMessageId": member.LastReadMessageID,
+				"unreadCount":       member.UnreadCount,
+				"unreadMentions":    member.UnreadMentions,
+				"readAt":            member.LastReadAt,
+			}))
+		}
 
-		c.JSON(http.StatusOK, receipt)
+		c.JSON(http.StatusOK, gin.H{
+			"messageId":         messageID,
+			"chatId":            message.ChatID,
+			"userId":            userIDStr,
+			"readAt":            member.LastReadAt,
+			"lastReadMessageId": member.LastReadMessageID,
+			"unreadCount":       member.UnreadCount,
+		})
 	}
 }
 
-// MarkChatRead отмечает все сообщения в чате как прочитанные
+// MarkChatRead ставит курсор прочтения на последнее сообщение чата
 func MarkChatRead(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		chatID := c.Param("id")
@@ -761,59 +730,53 @@ func MarkChatRead(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 			return
 		}
 
-		// Получаем все непрочитанные сообщения в чате
-		var unreadMessages []models.Message
-		subquery := db.Model(&models.MessageReadReceipt{}).
-			Select("message_id").
-			Where("user_id = ?", userIDStr)
-		
-		db.Where("chat_id = ? AND sender_id != ? AND deleted_at IS NULL", chatID, userIDStr).
-			Where("id NOT IN (?)", subquery).
-			Find(&unreadMessages)
-
-		// Создаем записи о прочтении для всех непрочитанных сообщений
-		receipts := make([]models.MessageReadReceipt, 0, len(unreadMessages))
-		senderIDs := make(map[string]bool)
-
-		for _, msg := range unreadMessages {
-			receipt := models.MessageReadReceipt{
-				ID:        uuid.New().String(),
-				MessageID: msg.ID,
-				UserID:    userIDStr,
-			}
-			receipts = append(receipts, receipt)
-			senderIDs[msg.SenderID] = true
+		var latest models.Message
+		if err := db.Where("chat_id = ? AND deleted_at IS NULL AND moderation_status = 'approved'", chatID).
+			Where("COALESCE(thread_id, '') = ''").
+			Order("created_at DESC").
+			First(&latest).Error; err != nil {
+			c.JSON(http.StatusOK, gin.H{"readCount": 0})
+			return
 		}
 
-		if len(receipts) > 0 {
-			// Массовое создание записей
-			if err := db.Create(&receipts).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
-				return
-			}
-
-			// Отправляем уведомления всем отправителям
-			readJSON, _ := json.Marshal(gin.H{
-				"type": "chat:read",
-				"data": gin.H{
-					"chatId": chatID,
-					"userId": userIDStr,
-					"readAt": time.Now(),
-				},
-			})
+		previous := memberCursors(db, chatID, []string{userIDStr})[userIDStr]
+		advanced, err := advanceReadCursor(db, chatID, userIDStr, latest)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		if !advanced {
+			c.JSON(http.StatusOK, gin.H{"readCount": 0, "lastReadMessageId": member.LastReadMessageID})
+			return
+		}
 
-			for senderID := range senderIDs {
-				wsHub.SendToUser(senderID, readJSON)
-			}
+		// Отправители прочитанных сообщений и другие устройства читателя
+		var senderIDs []string
+		query := db.Model(&models.Message{}).
+			Where("chat_id = ? AND sender_id <> ? AND deleted_at IS NULL AND created_at <= ?", chatID, userIDStr, latest.CreatedAt)
+		if previous.ReadUpTo != nil {
+			query = query.Where("created_at > ?", *previous.ReadUpTo)
 		}
+		query.Distinct("sender_id").Pluck("sender_id", &senderIDs)
+
+		readEvent := wsEvent("chat:read", gin.H{
+			"chatId":            chatID,
+			"userId":            userIDStr,
+			"lastReadMessageId": latest.ID,
+			"unreadCount":       0,
+			"unreadMentions":    0,
+			"readAt":            time.Now(),
+		})
+		wsHub.SendToUsers(append(senderIDs, userIDStr), readEvent)
 
 		c.JSON(http.StatusOK, gin.H{
-			"readCount": len(receipts),
+			"readCount":         member.UnreadCount,
+			"lastReadMessageId": latest.ID,
 		})
 	}
 }
 
-// GetMessageReadReceipts получает список пользователей, прочитавших сообщение
+// GetMessageReadReceipts получает список участников, чей курсор прочтения дошел до сообщения
 func GetMessageReadReceipts(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		messageID := c.Param("id")
@@ -838,26 +801,32 @@ func GetMessageReadReceipts(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Получаем все записи о прочтении
-		var receipts []models.MessageReadReceipt
-		if err := db.Where("message_id = ?").
+		// readAt — момент, когда курсор участника прошел это сообщение (или позже)
+		var readers []models.ChatMember
+		if err := db.Joins("JOIN messages lr ON lr.id = chat_members.last_read_message_id").
+			Where("chat_members.chat_id = ? AND chat_members.user_id <> ? AND lr.created_at >= ?", message.ChatID, message.SenderID, message.CreatedAt).
 			Preload("User").
-			Order("read_at DESC").
-			Find(&receipts).Error; err != nil {
+			Order("chat_members.last_read_at DESC").
+			Find(&readers).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
 			return
 		}
 
 		// Формируем ответ
-		result := make([]gin.H, len(receipts))
-		for i, receipt := range receipts {
+		readerIDs := make([]string, len(readers))
+		for i, reader := range readers {
+			readerIDs[i] = reader.UserID
+		}
+		view := newPrivacyView(db, userIDStr, readerIDs)
+		result := make([]gin.H, len(readers))
+		for i, reader := range readers {
 			result[i] = gin.H{
-				"userId": receipt.UserID,
-				"readAt": receipt.ReadAt,
+				"userId": reader.UserID,
+				"readAt": reader.LastReadAt,
 				"user": gin.H{
-					"id":       receipt.User.ID,
-					"username": receipt.User.Username,
-					"avatarUrl": receipt.User.AvatarURL,
+					"id":        reader.User.ID,
+					"username":  reader.User.Username,
+					"avatarUrl": view.avatar(reader.User),
 				},
 			}
 		}
@@ -907,6 +876,14 @@ func ForwardMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden", "detail": "no_access_to_target_chat"})
 			return
 		}
+		if dmBlocked(db, req.ChatID, userIDStr) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "blocked"})
+			return
+		}
+		if restriction := sendRestriction(db, req.ChatID, userIDStr); restriction != nil {
+			c.JSON(http.StatusForbidden, restriction)
+			return
+		}
 
 		// Создаем новое сообщение с пересылкой
 		forwardedMessage := models.Message{
@@ -922,18 +899,22 @@ func ForwardMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 			LocationLon:   originalMessage.LocationLon,
 		}
 
-		// Если нет комментария, используем текст исходного сообщения
+		// Если нет комментария, используем текст исходного сообщения с его форматированием
 		if forwardedMessage.Text == "" {
 			forwardedMessage.Text = originalMessage.Text
+			forwardedMessage.EntitiesJSON = originalMessage.EntitiesJSON
+			forwardedMessage.PreviewJSON = originalMessage.PreviewJSON
 		}
 
 		if err := db.Create(&forwardedMessage).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
 			return
 		}
+		bumpUnread(db, forwardedMessage)
+		refreshChatSummary(db, forwardedMessage.ChatID)
 
 		// Загружаем полную информацию о пересланном сообщении
-		db.Preload("Sender").Preload("Reactions").First(&forwardedMessage, "id = ?", forwardedMessage.ID)
+		db.Preload("Sender").First(&forwardedMessage, "id = ?", forwardedMessage.ID)
 
 		// Загружаем информацию об исходном сообщении для ответа
 		var originalSender models.User
@@ -960,7 +941,7 @@ func ForwardMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 				"sender": gin.H{
 					"id":       originalSender.ID,
 					"username": originalSender.Username,
-					"avatarUrl": originalSender.AvatarURL,
+					"avatarUrl": publicAvatar(originalSender),
 				},
 				"attachmentUrl": originalMessage.AttachmentURL,
 				"createdAt":     originalMessage.CreatedAt,
@@ -970,7 +951,7 @@ func ForwardMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 			response["sender"] = gin.H{
 				"id":       forwardedMessage.Sender.ID,
 				"username": forwardedMessage.Sender.Username,
-				"avatarUrl": forwardedMessage.Sender.AvatarURL,
+				"avatarUrl": publicAvatar(forwardedMessage.Sender),
 			}
 		}
 
@@ -981,6 +962,7 @@ func ForwardMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 		}
 		messageJSON, _ := json.Marshal(wsMessage)
 		wsHub.BroadcastToChat(req.ChatID, messageJSON)
+		go deliverToConnected(db, wsHub, forwardedMessage)
 
 		c.JSON(http.StatusOK, response)
 	}
@@ -56,6 +56,13 @@ func authMiddleware(cfg *config.Config) gin.HandlerFunc {
 			return
 		}
 
+		// Гостевой токен встречи действует только для WebSocket
+		if guest, _ := claims["guest"].(bool); guest {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			c.Abort()
+			return
+		}
+
 		c.Set("userID", userID)
 		c.Set("username", claims["username"])
 		c.Next()
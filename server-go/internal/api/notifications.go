@@ -0,0 +1,610 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	_ "time/tzdata" // Часовые пояса расписаний «не беспокоить» без системной tzdata
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"safegram-server/internal/config"
+	"safegram-server/internal/email"
+	"safegram-server/internal/models"
+	"safegram-server/internal/websocket"
+)
+
+// Виды уведомлений
+const (
+	notifyMessage  = "message"
+	notifyMention  = "mention"
+	notifyReaction = "reaction"
+	notifyCall     = "call"
+)
+
+// notification событие, о котором нужно уведомить пользователя
+type notification struct {
+	UserID  string
+	Kind    string
+	ChatID  string
+	Title   string
+	Body    string
+	Text    string // Полный текст для поиска ключевых слов
+	Mention string // Вид упоминания (user, role, everyone, here): упоминания пробивают отключенный звук
+	Data    map[string]interface{}
+}
+
+func defaultNotificationSettings(userID string) models.NotificationSettings {
+	return models.NotificationSettings{
+		UserID:    userID,
+		Messages:  true,
+		Mentions:  true,
+		Reactions: false,
+		Calls:     true,
+		Groups:    true,
+		Servers:   true,
+		Email:     false,
+		Push:      true,
+		DNDStart:  "23:00",
+		DNDEnd:    "08:00",
+		TimeZone:  "UTC",
+	}
+}
+
+func loadNotificationSettings(db *gorm.DB, userID string) models.NotificationSettings {
+	var settings models.NotificationSettings
+	if err := db.First(&settings, "user_id = ?", userID).Error; err != nil {
+		return defaultNotificationSettings(userID)
+	}
+	return settings
+}
+
+// parseClock разбирает время HH:MM в минуты от полуночи
+func parseClock(value string) (int, bool) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// inDNDSchedule попадает ли момент в расписание «не беспокоить» пользователя
+func inDNDSchedule(settings models.NotificationSettings, now time.Time) bool {
+	if !settings.DNDEnabled {
+		return false
+	}
+	start, okStart := parseClock(settings.DNDStart)
+	end, okEnd := parseClock(settings.DNDEnd)
+	if !okStart || !okEnd || start == end {
+		return false
+	}
+	loc, err := time.LoadLocation(settings.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	minutes := local.Hour()*60 + local.Minute()
+	if start < end {
+		return minutes >= start && minutes < end
+	}
+	// Интервал через полночь, например 23:00–08:00
+	return minutes >= start || minutes < end
+}
+
+// preferenceKeywords ключевые слова настройки
+func preferenceKeywords(pref models.NotificationPreference) []string {
+	var keywords []string
+	if pref.Keywords != "" {
+		json.Unmarshal([]byte(pref.Keywords), &keywords)
+	}
+	return keywords
+}
+
+func matchesKeyword(keywords []string, text string) bool {
+	if text == "" {
+		return false
+	}
+	lower := strings.ToLower(text)
+	for _, keyword := range keywords {
+		if keyword != "" && strings.Contains(lower, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	return false
+}
+
+// notificationPreference настройка чата, а если ее нет — сервера, к которому относится чат
+func notificationPreference(db *gorm.DB, userID, chatID, serverID string) (models.NotificationPreference, bool) {
+	var pref models.NotificationPreference
+	if err := db.Where("user_id = ? AND scope_type = ? AND scope_id = ?", userID, "chat", chatID).First(&pref).Error; err == nil {
+		return pref, true
+	}
+	if serverID != "" {
+		if err := db.Where("user_id = ? AND scope_type = ? AND scope_id = ?", userID, "server", serverID).First(&pref).Error; err == nil {
+			return pref, true
+		}
+	}
+	return pref, false
+}
+
+// dispatchNotification решает, уведомлять ли пользователя и каким каналом:
+// событие WebSocket для подключенных устройств, Web Push или почтовый дайджест
+func dispatchNotification(db *gorm.DB, hub *websocket.Hub, n notification) {
+	settings := loadNotificationSettings(db, n.UserID)
+	now := time.Now()
+	sound := ""
+
+	if n.ChatID != "" {
+		var chat models.Chat
+		db.Select("id", "type").First(&chat, "id = ?", n.ChatID)
+		serverID := serverIDForChat(db, n.ChatID)
+		if serverID != "" && !settings.Servers {
+			return
+		}
+		if serverID == "" && chat.Type == "group" && !settings.Groups {
+			return
+		}
+
+		if pref, ok := notificationPreference(db, n.UserID, n.ChatID, serverID); ok {
+			if n.Kind == notifyMessage && matchesKeyword(preferenceKeywords(pref), n.Text) {
+				n.Kind = notifyMention
+			}
+			// Звонки и упоминания не зависят от отключения звука в чате
+			if n.Kind != notifyCall && n.Mention == "" {
+				if pref.MutedUntil != nil && pref.MutedUntil.After(now) {
+					return
+				}
+				switch pref.Level {
+				case "none":
+					return
+				case "mentions":
+					if n.Kind != notifyMention {
+						return
+					}
+				}
+			}
+			sound = pref.Sound
+		}
+	}
+
+	switch n.Kind {
+	case notifyMessage:
+		if !settings.Messages {
+			return
+		}
+	case notifyMention:
+		if !settings.Mentions {
+			return
+		}
+	case notifyReaction:
+		if !settings.Reactions {
+			return
+		}
+	case notifyCall:
+		if !settings.Calls {
+			return
+		}
+	}
+
+	quiet := inDNDSchedule(settings, now) || userPresence(n.UserID) == presenceDND
+
+	if hub != nil && hub.IsConnected(n.UserID) {
+		// Само событие уже доставлено; notification говорит клиенту показать оповещение.
+		// Для звонков оповещение — call:incoming
+		if !quiet && n.Kind != notifyCall {
+			hub.SendToUser(n.UserID, wsEvent("notification", gin.H{
+				"kind":   n.Kind,
+				"chatId": n.ChatID,
+				"title":  n.Title,
+				"body":   n.Body,
+				"sound":  sound,
+				"data":   n.Data,
+			}))
+		}
+		return
+	}
+
+	if !quiet && settings.Push {
+		var subscriptions int64
+		db.Model(&models.PushSubscription{}).Where("user_id = ?", n.UserID).Count(&subscriptions)
+		if subscriptions > 0 {
+			data := map[string]interface{}{"kind": n.Kind, "sound": sound}
+			for key, value := range n.Data {
+				data[key] = value
+			}
+			SendPushNotification(db, n.UserID, n.Title, n.Body, data)
+			return
+		}
+	}
+
+	if settings.Email {
+		item := models.NotificationDigestItem{
+			ID:     uuid.New().String(),
+			UserID: n.UserID,
+			Kind:   n.Kind,
+			ChatID: n.ChatID,
+			Title:  n.Title,
+			Body:   n.Body,
+		}
+		if err := db.Create(&item).Error; err != nil {
+			log.Printf("Failed to queue digest item: %v", err)
+		}
+	}
+}
+
+// notificationPreview текст сообщения для уведомления
+func notificationPreview(text, fallback string) string {
+	if text == "" {
+		return fallback
+	}
+	if len([]rune(text)) > 100 {
+		return string([]rune(text)[:100]) + "..."
+	}
+	return text
+}
+
+// notifyChatMessage уведомляет участников чата о новом сообщении
+func notifyChatMessage(db *gorm.DB, hub *websocket.Hub, message models.Message) {
+	var chat models.Chat
+	if err := db.First(&chat, "id = ?", message.ChatID).Error; err != nil {
+		return
+	}
+	var sender models.User
+	db.Select("id", "username").First(&sender, "id = ?", message.SenderID)
+
+	// Об ответах в треде узнают только его подписчики
+	var members []models.ChatMember
+	recipients := db.Where("chat_id = ? AND user_id != ?", message.ChatID, message.SenderID)
+	url := "/chats/" + message.ChatID
+	if message.ThreadID != "" {
+		recipients = recipients.Where("user_id IN (?)",
+			db.Model(&models.ThreadFollower{}).Select("user_id").Where("thread_id = ?", message.ThreadID))
+		url += "?thread=" + message.ThreadID
+	}
+	recipients.Find(&members)
+	mentioned := messageMentionKinds(db, message.ID)
+
+	title := chat.Name
+	if chat.Type == "dm" || title == "" {
+		title = sender.Username
+	}
+	if title == "" {
+		title = "SafeGram"
+	}
+	body := notificationPreview(message.Text, "Новое сообщение")
+	if chat.Type != "dm" && sender.Username != "" {
+		body = sender.Username + ": " + body
+	}
+
+	for _, member := range members {
+		kind := notifyMessage
+		if mentioned[member.UserID] != "" {
+			kind = notifyMention
+		}
+		dispatchNotification(db, hub, notification{
+			UserID:  member.UserID,
+			Kind:    kind,
+			ChatID:  message.ChatID,
+			Title:   title,
+			Body:    body,
+			Text:    message.Text,
+			Mention: mentioned[member.UserID],
+			Data: map[string]interface{}{
+				"chatId":    message.ChatID,
+				"threadId":  message.ThreadID,
+				"messageId": message.ID,
+				"url":       url,
+			},
+		})
+	}
+}
+
+// GetUserNotifications возвращает глобальные настройки уведомлений
+func GetUserNotifications(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"notifications": loadNotificationSettings(db, userIDStr)})
+	}
+}
+
+// UpdateUserNotifications обновляет глобальные настройки уведомлений
+func UpdateUserNotifications(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var req struct {
+			Messages   *bool   `json:"messages"`
+			Mentions   *bool   `json:"mentions"`
+			Reactions  *bool   `json:"reactions"`
+			Calls      *bool   `json:"calls"`
+			Groups     *bool   `json:"groups"`
+			Servers    *bool   `json:"servers"`
+			Email      *bool   `json:"email"`
+			Push       *bool   `json:"push"`
+			DNDEnabled *bool   `json:"dndEnabled"`
+			DNDStart   *string `json:"dndStart"`
+			DNDEnd     *string `json:"dndEnd"`
+			TimeZone   *string `json:"timeZone"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		settings := loadNotificationSettings(db, userIDStr)
+		flags := []struct {
+			value  *bool
+			target *bool
+		}{
+			{req.Messages, &settings.Messages},
+			{req.Mentions, &settings.Mentions},
+			{req.Reactions, &settings.Reactions},
+			{req.Calls, &settings.Calls},
+			{req.Groups, &settings.Groups},
+			{req.Servers, &settings.Servers},
+			{req.Email, &settings.Email},
+			{req.Push, &settings.Push},
+			{req.DNDEnabled, &settings.DNDEnabled},
+		}
+		for _, flag := range flags {
+			if flag.value != nil {
+				*flag.target = *flag.value
+			}
+		}
+		if req.DNDStart != nil {
+			if _, ok := parseClock(*req.DNDStart); !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_time"})
+				return
+			}
+			settings.DNDStart = *req.DNDStart
+		}
+		if req.DNDEnd != nil {
+			if _, ok := parseClock(*req.DNDEnd); !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_time"})
+				return
+			}
+			settings.DNDEnd = *req.DNDEnd
+		}
+		if req.TimeZone != nil {
+			if _, err := time.LoadLocation(*req.TimeZone); err != nil || *req.TimeZone == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_timezone"})
+				return
+			}
+			settings.TimeZone = *req.TimeZone
+		}
+
+		if err := db.Save(&settings).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true, "notifications": settings})
+	}
+}
+
+func preferenceResponse(pref models.NotificationPreference) gin.H {
+	result := gin.H{
+		"scopeType": pref.ScopeType,
+		"scopeId":   pref.ScopeID,
+		"level":     pref.Level,
+		"keywords":  preferenceKeywords(pref),
+		"sound":     pref.Sound,
+		"muted":     pref.MutedUntil != nil && pref.MutedUntil.After(time.Now()),
+	}
+	if pref.MutedUntil != nil {
+		result["mutedUntil"] = pref.MutedUntil.Unix() * 1000
+	}
+	return result
+}
+
+// notificationScopeMember проверяет, что пользователь состоит в чате или на сервере
+func notificationScopeMember(db *gorm.DB, scopeType, scopeID, userID string) bool {
+	var count int64
+	if scopeType == "server" {
+		db.Model(&models.ServerMember{}).Where("server_id = ? AND user_id = ?", scopeID, userID).Count(&count)
+	} else {
+		db.Model(&models.ChatMember{}).Where("chat_id = ? AND user_id = ?", scopeID, userID).Count(&count)
+	}
+	return count > 0
+}
+
+// GetNotificationPreferences возвращает все настройки уведомлений по чатам и серверам
+func GetNotificationPreferences(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var prefs []models.NotificationPreference
+		db.Where("user_id = ?", userIDStr).Order("created_at ASC").Find(&prefs)
+		result := make([]gin.H, len(prefs))
+		for i, pref := range prefs {
+			result[i] = preferenceResponse(pref)
+		}
+		c.JSON(http.StatusOK, gin.H{"preferences": result})
+	}
+}
+
+// GetScopeNotifications настройки уведомлений чата или сервера (scopeType = chat | server)
+func GetScopeNotifications(db *gorm.DB, scopeType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		scopeID := c.Param("id")
+		if !notificationScopeMember(db, scopeType, scopeID, userIDStr) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		pref := models.NotificationPreference{ScopeType: scopeType, ScopeID: scopeID, Level: "all"}
+		db.Where("user_id = ? AND scope_type = ? AND scope_id = ?", userIDStr, scopeType, scopeID).First(&pref)
+		c.JSON(http.StatusOK, gin.H{"preference": preferenceResponse(pref)})
+	}
+}
+
+// UpdateScopeNotifications меняет настройки уведомлений чата или сервера:
+// muteFor — секунды (0 — включить звук, -1 — навсегда), level, keywords, sound
+func UpdateScopeNotifications(db *gorm.DB, scopeType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		scopeID := c.Param("id")
+		if !notificationScopeMember(db, scopeType, scopeID, userIDStr) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var req struct {
+			MuteFor    *int64    `json:"muteFor"`
+			MutedUntil *int64    `json:"mutedUntil"` // Время в миллисекундах
+			Level      *string   `json:"level"`
+			Keywords   *[]string `json:"keywords"`
+			Sound      *string   `json:"sound"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		var pref models.NotificationPreference
+		if err := db.Where("user_id = ? AND scope_type = ? AND scope_id = ?", userIDStr, scopeType, scopeID).First(&pref).Error; err != nil {
+			pref = models.NotificationPreference{
+				ID:        uuid.New().String(),
+				UserID:    userIDStr,
+				ScopeType: scopeType,
+				ScopeID:   scopeID,
+				Level:     "all",
+			}
+		}
+
+		switch {
+		case req.MuteFor != nil && *req.MuteFor < 0:
+			forever := time.Now().AddDate(100, 0, 0)
+			pref.MutedUntil = &forever
+		case req.MuteFor != nil && *req.MuteFor == 0:
+			pref.MutedUntil = nil
+		case req.MuteFor != nil:
+			until := time.Now().Add(time.Duration(*req.MuteFor) * time.Second)
+			pref.MutedUntil = &until
+		case req.MutedUntil != nil && *req.MutedUntil > 0:
+			until := time.UnixMilli(*req.MutedUntil)
+			pref.MutedUntil = &until
+		case req.MutedUntil != nil:
+			pref.MutedUntil = nil
+		}
+		if req.Level != nil {
+			if *req.Level != "all" && *req.Level != "mentions" && *req.Level != "none" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_level"})
+				return
+			}
+			pref.Level = *req.Level
+		}
+		if req.Keywords != nil {
+			if len(*req.Keywords) > 50 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "too_many_keywords"})
+				return
+			}
+			keywords := make([]string, 0, len(*req.Keywords))
+			for _, keyword := range *req.Keywords {
+				if keyword = strings.TrimSpace(keyword); keyword != "" {
+					keywords = append(keywords, keyword)
+				}
+			}
+			keywordsJSON, _ := json.Marshal(keywords)
+			pref.Keywords = string(keywordsJSON)
+		}
+		if req.Sound != nil {
+			pref.Sound = *req.Sound
+		}
+
+		if err := db.Save(&pref).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"preference": preferenceResponse(pref)})
+	}
+}
+
+// ResetScopeNotifications возвращает чату или серверу настройки по умолчанию
+func ResetScopeNotifications(db *gorm.DB, scopeType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		db.Where("user_id = ? AND scope_type = ? AND scope_id = ?", userIDStr, scopeType, c.Param("id")).
+			Delete(&models.NotificationPreference{})
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// StartNotificationDigest раз в час отправляет почтовые дайджесты пропущенных уведомлений
+func StartNotificationDigest(db *gorm.DB, cfg *config.Config) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for range ticker.C {
+		var userIDs []string
+		db.Model(&models.NotificationDigestItem{}).Distinct("user_id").
+			Where("created_at < ?", time.Now().Add(-15*time.Minute)).
+			Pluck("user_id", &userIDs)
+
+		for _, userID := range userIDs {
+			var items []models.NotificationDigestItem
+			db.Where("user_id = ?", userID).Order("created_at ASC").Find(&items)
+			db.Where("user_id = ?", userID).Delete(&models.NotificationDigestItem{})
+
+			// Вернувшемуся в сеть пользователю дайджест не нужен
+			if len(items) == 0 || userPresence(userID) != presenceOffline {
+				continue
+			}
+			var user models.User
+			if err := db.First(&user, "id = ?", userID).Error; err != nil || user.Email == nil || *user.Email == "" {
+				continue
+			}
+
+			entries := make([]email.DigestItem, 0, len(items))
+			for _, item := range items {
+				if len(entries) == 20 {
+					break
+				}
+				link := cfg.AppURL + "/app/chats"
+				if item.ChatID != "" {
+					link = cfg.AppURL + "/chats/" + item.ChatID
+				}
+				entries = append(entries, email.DigestItem{Title: item.Title, Body: item.Body, Link: link})
+			}
+			if err := email.SendNotificationDigest(*user.Email, user.Username, cfg.AppURL, entries); err != nil {
+				log.Printf("Failed to send notification digest to %s: %v", userID, err)
+			}
+		}
+	}
+}
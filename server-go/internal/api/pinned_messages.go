@@ -7,6 +7,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"safegram-server/internal/authz"
 	"safegram-server/internal/models"
 	"safegram-server/internal/websocket"
 )
@@ -36,18 +37,10 @@ func PinMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 			return
 		}
 
-		// Проверяем права (только админы и владельцы могут закреплять)
-		if member.Role != "owner" && member.Role != "admin" {
-			// Для DM чатов разрешаем закреплять всем
-			var chat models.Chat
-			if err := db.First(&chat, "id = ?", message.ChatID).Error; err != nil {
-				c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
-				return
-			}
-			if chat.Type != "dm" {
-				c.JSON(http.StatusForbidden, gin.H{"error": "forbidden", "detail": "only_admins_can_pin"})
-				return
-			}
+		// Проверяем право закреплять (в DM есть у всех участников)
+		if !authz.Can(userIDStr, authz.Chat(message.ChatID), authz.PinMessages) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden", "detail": "only_admins_can_pin"})
+			return
 		}
 
 		// Проверяем, не закреплено ли уже
@@ -80,6 +73,7 @@ func PinMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 
 		// Загружаем полную информацию
 		db.Preload("Message").Preload("Message.Sender").Preload("User").First(&pinned, "id = ?", pinned.ID)
+		pinned.Message.Sender.AvatarURL = visibleAvatar(db, userIDStr, pinned.Message.Sender)
 
 		// Отправляем уведомление через WebSocket
 		pinJSON, _ := json.Marshal(gin.H{
@@ -122,17 +116,10 @@ func UnpinMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 			return
 		}
 
-		// Проверяем права (только админы, владельцы или тот, кто закрепил)
-		if member.Role != "owner" && member.Role != "admin" && pinned.PinnedBy != userIDStr {
-			var chat models.Chat
-			if err := db.First(&chat, "id = ?", pinned.ChatID).Error; err != nil {
-				c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
-				return
-			}
-			if chat.Type != "dm" {
-				c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-				return
-			}
+		// Проверяем права (pin_messages или тот, кто закрепил)
+		if pinned.PinnedBy != userIDStr && !authz.Can(userIDStr, authz.Chat(pinned.ChatID), authz.PinMessages) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
 		}
 
 		// Удаляем закрепление
@@ -187,6 +174,11 @@ func GetPinnedMessages(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// Формируем ответ
+		userIDs := make([]string, 0, len(pinned)*2)
+		for _, p := range pinned {
+			userIDs = append(userIDs, p.Message.SenderID, p.PinnedBy)
+		}
+		view := newPrivacyView(db, userIDStr, userIDs)
 		result := make([]gin.H, len(pinned))
 		for i, p := range pinned {
 			msgData := gin.H{
@@ -201,7 +193,7 @@ func GetPinnedMessages(db *gorm.DB) gin.HandlerFunc {
 				msgData["sender"] = gin.H{
 					"id":       p.Message.Sender.ID,
 					"username": p.Message.Sender.Username,
-					"avatarUrl": p.Message.Sender.AvatarURL,
+					"avatarUrl": view.avatar(p.Message.Sender),
 				}
 			}
 
@@ -215,7 +207,7 @@ func GetPinnedMessages(db *gorm.DB) gin.HandlerFunc {
 				"user": gin.H{
 					"id":       p.User.ID,
 					"username": p.User.Username,
-					"avatarUrl": p.User.AvatarURL,
+					"avatarUrl": view.avatar(p.User),
 				},
 			}
 		}
@@ -1,15 +1,362 @@
 package api
 
 import (
+	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"safegram-server/internal/authz"
 	"safegram-server/internal/models"
 	"safegram-server/internal/websocket"
 )
 
+// Ограничения опросов
+const (
+	maxPollQuestionLength    = 300
+	maxPollOptionLength      = 100
+	maxPollExplanationLength = 200
+	minPollOptions           = 2
+	maxPollOptions           = 10
+	minPollDuration          = 5 * time.Second
+	maxPollDuration          = 30 * 24 * time.Hour
+)
+
+// pollRequest параметры нового опроса (POST /messages/:id/poll и поле poll при отправке сообщения)
+type pollRequest struct {
+	Question string `json:"question"`
+	Options  []struct {
+		Text string `json:"text"`
+	} `json:"options"`
+	MultipleChoice     bool   `json:"multipleChoice"`
+	Anonymous          bool   `json:"anonymous"`
+	Quiz               bool   `json:"quiz"`
+	CorrectOption      *int   `json:"correctOption"` // Индекс правильного варианта викторины
+	Explanation        string `json:"explanation"`   // Пояснение, которое видят ответившие
+	AllowAddingOptions bool   `json:"allowAddingOptions"`
+	CloseAt            *int64 `json:"closeAt"`     // Момент закрытия (мс)
+	ClosePeriod        int    `json:"closePeriod"` // Или длительность в секундах
+}
+
+// buildPoll проверяет параметры и собирает опрос с вариантами; errBody — ответ 400
+func buildPoll(req pollRequest, chatID, messageID, creatorID string) (models.Poll, gin.H) {
+	poll := models.Poll{
+		ID:                 uuid.New().String(),
+		ChatID:             chatID,
+		MessageID:          messageID,
+		Question:           strings.TrimSpace(req.Question),
+		CreatedBy:          creatorID,
+		MultipleChoice:     req.MultipleChoice,
+		Anonymous:          req.Anonymous,
+		Quiz:               req.Quiz,
+		AllowAddingOptions: req.AllowAddingOptions,
+	}
+	if poll.Question == "" || len([]rune(poll.Question)) > maxPollQuestionLength {
+		return poll, gin.H{"error": "invalid_question"}
+	}
+
+	seen := make(map[string]bool)
+	for _, opt := range req.Options {
+		text := strings.TrimSpace(opt.Text)
+		if text == "" {
+			continue
+		}
+		if len([]rune(text)) > maxPollOptionLength {
+			return poll, gin.H{"error": "invalid_option"}
+		}
+		if seen[strings.ToLower(text)] {
+			return poll, gin.H{"error": "duplicate_option"}
+		}
+		seen[strings.ToLower(text)] = true
+		poll.Options = append(poll.Options, models.PollOption{
+			ID:     uuid.New().String(),
+			PollID: poll.ID,
+			Text:   text,
+			Order:  len(poll.Options),
+		})
+	}
+	if len(poll.Options) < minPollOptions || len(poll.Options) > maxPollOptions {
+		return poll, gin.H{"error": "invalid_options", "min": minPollOptions, "max": maxPollOptions}
+	}
+
+	if req.Quiz {
+		// В викторине один ответ и фиксированный набор вариантов
+		if req.MultipleChoice || req.AllowAddingOptions {
+			return poll, gin.H{"error": "invalid_quiz"}
+		}
+		if req.CorrectOption == nil || *req.CorrectOption < 0 || *req.CorrectOption >= len(poll.Options) {
+			return poll, gin.H{"error": "invalid_correct_option"}
+		}
+		poll.CorrectOptionID = poll.Options[*req.CorrectOption].ID
+		poll.Explanation = strings.TrimSpace(req.Explanation)
+		if len([]rune(poll.Explanation)) > maxPollExplanationLength {
+			return poll, gin.H{"error": "invalid_explanation"}
+		}
+	} else if req.CorrectOption != nil || req.Explanation != "" {
+		return poll, gin.H{"error": "invalid_correct_option"}
+	}
+
+	if req.CloseAt != nil || req.ClosePeriod != 0 {
+		if req.CloseAt != nil && req.ClosePeriod != 0 {
+			return poll, gin.H{"error": "invalid_close_at"}
+		}
+		now := time.Now()
+		closeAt := now.Add(time.Duration(req.ClosePeriod) * time.Second)
+		if req.CloseAt != nil {
+			closeAt = time.UnixMilli(*req.CloseAt)
+		}
+		if closeAt.Before(now.Add(minPollDuration)) || closeAt.After(now.Add(maxPollDuration)) {
+			return poll, gin.H{"error": "invalid_close_at"}
+		}
+		poll.CloseAt = &closeAt
+	}
+	return poll, nil
+}
+
+// pollForMember опрос, доступный пользователю: он видит чат опроса
+func pollForMember(db *gorm.DB, pollID, userID string) (models.Poll, int, string) {
+	var poll models.Poll
+	if err := db.Preload("Options", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order(`"order" ASC`)
+	}).First(&poll, "id = ?", pollID).Error; err != nil {
+		return poll, http.StatusNotFound, "not_found"
+	}
+	if !authz.Can(userID, authz.Chat(poll.ChatID), authz.ViewChannel) {
+		return poll, http.StatusForbidden, "forbidden"
+	}
+	return poll, 0, ""
+}
+
+// pollVoteCount число голосов за вариант опроса (строка GROUP BY option_id)
+type pollVoteCount struct {
+	OptionID string
+	Votes    int64
+}
+
+// tallyPollOptions раскладывает агрегированные голоса по вариантам опроса.
+// Голоса за варианты, которых уже нет, учитываются только в общем числе
+func tallyPollOptions(poll models.Poll, counts []pollVoteCount, votersByOption map[string][]string) ([]gin.H, int64) {
+	votesByOption := make(map[string]int64, len(counts))
+	var totalVotes int64
+	for _, count := range counts {
+		votesByOption[count.OptionID] = count.Votes
+		totalVotes += count.Votes
+	}
+
+	options := make([]gin.H, len(poll.Options))
+	for i, opt := range poll.Options {
+		options[i] = gin.H{
+			"id":    opt.ID,
+			"text":  opt.Text,
+			"order": opt.Order,
+			"votes": votesByOption[opt.ID],
+		}
+		if opt.AddedBy != "" {
+			options[i]["addedBy"] = opt.AddedBy
+		}
+		if !poll.Anonymous {
+			voters := votersByOption[opt.ID]
+			if voters == nil {
+				voters = []string{}
+			}
+			options[i]["voters"] = voters
+		}
+	}
+	return options, totalVotes
+}
+
+// pollResults агрегированные результаты опроса, одинаковые для всех участников.
+// В анонимном опросе списки проголосовавших не раскрываются; правильный ответ викторины — только после закрытия
+func pollResults(db *gorm.DB, poll models.Poll) gin.H {
+	var counts []pollVoteCount
+	db.Model(&models.PollVote{}).Select("option_id, COUNT(*) AS votes").
+		Where("poll_id = ?", poll.ID).Group("option_id").Scan(&counts)
+	var totalVoters int64
+	db.Model(&models.PollVote{}).Where("poll_id = ?", poll.ID).Distinct("user_id").Count(&totalVoters)
+
+	votersByOption := make(map[string][]string)
+	if !poll.Anonymous {
+		var votes []models.PollVote
+		db.Select("option_id", "user_id").Where("poll_id = ?", poll.ID).Order("created_at ASC").Find(&votes)
+		for _, vote := range votes {
+			votersByOption[vote.OptionID] = append(votersByOption[vote.OptionID], vote.UserID)
+		}
+	}
+
+	options, totalVotes := tallyPollOptions(poll, counts, votersByOption)
+	result := gin.H{
+		"id":          poll.ID,
+		"pollId":      poll.ID,
+		"chatId":      poll.ChatID,
+		"messageId":   poll.MessageID,
+		"options":     options,
+		"totalVotes":  totalVotes,
+		"totalVoters": totalVoters,
+		"closed":      pollClosed(poll),
+		"closedAt":    poll.ClosedAt,
+	}
+	if poll.Quiz && pollClosed(poll) {
+		result["correctOptionId"] = poll.CorrectOptionID
+		result["explanation"] = poll.Explanation
+	}
+	return result
+}
+
+// pollPayload опрос для участника: параметры, результаты и выбор самого участника
+func pollPayload(db *gorm.DB, poll models.Poll, viewerID string) gin.H {
+	if poll.Options == nil {
+		db.Where("poll_id = ?", poll.ID).Order(`"order" ASC`).Find(&poll.Options)
+	}
+	payload := pollResults(db, poll)
+	payload["question"] = poll.Question
+	payload["createdBy"] = poll.CreatedBy
+	payload["createdAt"] = poll.CreatedAt.Unix() * 1000
+	payload["multipleChoice"] = poll.MultipleChoice
+	payload["anonymous"] = poll.Anonymous
+	payload["quiz"] = poll.Quiz
+	payload["allowAddingOptions"] = poll.AllowAddingOptions
+	payload["closeAt"] = poll.CloseAt
+
+	chosen := make([]string, 0)
+	db.Model(&models.PollVote{}).Where("poll_id = ? AND user_id = ?", poll.ID, viewerID).Pluck("option_id", &chosen)
+	payload["chosen"] = chosen
+	// Проголосовавший в викторине узнает правильный ответ сразу
+	if poll.Quiz && len(chosen) > 0 {
+		payload["correctOptionId"] = poll.CorrectOptionID
+		payload["explanation"] = poll.Explanation
+	}
+	return payload
+}
+
+// broadcastPollUpdate рассылает актуальные результаты опроса (в треде — подписчикам треда)
+func broadcastPollUpdate(db *gorm.DB, wsHub *websocket.Hub, poll models.Poll) {
+	event := wsEvent("poll:update", pollResults(db, poll))
+	var message models.Message
+	if err := db.Select("id", "chat_id", "thread_id").First(&message, "id = ?", poll.MessageID).Error; err != nil {
+		wsHub.BroadcastToChat(poll.ChatID, event)
+		return
+	}
+	broadcastMessageEvent(db, wsHub, message, event)
+}
+
+// pollClosed опрос закрыт вручную или его срок уже наступил
+// (StartPollCloser отмечает такие опросы закрытыми с задержкой)
+func pollClosed(poll models.Poll) bool {
+	return poll.ClosedAt != nil || poll.CloseAt != nil && !time.Now().Before(*poll.CloseAt)
+}
+
+// closePoll закрывает опрос; false — опрос уже закрыт. actorID пустой при закрытии по сроку
+func closePoll(db *gorm.DB, wsHub *websocket.Hub, poll models.Poll, actorID string) bool {
+	now := time.Now()
+	result := db.Model(&models.Poll{}).
+		Where("id = ? AND closed_at IS NULL", poll.ID).
+		Updates(map[string]interface{}{"closed_at": now, "closed_by": actorID})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	poll.ClosedAt = &now
+	poll.ClosedBy = actorID
+	broadcastPollUpdate(db, wsHub, poll)
+	return true
+}
+
+// castVote заменяет выбор пользователя на optionIDs; errBody вместе с кодом ответа
+func castVote(db *gorm.DB, poll models.Poll, userID string, optionIDs []string) (int, gin.H) {
+	if pollClosed(poll) {
+		return http.StatusConflict, gin.H{"error": "poll_closed"}
+	}
+	if len(optionIDs) == 0 {
+		return http.StatusBadRequest, gin.H{"error": "bad_request"}
+	}
+	if len(optionIDs) > 1 && !poll.MultipleChoice {
+		return http.StatusBadRequest, gin.H{"error": "multiple_choice_disabled"}
+	}
+
+	valid := make(map[string]bool, len(poll.Options))
+	for _, opt := range poll.Options {
+		valid[opt.ID] = true
+	}
+	selected := make(map[string]bool, len(optionIDs))
+	for _, optionID := range optionIDs {
+		if !valid[optionID] || selected[optionID] {
+			return http.StatusBadRequest, gin.H{"error": "invalid_option"}
+		}
+		selected[optionID] = true
+	}
+
+	var current []string
+	db.Model(&models.PollVote{}).Where("poll_id = ? AND user_id = ?", poll.ID, userID).Pluck("option_id", &current)
+	if len(current) > 0 && poll.Quiz {
+		return http.StatusConflict, gin.H{"error": "already_voted"}
+	}
+	if len(current) == len(selected) {
+		same := true
+		for _, optionID := range current {
+			same = same && selected[optionID]
+		}
+		if same {
+			return http.StatusConflict, gin.H{"error": "already_voted"}
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("poll_id = ? AND user_id = ?", poll.ID, userID).Delete(&models.PollVote{}).Error; err != nil {
+			return err
+		}
+		for _, optionID := range optionIDs {
+			vote := models.PollVote{
+				ID:       uuid.New().String(),
+				PollID:   poll.ID,
+				UserID:   userID,
+				OptionID: optionID,
+			}
+			if err := tx.Create(&vote).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return http.StatusInternalServerError, gin.H{"error": "server_error"}
+	}
+	return 0, nil
+}
+
+// votePoll общая часть голосования по pollId и по messageId
+func votePoll(c *gin.Context, db *gorm.DB, wsHub *websocket.Hub, pollID, userID string) {
+	var req struct {
+		OptionID  string   `json:"optionId"`
+		OptionIDs []string `json:"optionIds"` // Несколько вариантов (multipleChoice)
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+		return
+	}
+	optionIDs := req.OptionIDs
+	if req.OptionID != "" {
+		optionIDs = append([]string{req.OptionID}, optionIDs...)
+	}
+
+	poll, status, code := pollForMember(db, pollID, userID)
+	if status != 0 {
+		c.JSON(status, gin.H{"error": code})
+		return
+	}
+	if status, errBody := castVote(db, poll, userID, optionIDs); errBody != nil {
+		c.JSON(status, errBody)
+		return
+	}
+
+	broadcastPollUpdate(db, wsHub, poll)
+	payload := pollPayload(db, poll, userID)
+	// Другие устройства проголосовавшего узнают его выбор
+	wsHub.SendToUser(userID, wsEvent("poll:voted", gin.H{"pollId": poll.ID, "messageId": poll.MessageID, "chosen": payload["chosen"]}))
+	c.JSON(http.StatusOK, payload)
+}
+
 // CreatePoll создает опрос в сообщении
 func CreatePoll(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -21,13 +368,7 @@ func CreatePoll(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 			return
 		}
 
-		var req struct {
-			Question   string   `json:"question" binding:"required"`
-			Options    []struct {
-				Text string `json:"text" binding:"required"`
-			} `json:"options" binding:"required,min=2,max=10"`
-		}
-
+		var req pollRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
 			return
@@ -52,81 +393,29 @@ func CreatePoll(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 			return
 		}
 
-		// Создаем опрос
-		poll := models.Poll{
-			ID:        uuid.New().String(),
-			ChatID:    message.ChatID,
-			MessageID: messageID,
-			Question:  req.Question,
-			CreatedBy: userIDStr,
-		}
-		
-		// Создаем опции
-		for i, opt := range req.Options {
-			if opt.Text != "" {
-				poll.Options = append(poll.Options, models.PollOption{
-					ID:     uuid.New().String(),
-					PollID: poll.ID,
-					Text:   opt.Text,
-					Order:  i,
-				})
-			}
+		poll, errBody := buildPoll(req, message.ChatID, messageID, userIDStr)
+		if errBody != nil {
+			c.JSON(http.StatusBadRequest, errBody)
+			return
 		}
 
 		if err := db.Create(&poll).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
 			return
 		}
-		
+
 		// Обновляем сообщение с pollID
 		message.PollID = poll.ID
 		db.Save(&message)
 
-		// Загружаем опрос с голосами
-		db.Preload("Options").Preload("Votes").Preload("Votes.User").First(&poll, "id = ?", poll.ID)
-
-		// Формируем ответ
-		optionsData := make([]gin.H, len(poll.Options))
-		for i, opt := range poll.Options {
-			optionsData[i] = gin.H{
-				"id":   opt.ID,
-				"text": opt.Text,
-			}
-		}
-		
-		response := gin.H{
-			"id":         poll.ID,
-			"messageId":  poll.MessageID,
-			"question":   poll.Question,
-			"options":    optionsData,
-			"createdAt":  poll.CreatedAt.Unix() * 1000,
-			"votes":      make([]gin.H, len(poll.Votes)),
-		}
-
-		for i, vote := range poll.Votes {
-			response["votes"].([]gin.H)[i] = gin.H{
-				"id":       vote.ID,
-				"userId":   vote.UserID,
-				"optionId": vote.OptionID,
-				"createdAt": vote.CreatedAt.Unix() * 1000,
-			}
-			if vote.User.ID != "" {
-				response["votes"].([]gin.H)[i]["user"] = gin.H{
-					"id":       vote.User.ID,
-					"username": vote.User.Username,
-					"avatarUrl": vote.User.AvatarURL,
-				}
-			}
-		}
-
-		c.JSON(http.StatusOK, response)
+		broadcastPollUpdate(db, wsHub, poll)
+		c.JSON(http.StatusOK, pollPayload(db, poll, userIDStr))
 	}
 }
 
 // VotePollByMessage голосует в опросе по messageId
 func VotePollByMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		messageID := c.Param("id")
 		userID, _ := c.Get("userID")
 		userIDStr, ok := userID.(string)
 		if !ok {
@@ -134,113 +423,104 @@ func VotePollByMessage(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 			return
 		}
 
-		var req struct {
-			OptionID string `json:"optionId" binding:"required"`
-		}
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
-			return
-		}
-
-		// Находим сообщение и опрос
 		var message models.Message
-		if err := db.First(&message, "id = ?", messageID).Error; err != nil {
+		if err := db.First(&message, "id = ?", c.Param("id")).Error; err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
 			return
 		}
-
 		if message.PollID == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "not_a_poll"})
 			return
 		}
 
-		// Вызываем VotePoll с pollID
-		pollID := message.PollID
-		var poll models.Poll
-		if err := db.Preload("Options").First(&poll, "id = ?", pollID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "poll_not_found"})
+		votePoll(c, db, wsHub, message.PollID, userIDStr)
+	}
+}
+
+// VotePoll голосует в опросе: optionId или optionIds (для multipleChoice). Повторный голос заменяет выбор
+func VotePoll(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
 			return
 		}
 
-		// Проверяем, что опция существует
-		optionExists := false
-		for _, opt := range poll.Options {
-			if opt.ID == req.OptionID {
-				optionExists = true
-				break
-			}
-		}
+		votePoll(c, db, wsHub, c.Param("id"), userIDStr)
+	}
+}
 
-		if !optionExists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_option"})
+// RetractPollVote отзывает голос текущего пользователя (в викторине голос окончательный)
+func RetractPollVote(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
 			return
 		}
 
-		// Проверяем существующий голос
-		var existingVote models.PollVote
-		if err := db.Where("poll_id = ? AND user_id = ?", pollID, userIDStr).First(&existingVote).Error; err == nil {
-			if existingVote.OptionID == req.OptionID {
-				c.JSON(http.StatusConflict, gin.H{"error": "already_voted"})
-				return
-			}
-			// Обновляем голос
-			existingVote.OptionID = req.OptionID
-			if err := db.Save(&existingVote).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
-				return
-			}
-		} else {
-			// Создаем новый голос
-			vote := models.PollVote{
-				ID:       uuid.New().String(),
-				PollID:   pollID,
-				UserID:   userIDStr,
-				OptionID: req.OptionID,
-			}
-			if err := db.Create(&vote).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
-				return
-			}
+		poll, status, code := pollForMember(db, c.Param("id"), userIDStr)
+		if status != 0 {
+			c.JSON(status, gin.H{"error": code})
+			return
+		}
+		if pollClosed(poll) {
+			c.JSON(http.StatusConflict, gin.H{"error": "poll_closed"})
+			return
+		}
+		if poll.Quiz {
+			c.JSON(http.StatusConflict, gin.H{"error": "quiz_vote_final"})
+			return
 		}
 
-		// Загружаем обновленный опрос
-		db.Preload("Options").Preload("Votes").Preload("Votes.User").First(&poll, "id = ?", pollID)
+		result := db.Where("poll_id = ? AND user_id = ?", poll.ID, userIDStr).Delete(&models.PollVote{})
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		if result.RowsAffected > 0 {
+			broadcastPollUpdate(db, wsHub, poll)
+			wsHub.SendToUser(userIDStr, wsEvent("poll:voted", gin.H{"pollId": poll.ID, "messageId": poll.MessageID, "chosen": []string{}}))
+		}
+		c.JSON(http.StatusOK, pollPayload(db, poll, userIDStr))
+	}
+}
 
-		// Формируем ответ
-		totalVotes := int64(len(poll.Votes))
-		optionsWithVotes := make([]gin.H, 0)
-		for _, opt := range poll.Options {
-			voteCount := int64(0)
-			voters := make([]string, 0)
-			for _, vote := range poll.Votes {
-				if vote.OptionID == opt.ID {
-					voteCount++
-					voters = append(voters, vote.UserID)
-				}
-			}
-			optionsWithVotes = append(optionsWithVotes, gin.H{
-				"id":     opt.ID,
-				"text":   opt.Text,
-				"votes":  voteCount,
-				"voters": voters,
-			})
+// ClosePoll закрывает опрос досрочно (автор опроса или модератор чата)
+func ClosePoll(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
 		}
 
-		response := gin.H{
-			"id":         poll.ID,
-			"question":   poll.Question,
-			"options":    optionsWithVotes,
-			"totalVotes": totalVotes,
+		poll, status, code := pollForMember(db, c.Param("id"), userIDStr)
+		if status != 0 {
+			c.JSON(status, gin.H{"error": code})
+			return
+		}
+		if poll.CreatedBy != userIDStr && !authz.Can(userIDStr, authz.Chat(poll.ChatID), authz.ManageMessages) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		if !closePoll(db, wsHub, poll, userIDStr) {
+			c.JSON(http.StatusConflict, gin.H{"error": "poll_closed"})
+			return
 		}
 
-		c.JSON(http.StatusOK, response)
+		db.First(&poll, "id = ?", poll.ID)
+		c.JSON(http.StatusOK, pollPayload(db, poll, userIDStr))
 	}
 }
 
-// VotePoll голосует в опросе
-func VotePoll(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+// AddPollOption добавляет вариант в открытый опрос: автор опроса или любой участник,
+// если опрос это разрешает. В викторине варианты не добавляются
+func AddPollOption(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		pollID := c.Param("id")
 		userID, _ := c.Get("userID")
 		userIDStr, ok := userID.(string)
 		if !ok {
@@ -249,158 +529,131 @@ func VotePoll(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 		}
 
 		var req struct {
-			OptionID string `json:"optionId" binding:"required"`
+			Text string `json:"text" binding:"required"`
 		}
-
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
 			return
 		}
 
-		// Проверяем существование опроса
-		var poll models.Poll
-		if err := db.Preload("Message").First(&poll, "id = ?", pollID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+		poll, status, code := pollForMember(db, c.Param("id"), userIDStr)
+		if status != 0 {
+			c.JSON(status, gin.H{"error": code})
 			return
 		}
-
-		// Загружаем опции
-		db.Preload("Options").First(&poll, "id = ?", pollID)
-		
-		// Проверяем, что опция существует
-		optionExists := false
-		for _, opt := range poll.Options {
-			if opt.ID == req.OptionID {
-				optionExists = true
-				break
-			}
+		if poll.CreatedBy != userIDStr && (!poll.AllowAddingOptions || !authz.Can(userIDStr, authz.Chat(poll.ChatID), authz.SendMessages)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		if poll.Quiz {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_quiz"})
+			return
+		}
+		if pollClosed(poll) {
+			c.JSON(http.StatusConflict, gin.H{"error": "poll_closed"})
+			return
 		}
 
-		if !optionExists {
+		text := strings.TrimSpace(req.Text)
+		if text == "" || len([]rune(text)) > maxPollOptionLength {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_option"})
 			return
 		}
-
-		// Проверяем существующий голос (для одиночного выбора - обновляем, для множественного - создаем новый)
-		var existingVote models.PollVote
-		if err := db.Where("poll_id = ? AND user_id = ?", pollID, userIDStr).First(&existingVote).Error; err == nil {
-			// Если уже голосовал за эту опцию - ошибка
-			if existingVote.OptionID == req.OptionID {
-				c.JSON(http.StatusConflict, gin.H{"error": "already_voted"})
-				return
-			}
-			// Обновляем голос на новую опцию
-			existingVote.OptionID = req.OptionID
-			if err := db.Save(&existingVote).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		if len(poll.Options) >= maxPollOptions {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "too_many_options", "max": maxPollOptions})
+			return
+		}
+		for _, opt := range poll.Options {
+			if strings.EqualFold(opt.Text, text) {
+				c.JSON(http.StatusConflict, gin.H{"error": "duplicate_option"})
 				return
 			}
-			c.JSON(http.StatusOK, gin.H{"ok": true, "voteId": existingVote.ID})
-			return
 		}
 
-		// Создаем новый голос
-		vote := models.PollVote{
-			ID:       uuid.New().String(),
-			PollID:   pollID,
-			UserID:   userIDStr,
-			OptionID: req.OptionID,
+		option := models.PollOption{
+			ID:      uuid.New().String(),
+			PollID:  poll.ID,
+			Text:    text,
+			Order:   len(poll.Options),
+			AddedBy: userIDStr,
 		}
-
-		if err := db.Create(&vote).Error; err != nil {
+		if err := db.Create(&option).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
 			return
 		}
+		poll.Options = append(poll.Options, option)
 
-		// Загружаем обновленный опрос
-		db.Preload("Options").Preload("Votes").Preload("Votes.User").First(&poll, "id = ?", pollID)
-
-		// Формируем ответ
-		optionsData := make([]gin.H, len(poll.Options))
-		for i, opt := range poll.Options {
-			optionsData[i] = gin.H{
-				"id":   opt.ID,
-				"text": opt.Text,
-			}
-		}
-		
-		response := gin.H{
-			"id":         poll.ID,
-			"messageId":  poll.MessageID,
-			"question":   poll.Question,
-			"options":    optionsData,
-			"createdAt":  poll.CreatedAt.Unix() * 1000,
-			"votes":      make([]gin.H, len(poll.Votes)),
-		}
-
-		for i, v := range poll.Votes {
-			response["votes"].([]gin.H)[i] = gin.H{
-				"id":       v.ID,
-				"userId":   v.UserID,
-				"optionId": v.OptionID,
-				"createdAt": v.CreatedAt.Unix() * 1000,
-			}
-			if v.User.ID != "" {
-				response["votes"].([]gin.H)[i]["user"] = gin.H{
-					"id":       v.User.ID,
-					"username": v.User.Username,
-					"avatarUrl": v.User.AvatarURL,
-				}
-			}
-		}
-
-		c.JSON(http.StatusOK, response)
+		broadcastPollUpdate(db, wsHub, poll)
+		c.JSON(http.StatusOK, pollPayload(db, poll, userIDStr))
 	}
 }
 
-// GetPoll возвращает информацию об опросе
+// GetPoll возвращает информацию об опросе; в открытом опросе — вместе со списком голосов
 func GetPoll(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		pollID := c.Param("id")
-
-		var poll models.Poll
-		if err := db.Preload("Votes").Preload("Votes.User").First(&poll, "id = ?", pollID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
 			return
 		}
 
-		// Загружаем опции
-		db.Preload("Options").First(&poll, "id = ?", pollID)
-		
-		optionsData := make([]gin.H, len(poll.Options))
-		for i, opt := range poll.Options {
-			optionsData[i] = gin.H{
-				"id":   opt.ID,
-				"text": opt.Text,
-			}
+		poll, status, code := pollForMember(db, c.Param("id"), userIDStr)
+		if status != 0 {
+			c.JSON(status, gin.H{"error": code})
+			return
 		}
-		
-		response := gin.H{
-			"id":         poll.ID,
-			"messageId":  poll.MessageID,
-			"question":   poll.Question,
-			"options":    optionsData,
-			"createdAt":  poll.CreatedAt.Unix() * 1000,
-			"votes":      make([]gin.H, len(poll.Votes)),
-		}
-
-		for i, vote := range poll.Votes {
-			response["votes"].([]gin.H)[i] = gin.H{
-				"id":       vote.ID,
-				"userId":   vote.UserID,
-				"optionId": vote.OptionID,
-				"createdAt": vote.CreatedAt.Unix() * 1000,
+
+		response := pollPayload(db, poll, userIDStr)
+		if !poll.Anonymous {
+			var votes []models.PollVote
+			db.Where("poll_id = ?", poll.ID).Preload("User").Order("created_at ASC").Find(&votes)
+			voterIDs := make([]string, len(votes))
+			for i, vote := range votes {
+				voterIDs[i] = vote.UserID
 			}
-			if vote.User.ID != "" {
-				response["votes"].([]gin.H)[i]["user"] = gin.H{
-					"id":       vote.User.ID,
-					"username": vote.User.Username,
-					"avatarUrl": vote.User.AvatarURL,
+			voters := newPrivacyView(db, userIDStr, voterIDs)
+			votesData := make([]gin.H, len(votes))
+			for i, vote := range votes {
+				votesData[i] = gin.H{
+					"id":        vote.ID,
+					"userId":    vote.UserID,
+					"optionId":  vote.OptionID,
+					"createdAt": vote.CreatedAt.Unix() * 1000,
+				}
+				if vote.User.ID != "" {
+					votesData[i]["user"] = gin.H{
+						"id":        vote.User.ID,
+						"username":  vote.User.Username,
+						"avatarUrl": voters.avatar(vote.User),
+					}
 				}
 			}
+			response["votes"] = votesData
 		}
 
 		c.JSON(http.StatusOK, response)
 	}
 }
 
+// StartPollCloser закрывает опросы, у которых наступил срок closeAt
+func StartPollCloser(db *gorm.DB, wsHub *websocket.Hub) {
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		var polls []models.Poll
+		db.Preload("Options", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order(`"order" ASC`)
+		}).Where("closed_at IS NULL AND close_at <= ?", time.Now()).Limit(100).Find(&polls)
+
+		closed := 0
+		for _, poll := range polls {
+			if closePoll(db, wsHub, poll, "") {
+				closed++
+			}
+		}
+		if closed > 0 {
+			log.Printf("Closed %d polls by deadline", closed)
+		}
+	}
+}
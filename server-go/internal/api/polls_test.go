@@ -0,0 +1,111 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"safegram-server/internal/models"
+)
+
+func TestTallyPollOptions(t *testing.T) {
+	options := []models.PollOption{{ID: "a", Text: "A"}, {ID: "b", Text: "B", Order: 1}, {ID: "c", Text: "C", Order: 2, AddedBy: "u3"}}
+	voters := map[string][]string{"a": {"u1", "u2", "u3"}, "b": {"u1"}}
+
+	tests := []struct {
+		name       string
+		poll       models.Poll
+		counts     []pollVoteCount
+		voters     map[string][]string
+		votesBy    map[string]int64
+		votersBy   map[string][]string // nil — списки не раскрываются
+		totalVotes int64
+	}{
+		{
+			name:       "без голосов",
+			poll:       models.Poll{Options: options},
+			voters:     map[string][]string{},
+			votesBy:    map[string]int64{"a": 0, "b": 0, "c": 0},
+			votersBy:   map[string][]string{"a": {}, "b": {}, "c": {}},
+			totalVotes: 0,
+		},
+		{
+			name:       "голоса по вариантам",
+			poll:       models.Poll{MultipleChoice: true, Options: options},
+			counts:     []pollVoteCount{{OptionID: "a", Votes: 3}, {OptionID: "b", Votes: 1}},
+			voters:     voters,
+			votesBy:    map[string]int64{"a": 3, "b": 1, "c": 0},
+			votersBy:   map[string][]string{"a": {"u1", "u2", "u3"}, "b": {"u1"}, "c": {}},
+			totalVotes: 4,
+		},
+		{
+			name:       "голоса за удаленный вариант только в общем числе",
+			poll:       models.Poll{Options: options},
+			counts:     []pollVoteCount{{OptionID: "a", Votes: 2}, {OptionID: "gone", Votes: 5}},
+			voters:     map[string][]string{},
+			votesBy:    map[string]int64{"a": 2, "b": 0, "c": 0},
+			votersBy:   map[string][]string{"a": {}, "b": {}, "c": {}},
+			totalVotes: 7,
+		},
+		{
+			name:       "анонимный опрос без списков проголосовавших",
+			poll:       models.Poll{Anonymous: true, Options: options},
+			counts:     []pollVoteCount{{OptionID: "a", Votes: 3}, {OptionID: "b", Votes: 1}},
+			voters:     voters,
+			votesBy:    map[string]int64{"a": 3, "b": 1, "c": 0},
+			totalVotes: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, totalVotes := tallyPollOptions(tt.poll, tt.counts, tt.voters)
+			if totalVotes != tt.totalVotes {
+				t.Errorf("totalVotes = %d, want %d", totalVotes, tt.totalVotes)
+			}
+			if len(result) != len(tt.poll.Options) {
+				t.Fatalf("options = %d, want %d", len(result), len(tt.poll.Options))
+			}
+			for i, option := range result {
+				id := option["id"].(string)
+				if id != tt.poll.Options[i].ID {
+					t.Errorf("option[%d] = %s, want %s", i, id, tt.poll.Options[i].ID)
+				}
+				if got := option["votes"]; got != tt.votesBy[id] {
+					t.Errorf("votes[%s] = %v, want %d", id, got, tt.votesBy[id])
+				}
+				voters, shown := option["voters"]
+				if tt.votersBy == nil {
+					if shown {
+						t.Errorf("voters[%s] раскрыты в анонимном опросе", id)
+					}
+					continue
+				}
+				if !reflect.DeepEqual(voters, tt.votersBy[id]) {
+					t.Errorf("voters[%s] = %v, want %v", id, voters, tt.votersBy[id])
+				}
+			}
+		})
+	}
+}
+
+func TestPollClosed(t *testing.T) {
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	tests := []struct {
+		name string
+		poll models.Poll
+		want bool
+	}{
+		{"открыт", models.Poll{}, false},
+		{"срок еще не наступил", models.Poll{CloseAt: &future}, false},
+		{"срок прошел, закрытие еще не обработано", models.Poll{CloseAt: &past}, true},
+		{"закрыт вручную", models.Poll{ClosedAt: &past}, true},
+		{"закрыт раньше срока", models.Poll{CloseAt: &future, ClosedAt: &past}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pollClosed(tt.poll); got != tt.want {
+				t.Errorf("pollClosed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"safegram-server/internal/models"
+	"safegram-server/internal/redis"
+	"safegram-server/internal/websocket"
+)
+
+// Состояния присутствия. invisible видит только сам пользователь, остальным он offline
+const (
+	presenceOnline    = "online"
+	presenceIdle      = "idle"
+	presenceDND       = "dnd"
+	presenceInvisible = "invisible"
+	presenceOffline   = "offline"
+)
+
+// presenceGroupLimit группы крупнее не участвуют в рассылке присутствия
+const presenceGroupLimit = 500
+
+// presenceMode нормализует режим, выбранный пользователем (старые статусы away/busy/offline)
+func presenceMode(status string) (string, bool) {
+	switch status {
+	case presenceOnline, presenceIdle, presenceDND, presenceInvisible:
+		return status, true
+	case "away":
+		return presenceIdle, true
+	case "busy":
+		return presenceDND, true
+	case presenceOffline:
+		return presenceInvisible, true
+	}
+	return "", false
+}
+
+// publicPresence состояние, которое видят другие пользователи
+func publicPresence(state string) string {
+	if state == presenceInvisible {
+		return presenceOffline
+	}
+	return state
+}
+
+// presenceService агрегирует устройства пользователя и рассылает изменения
+// только тем, кому присутствие разрешено видеть
+type presenceService struct {
+	db  *gorm.DB
+	hub *websocket.Hub
+
+	mu   sync.Mutex
+	last map[string]string // последнее разосланное публичное состояние
+}
+
+var presence *presenceService
+
+// RegisterPresence подключает сервис присутствия к hub (до запуска Run)
+func RegisterPresence(db *gorm.DB, hub *websocket.Hub) {
+	presence = &presenceService{db: db, hub: hub, last: make(map[string]string)}
+	hub.OnConnect(presence.connected)
+	hub.OnDisconnect(presence.disconnected)
+	hub.On("presence:update", presence.activity)
+	go redis.SubscribeDeviceExpiry(presence.expired)
+}
+
+// userPresence текущее состояние пользователя (с точки зрения его самого)
+func userPresence(userID string) string {
+	activities, err := redis.DeviceActivities(userID)
+	if err != nil || len(activities) == 0 {
+		return presenceOffline
+	}
+	mode, _ := redis.GetPresenceMode(userID)
+	switch mode {
+	case presenceInvisible, presenceDND, presenceIdle:
+		return mode
+	}
+	for _, activity := range activities {
+		if activity == "active" {
+			return presenceOnline
+		}
+	}
+	return presenceIdle
+}
+
+// presenceCandidates пользователи, связанные с userID: контакты в обе стороны
+// и участники общих личных чатов и небольших групп
+func presenceCandidates(db *gorm.DB, userID string) []string {
+	var ids []string
+	db.Raw(`SELECT contact_id FROM contacts WHERE owner_id = ?
+		UNION SELECT owner_id FROM contacts WHERE contact_id = ?
+		UNION SELECT m2.user_id FROM chat_members m1
+			JOIN chats ch ON ch.id = m1.chat_id AND ch.type IN ('dm', 'group') AND ch.deleted_at IS NULL
+			JOIN chat_members m2 ON m2.chat_id = m1.chat_id AND m2.deleted_at IS NULL
+			WHERE m1.user_id = ? AND m1.deleted_at IS NULL
+			AND (SELECT COUNT(*) FROM chat_members x WHERE x.chat_id = ch.id AND x.deleted_at IS NULL) <= ?`,
+		userID, userID, userID, presenceGroupLimit).Scan(&ids)
+
+	result := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id != userID {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// presenceAudience кому разрешено видеть присутствие userID (правило last seen и блокировки)
+func presenceAudience(db *gorm.DB, userID string) []string {
+	var user models.User
+	if err := db.Select("id", "privacy_last_seen").First(&user, "id = ?", userID).Error; err != nil {
+		return nil
+	}
+	rule := privacyRule(user.PrivacyLastSeen)
+	if rule == models.PrivacyNobody {
+		return nil
+	}
+
+	candidates := presenceCandidates(db, userID)
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	var blocked []string
+	db.Model(&models.UserBlock{}).Where("blocker_id = ? AND blocked_id IN ?", userID, candidates).Pluck("blocked_id", &blocked)
+	excluded := make(map[string]bool, len(blocked))
+	for _, id := range blocked {
+		excluded[id] = true
+	}
+	var contacts map[string]bool
+	if rule == models.PrivacyContacts {
+		var ids []string
+		db.Model(&models.Contact{}).Where("owner_id = ? AND contact_id IN ?", userID, candidates).Pluck("contact_id", &ids)
+		contacts = make(map[string]bool, len(ids))
+		for _, id := range ids {
+			contacts[id] = true
+		}
+	}
+
+	audience := make([]string, 0, len(candidates))
+	for _, id := range candidates {
+		if excluded[id] || (contacts != nil && !contacts[id]) {
+			continue
+		}
+		audience = append(audience, id)
+	}
+	return audience
+}
+
+// publish рассылает изменившееся состояние пользователя
+func (p *presenceService) publish(userID string) {
+	state := userPresence(userID)
+	p.hub.SendToUser(userID, wsEvent("presence:self", gin.H{"status": state}))
+
+	public := publicPresence(state)
+	p.mu.Lock()
+	if p.last[userID] == public {
+		p.mu.Unlock()
+		return
+	}
+	if public == presenceOffline {
+		delete(p.last, userID)
+	} else {
+		p.last[userID] = public
+	}
+	p.mu.Unlock()
+
+	data := gin.H{"userId": userID, "status": public}
+	if public == presenceOffline {
+		var user models.User
+		p.db.Select("id", "last_seen").First(&user, "id = ?", userID)
+		data["lastSeen"] = user.LastSeen
+	}
+	p.hub.SendToUsers(presenceAudience(p.db, userID), wsEvent("presence", data))
+}
+
+// snapshot состояния пользователей, чье присутствие видит viewerID
+func presenceSnapshot(db *gorm.DB, viewerID string) []gin.H {
+	candidates := presenceCandidates(db, viewerID)
+	result := make([]gin.H, 0, len(candidates))
+	if len(candidates) == 0 {
+		return result
+	}
+
+	var users []models.User
+	db.Select("id", "privacy_last_seen", "last_seen").Where("id IN ?", candidates).Find(&users)
+	view := newPrivacyView(db, viewerID, candidates)
+	online, _ := redis.OnlineAmong(candidates)
+	for _, user := range users {
+		if !view.allows(user, user.PrivacyLastSeen) {
+			continue
+		}
+		status := presenceOffline
+		if online[user.ID] {
+			status = publicPresence(userPresence(user.ID))
+		}
+		entry := gin.H{"userId": user.ID, "status": status}
+		if status == presenceOffline {
+			entry["lastSeen"] = user.LastSeen
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+func (p *presenceService) connected(userID, clientID string, firstConnection bool) {
+	if err := redis.SetDevicePresence(userID, clientID, "active"); err != nil {
+		log.Printf("Presence: failed to register device: %v", err)
+		return
+	}
+	// Подключение могло закрыться раньше, чем отработал этот обработчик
+	if !p.hub.HasClient(clientID) {
+		redis.RemoveDevicePresence(userID, clientID)
+		return
+	}
+	p.hub.SendToClient(clientID, wsEvent("presence:snapshot", gin.H{"users": presenceSnapshot(p.db, userID)}))
+	p.publish(userID)
+}
+
+func (p *presenceService) disconnected(userID, clientID string, lastConnection bool) {
+	p.deviceGone(userID, clientID)
+}
+
+// expired запись устройства истекла без отключения (упал сервер или пропущен heartbeat)
+func (p *presenceService) expired(userID, clientID string) {
+	if p.hub.HasClient(clientID) {
+		redis.SetDevicePresence(userID, clientID, "active")
+		return
+	}
+	p.deviceGone(userID, clientID)
+}
+
+// deviceGone убирает устройство; с последним устройством фиксируется last seen
+func (p *presenceService) deviceGone(userID, clientID string) {
+	redis.RemoveDevicePresence(userID, clientID)
+	if activities, err := redis.DeviceActivities(userID); err == nil && len(activities) == 0 {
+		now := time.Now()
+		p.db.Model(&models.User{}).Where("id = ?", userID).Update("last_seen", &now)
+	}
+	p.publish(userID)
+}
+
+// activity presence:update {activity: active|idle} — активность устройства
+func (p *presenceService) activity(client *websocket.Client, msg map[string]interface{}) {
+	activity, _ := msg["activity"].(string)
+	if activity != "active" && activity != "idle" {
+		return
+	}
+	if err := redis.SetDevicePresence(client.UserID(), client.ID(), activity); err != nil {
+		return
+	}
+	p.publish(client.UserID())
+}
+
+// setPresenceMode сохраняет режим пользователя и рассылает новое состояние.
+// Режим живет только в Redis: users.status публичен, и invisible в нем выдал бы пользователя
+func setPresenceMode(userID, mode string) {
+	if err := redis.SetPresenceMode(userID, mode); err != nil {
+		log.Printf("Presence: failed to save mode: %v", err)
+	}
+	if presence != nil {
+		presence.publish(userID)
+	}
+}
+
+// GetPresence возвращает состояния пользователей, чье присутствие видно текущему
+func GetPresence(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"self":  userPresence(userIDStr),
+			"users": presenceSnapshot(db, userIDStr),
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"safegram-server/internal/models"
+	"safegram-server/internal/redis"
+)
+
+// privacyRule нормализует правило приватности (пустое — everyone)
+func privacyRule(rule string) string {
+	switch rule {
+	case models.PrivacyContacts, models.PrivacyNobody:
+		return rule
+	}
+	return models.PrivacyEveryone
+}
+
+func validPrivacyRule(rule string) bool {
+	return rule == models.PrivacyEveryone || rule == models.PrivacyContacts || rule == models.PrivacyNobody
+}
+
+// avatarRule и bioRule учитывают старые флаги ShowAvatar/ShowBio
+func avatarRule(user models.User) string {
+	if !user.ShowAvatar {
+		return models.PrivacyNobody
+	}
+	return privacyRule(user.PrivacyAvatar)
+}
+
+func bioRule(user models.User) string {
+	if !user.ShowBio {
+		return models.PrivacyNobody
+	}
+	return privacyRule(user.PrivacyBio)
+}
+
+// privacyView отношения зрителя с набором пользователей, загруженные заранее,
+// чтобы сериализация списков не делала запросов на каждого пользователя
+type privacyView struct {
+	viewerID  string
+	contactOf map[string]bool   // пользователи, у которых зритель есть в контактах
+	blockedBy map[string]bool   // пользователи, заблокировавшие зрителя
+	blocked   map[string]bool   // пользователи, заблокированные зрителем
+	nicknames map[string]string // контакты зрителя и их имена
+
+	presence func(userID string) string // состояние пользователя; nil — userPresence
+}
+
+func newPrivacyView(db *gorm.DB, viewerID string, userIDs []string) *privacyView {
+	v := &privacyView{
+		viewerID:  viewerID,
+		contactOf: make(map[string]bool),
+		blockedBy: make(map[string]bool),
+		blocked:   make(map[string]bool),
+		nicknames: make(map[string]string),
+	}
+	if len(userIDs) == 0 {
+		return v
+	}
+
+	var reverse []string
+	db.Model(&models.Contact{}).Where("contact_id = ? AND owner_id IN ?", viewerID, userIDs).Pluck("owner_id", &reverse)
+	for _, id := range reverse {
+		v.contactOf[id] = true
+	}
+
+	var contacts []models.Contact
+	db.Where("owner_id = ? AND contact_id IN ?", viewerID, userIDs).Find(&contacts)
+	for _, contact := range contacts {
+		v.nicknames[contact.ContactID] = contact.Nickname
+	}
+
+	var blocks []models.UserBlock
+	db.Where("(blocker_id = ? AND blocked_id IN ?) OR (blocked_id = ? AND blocker_id IN ?)", viewerID, userIDs, viewerID, userIDs).
+		Find(&blocks)
+	for _, block := range blocks {
+		if block.BlockerID == viewerID {
+			v.blocked[block.BlockedID] = true
+		} else {
+			v.blockedBy[block.BlockerID] = true
+		}
+	}
+	return v
+}
+
+// allows проверяет правило пользователя для зрителя; заблокировавший видит зрителя как «nobody»
+func (v *privacyView) allows(user models.User, rule string) bool {
+	if user.ID == v.viewerID {
+		return true
+	}
+	if v.blockedBy[user.ID] {
+		return false
+	}
+	switch privacyRule(rule) {
+	case models.PrivacyEveryone:
+		return true
+	case models.PrivacyContacts:
+		return v.contactOf[user.ID]
+	}
+	return false
+}
+
+// isContact пользователь есть в контактах зрителя
+func (v *privacyView) isContact(userID string) bool {
+	_, ok := v.nicknames[userID]
+	return ok
+}
+
+// avatar аватар пользователя, если зрителю его видно, иначе пустая строка
+func (v *privacyView) avatar(user models.User) string {
+	if v.allows(user, avatarRule(user)) {
+		return user.AvatarURL
+	}
+	return ""
+}
+
+// visibleAvatar аватар одного пользователя для зрителя.
+// user должен быть загружен целиком: правило берется из show_avatar и privacy_avatar
+func visibleAvatar(db *gorm.DB, viewerID string, user models.User) string {
+	if user.AvatarURL == "" || user.ID == viewerID {
+		return user.AvatarURL
+	}
+	return newPrivacyView(db, viewerID, []string{user.ID}).avatar(user)
+}
+
+// publicAvatar аватар для данных, которые получают сразу многие (события чата, вебхуки):
+// только если он виден всем
+func publicAvatar(user models.User) string {
+	if avatarRule(user) == models.PrivacyEveryone {
+		return user.AvatarURL
+	}
+	return ""
+}
+
+// presenceAmong состояния набора пользователей: подробности из Redis запрашиваются
+// только у тех, кто онлайн, остальные сразу offline
+func presenceAmong(userIDs []string) func(userID string) string {
+	online, err := redis.OnlineAmong(userIDs)
+	return func(userID string) string {
+		if err == nil && !online[userID] {
+			return presenceOffline
+		}
+		return userPresence(userID)
+	}
+}
+
+// status публичное состояние пользователя; hidden, если last seen зрителю не виден
+func (v *privacyView) status(user models.User) string {
+	if !v.allows(user, user.PrivacyLastSeen) {
+		return "hidden"
+	}
+	if v.presence != nil {
+		return publicPresence(v.presence(user.ID))
+	}
+	return publicPresence(userPresence(user.ID))
+}
+
+// senderPrivacyView privacyView для авторов сообщений
+func senderPrivacyView(db *gorm.DB, viewerID string, messages []models.Message) *privacyView {
+	senderIDs := make([]string, 0, len(messages))
+	for _, message := range messages {
+		senderIDs = append(senderIDs, message.SenderID)
+	}
+	return newPrivacyView(db, viewerID, senderIDs)
+}
+
+// sender автор сообщения: только имя и видимый зрителю аватар
+func (v *privacyView) sender(user models.User) gin.H {
+	if user.ID == "" {
+		return nil
+	}
+	return gin.H{
+		"id":        user.ID,
+		"username":  user.Username,
+		"avatarUrl": v.avatar(user),
+	}
+}
+
+// messageView сообщение, отдаваемое моделью целиком: автор урезан до sender,
+// иначе models.User ушел бы со всем профилем в обход правил приватности
+type messageView struct {
+	models.Message
+	Sender gin.H `json:"sender,omitempty"`
+}
+
+func (v *privacyView) messages(messages []models.Message) []messageView {
+	result := make([]messageView, len(messages))
+	for i, message := range messages {
+		result[i] = messageView{Message: message, Sender: v.sender(message.Sender)}
+	}
+	return result
+}
+
+// messageViews сообщения для зрителя с авторами по правилам приватности
+func messageViews(db *gorm.DB, viewerID string, messages []models.Message) []messageView {
+	return senderPrivacyView(db, viewerID, messages).messages(messages)
+}
+
+// publicUser данные пользователя, видимые зрителю
+func (v *privacyView) publicUser(user models.User) gin.H {
+	result := gin.H{
+		"id":           user.ID,
+		"username":     user.Username,
+		"profileColor": user.ProfileColor,
+		"isContact":    v.isContact(user.ID),
+		"isBlocked":    v.blocked[user.ID],
+	}
+	if nickname := v.nicknames[user.ID]; nickname != "" {
+		result["nickname"] = nickname
+	}
+	result["avatarUrl"] = v.avatar(user)
+	if v.allows(user, bioRule(user)) {
+		result["about"] = user.About
+	}
+	status := v.status(user)
+	result["status"] = status
+	result["isOnline"] = status != presenceOffline && status != "hidden"
+	if status != "hidden" {
+		result["lastSeen"] = user.LastSeen
+	}
+	return result
+}
+
+// chatMemberView участник чата с профилем, видимым зрителю
+type chatMemberView struct {
+	models.ChatMember
+	User gin.H `json:"user,omitempty"`
+}
+
+func (v *privacyView) members(members []models.ChatMember) []chatMemberView {
+	result := make([]chatMemberView, len(members))
+	for i, member := range members {
+		result[i] = chatMemberView{ChatMember: member}
+		if member.User.ID != "" {
+			result[i].User = v.publicUser(member.User)
+		}
+	}
+	return result
+}
+
+// publicUsers сериализует список пользователей для зрителя
+func publicUsers(db *gorm.DB, viewerID string, users []models.User) []gin.H {
+	userIDs := make([]string, len(users))
+	for i, user := range users {
+		userIDs[i] = user.ID
+	}
+	view := newPrivacyView(db, viewerID, userIDs)
+	view.presence = presenceAmong(userIDs)
+	result := make([]gin.H, len(users))
+	for i, user := range users {
+		result[i] = view.publicUser(user)
+	}
+	return result
+}
+
+// usersBlocked один из пользователей заблокировал другого
+func usersBlocked(db *gorm.DB, a, b string) bool {
+	var count int64
+	db.Model(&models.UserBlock{}).
+		Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)", a, b, b, a).
+		Count(&count)
+	return count > 0
+}
+
+// dmBlocked личный чат, в котором собеседники заблокировали друг друга
+func dmBlocked(db *gorm.DB, chatID, userID string) bool {
+	var chat models.Chat
+	if err := db.Select("id", "type").First(&chat, "id = ?", chatID).Error; err != nil || chat.Type != "dm" {
+		return false
+	}
+	var otherIDs []string
+	db.Model(&models.ChatMember{}).Where("chat_id = ? AND user_id <> ?", chatID, userID).Limit(1).Pluck("user_id", &otherIDs)
+	return len(otherIDs) > 0 && usersBlocked(db, userID, otherIDs[0])
+}
+
+// interactionDenied проверяет, может ли actorID позвонить пользователю
+// или добавить его в группу; возвращает код ошибки или пустую строку
+func interactionDenied(db *gorm.DB, actorID, userID string, rule func(models.User) string) string {
+	var user models.User
+	if err := db.First(&user, "id = ?", userID).Error; err != nil {
+		return "not_found"
+	}
+	view := newPrivacyView(db, actorID, []string{userID})
+	if view.blocked[userID] || view.blockedBy[userID] {
+		return "blocked"
+	}
+	if !view.allows(user, rule(user)) {
+		return "privacy_restricted"
+	}
+	return ""
+}
+
+func callsRule(user models.User) string    { return user.PrivacyCalls }
+func groupAddRule(user models.User) string { return user.PrivacyGroupAdd }
+
+// groupAddDenied пользователи, которых actorID не может добавить в группу
+func groupAddDenied(db *gorm.DB, actorID string, userIDs []string) []string {
+	denied := make([]string, 0)
+	if len(userIDs) == 0 {
+		return denied
+	}
+	var users []models.User
+	db.Where("id IN ?", userIDs).Find(&users)
+	view := newPrivacyView(db, actorID, userIDs)
+	for _, user := range users {
+		if user.ID == actorID {
+			continue
+		}
+		if view.blocked[user.ID] || view.blockedBy[user.ID] || !view.allows(user, user.PrivacyGroupAdd) {
+			denied = append(denied, user.ID)
+		}
+	}
+	return denied
+}
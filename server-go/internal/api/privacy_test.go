@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"safegram-server/internal/models"
+)
+
+func TestPrivacyViewAllows(t *testing.T) {
+	view := &privacyView{
+		viewerID:  "viewer",
+		contactOf: map[string]bool{"friend": true, "blocker": true},
+		blockedBy: map[string]bool{"blocker": true},
+		blocked:   map[string]bool{},
+		nicknames: map[string]string{},
+	}
+
+	tests := []struct {
+		name   string
+		userID string
+		rule   string
+		want   bool
+	}{
+		{"себя видно всегда", "viewer", models.PrivacyNobody, true},
+		{"всем", "stranger", models.PrivacyEveryone, true},
+		{"пустое правило — всем", "stranger", "", true},
+		{"неизвестное правило — всем", "stranger", "friends", true},
+		{"контактам, зритель не в контактах", "stranger", models.PrivacyContacts, false},
+		{"контактам, зритель в контактах", "friend", models.PrivacyContacts, true},
+		{"никому", "friend", models.PrivacyNobody, false},
+		{"заблокировавший видит зрителя как nobody", "blocker", models.PrivacyEveryone, false},
+		{"заблокировавший контакт", "blocker", models.PrivacyContacts, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := view.allows(models.User{ID: tt.userID}, tt.rule); got != tt.want {
+				t.Errorf("allows(%q, %q) = %v, want %v", tt.userID, tt.rule, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrivacyViewAvatar(t *testing.T) {
+	view := &privacyView{
+		viewerID:  "viewer",
+		contactOf: map[string]bool{"friend": true},
+		blockedBy: map[string]bool{},
+		blocked:   map[string]bool{},
+		nicknames: map[string]string{},
+	}
+	user := func(id, rule string, show bool) models.User {
+		return models.User{ID: id, AvatarURL: "/uploads/avatars/" + id + ".png", ShowAvatar: show, PrivacyAvatar: rule}
+	}
+
+	tests := []struct {
+		name       string
+		user       models.User
+		wantView   bool // виден зрителю
+		wantPublic bool // виден в общих событиях
+	}{
+		{"всем", user("stranger", models.PrivacyEveryone, true), true, true},
+		{"контактам, свой контакт", user("friend", models.PrivacyContacts, true), true, false},
+		{"контактам, чужой", user("stranger", models.PrivacyContacts, true), false, false},
+		{"никому", user("friend", models.PrivacyNobody, true), false, false},
+		{"старый флаг ShowAvatar выключен", user("friend", models.PrivacyEveryone, false), false, false},
+		{"свой аватар", user("viewer", models.PrivacyNobody, true), true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := ""
+			if tt.wantView {
+				want = tt.user.AvatarURL
+			}
+			if got := view.avatar(tt.user); got != want {
+				t.Errorf("avatar() = %q, want %q", got, want)
+			}
+			want = ""
+			if tt.wantPublic {
+				want = tt.user.AvatarURL
+			}
+			if got := publicAvatar(tt.user); got != want {
+				t.Errorf("publicAvatar() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestPrivacyViewHidesProfileInPayloads(t *testing.T) {
+	view := &privacyView{
+		viewerID:  "viewer",
+		contactOf: map[string]bool{},
+		blockedBy: map[string]bool{},
+		blocked:   map[string]bool{},
+		nicknames: map[string]string{},
+		presence:  func(string) string { return presenceOnline },
+	}
+	lastSeen := time.Now()
+	email := "user@example.com"
+	user := func(id, rule string) models.User {
+		return models.User{
+			ID: id, Username: id, Email: &email, About: "about " + id, Status: presenceInvisible, LastSeen: &lastSeen,
+			ShowBio: true, ShowAvatar: true, PrivacyBio: rule, PrivacyLastSeen: rule,
+		}
+	}
+	open, hidden := user("open", models.PrivacyEveryone), user("hidden", models.PrivacyNobody)
+
+	item := chatListItem{
+		Chat:    models.Chat{ID: "chat"},
+		Members: view.members([]models.ChatMember{{UserID: "open", User: open}, {UserID: "hidden", User: hidden}}),
+	}
+	last := view.messages([]models.Message{{ID: "m1", SenderID: "hidden", Sender: hidden}})
+	item.LastMessage = &last[0]
+
+	raw, err := json.Marshal(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload struct {
+		Members []struct {
+			User map[string]interface{} `json:"user"`
+		} `json:"members"`
+		LastMessage struct {
+			Sender map[string]interface{} `json:"sender"`
+		} `json:"lastMessage"`
+	}
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.Members) != 2 {
+		t.Fatalf("members = %d, want 2", len(payload.Members))
+	}
+
+	shown := payload.Members[0].User
+	if shown["about"] != "about open" || shown["lastSeen"] == nil || shown["status"] != presenceOnline {
+		t.Errorf("открытый профиль: %v", shown)
+	}
+
+	for name, fields := range map[string]map[string]interface{}{
+		"участник чата":   payload.Members[1].User,
+		"автор сообщения": payload.LastMessage.Sender,
+	} {
+		for _, field := range []string{"about", "lastSeen", "email", "roles", "plan"} {
+			if _, ok := fields[field]; ok {
+				t.Errorf("%s: поле %s раскрыто при правиле nobody: %v", name, field, fields)
+			}
+		}
+		if status, ok := fields["status"]; ok && status != "hidden" {
+			t.Errorf("%s: status = %v, want hidden", name, status)
+		}
+	}
+	if payload.Members[1].User["isOnline"] != false {
+		t.Errorf("isOnline раскрыт при правиле nobody: %v", payload.Members[1].User)
+	}
+}
@@ -0,0 +1,506 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"safegram-server/internal/authz"
+	"safegram-server/internal/models"
+	"safegram-server/internal/websocket"
+)
+
+const (
+	maxReactionLimit     = 10
+	maxReactionWhitelist = 50
+	maxReactionUsersPage = 100
+)
+
+// reactionPolicy настройки реакций чата
+type reactionPolicy struct {
+	Mode    string   // all | whitelist | none
+	Allowed []string // Для whitelist: эмодзи или ID пользовательских эмодзи
+	Limit   int
+}
+
+func chatReactionPolicy(db *gorm.DB, chatID string) reactionPolicy {
+	var chat models.Chat
+	db.Select("id", "reaction_mode", "reaction_whitelist_json", "reaction_limit").First(&chat, "id = ?", chatID)
+	policy := reactionPolicy{Mode: chat.ReactionMode, Allowed: []string{}, Limit: chat.ReactionLimit}
+	if policy.Mode == "" {
+		policy.Mode = "all"
+	}
+	if policy.Limit < 1 {
+		policy.Limit = 1
+	}
+	if chat.ReactionWhitelistJSON != "" {
+		json.Unmarshal([]byte(chat.ReactionWhitelistJSON), &policy.Allowed)
+	}
+	return policy
+}
+
+// allows разрешена ли реакция в чате
+func (p reactionPolicy) allows(reaction models.MessageReaction) bool {
+	switch p.Mode {
+	case "none":
+		return false
+	case "whitelist":
+		key := reaction.Emoji
+		if reaction.CustomEmojiID != "" {
+			key = reaction.CustomEmojiID
+		}
+		for _, allowed := range p.Allowed {
+			if allowed == key {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// reactionSummaries сводки реакций по сообщениям: эмодзи, число и (если задан viewerID)
+// поставил ли ее зритель. Реакции идут в порядке первого появления
+func reactionSummaries(db *gorm.DB, messageIDs []string, viewerID string) map[string][]gin.H {
+	result := make(map[string][]gin.H)
+	if len(messageIDs) == 0 {
+		return result
+	}
+
+	var rows []struct {
+		MessageID     string
+		Emoji         string
+		CustomEmojiID string
+		Count         int64
+		ReactedByMe   bool
+	}
+	db.Raw(`SELECT message_id, emoji, custom_emoji_id, COUNT(*) AS count, BOOL_OR(user_id = ?) AS reacted_by_me
+		FROM message_reactions WHERE message_id IN ?
+		GROUP BY message_id, emoji, custom_emoji_id
+		ORDER BY MIN(created_at) ASC`, viewerID, messageIDs).Scan(&rows)
+
+	customIDs := make([]string, 0)
+	for _, row := range rows {
+		if row.CustomEmojiID != "" {
+			customIDs = append(customIDs, row.CustomEmojiID)
+		}
+	}
+	custom := make(map[string]models.CustomEmoji)
+	if len(customIDs) > 0 {
+		var emojis []models.CustomEmoji
+		db.Where("id IN ?", customIDs).Find(&emojis)
+		for _, emoji := range emojis {
+			custom[emoji.ID] = emoji
+		}
+	}
+
+	for _, row := range rows {
+		item := gin.H{"emoji": row.Emoji, "count": row.Count}
+		if row.CustomEmojiID != "" {
+			if emoji, ok := custom[row.CustomEmojiID]; ok {
+				item["customEmoji"] = customEmojiPayload(emoji)
+			} else {
+				item["customEmoji"] = gin.H{"id": row.CustomEmojiID, "deleted": true}
+			}
+		}
+		if viewerID != "" {
+			item["reactedByMe"] = row.ReactedByMe
+		}
+		result[row.MessageID] = append(result[row.MessageID], item)
+	}
+	return result
+}
+
+// reactionSummary сводка реакций одного сообщения
+func reactionSummary(db *gorm.DB, messageID, viewerID string) []gin.H {
+	if summary, ok := reactionSummaries(db, []string{messageID}, viewerID)[messageID]; ok {
+		return summary
+	}
+	return []gin.H{}
+}
+
+// reactionKeys краткое описание реакций для событий
+func reactionKeys(reactions []models.MessageReaction) []gin.H {
+	keys := make([]gin.H, len(reactions))
+	for i, reaction := range reactions {
+		keys[i] = gin.H{"emoji": reaction.Emoji, "customEmojiId": reaction.CustomEmojiID}
+	}
+	return keys
+}
+
+// broadcastReactionEvent рассылает изменение реакций пользователя вместе с новой сводкой.
+// reactedByMe в сводке нет — клиент знает свои реакции по userId
+func broadcastReactionEvent(db *gorm.DB, wsHub *websocket.Hub, eventType string, message models.Message, userID string, data gin.H) {
+	data["messageId"] = message.ID
+	data["chatId"] = message.ChatID
+	data["threadId"] = message.ThreadID
+	data["userId"] = userID
+	data["reactions"] = reactionSummary(db, message.ID, "")
+	broadcastMessageEvent(db, wsHub, message, wsEvent(eventType, data))
+}
+
+// reactableMessage сообщение, на реакции которого пользователь может смотреть
+func reactableMessage(db *gorm.DB, messageID, userID string) (models.Message, authz.Permission, bool) {
+	var message models.Message
+	if err := db.First(&message, "id = ? AND deleted_at IS NULL", messageID).Error; err != nil {
+		return message, 0, false
+	}
+	perms := authz.Permissions(userID, authz.Chat(message.ChatID))
+	if !perms.Has(authz.ViewChannel) {
+		return message, perms, false
+	}
+	if message.ModerationStatus != "approved" && message.SenderID != userID && !perms.Has(authz.ManageMessages) {
+		return message, perms, false
+	}
+	return message, perms, true
+}
+
+// AddReaction ставит реакцию: эмодзи Unicode или пользовательский эмодзи сервера/группы.
+// Повторная такая же реакция ничего не меняет; сверх лимита чата снимаются самые старые
+func AddReaction(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var req struct {
+			Emoji         string `json:"emoji"`
+			CustomEmojiID string `json:"customEmojiId"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || req.Emoji == "" && req.CustomEmojiID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		message, perms, found := reactableMessage(db, c.Param("id"), userIDStr)
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		if !perms.Has(authz.AddReactions) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		if code, expiresAt, restricted := serverRestriction(db, message.ChatID, userIDStr); restricted {
+			c.JSON(http.StatusForbidden, gin.H{"error": code, "expiresAt": expiresAt})
+			return
+		}
+
+		policy := chatReactionPolicy(db, message.ChatID)
+		if policy.Mode == "none" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "reactions_disabled"})
+			return
+		}
+
+		reaction := models.MessageReaction{
+			ID:        uuid.New().String(),
+			MessageID: message.ID,
+			UserID:    userIDStr,
+			Emoji:     req.Emoji,
+		}
+		if req.CustomEmojiID != "" {
+			emoji, ok := customEmojiForChat(db, message.ChatID, req.CustomEmojiID)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "unknown_custom_emoji"})
+				return
+			}
+			reaction.Emoji = ":" + emoji.Name + ":"
+			reaction.CustomEmojiID = emoji.ID
+		} else if !isEmoji(req.Emoji) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_emoji"})
+			return
+		}
+		if !policy.allows(reaction) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "reaction_not_allowed"})
+			return
+		}
+
+		var existing []models.MessageReaction
+		db.Where("message_id = ? AND user_id = ?", message.ID, userIDStr).Order("created_at ASC").Find(&existing)
+		for _, r := range existing {
+			if r.Emoji == reaction.Emoji && r.CustomEmojiID == reaction.CustomEmojiID {
+				c.JSON(http.StatusOK, gin.H{"reaction": r, "reactions": reactionSummary(db, message.ID, userIDStr)})
+				return
+			}
+		}
+		var removed []models.MessageReaction
+		if excess := len(existing) - policy.Limit + 1; excess > 0 {
+			removed = existing[:excess]
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, r := range removed {
+				if err := tx.Delete(&models.MessageReaction{}, "id = ?", r.ID).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Create(&reaction).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "reaction_conflict"})
+			return
+		}
+
+		broadcastReactionEvent(db, wsHub, "reaction", message, userIDStr, gin.H{
+			"emoji":         reaction.Emoji,
+			"customEmojiId": reaction.CustomEmojiID,
+			"removed":       reactionKeys(removed),
+		})
+
+		if message.SenderID != userIDStr {
+			go func() {
+				var reactor models.User
+				db.Select("id", "username").First(&reactor, "id = ?", userIDStr)
+				dispatchNotification(db, wsHub, notification{
+					UserID: message.SenderID,
+					Kind:   notifyReaction,
+					ChatID: message.ChatID,
+					Title:  reactor.Username,
+					Body:   reaction.Emoji + " " + notificationPreview(message.Text, "к вашему сообщению"),
+					Data: map[string]interface{}{
+						"chatId":    message.ChatID,
+						"messageId": message.ID,
+						"url":       "/chats/" + message.ChatID,
+					},
+				})
+			}()
+		}
+
+		c.JSON(http.StatusOK, gin.H{"reaction": reaction, "reactions": reactionSummary(db, message.ID, userIDStr)})
+	}
+}
+
+// RemoveReaction снимает свою реакцию (?emoji= или ?customEmojiId=), без параметров — все свои реакции
+func RemoveReaction(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		message, _, found := reactableMessage(db, c.Param("id"), userIDStr)
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+
+		query := db.Where("message_id = ? AND user_id = ?", message.ID, userIDStr)
+		if customEmojiID := c.Query("customEmojiId"); customEmojiID != "" {
+			query = query.Where("custom_emoji_id = ?", customEmojiID)
+		} else if emoji := c.Query("emoji"); emoji != "" {
+			query = query.Where("emoji = ? AND custom_emoji_id = ''", emoji)
+		}
+		var removed []models.MessageReaction
+		query.Find(&removed)
+
+		if len(removed) > 0 {
+			ids := make([]string, len(removed))
+			for i, r := range removed {
+				ids[i] = r.ID
+			}
+			if err := db.Delete(&models.MessageReaction{}, "id IN ?", ids).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+				return
+			}
+			broadcastReactionEvent(db, wsHub, "reaction:remove", message, userIDStr, gin.H{"removed": reactionKeys(removed)})
+		}
+
+		c.JSON(http.StatusOK, gin.H{"reactions": reactionSummary(db, message.ID, userIDStr)})
+	}
+}
+
+// GetMessageReactions кто поставил реакции на сообщение, новые первыми.
+// Фильтр ?emoji= или ?customEmojiId=, страницы по ?before= (мс) и ?limit=
+func GetMessageReactions(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		message, perms, found := reactableMessage(db, c.Param("id"), userIDStr)
+		if !found || !perms.Has(authz.ReadHistory) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+
+		limit := 50
+		if parsed := parseInt(c.Query("limit")); parsed > 0 && parsed <= maxReactionUsersPage {
+			limit = parsed
+		}
+		query := db.Where("message_id = ?", message.ID).Preload("User").Order("created_at DESC").Limit(limit)
+		if customEmojiID := c.Query("customEmojiId"); customEmojiID != "" {
+			query = query.Where("custom_emoji_id = ?", customEmojiID)
+		} else if emoji := c.Query("emoji"); emoji != "" {
+			query = query.Where("emoji = ? AND custom_emoji_id = ''", emoji)
+		}
+		if before := c.Query("before"); before != "" {
+			ms, err := strconv.ParseInt(before, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+				return
+			}
+			query = query.Where("created_at < ?", time.UnixMilli(ms))
+		}
+
+		var reactions []models.MessageReaction
+		if err := query.Find(&reactions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		userIDs := make([]string, len(reactions))
+		for i, reaction := range reactions {
+			userIDs[i] = reaction.UserID
+		}
+		view := newPrivacyView(db, userIDStr, userIDs)
+		users := make([]gin.H, len(reactions))
+		for i, reaction := range reactions {
+			users[i] = gin.H{
+				"userId":        reaction.UserID,
+				"emoji":         reaction.Emoji,
+				"customEmojiId": reaction.CustomEmojiID,
+				"reactedAt":     reaction.CreatedAt,
+				"user": gin.H{
+					"id":        reaction.User.ID,
+					"username":  reaction.User.Username,
+					"avatarUrl": view.avatar(reaction.User),
+				},
+			}
+		}
+
+		response := gin.H{
+			"messageId": message.ID,
+			"reactions": reactionSummary(db, message.ID, userIDStr),
+			"users":     users,
+		}
+		if len(reactions) == limit {
+			response["nextBefore"] = reactions[len(reactions)-1].CreatedAt.UnixMilli()
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+func reactionPolicyPayload(db *gorm.DB, chatID string) gin.H {
+	policy := chatReactionPolicy(db, chatID)
+	return gin.H{"mode": policy.Mode, "allowed": policy.Allowed, "limit": policy.Limit}
+}
+
+// GetChatReactionSettings настройки реакций чата
+func GetChatReactionSettings(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		chatID := c.Param("id")
+		if !authz.Can(userIDStr, authz.Chat(chatID), authz.ViewChannel) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		c.JSON(http.StatusOK, reactionPolicyPayload(db, chatID))
+	}
+}
+
+// UpdateChatReactionSettings задает режим реакций (all | whitelist | none), список разрешенных
+// (эмодзи или ID пользовательских эмодзи) и лимит реакций участника на сообщение.
+// В личном чате это может сделать любой из собеседников
+func UpdateChatReactionSettings(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		chatID := c.Param("id")
+		var chat models.Chat
+		if err := db.First(&chat, "id = ?", chatID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		allowed := authz.Can(userIDStr, authz.Chat(chatID), authz.ManageSettings)
+		if chat.Type == "dm" {
+			allowed = authz.IsMember(userIDStr, authz.Chat(chatID))
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var req struct {
+			Mode    *string   `json:"mode"`
+			Allowed *[]string `json:"allowed"`
+			Limit   *int      `json:"limit"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		updates := make(map[string]interface{})
+		if req.Mode != nil {
+			if *req.Mode != "all" && *req.Mode != "whitelist" && *req.Mode != "none" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_mode"})
+				return
+			}
+			updates["reaction_mode"] = *req.Mode
+		}
+		if req.Limit != nil {
+			if *req.Limit < 1 || *req.Limit > maxReactionLimit {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_limit", "max": maxReactionLimit})
+				return
+			}
+			updates["reaction_limit"] = *req.Limit
+		}
+		if req.Allowed != nil {
+			if len(*req.Allowed) > maxReactionWhitelist {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "too_many_reactions", "max": maxReactionWhitelist})
+				return
+			}
+			list := make([]string, 0, len(*req.Allowed))
+			seen := make(map[string]bool)
+			for _, entry := range *req.Allowed {
+				if seen[entry] {
+					continue
+				}
+				if _, custom := customEmojiForChat(db, chatID, entry); !custom && !isEmoji(entry) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_emoji", "emoji": entry})
+					return
+				}
+				seen[entry] = true
+				list = append(list, entry)
+			}
+			encoded, _ := json.Marshal(list)
+			updates["reaction_whitelist_json"] = string(encoded)
+		}
+
+		if len(updates) > 0 {
+			if err := db.Model(&chat).Updates(updates).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+				return
+			}
+			if chat.Type != "dm" {
+				logModeration(db, chatID, "", userIDStr, "reaction_settings_updated", "", "", updates)
+			}
+		}
+
+		c.JSON(http.StatusOK, reactionPolicyPayload(db, chatID))
+	}
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"safegram-server/internal/models"
+	"safegram-server/internal/websocket"
+)
+
+// Позиции курсоров участника: время создания сообщения, на котором стоит курсор
+const (
+	readPositionSQL      = "COALESCE((SELECT lr.created_at FROM messages lr WHERE lr.id = chat_members.last_read_message_id), '-infinity'::timestamptz)"
+	deliveredPositionSQL = "COALESCE((SELECT ld.created_at FROM messages ld WHERE ld.id = chat_members.last_delivered_message_id), '-infinity'::timestamptz)"
+)
+
+// bumpUnread новое видимое сообщение увеличивает счетчики остальных участников
+// и счетчики упоминаний упомянутых. Ответы в тредах учитываются только подписчиками треда
+func bumpUnread(db *gorm.DB, message models.Message) {
+	if message.ThreadID != "" {
+		bumpThreadUnread(db, message)
+		return
+	}
+	db.Model(&models.ChatMember{}).
+		Where("chat_id = ? AND user_id <> ?", message.ChatID, message.SenderID).
+		UpdateColumn("unread_count", gorm.Expr("unread_count + 1"))
+	db.Model(&models.ChatMember{}).
+		Where("chat_id = ? AND user_id IN (?)", message.ChatID,
+			db.Model(&models.MessageMention{}).Select("user_id").Where("message_id = ?", message.ID)).
+		UpdateColumn("unread_mentions", gorm.Expr("unread_mentions + 1"))
+}
+
+// dropUnread удаленное сообщение снимается со счетчиков тех, кто его еще не прочитал
+func dropUnread(db *gorm.DB, message models.Message) {
+	if message.ThreadID != "" {
+		dropThreadUnread(db, message)
+		return
+	}
+	db.Model(&models.ChatMember{}).
+		Where("chat_id = ? AND user_id <> ? AND unread_count > 0 AND joined_at <= ?", message.ChatID, message.SenderID, message.CreatedAt).
+		Where(readPositionSQL+" < ?", message.CreatedAt).
+		UpdateColumn("unread_count", gorm.Expr("unread_count - 1"))
+	db.Model(&models.ChatMember{}).
+		Where("chat_id = ? AND unread_mentions > 0 AND user_id IN (?)", message.ChatID,
+			db.Model(&models.MessageMention{}).Select("user_id").Where("message_id = ?", message.ID)).
+		Where(readPositionSQL+" < ?", message.CreatedAt).
+		UpdateColumn("unread_mentions", gorm.Expr("unread_mentions - 1"))
+}
+
+// unreadAfter количество видимых сообщений других участников в ленте чата после момента after
+func unreadAfter(db *gorm.DB, chatID, userID string, after time.Time) int64 {
+	var count int64
+	db.Model(&models.Message{}).
+		Where("chat_id = ? AND sender_id <> ? AND deleted_at IS NULL AND moderation_status = 'approved' AND created_at > ?", chatID, userID, after).
+		Where("COALESCE(thread_id, '') = ''").
+		Count(&count)
+	return count
+}
+
+// advanceDeliveredCursor двигает курсор доставки участника вперед до message;
+// возвращает false, если курсор уже стоит не раньше
+func advanceDeliveredCursor(db *gorm.DB, chatID, userID string, message models.Message) bool {
+	now := time.Now()
+	result := db.Model(&models.ChatMember{}).
+		Where("chat_id = ? AND user_id = ?", chatID, userID).
+		Where(deliveredPositionSQL+" < ?", message.CreatedAt).
+		Updates(map[string]interface{}{"last_delivered_message_id": message.ID, "last_delivered_at": now})
+	return result.Error == nil && result.RowsAffected > 0
+}
+
+// advanceReadCursor двигает курсор прочтения участника вперед до message
+// и пересчитывает его счетчики непрочитанных сообщений и упоминаний. Прочитанное считается и доставленным.
+// Возвращает false, если курсор уже стоит не раньше
+func advanceReadCursor(db *gorm.DB, chatID, userID string, message models.Message) (bool, error) {
+	advanceDeliveredCursor(db, chatID, userID, message)
+
+	now := time.Now()
+	result := db.Model(&models.ChatMember{}).
+		Where("chat_id = ? AND user_id = ?", chatID, userID).
+		Where(readPositionSQL+" < ?", message.CreatedAt).
+		Updates(map[string]interface{}{
+			"last_read_message_id": message.ID,
+			"last_read_at":         now,
+			"unread_count":         unreadAfter(db, chatID, userID, message.CreatedAt),
+			"unread_mentions":      unreadMentionsAfter(db, chatID, userID, message.CreatedAt),
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// memberCursor позиции курсоров участника (nil — курсора нет)
+type memberCursor struct {
+	UserID        string
+	ReadUpTo      *time.Time
+	DeliveredUpTo *time.Time
+}
+
+func (m memberCursor) hasRead(message models.Message) bool {
+	return m.ReadUpTo != nil && !message.CreatedAt.After(*m.ReadUpTo)
+}
+
+func (m memberCursor) hasDelivered(message models.Message) bool {
+	return m.hasRead(message) || (m.DeliveredUpTo != nil && !message.CreatedAt.After(*m.DeliveredUpTo))
+}
+
+// memberCursors курсоры участников чата (userIDs пустой — всех)
+func memberCursors(db *gorm.DB, chatID string, userIDs []string) map[string]memberCursor {
+	query := db.Table("chat_members").
+		Select("chat_members.user_id, lr.created_at AS read_up_to, ld.created_at AS delivered_up_to").
+		Joins("LEFT JOIN messages lr ON lr.id = chat_members.last_read_message_id").
+		Joins("LEFT JOIN messages ld ON ld.id = chat_members.last_delivered_message_id").
+		Where("chat_members.chat_id = ? AND chat_members.deleted_at IS NULL", chatID)
+	if len(userIDs) > 0 {
+		query = query.Where("chat_members.user_id IN ?", userIDs)
+	}
+
+	var rows []memberCursor
+	query.Scan(&rows)
+	result := make(map[string]memberCursor, len(rows))
+	for _, row := range rows {
+		result[row.UserID] = row
+	}
+	return result
+}
+
+// messageStatus статус собственного сообщения в личном чате по курсору собеседника
+func messageStatus(peer memberCursor, message models.Message) string {
+	if peer.hasRead(message) {
+		return "read"
+	}
+	if peer.hasDelivered(message) {
+		return "delivered"
+	}
+	return "sent"
+}
+
+// dmPeer собеседник в личном чате ("" — чат не личный)
+func dmPeer(db *gorm.DB, chatID, userID string) string {
+	var chat models.Chat
+	if err := db.Select("id", "type").First(&chat, "id = ?", chatID).Error; err != nil || chat.Type != "dm" {
+		return ""
+	}
+	var peerIDs []string
+	db.Model(&models.ChatMember{}).Where("chat_id = ? AND user_id <> ?", chatID, userID).Limit(1).Pluck("user_id", &peerIDs)
+	if len(peerIDs) == 0 {
+		return ""
+	}
+	return peerIDs[0]
+}
+
+// notifyDelivered сообщает собеседнику в личном чате, что его сообщения доставлены
+func notifyDelivered(wsHub *websocket.Hub, peerID, chatID, userID string, message models.Message) {
+	wsHub.SendToUser(peerID, wsEvent("chat:delivered", gin.H{
+		"chatId":      chatID,
+		"userId":      userID,
+		"messageId":   message.ID,
+		"deliveredAt": time.Now(),
+	}))
+}
+
+// deliverToConnected в личном чате сообщение, разосланное подключенному
+// собеседнику, сразу считается доставленным
+func deliverToConnected(db *gorm.DB, wsHub *websocket.Hub, message models.Message) {
+	peerID := dmPeer(db, message.ChatID, message.SenderID)
+	if peerID == "" || !wsHub.IsConnected(peerID) {
+		return
+	}
+	if advanceDeliveredCursor(db, message.ChatID, peerID, message) {
+		notifyDelivered(wsHub, message.SenderID, message.ChatID, peerID, message)
+	}
+}
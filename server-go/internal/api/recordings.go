@@ -0,0 +1,999 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"safegram-server/internal/authz"
+	"safegram-server/internal/config"
+	"safegram-server/internal/models"
+	"safegram-server/internal/redis"
+	"safegram-server/internal/sfu"
+	"safegram-server/internal/transcribe"
+	"safegram-server/internal/websocket"
+)
+
+// recordingDir каталог записей; каждая запись хранится в подкаталоге со своим ID.
+// Он вне ./uploads: файлы отдает только GetRecordingFile участникам звонка
+const (
+	recordingDir       = "./recordings"
+	legacyRecordingDir = "./uploads/call-recordings"
+)
+
+// recordingFormats допустимые форматы клиентской записи по сигнатуре содержимого
+var recordingFormats = map[string]string{
+	"video/webm":      ".webm",
+	"audio/webm":      ".webm",
+	"application/ogg": ".ogg",
+	"audio/ogg":       ".ogg",
+	"video/mp4":       ".mp4",
+	"audio/mp4":       ".mp4",
+}
+
+// recordingContentTypes тип содержимого при отдаче файла записи
+var recordingContentTypes = map[string]string{
+	".webm": "video/webm",
+	".ogg":  "audio/ogg",
+	".mp4":  "video/mp4",
+}
+
+// recordingFileURL адрес файла записи (через API, с проверкой доступа)
+func recordingFileURL(recordingID string) string {
+	return "/api/recordings/" + recordingID + "/file"
+}
+
+var (
+	// transcriber движок расшифровки; nil — расшифровка отключена
+	transcriber        transcribe.Transcriber
+	transcribeLanguage string
+	recordingRetention = 30 * 24 * time.Hour
+)
+
+// InitRecordings настраивает расшифровку и закрывает записи, прерванные перезапуском
+func InitRecordings(db *gorm.DB, cfg *config.Config) error {
+	recordingRetention = time.Duration(cfg.RecordingRetentionDays) * 24 * time.Hour
+	transcribeLanguage = cfg.TranscribeLanguage
+
+	db.Model(&models.CallRecording{}).Where("status = ?", "pending_consent").
+		Update("status", "cancelled")
+	db.Model(&models.CallRecording{}).Where("status IN ?", []string{"recording", "processing"}).
+		Updates(map[string]interface{}{"status": "failed", "error": "server_restarted"})
+	db.Model(&models.CallRecording{}).Where("transcript_status = ?", "pending").
+		Update("transcript_status", "failed")
+	moveLegacyRecordings(db)
+
+	var err error
+	transcriber, err = transcribe.New(transcribe.Config{
+		Backend: cfg.TranscribeBackend,
+		Command: cfg.TranscribeCommand,
+		URL:     cfg.TranscribeURL,
+		APIKey:  cfg.TranscribeAPIKey,
+		Model:   cfg.TranscribeModel,
+	})
+	return err
+}
+
+// moveLegacyRecordings переносит записи из публичного ./uploads в закрытый каталог
+// и заменяет прямые ссылки на них ссылками через API
+func moveLegacyRecordings(db *gorm.DB) {
+	if _, err := os.Stat(legacyRecordingDir); err == nil {
+		if _, err := os.Stat(recordingDir); os.IsNotExist(err) {
+			if err := os.Rename(legacyRecordingDir, recordingDir); err != nil {
+				log.Printf("Failed to move call recordings out of uploads: %v", err)
+				return
+			}
+		} else {
+			log.Printf("Both %s and %s exist: move legacy call recordings manually", legacyRecordingDir, recordingDir)
+			return
+		}
+	}
+	legacyPrefix := filepath.Clean(legacyRecordingDir) + string(filepath.Separator)
+	db.Exec("UPDATE call_recordings SET file_path = ? || SUBSTRING(file_path FROM ?) WHERE file_path LIKE ?",
+		filepath.Clean(recordingDir)+string(filepath.Separator), len(legacyPrefix)+1, legacyPrefix+"%")
+	db.Exec("UPDATE call_recordings SET url = '/api/recordings/' || id || '/file' WHERE url LIKE '/uploads/%'")
+	for _, table := range []string{"calls", "group_calls"} {
+		db.Exec("UPDATE " + table + ` SET recording_url = '/api/recordings/' || SPLIT_PART(recording_url, '/', 4) || '/file'
+			WHERE recording_url LIKE '/uploads/call-recordings/%'`)
+	}
+}
+
+// recordingPolicy политика записей чата; без настроек — запись разрешена, расшифровка включена
+func recordingPolicy(db *gorm.DB, chatID string) models.RecordingPolicy {
+	policy := models.RecordingPolicy{ChatID: chatID, Transcribe: true}
+	db.First(&policy, "chat_id = ?", chatID)
+	return policy
+}
+
+func recordingParticipants(rec models.CallRecording) []string {
+	var participants []string
+	json.Unmarshal([]byte(rec.Participants), &participants)
+	return participants
+}
+
+// participantRecordings ограничивает выборку записями, в звонке которых пользователь участвовал
+func participantRecordings(query *gorm.DB, userID string) *gorm.DB {
+	return query.Where("coalesce(nullif(call_recordings.participants, ''), '[]')::jsonb @> jsonb_build_array(?::text)", userID)
+}
+
+func isRecordingParticipant(rec models.CallRecording, userID string) bool {
+	for _, participantID := range recordingParticipants(rec) {
+		if participantID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyRecording рассылает событие записи всем участникам звонка
+func notifyRecording(wsHub *websocket.Hub, rec models.CallRecording, eventType string, extra gin.H) {
+	if wsHub == nil {
+		return
+	}
+	data := gin.H{
+		"recordingId": rec.ID,
+		"callId":      rec.CallID,
+		"callKind":    rec.CallKind,
+		"chatId":      rec.ChatID,
+		"status":      rec.Status,
+		"startedBy":   rec.StartedBy,
+	}
+	for key, value := range extra {
+		data[key] = value
+	}
+	event := wsEvent(eventType, data)
+	for _, participantID := range recordingParticipants(rec) {
+		wsHub.SendToUser(participantID, event)
+	}
+}
+
+// recordingTarget звонок, который можно записать
+type recordingTarget struct {
+	kind         string // "call" | "group_call" | "voice_room"
+	chatID       string
+	source       string // "sfu" | "client"
+	participants []string
+}
+
+// findRecordingTarget ищет идущий звонок и тех, чье согласие требуется.
+// errCode != "" — записать нельзя.
+func findRecordingTarget(db *gorm.DB, callID, userID string) (recordingTarget, int, string) {
+	var call models.Call
+	if err := db.First(&call, "id = ?", callID).Error; err == nil {
+		if call.CallerID != userID && call.ReceiverID != userID {
+			return recordingTarget{}, http.StatusForbidden, "forbidden"
+		}
+		if call.Status != "answered" {
+			return recordingTarget{}, http.StatusConflict, "call_not_active"
+		}
+		// 1:1 звонок идет напрямую между клиентами — пишет клиент
+		return recordingTarget{
+			kind:         "call",
+			chatID:       call.ChatID,
+			source:       "client",
+			participants: []string{call.CallerID, call.ReceiverID},
+		}, 0, ""
+	}
+
+	room, ok := findSFURoom(db, callID, true)
+	if !ok {
+		return recordingTarget{}, http.StatusNotFound, "not_found"
+	}
+	target := recordingTarget{kind: room.Kind, chatID: room.ChatID, source: "client"}
+
+	if room.Kind == "voice_room" {
+		var voiceRoom models.VoiceRoom
+		db.First(&voiceRoom, "id = ?", room.ID)
+		if voiceRoom.Status != "live" {
+			return recordingTarget{}, http.StatusConflict, "call_not_active"
+		}
+		// Запись комнаты включает ведущий
+		if !voiceRoomHost(voiceRoom, userID) {
+			return recordingTarget{}, http.StatusForbidden, "forbidden"
+		}
+		state, err := redis.GetVoiceRoomState(room.ID)
+		if err != nil {
+			return recordingTarget{}, http.StatusInternalServerError, "server_error"
+		}
+		// В запись попадают только выступающие — согласие нужно от них
+		for participantID := range state.Present {
+			if voiceRoomRole(voiceRoom, state, participantID) != "listener" {
+				target.participants = append(target.participants, participantID)
+			}
+		}
+	} else if sfuManager != nil {
+		for _, participant := range sfuManager.Participants(room.ID) {
+			target.participants = append(target.participants, participant.UserID)
+		}
+	}
+
+	if sfuManager != nil && len(target.participants) > 0 {
+		target.source = "sfu"
+	} else if room.Kind == "group_call" {
+		// Без SFU — участники из истории звонка
+		db.Model(&models.GroupCallParticipant{}).
+			Where("call_id = ? AND left_at IS NULL", room.ID).
+			Distinct().Pluck("user_id", &target.participants)
+	}
+
+	found := false
+	for _, participantID := range target.participants {
+		if participantID == userID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		if room.Kind != "voice_room" {
+			return recordingTarget{}, http.StatusForbidden, "forbidden"
+		}
+		// Ведущий-слушатель тоже дает согласие
+		target.participants = append(target.participants, userID)
+	}
+	return target, 0, ""
+}
+
+// StartCallRecording запрашивает запись звонка: участники получают recording:consent_requested,
+// запись начинается, когда согласятся все
+func StartCallRecording(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var req struct {
+			CallID string `json:"callId" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		target, status, code := findRecordingTarget(db, req.CallID, userIDStr)
+		if code != "" {
+			c.JSON(status, gin.H{"error": code})
+			return
+		}
+		if recordingPolicy(db, target.chatID).Disabled {
+			c.JSON(http.StatusForbidden, gin.H{"error": "recording_disabled"})
+			return
+		}
+
+		var active int64
+		db.Model(&models.CallRecording{}).
+			Where("call_id = ? AND status IN ?", req.CallID, []string{"pending_consent", "recording"}).
+			Count(&active)
+		if active > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "already_recording"})
+			return
+		}
+
+		participants, _ := json.Marshal(target.participants)
+		rec := models.CallRecording{
+			ID:               uuid.New().String(),
+			CallID:           req.CallID,
+			CallKind:         target.kind,
+			ChatID:           target.chatID,
+			StartedBy:        userIDStr,
+			Status:           "pending_consent",
+			Source:           target.source,
+			Participants:     string(participants),
+			TranscriptStatus: "none",
+		}
+		if err := db.Create(&rec).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		// Инициатор согласен по определению
+		db.Create(&models.RecordingConsent{ID: uuid.New().String(), RecordingID: rec.ID, UserID: userIDStr, Consented: true})
+
+		notifyRecording(wsHub, rec, "recording:consent_requested", nil)
+		rec = checkRecordingConsents(db, wsHub, rec)
+		c.JSON(http.StatusCreated, gin.H{"recording": rec})
+	}
+}
+
+// checkRecordingConsents начинает запись, когда согласились все участники
+func checkRecordingConsents(db *gorm.DB, wsHub *websocket.Hub, rec models.CallRecording) models.CallRecording {
+	var consented int64
+	db.Model(&models.RecordingConsent{}).
+		Where("recording_id = ? AND consented = ?", rec.ID, true).
+		Count(&consented)
+	if int(consented) < len(recordingParticipants(rec)) {
+		return rec
+	}
+
+	if rec.Source == "sfu" {
+		if sfuManager == nil {
+			return failRecording(db, wsHub, rec, "sfu_unavailable")
+		}
+		if err := sfuManager.StartRecording(rec.CallID, filepath.Join(recordingDir, rec.ID)); err != nil {
+			log.Printf("Failed to start recording %s: %v", rec.ID, err)
+			return failRecording(db, wsHub, rec, err.Error())
+		}
+	}
+
+	now := time.Now()
+	rec.Status = "recording"
+	rec.StartedAt = &now
+	db.Model(&rec).Updates(map[string]interface{}{"status": rec.Status, "started_at": now})
+	notifyRecording(wsHub, rec, "recording:started", nil)
+	return rec
+}
+
+func failRecording(db *gorm.DB, wsHub *websocket.Hub, rec models.CallRecording, reason string) models.CallRecording {
+	rec.Status = "failed"
+	rec.Error = reason
+	db.Model(&rec).Updates(map[string]interface{}{"status": rec.Status, "error": reason})
+	notifyRecording(wsHub, rec, "recording:failed", gin.H{"error": reason})
+	return rec
+}
+
+// loadRecording запись по :id, доступная только участнику звонка
+func loadRecording(c *gin.Context, db *gorm.DB, userID string) (models.CallRecording, bool) {
+	var rec models.CallRecording
+	if err := db.First(&rec, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+		return rec, false
+	}
+	if !isRecordingParticipant(rec, userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+		return rec, false
+	}
+	return rec, true
+}
+
+// RespondRecordingConsent ответ участника на запрос записи
+func RespondRecordingConsent(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var req struct {
+			Consent *bool `json:"consent" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		rec, found := loadRecording(c, db, userIDStr)
+		if !found {
+			return
+		}
+		if rec.Status != "pending_consent" && rec.Status != "recording" {
+			c.JSON(http.StatusConflict, gin.H{"error": "consent_closed"})
+			return
+		}
+
+		consent := models.RecordingConsent{RecordingID: rec.ID, UserID: userIDStr}
+		if err := db.Where(&consent).First(&consent).Error; err != nil {
+			consent.ID = uuid.New().String()
+		}
+		consent.Consented = *req.Consent
+		if err := db.Save(&consent).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		// Во время записи отвечают вошедшие позже: серверная запись пишет только согласившихся,
+		// клиентскую выборочно не ограничить — отказ ее останавливает
+		if rec.Status == "recording" {
+			if rec.Source == "sfu" && sfuManager != nil {
+				sfuManager.ExcludeFromRecording(rec.CallID, userIDStr, !consent.Consented)
+			} else if !consent.Consented {
+				rec = stopRecording(db, wsHub, rec)
+			}
+			notifyRecording(wsHub, rec, "recording:consent", gin.H{"userId": userIDStr, "consented": consent.Consented})
+			c.JSON(http.StatusOK, gin.H{"recording": rec})
+			return
+		}
+
+		// Любой отказ до начала записи отменяет ее
+		if !consent.Consented {
+			rec.Status = "declined"
+			db.Model(&rec).Update("status", rec.Status)
+			notifyRecording(wsHub, rec, "recording:declined", gin.H{"userId": userIDStr})
+			c.JSON(http.StatusOK, gin.H{"recording": rec})
+			return
+		}
+
+		notifyRecording(wsHub, rec, "recording:consent", gin.H{"userId": userIDStr, "consented": true})
+		rec = checkRecordingConsents(db, wsHub, rec)
+		c.JSON(http.StatusOK, gin.H{"recording": rec})
+	}
+}
+
+// stopRecording останавливает запись: серверная уходит в обработку,
+// клиентская ждет загрузки файла
+func stopRecording(db *gorm.DB, wsHub *websocket.Hub, rec models.CallRecording) models.CallRecording {
+	now := time.Now()
+	rec.StoppedAt = &now
+	if rec.StartedAt != nil {
+		rec.Duration = int(now.Sub(*rec.StartedAt).Seconds())
+	}
+
+	if rec.Source == "sfu" {
+		rec.Status = "processing"
+		var tracks []sfu.RecordedTrack
+		if sfuManager != nil {
+			tracks = sfuManager.StopRecording(rec.CallID)
+		}
+		go processRecording(db, wsHub, rec, tracks)
+	} else {
+		rec.Status = "stopped"
+	}
+
+	db.Model(&rec).Updates(map[string]interface{}{
+		"status":     rec.Status,
+		"stopped_at": now,
+		"duration":   rec.Duration,
+	})
+	notifyRecording(wsHub, rec, "recording:stopped", nil)
+	return rec
+}
+
+// stopCallRecordings завершает записи закончившегося звонка
+func stopCallRecordings(db *gorm.DB, wsHub *websocket.Hub, callID string) {
+	var recs []models.CallRecording
+	db.Where("call_id = ? AND status IN ?", callID, []string{"pending_consent", "recording"}).Find(&recs)
+	for _, rec := range recs {
+		if rec.Status == "pending_consent" {
+			rec.Status = "cancelled"
+			db.Model(&rec).Update("status", rec.Status)
+			notifyRecording(wsHub, rec, "recording:cancelled", nil)
+			continue
+		}
+		stopRecording(db, wsHub, rec)
+	}
+}
+
+// recordingJoined предупреждает вошедшего в комнату о запрошенной или идущей записи: он становится
+// участником записи и может ее остановить. Пока вошедший не согласился, его звук в запись не попадает
+func recordingJoined(db *gorm.DB, client *websocket.Client, roomID string) {
+	var rec models.CallRecording
+	if err := db.Where("call_id = ? AND status IN ?", roomID, []string{"pending_consent", "recording"}).First(&rec).Error; err != nil {
+		return
+	}
+	userID := client.UserID()
+	if !isRecordingParticipant(rec, userID) {
+		participants, _ := json.Marshal(append(recordingParticipants(rec), userID))
+		rec.Participants = string(participants)
+		db.Model(&rec).Update("participants", rec.Participants)
+	}
+
+	data := gin.H{
+		"recordingId": rec.ID,
+		"callId":      rec.CallID,
+		"callKind":    rec.CallKind,
+		"chatId":      rec.ChatID,
+		"status":      rec.Status,
+		"startedBy":   rec.StartedBy,
+		"startedAt":   rec.StartedAt,
+	}
+	var consent models.RecordingConsent
+	if db.Where("recording_id = ? AND user_id = ? AND consented = ?", rec.ID, userID, true).First(&consent).Error == nil {
+		client.Send(wsEvent("recording:active", data))
+		return
+	}
+	if rec.Status == "recording" && rec.Source == "sfu" && sfuManager != nil {
+		sfuManager.ExcludeFromRecording(roomID, userID, true)
+	}
+	data["lateJoin"] = true
+	client.Send(wsEvent("recording:consent_requested", data))
+}
+
+// StopCallRecording останавливает запись (любой участник может отозвать согласие)
+func StopCallRecording(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		rec, found := loadRecording(c, db, userIDStr)
+		if !found {
+			return
+		}
+		switch rec.Status {
+		case "pending_consent":
+			rec.Status = "cancelled"
+			db.Model(&rec).Update("status", rec.Status)
+			notifyRecording(wsHub, rec, "recording:cancelled", nil)
+		case "recording":
+			rec = stopRecording(db, wsHub, rec)
+		default:
+			c.JSON(http.StatusConflict, gin.H{"error": "not_recording"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"recording": rec})
+	}
+}
+
+// UploadCallRecording загружает файл клиентской записи (звонки без SFU)
+func UploadCallRecording(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		var rec models.CallRecording
+		if err := db.First(&rec, "id = ?", c.PostForm("recordingId")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		if !isRecordingParticipant(rec, userIDStr) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		// Загрузить можно только запись, на которую все дали согласие
+		if rec.Source != "client" || (rec.Status != "recording" && rec.Status != "stopped") {
+			c.JSON(http.StatusConflict, gin.H{"error": "upload_not_allowed"})
+			return
+		}
+
+		// Формат определяется по содержимому, а не по имени файла от клиента
+		src, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(src, head)
+		src.Close()
+		contentType, _, _ := strings.Cut(http.DetectContentType(head[:n]), ";")
+		ext, ok := recordingFormats[contentType]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_format", "detail": "webm, ogg or mp4 expected"})
+			return
+		}
+		dir := filepath.Join(recordingDir, rec.ID)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		path := filepath.Join(dir, "recording"+ext)
+		if err := c.SaveUploadedFile(file, path); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		now := time.Now()
+		rec.Status = "processing"
+		if rec.StoppedAt == nil {
+			rec.StoppedAt = &now
+		}
+		if duration, err := strconv.Atoi(c.PostForm("duration")); err == nil && duration > 0 {
+			rec.Duration = duration
+		}
+		db.Model(&rec).Updates(map[string]interface{}{
+			"status":     rec.Status,
+			"stopped_at": rec.StoppedAt,
+			"duration":   rec.Duration,
+		})
+		go processRecording(db, wsHub, rec, []sfu.RecordedTrack{{UserID: userIDStr, Path: path}})
+
+		c.JSON(http.StatusAccepted, gin.H{"recording": rec})
+	}
+}
+
+// mixRecordingTracks сводит дорожки участников в один файл через ffmpeg.
+// Без ffmpeg остается первая дорожка, остальные лежат рядом.
+func mixRecordingTracks(rec models.CallRecording, tracks []sfu.RecordedTrack) (string, error) {
+	if len(tracks) == 1 {
+		return tracks[0].Path, nil
+	}
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		log.Printf("ffmpeg not found, recording %s keeps separate tracks", rec.ID)
+		return tracks[0].Path, nil
+	}
+
+	output := filepath.Join(recordingDir, rec.ID, "mix.ogg")
+	args := []string{"-y", "-loglevel", "error"}
+	var filter strings.Builder
+	for i, track := range tracks {
+		args = append(args, "-i", track.Path)
+		delay := track.Offset.Milliseconds()
+		filter.WriteString("[" + strconv.Itoa(i) + ":a]adelay=" + strconv.FormatInt(delay, 10) + ":all=1[a" + strconv.Itoa(i) + "];")
+	}
+	for i := range tracks {
+		filter.WriteString("[a" + strconv.Itoa(i) + "]")
+	}
+	filter.WriteString("amix=inputs=" + strconv.Itoa(len(tracks)) + ":normalize=0")
+	args = append(args, "-filter_complex", filter.String(), "-c:a", "libopus", output)
+
+	if out, err := exec.Command(ffmpeg, args...).CombinedOutput(); err != nil {
+		log.Printf("ffmpeg mix failed for recording %s: %v: %s", rec.ID, err, strings.TrimSpace(string(out)))
+		return "", err
+	}
+	return output, nil
+}
+
+// processRecording сводит дорожки, публикует запись и запускает расшифровку
+func processRecording(db *gorm.DB, wsHub *websocket.Hub, rec models.CallRecording, tracks []sfu.RecordedTrack) {
+	if len(tracks) == 0 {
+		failRecording(db, wsHub, rec, "empty_recording")
+		return
+	}
+	path, err := mixRecordingTracks(rec, tracks)
+	if err != nil {
+		failRecording(db, wsHub, rec, "mix_failed")
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		failRecording(db, wsHub, rec, "file_missing")
+		return
+	}
+
+	policy := recordingPolicy(db, rec.ChatID)
+	retention := recordingRetention
+	if policy.RetentionDays > 0 {
+		retention = time.Duration(policy.RetentionDays) * 24 * time.Hour
+	}
+	expiresAt := time.Now().Add(retention)
+
+	rec.Status = "ready"
+	rec.FilePath = path
+	rec.URL = recordingFileURL(rec.ID)
+	rec.Size = info.Size()
+	rec.ExpiresAt = &expiresAt
+	if policy.Transcribe && transcriber != nil {
+		rec.TranscriptStatus = "pending"
+	}
+	db.Model(&rec).Updates(map[string]interface{}{
+		"status":            rec.Status,
+		"file_path":         rec.FilePath,
+		"url":               rec.URL,
+		"size":              rec.Size,
+		"expires_at":        expiresAt,
+		"transcript_status": rec.TranscriptStatus,
+	})
+
+	// Ссылка на запись в истории звонков
+	switch rec.CallKind {
+	case "call":
+		db.Model(&models.Call{}).Where("id = ?", rec.CallID).Update("recording_url", rec.URL)
+	case "group_call":
+		db.Model(&models.GroupCall{}).Where("id = ?", rec.CallID).Update("recording_url", rec.URL)
+	}
+	notifyRecording(wsHub, rec, "recording:ready", gin.H{"url": rec.URL, "expiresAt": expiresAt})
+
+	if rec.TranscriptStatus == "pending" {
+		transcribeRecording(db, wsHub, rec)
+	}
+}
+
+// transcribeRecording расшифровывает готовую запись
+func transcribeRecording(db *gorm.DB, wsHub *websocket.Hub, rec models.CallRecording) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	result, err := transcriber.Transcribe(ctx, rec.FilePath, transcribeLanguage)
+	if err != nil {
+		log.Printf("Transcription of recording %s failed (%s): %v", rec.ID, transcriber.Name(), err)
+		rec.TranscriptStatus = "failed"
+		db.Model(&rec).Update("transcript_status", rec.TranscriptStatus)
+		notifyRecording(wsHub, rec, "recording:transcribed", gin.H{"transcriptStatus": rec.TranscriptStatus})
+		return
+	}
+
+	segments, _ := json.Marshal(result.Segments)
+	rec.TranscriptStatus = "done"
+	rec.Transcript = result.Text
+	rec.Language = result.Language
+	db.Model(&rec).Updates(map[string]interface{}{
+		"transcript_status": rec.TranscriptStatus,
+		"transcript":        rec.Transcript,
+		"transcript_json":   string(segments),
+		"language":          rec.Language,
+	})
+	notifyRecording(wsHub, rec, "recording:transcribed", gin.H{"transcriptStatus": rec.TranscriptStatus})
+}
+
+func recordingPayload(rec models.CallRecording) gin.H {
+	var segments []transcribe.Segment
+	json.Unmarshal([]byte(rec.TranscriptJSON), &segments)
+	return gin.H{
+		"id":               rec.ID,
+		"callId":           rec.CallID,
+		"callKind":         rec.CallKind,
+		"chatId":           rec.ChatID,
+		"startedBy":        rec.StartedBy,
+		"status":           rec.Status,
+		"source":           rec.Source,
+		"participants":     recordingParticipants(rec),
+		"url":              rec.URL,
+		"size":             rec.Size,
+		"duration":         rec.Duration,
+		"startedAt":        rec.StartedAt,
+		"stoppedAt":        rec.StoppedAt,
+		"expiresAt":        rec.ExpiresAt,
+		"transcriptStatus": rec.TranscriptStatus,
+		"transcript":       rec.Transcript,
+		"segments":         segments,
+		"language":         rec.Language,
+		"createdAt":        rec.CreatedAt,
+	}
+}
+
+// GetCallRecording запись вместе с согласиями участников и расшифровкой
+func GetCallRecording(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		rec, found := loadRecording(c, db, userIDStr)
+		if !found {
+			return
+		}
+
+		var consents []models.RecordingConsent
+		db.Where("recording_id = ?", rec.ID).Find(&consents)
+
+		payload := recordingPayload(rec)
+		payload["consents"] = consents
+		c.JSON(http.StatusOK, gin.H{"recording": payload})
+	}
+}
+
+// GetRecordingFile отдает файл готовой записи только участникам записанного звонка
+func GetRecordingFile(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var rec models.CallRecording
+		if err := db.First(&rec, "id = ?", c.Param("id")).Error; err != nil ||
+			!isRecordingParticipant(rec, userIDStr) || rec.Status != "ready" || rec.FilePath == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		contentType, ok := recordingContentTypes[strings.ToLower(filepath.Ext(rec.FilePath))]
+		if !ok {
+			contentType = "application/octet-stream"
+		}
+
+		c.Header("Content-Type", contentType)
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.File(rec.FilePath)
+	}
+}
+
+// GetCallRecordings записи звонка (?callId=) или чата (?chatId=)
+func GetCallRecordings(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		query := participantRecordings(db.Where("status <> ?", "expired"), userIDStr).Order("created_at DESC").Limit(100)
+		if callID := c.Query("callId"); callID != "" {
+			query = query.Where("call_id = ?", callID)
+		} else if chatID := c.Query("chatId"); chatID != "" {
+			query = query.Where("chat_id = ?", chatID)
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		var recs []models.CallRecording
+		if err := query.Find(&recs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		result := make([]gin.H, 0, len(recs))
+		for _, rec := range recs {
+			if !isRecordingParticipant(rec, userIDStr) {
+				continue
+			}
+			payload := recordingPayload(rec)
+			delete(payload, "transcript")
+			delete(payload, "segments")
+			result = append(result, payload)
+		}
+		c.JSON(http.StatusOK, gin.H{"recordings": result})
+	}
+}
+
+// SearchCallRecordings полнотекстовый поиск по расшифровкам звонков, в которых участвовал пользователь
+func SearchCallRecordings(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		q := strings.TrimSpace(c.Query("q"))
+		if q == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		type searchRow struct {
+			models.CallRecording
+			Snippet string
+		}
+		var rows []searchRow
+		err := participantRecordings(db.Table("call_recordings"), userIDStr).
+			Select("call_recordings.*, ts_headline('simple', call_recordings.transcript, plainto_tsquery('simple', ?)) AS snippet", q).
+			Where("call_recordings.transcript_status = ? AND call_recordings.status = ?", "done", "ready").
+			Where("to_tsvector('simple', coalesce(call_recordings.transcript, '')) @@ plainto_tsquery('simple', ?)", q).
+			Order("call_recordings.created_at DESC").
+			Limit(50).
+			Scan(&rows).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		result := make([]gin.H, 0, len(rows))
+		for _, row := range rows {
+			payload := recordingPayload(row.CallRecording)
+			delete(payload, "transcript")
+			delete(payload, "segments")
+			payload["snippet"] = row.Snippet
+			result = append(result, payload)
+		}
+		c.JSON(http.StatusOK, gin.H{"recordings": result})
+	}
+}
+
+// GetRecordingPolicy политика записей чата
+func GetRecordingPolicy(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		chatID := c.Param("id")
+		if !authz.IsMember(userIDStr, authz.Chat(chatID)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"policy":               recordingPolicy(db, chatID),
+			"defaultRetentionDays": int(recordingRetention.Hours() / 24),
+			"transcription":        transcriber != nil,
+		})
+	}
+}
+
+// UpdateRecordingPolicy меняет политику записей чата
+func UpdateRecordingPolicy(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		chatID := c.Param("id")
+		if !authz.Can(userIDStr, authz.Chat(chatID), authz.ManageSettings) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var req struct {
+			Disabled      *bool `json:"disabled"`
+			RetentionDays *int  `json:"retentionDays"`
+			Transcribe    *bool `json:"transcribe"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+		if req.RetentionDays != nil && (*req.RetentionDays < 0 || *req.RetentionDays > 3650) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_retention"})
+			return
+		}
+
+		policy := recordingPolicy(db, chatID)
+		if req.Disabled != nil {
+			policy.Disabled = *req.Disabled
+		}
+		if req.RetentionDays != nil {
+			policy.RetentionDays = *req.RetentionDays
+		}
+		if req.Transcribe != nil {
+			policy.Transcribe = *req.Transcribe
+		}
+		policy.UpdatedBy = userIDStr
+		if err := db.Save(&policy).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		logModeration(db, chatID, "", userIDStr, "recording_policy_updated", "", "", gin.H{
+			"disabled":      policy.Disabled,
+			"retentionDays": policy.RetentionDays,
+			"transcribe":    policy.Transcribe,
+		})
+		c.JSON(http.StatusOK, gin.H{"policy": policy})
+	}
+}
+
+// StartRecordingRetention раз в час удаляет записи с истекшим сроком хранения
+func StartRecordingRetention(db *gorm.DB) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		expireRecordings(db)
+		<-ticker.C
+	}
+}
+
+func expireRecordings(db *gorm.DB) {
+	var recs []models.CallRecording
+	db.Where("expires_at IS NOT NULL AND expires_at < ? AND status <> ?", time.Now(), "expired").Find(&recs)
+	for _, rec := range recs {
+		if err := os.RemoveAll(filepath.Join(recordingDir, rec.ID)); err != nil {
+			log.Printf("Failed to remove recording %s: %v", rec.ID, err)
+			continue
+		}
+		db.Model(&rec).Updates(map[string]interface{}{
+			"status":          "expired",
+			"url":             "",
+			"file_path":       "",
+			"transcript":      "",
+			"transcript_json": "",
+		})
+		if rec.URL != "" {
+			db.Model(&models.Call{}).Where("id = ? AND recording_url = ?", rec.CallID, rec.URL).Update("recording_url", "")
+			db.Model(&models.GroupCall{}).Where("id = ? AND recording_url = ?", rec.CallID, rec.URL).Update("recording_url", "")
+		}
+	}
+	if len(recs) > 0 {
+		log.Printf("Expired %d call recordings", len(recs))
+	}
+}
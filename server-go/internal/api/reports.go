@@ -0,0 +1,608 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"safegram-server/internal/authz"
+	"safegram-server/internal/models"
+	"safegram-server/internal/websocket"
+)
+
+var validReportReasons = map[string]bool{
+	"spam":     true,
+	"abuse":    true,
+	"violence": true,
+	"nsfw":     true,
+	"scam":     true,
+	"other":    true,
+}
+
+// reportSnapshot проверяет доступ к объекту жалобы и собирает снимок доказательств.
+// Возвращает автора объекта, чат (если есть) и JSON снимка.
+func reportSnapshot(db *gorm.DB, reporterID, targetType, targetID string) (targetUserID, chatID string, evidence any, ok bool) {
+	switch targetType {
+	case "message":
+		var msg models.Message
+		if err := db.Preload("Sender").First(&msg, "id = ?", targetID).Error; err != nil {
+			return "", "", nil, false
+		}
+		if !authz.IsMember(reporterID, authz.Chat(msg.ChatID)) {
+			return "", "", nil, false
+		}
+		return msg.SenderID, msg.ChatID, gin.H{
+			"messageId":      msg.ID,
+			"chatId":         msg.ChatID,
+			"senderId":       msg.SenderID,
+			"senderUsername": msg.Sender.Username,
+			"text":           msg.Text,
+			"ciphertext":     msg.Ciphertext,
+			"attachmentUrl":  msg.AttachmentURL,
+			"stickerId":      msg.StickerID,
+			"gifUrl":         msg.GifURL,
+			"editedAt":       msg.EditedAt,
+			"createdAt":      msg.CreatedAt,
+		}, true
+	case "user":
+		var user models.User
+		if err := db.First(&user, "id = ?", targetID).Error; err != nil {
+			return "", "", nil, false
+		}
+		return user.ID, "", gin.H{
+			"userId":    user.ID,
+			"username":  user.Username,
+			"avatarUrl": user.AvatarURL,
+			"about":     user.About,
+		}, true
+	case "chat":
+		var chat models.Chat
+		if err := db.First(&chat, "id = ?", targetID).Error; err != nil {
+			return "", "", nil, false
+		}
+		if chat.Type == "dm" && !authz.IsMember(reporterID, authz.Chat(chat.ID)) {
+			return "", "", nil, false
+		}
+		return chat.CreatedBy, chat.ID, gin.H{
+			"chatId":      chat.ID,
+			"type":        chat.Type,
+			"name":        chat.Name,
+			"description": chat.Description,
+			"createdBy":   chat.CreatedBy,
+		}, true
+	case "story":
+		var story models.Story
+		if err := db.First(&story, "id = ?", targetID).Error; err != nil {
+			return "", "", nil, false
+		}
+		return story.UserID, "", gin.H{
+			"storyId":    story.ID,
+			"userId":     story.UserID,
+			"type":       story.Type,
+			"contentUrl": story.ContentURL,
+			"text":       story.Text,
+			"createdAt":  story.CreatedAt,
+		}, true
+	}
+	return "", "", nil, false
+}
+
+// CreateReport создает жалобу на сообщение, пользователя, чат или историю
+func CreateReport(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var req struct {
+			TargetType string `json:"targetType" binding:"required"`
+			TargetID   string `json:"targetId" binding:"required"`
+			Reason     string `json:"reason" binding:"required"`
+			Comment    string `json:"comment"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+		if !validReportReasons[req.Reason] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_reason"})
+			return
+		}
+
+		targetUserID, chatID, evidence, found := reportSnapshot(db, userIDStr, req.TargetType, req.TargetID)
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		if targetUserID == userIDStr && req.TargetType == "user" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cannot_report_self"})
+			return
+		}
+
+		// Повторная жалоба на тот же объект, пока первая не рассмотрена, не создается
+		var existing models.Report
+		if err := db.Where("reporter_id = ? AND target_type = ? AND target_id = ? AND status IN ?",
+			userIDStr, req.TargetType, req.TargetID, []string{"open", "in_review"}).First(&existing).Error; err == nil {
+			c.JSON(http.StatusOK, gin.H{"report": existing})
+			return
+		}
+
+		evidenceJSON, _ := json.Marshal(evidence)
+		report := models.Report{
+			ID:           uuid.New().String(),
+			ReporterID:   userIDStr,
+			TargetType:   req.TargetType,
+			TargetID:     req.TargetID,
+			TargetUserID: targetUserID,
+			ChatID:       chatID,
+			Reason:       req.Reason,
+			Comment:      req.Comment,
+			Evidence:     string(evidenceJSON),
+			Status:       "open",
+		}
+		if err := db.Create(&report).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		logModeration(db, chatID, "", userIDStr, "report_create", targetUserID, reportMessageID(report), gin.H{
+			"reportId":   report.ID,
+			"targetType": report.TargetType,
+			"reason":     report.Reason,
+		})
+		c.JSON(http.StatusCreated, gin.H{"report": report})
+	}
+}
+
+func reportMessageID(report models.Report) string {
+	if report.TargetType == "message" {
+		return report.TargetID
+	}
+	return ""
+}
+
+// GetMyReports жалобы, отправленные текущим пользователем
+func GetMyReports(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var reports []models.Report
+		db.Select("id", "target_type", "target_id", "reason", "status", "resolution", "created_at", "resolved_at").
+			Where("reporter_id = ?", userIDStr).
+			Order("created_at DESC").Limit(100).Find(&reports)
+		c.JSON(http.StatusOK, gin.H{"reports": reports})
+	}
+}
+
+// GetAdminReports очередь жалоб (фильтры: status, assignee, targetType)
+func GetAdminReports(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := db.Model(&models.Report{})
+		if status := c.Query("status"); status != "" {
+			query = query.Where("status = ?", status)
+		} else {
+			query = query.Where("status IN ?", []string{"open", "in_review"})
+		}
+		if assignee := c.Query("assignee"); assignee != "" {
+			if assignee == "me" {
+				assignee = c.GetString("userID")
+			}
+			query = query.Where("assignee_id = ?", assignee)
+		}
+		if targetType := c.Query("targetType"); targetType != "" {
+			query = query.Where("target_type = ?", targetType)
+		}
+
+		limit := parseInt(c.DefaultQuery("limit", "100"))
+		if limit <= 0 || limit > 500 {
+			limit = 100
+		}
+
+		var reports []models.Report
+		if err := query.Order("created_at ASC").Limit(limit).Find(&reports).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		c.JSON(http.StatusOK, reports)
+	}
+}
+
+// GetAdminReport жалоба вместе с другими жалобами на тот же объект
+func GetAdminReport(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var report models.Report
+		if err := db.First(&report, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+
+		var related []models.Report
+		db.Where("target_type = ? AND target_id = ? AND id != ?", report.TargetType, report.TargetID, report.ID).
+			Order("created_at DESC").Limit(50).Find(&related)
+		c.JSON(http.StatusOK, gin.H{"report": report, "related": related})
+	}
+}
+
+// AssignReport назначает жалобу администратору (по умолчанию себе)
+func AssignReport(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.GetString("userID")
+
+		var req struct {
+			AssigneeID string `json:"assigneeId"`
+		}
+		_ = c.ShouldBindJSON(&req)
+		if req.AssigneeID == "" {
+			req.AssigneeID = actorID
+		}
+
+		var report models.Report
+		if err := db.First(&report, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		if report.Status != "open" && report.Status != "in_review" {
+			c.JSON(http.StatusConflict, gin.H{"error": "already_resolved"})
+			return
+		}
+
+		report.AssigneeID = req.AssigneeID
+		report.Status = "in_review"
+		db.Model(&report).Updates(map[string]interface{}{"assignee_id": report.AssigneeID, "status": report.Status})
+
+		logModeration(db, report.ChatID, "", actorID, "report_assign", report.TargetUserID, reportMessageID(report), gin.H{
+			"reportId":   report.ID,
+			"assigneeId": report.AssigneeID,
+		})
+		c.JSON(http.StatusOK, gin.H{"report": report})
+	}
+}
+
+// ResolveReport закрывает жалобу с действием: warn | ban | delete | dismiss
+func ResolveReport(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.GetString("userID")
+
+		var req struct {
+			Action  string `json:"action" binding:"required"`
+			Note    string `json:"note"`
+			Scope   string `json:"scope"`   // для ban: "chat" | "platform"
+			Minutes int    `json:"minutes"` // для ban в чате; 0 — бессрочно
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		var report models.Report
+		if err := db.First(&report, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		if report.Status != "open" && report.Status != "in_review" {
+			c.JSON(http.StatusConflict, gin.H{"error": "already_resolved"})
+			return
+		}
+
+		meta := gin.H{"reportId": report.ID, "note": req.Note}
+		status := "resolved"
+
+		switch req.Action {
+		case "dismiss":
+			status = "dismissed"
+
+		case "warn":
+			if report.TargetUserID == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "no_target_user"})
+				return
+			}
+			if report.ChatID != "" {
+				applyWarning(db, nil, report.ChatID, report.TargetUserID, actorID, req.Note)
+			}
+			go SendPushNotification(db, report.TargetUserID, "Предупреждение", "Вы получили предупреждение от модерации", map[string]interface{}{
+				"type":     "moderation_warning",
+				"reportId": report.ID,
+			})
+
+		case "ban":
+			if report.TargetUserID == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "no_target_user"})
+				return
+			}
+			scope := req.Scope
+			if scope == "" {
+				scope = "platform"
+				if report.ChatID != "" {
+					scope = "chat"
+				}
+			}
+			meta["scope"] = scope
+			switch scope {
+			case "chat":
+				if report.ChatID == "" {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "no_chat"})
+					return
+				}
+				var exp *time.Time
+				if req.Minutes > 0 {
+					t := time.Now().Add(time.Duration(req.Minutes) * time.Minute)
+					exp = &t
+					meta["expiresAt"] = t
+				}
+				_ = db.Create(&models.ChatBan{
+					ID:        uuid.New().String(),
+					ChatID:    report.ChatID,
+					UserID:    report.TargetUserID,
+					ActorID:   actorID,
+					Reason:    req.Note,
+					ExpiresAt: exp,
+				}).Error
+				logMemberEvent(db, "chat", report.ChatID, report.TargetUserID, actorID, "ban", meta)
+			case "platform":
+				var target models.User
+				if err := db.First(&target, "id = ?", report.TargetUserID).Error; err != nil {
+					c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+					return
+				}
+				for _, role := range target.ParseRoles() {
+					if role == "owner" {
+						c.JSON(http.StatusForbidden, gin.H{"error": "cannot_block_owner"})
+						return
+					}
+				}
+				db.Model(&target).Updates(map[string]interface{}{"status": "banned", "roles": "[]"})
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_scope"})
+				return
+			}
+
+		case "delete":
+			switch report.TargetType {
+			case "message":
+				var msg models.Message
+				if err := db.First(&msg, "id = ?", report.TargetID).Error; err == nil && msg.DeletedAt == nil {
+					now := time.Now()
+					db.Model(&msg).Updates(map[string]interface{}{"deleted_at": now, "deleted_by": "moderator"})
+					msg.DeletedAt = &now
+					msg.DeletedBy = "moderator"
+					if msg.ModerationStatus == "approved" {
+						dropUnread(db, msg)
+					}
+					refreshChatSummary(db, msg.ChatID)
+					refreshThreadSummary(db, wsHub, msg.ThreadID)
+					broadcastMessageEvent(db, wsHub, msg, wsEvent("message:delete", messageTombstone(msg)))
+				}
+			case "story":
+				db.Where("story_id = ?", report.TargetID).Delete(&models.StoryView{})
+				db.Delete(&models.Story{}, "id = ?", report.TargetID)
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{"error": "cannot_delete_target"})
+				return
+			}
+
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_action"})
+			return
+		}
+
+		now := time.Now()
+		report.Status = status
+		report.Resolution = req.Action
+		report.ResolutionNote = req.Note
+		report.ResolvedBy = actorID
+		report.ResolvedAt = &now
+		if report.AssigneeID == "" {
+			report.AssigneeID = actorID
+		}
+		db.Save(&report)
+
+		// Остальные открытые жалобы на тот же объект закрываются тем же решением
+		db.Model(&models.Report{}).
+			Where("target_type = ? AND target_id = ? AND status IN ?", report.TargetType, report.TargetID, []string{"open", "in_review"}).
+			Updates(map[string]interface{}{
+				"status":          status,
+				"resolution":      req.Action,
+				"resolution_note": req.Note,
+				"resolved_by":     actorID,
+				"resolved_at":     now,
+			})
+
+		logModeration(db, report.ChatID, "", actorID, "report_"+req.Action, report.TargetUserID, reportMessageID(report), meta)
+		c.JSON(http.StatusOK, gin.H{"report": report})
+	}
+}
+
+// CreateAppeal апелляция заблокированного пользователя
+func CreateAppeal(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var req struct {
+			Scope    string `json:"scope" binding:"required"` // platform | chat
+			ChatID   string `json:"chatId"`
+			ReportID string `json:"reportId"`
+			Text     string `json:"text" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		switch req.Scope {
+		case "platform":
+			var user models.User
+			if err := db.First(&user, "id = ?", userIDStr).Error; err != nil || user.Status != "banned" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "not_banned"})
+				return
+			}
+			req.ChatID = ""
+		case "chat":
+			var ban models.ChatBan
+			if req.ChatID == "" || db.Where("chat_id = ? AND user_id = ? AND (expires_at IS NULL OR expires_at > ?)", req.ChatID, userIDStr, time.Now()).
+				First(&ban).Error != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "not_banned"})
+				return
+			}
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_scope"})
+			return
+		}
+
+		// Жалоба должна быть на самого заявителя и закончиться баном в той же области
+		if req.ReportID != "" {
+			var report models.Report
+			if err := db.First(&report, "id = ?", req.ReportID).Error; err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "report_not_found"})
+				return
+			}
+			if report.TargetUserID != userIDStr {
+				c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+				return
+			}
+			if report.Status != "resolved" || report.Resolution != "ban" || req.Scope == "chat" && report.ChatID != req.ChatID {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "report_not_actioned"})
+				return
+			}
+		}
+
+		var pending int64
+		db.Model(&models.Appeal{}).
+			Where("user_id = ? AND scope = ? AND chat_id = ? AND status = ?", userIDStr, req.Scope, req.ChatID, "pending").
+			Count(&pending)
+		if pending > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "appeal_pending"})
+			return
+		}
+
+		appeal := models.Appeal{
+			ID:       uuid.New().String(),
+			UserID:   userIDStr,
+			Scope:    req.Scope,
+			ChatID:   req.ChatID,
+			ReportID: req.ReportID,
+			Text:     req.Text,
+			Status:   "pending",
+		}
+		if err := db.Create(&appeal).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		logModeration(db, appeal.ChatID, "", userIDStr, "appeal_create", userIDStr, "", gin.H{"appealId": appeal.ID, "scope": appeal.Scope})
+		c.JSON(http.StatusCreated, gin.H{"appeal": appeal})
+	}
+}
+
+// GetMyAppeals апелляции текущего пользователя
+func GetMyAppeals(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var appeals []models.Appeal
+		db.Where("user_id = ?", c.GetString("userID")).Order("created_at DESC").Limit(50).Find(&appeals)
+		c.JSON(http.StatusOK, gin.H{"appeals": appeals})
+	}
+}
+
+// GetAdminAppeals очередь апелляций
+func GetAdminAppeals(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status := c.DefaultQuery("status", "pending")
+		var appeals []models.Appeal
+		db.Where("status = ?", status).Order("created_at ASC").Limit(100).Find(&appeals)
+		c.JSON(http.StatusOK, gin.H{"appeals": appeals})
+	}
+}
+
+// ReviewAppeal принимает или отклоняет апелляцию; принятие снимает бан
+func ReviewAppeal(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.GetString("userID")
+
+		var req struct {
+			Accept bool   `json:"accept"`
+			Note   string `json:"note"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		var appeal models.Appeal
+		if err := db.First(&appeal, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		if appeal.Status != "pending" {
+			c.JSON(http.StatusConflict, gin.H{"error": "already_reviewed"})
+			return
+		}
+
+		action := "appeal_reject"
+		appeal.Status = "rejected"
+		if req.Accept {
+			action = "appeal_accept"
+			appeal.Status = "accepted"
+			if appeal.Scope == "chat" {
+				db.Where("chat_id = ? AND user_id = ?", appeal.ChatID, appeal.UserID).Delete(&models.ChatBan{})
+				logMemberEvent(db, "chat", appeal.ChatID, appeal.UserID, actorID, "unban", gin.H{"appealId": appeal.ID})
+			} else {
+				db.Model(&models.User{}).Where("id = ? AND status = ?", appeal.UserID, "banned").Update("status", "online")
+			}
+		}
+
+		now := time.Now()
+		appeal.ReviewerID = actorID
+		appeal.ReviewNote = req.Note
+		appeal.ReviewedAt = &now
+		db.Save(&appeal)
+
+		logModeration(db, appeal.ChatID, "", actorID, action, appeal.UserID, "", gin.H{"appealId": appeal.ID, "note": req.Note})
+		go SendPushNotification(db, appeal.UserID, "Апелляция рассмотрена", "Решение по вашей апелляции принято", map[string]interface{}{
+			"type":     "appeal_reviewed",
+			"appealId": appeal.ID,
+			"status":   appeal.Status,
+		})
+		c.JSON(http.StatusOK, gin.H{"appeal": appeal})
+	}
+}
+
+// CreateFeedback отправка обратной связи
+func CreateFeedback(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Subject string `json:"subject" binding:"required"`
+			Body    string `json:"body" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		fb := models.Feedback{
+			ID:      uuid.New().String(),
+			UserID:  c.GetString("userID"),
+			Subject: req.Subject,
+			Body:    req.Body,
+		}
+		if err := db.Create(&fb).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"ok": true, "id": fb.ID})
+	}
+}
@@ -0,0 +1,546 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"safegram-server/internal/authz"
+	"safegram-server/internal/models"
+)
+
+// validRoleScope проверяет, что область поддерживает роли:
+// сервер или группа/канал, не привязанный к серверу
+func validRoleScope(db *gorm.DB, scopeType, scopeID string) bool {
+	if scopeType == "server" {
+		var server models.Server
+		return db.First(&server, "id = ?", scopeID).Error == nil
+	}
+	var chat models.Chat
+	if err := db.First(&chat, "id = ? AND type IN ?", scopeID, []string{"group", "channel"}).Error; err != nil {
+		return false
+	}
+	var ch models.Channel
+	return db.Where("chat_id = ?", scopeID).First(&ch).Error != nil
+}
+
+// logScopeModeration пишет лог модерации для группы или сервера
+func logScopeModeration(db *gorm.DB, scopeType, scopeID, actorID, action, targetUserID string, metadata any) {
+	if scopeType == "server" {
+		logModeration(db, "", scopeID, actorID, action, targetUserID, "", metadata)
+		return
+	}
+	logModeration(db, scopeID, "", actorID, action, targetUserID, "", metadata)
+}
+
+// canGrant проверяет, что актор не выдает права, которых у него нет
+func canGrant(actorPerms authz.Permission, requested int64) bool {
+	return authz.Permission(requested)&^actorPerms == 0
+}
+
+// GetRoles список ролей группы/сервера (участники)
+func GetRoles(db *gorm.DB, scopeType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopeID := c.Param("id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if !validRoleScope(db, scopeType, scopeID) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		if !authz.IsMember(userIDStr, authz.Scope{Type: scopeType, ID: scopeID}) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		if _, err := authz.DefaultRole(scopeType, scopeID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var roles []models.Role
+		db.Where("scope_type = ? AND scope_id = ?", scopeType, scopeID).Order("position DESC").Find(&roles)
+
+		c.JSON(http.StatusOK, gin.H{"roles": roles, "permissions": authz.AllNames()})
+	}
+}
+
+// CreateRole создает роль (manage_roles, ниже собственной позиции)
+func CreateRole(db *gorm.DB, scopeType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopeID := c.Param("id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if !validRoleScope(db, scopeType, scopeID) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		scope := authz.Scope{Type: scopeType, ID: scopeID}
+		actorPerms := authz.Permissions(userIDStr, scope)
+		if !actorPerms.Has(authz.ManageRoles) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient_permissions"})
+			return
+		}
+
+		var req struct {
+			Name        string `json:"name" binding:"required"`
+			Color       string `json:"color"`
+			Position    int    `json:"position"`
+			Permissions int64  `json:"permissions"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		if req.Position <= 0 {
+			req.Position = 1
+		}
+		if req.Position >= authz.Rank(userIDStr, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "role_hierarchy"})
+			return
+		}
+		req.Permissions &= int64(authz.AllPermissions)
+		if !canGrant(actorPerms, req.Permissions) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "permission_escalation"})
+			return
+		}
+
+		role := models.Role{
+			ID:          uuid.New().String(),
+			ScopeType:   scopeType,
+			ScopeID:     scopeID,
+			Name:        req.Name,
+			Color:       req.Color,
+			Position:    req.Position,
+			Permissions: req.Permissions,
+		}
+		if err := db.Create(&role).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		logScopeModeration(db, scopeType, scopeID, userIDStr, "role_create", "", gin.H{"roleId": role.ID, "name": role.Name})
+		c.JSON(http.StatusOK, gin.H{"role": role})
+	}
+}
+
+// UpdateRole изменяет роль (manage_roles, ниже собственной позиции)
+func UpdateRole(db *gorm.DB, scopeType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopeID := c.Param("id")
+		roleID := c.Param("roleId")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		scope := authz.Scope{Type: scopeType, ID: scopeID}
+		actorPerms := authz.Permissions(userIDStr, scope)
+		if !actorPerms.Has(authz.ManageRoles) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient_permissions"})
+			return
+		}
+
+		var role models.Role
+		if err := db.First(&role, "id = ? AND scope_type = ? AND scope_id = ?", roleID, scopeType, scopeID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+
+		rank := authz.Rank(userIDStr, scope)
+		if role.Position >= rank {
+			c.JSON(http.StatusForbidden, gin.H{"error": "role_hierarchy"})
+			return
+		}
+
+		var req struct {
+			Name        *string `json:"name"`
+			Color       *string `json:"color"`
+			Position    *int    `json:"position"`
+			Permissions *int64  `json:"permissions"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		// У @everyone нельзя менять имя и позицию
+		if role.IsDefault && (req.Name != nil || req.Position != nil) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "default_role_immutable"})
+			return
+		}
+
+		if req.Name != nil && *req.Name != "" {
+			role.Name = *req.Name
+		}
+		if req.Color != nil {
+			role.Color = *req.Color
+		}
+		if req.Position != nil {
+			if *req.Position <= 0 || *req.Position >= rank {
+				c.JSON(http.StatusForbidden, gin.H{"error": "role_hierarchy"})
+				return
+			}
+			role.Position = *req.Position
+		}
+		if req.Permissions != nil {
+			perms := *req.Permissions & int64(authz.AllPermissions)
+			// Можно снимать любые права роли, но добавлять только имеющиеся у себя
+			if !canGrant(actorPerms, perms&^role.Permissions) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "permission_escalation"})
+				return
+			}
+			role.Permissions = perms
+		}
+
+		if err := db.Save(&role).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		logScopeModeration(db, scopeType, scopeID, userIDStr, "role_update", "", gin.H{"roleId": role.ID, "permissions": role.Permissions})
+		c.JSON(http.StatusOK, gin.H{"role": role})
+	}
+}
+
+// DeleteRole удаляет роль и все ее назначения
+func DeleteRole(db *gorm.DB, scopeType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopeID := c.Param("id")
+		roleID := c.Param("roleId")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		scope := authz.Scope{Type: scopeType, ID: scopeID}
+		if !authz.Can(userIDStr, scope, authz.ManageRoles) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient_permissions"})
+			return
+		}
+
+		var role models.Role
+		if err := db.First(&role, "id = ? AND scope_type = ? AND scope_id = ?", roleID, scopeType, scopeID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		if role.IsDefault {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "default_role_immutable"})
+			return
+		}
+		if role.Position >= authz.Rank(userIDStr, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "role_hierarchy"})
+			return
+		}
+
+		db.Where("role_id = ?", role.ID).Delete(&models.MemberRole{})
+		db.Where("subject_type = ? AND subject_id = ?", "role", role.ID).Delete(&models.PermissionOverwrite{})
+		db.Delete(&role)
+
+		logScopeModeration(db, scopeType, scopeID, userIDStr, "role_delete", "", gin.H{"roleId": role.ID, "name": role.Name})
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// AssignRole выдает роль участнику
+func AssignRole(db *gorm.DB, scopeType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopeID := c.Param("id")
+		targetUserID := c.Param("userId")
+		roleID := c.Param("roleId")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		scope := authz.Scope{Type: scopeType, ID: scopeID}
+		if !authz.Can(userIDStr, scope, authz.ManageRoles) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient_permissions"})
+			return
+		}
+
+		var role models.Role
+		if err := db.First(&role, "id = ? AND scope_type = ? AND scope_id = ?", roleID, scopeType, scopeID).Error; err != nil || role.IsDefault {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		if role.Position >= authz.Rank(userIDStr, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "role_hierarchy"})
+			return
+		}
+		// Роли участников не ниже себя не меняют
+		if targetUserID != userIDStr && !authz.Outranks(userIDStr, targetUserID, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "role_hierarchy"})
+			return
+		}
+		// Роль не может нести права, которых нет у самого актора
+		if !canGrant(authz.Permissions(userIDStr, scope), role.Permissions) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "permission_escalation"})
+			return
+		}
+		if !authz.IsMember(targetUserID, scope) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_member"})
+			return
+		}
+
+		var existing models.MemberRole
+		if err := db.Where("role_id = ? AND user_id = ?", role.ID, targetUserID).First(&existing).Error; err == nil {
+			c.JSON(http.StatusOK, gin.H{"ok": true})
+			return
+		}
+
+		if err := db.Create(&models.MemberRole{
+			ID:        uuid.New().String(),
+			RoleID:    role.ID,
+			ScopeType: scopeType,
+			ScopeID:   scopeID,
+			UserID:    targetUserID,
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		logMemberEvent(db, scopeType, scopeID, targetUserID, userIDStr, "role_add", gin.H{"roleId": role.ID, "name": role.Name})
+		logScopeModeration(db, scopeType, scopeID, userIDStr, "role_assign", targetUserID, gin.H{"roleId": role.ID})
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// RevokeRole снимает роль с участника
+func RevokeRole(db *gorm.DB, scopeType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopeID := c.Param("id")
+		targetUserID := c.Param("userId")
+		roleID := c.Param("roleId")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		scope := authz.Scope{Type: scopeType, ID: scopeID}
+		if !authz.Can(userIDStr, scope, authz.ManageRoles) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient_permissions"})
+			return
+		}
+
+		var role models.Role
+		if err := db.First(&role, "id = ? AND scope_type = ? AND scope_id = ?", roleID, scopeType, scopeID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		if role.Position >= authz.Rank(userIDStr, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "role_hierarchy"})
+			return
+		}
+		if targetUserID != userIDStr && !authz.Outranks(userIDStr, targetUserID, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "role_hierarchy"})
+			return
+		}
+
+		db.Where("role_id = ? AND user_id = ?", role.ID, targetUserID).Delete(&models.MemberRole{})
+
+		logMemberEvent(db, scopeType, scopeID, targetUserID, userIDStr, "role_remove", gin.H{"roleId": role.ID, "name": role.Name})
+		logScopeModeration(db, scopeType, scopeID, userIDStr, "role_revoke", targetUserID, gin.H{"roleId": role.ID})
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// overwriteTarget проверяет, что канал/категория принадлежит серверу
+func overwriteTarget(db *gorm.DB, targetType, serverID, targetID string) bool {
+	if targetType == "category" {
+		var cat models.ChannelCategory
+		return db.First(&cat, "id = ? AND server_id = ?", targetID, serverID).Error == nil
+	}
+	var ch models.Channel
+	return db.First(&ch, "id = ? AND server_id = ?", targetID, serverID).Error == nil
+}
+
+// GetPermissionOverwrites переопределения прав канала/категории (manage_roles)
+func GetPermissionOverwrites(db *gorm.DB, targetType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serverID := c.Param("id")
+		targetID := c.Param(targetType + "Id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if !authz.Can(userIDStr, authz.Server(serverID), authz.ManageRoles) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient_permissions"})
+			return
+		}
+		if !overwriteTarget(db, targetType, serverID, targetID) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+
+		var overwrites []models.PermissionOverwrite
+		db.Where("target_type = ? AND target_id = ?", targetType, targetID).Find(&overwrites)
+		c.JSON(http.StatusOK, gin.H{"overwrites": overwrites})
+	}
+}
+
+// SetPermissionOverwrite создает/обновляет переопределение прав (manage_roles)
+func SetPermissionOverwrite(db *gorm.DB, targetType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serverID := c.Param("id")
+		targetID := c.Param(targetType + "Id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		scope := authz.Server(serverID)
+		actorPerms := authz.Permissions(userIDStr, scope)
+		if !actorPerms.Has(authz.ManageRoles) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient_permissions"})
+			return
+		}
+		if !overwriteTarget(db, targetType, serverID, targetID) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+
+		var req struct {
+			SubjectType string `json:"subjectType" binding:"required"` // everyone | role | member
+			SubjectID   string `json:"subjectId"`
+			Allow       int64  `json:"allow"`
+			Deny        int64  `json:"deny"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || req.Allow&req.Deny != 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+		req.Allow &= int64(authz.AllPermissions &^ authz.Administrator)
+		req.Deny &= int64(authz.AllPermissions &^ authz.Administrator)
+
+		switch req.SubjectType {
+		case "everyone":
+			req.SubjectID = ""
+		case "role":
+			var role models.Role
+			if err := db.First(&role, "id = ? AND scope_type = ? AND scope_id = ?", req.SubjectID, "server", serverID).Error; err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+				return
+			}
+		case "member":
+			if !authz.IsMember(req.SubjectID, scope) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "not_member"})
+				return
+			}
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		if !canGrant(actorPerms, req.Allow|req.Deny) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "permission_escalation"})
+			return
+		}
+
+		var overwrite models.PermissionOverwrite
+		err := db.Where("target_type = ? AND target_id = ? AND subject_type = ? AND subject_id = ?",
+			targetType, targetID, req.SubjectType, req.SubjectID).First(&overwrite).Error
+		if err != nil {
+			overwrite = models.PermissionOverwrite{
+				ID:          uuid.New().String(),
+				ServerID:    serverID,
+				TargetType:  targetType,
+				TargetID:    targetID,
+				SubjectType: req.SubjectType,
+				SubjectID:   req.SubjectID,
+			}
+		}
+		overwrite.Allow = req.Allow
+		overwrite.Deny = req.Deny
+		if err := db.Save(&overwrite).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		logModeration(db, "", serverID, userIDStr, "permission_overwrite_set", "", "", gin.H{
+			"targetType":  targetType,
+			"targetId":    targetID,
+			"subjectType": req.SubjectType,
+			"subjectId":   req.SubjectID,
+			"allow":       req.Allow,
+			"deny":        req.Deny,
+		})
+		c.JSON(http.StatusOK, gin.H{"overwrite": overwrite})
+	}
+}
+
+// DeletePermissionOverwrite удаляет переопределение прав (manage_roles)
+func DeletePermissionOverwrite(db *gorm.DB, targetType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serverID := c.Param("id")
+		targetID := c.Param(targetType + "Id")
+		overwriteID := c.Param("overwriteId")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if !authz.Can(userIDStr, authz.Server(serverID), authz.ManageRoles) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient_permissions"})
+			return
+		}
+
+		db.Where("id = ? AND server_id = ? AND target_type = ? AND target_id = ?", overwriteID, serverID, targetType, targetID).
+			Delete(&models.PermissionOverwrite{})
+		logModeration(db, "", serverID, userIDStr, "permission_overwrite_delete", "", "", gin.H{"targetType": targetType, "targetId": targetID})
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// GetMyPermissions итоговые права текущего пользователя в чате или на сервере
+func GetMyPermissions(scopeType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopeID := c.Param("id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		scope := authz.Scope{Type: scopeType, ID: scopeID}
+		if !authz.IsMember(userIDStr, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		perms := authz.Permissions(userIDStr, scope)
+		c.JSON(http.StatusOK, gin.H{
+			"permissions": int64(perms),
+			"names":       perms.Names(),
+			"rank":        authz.Rank(userIDStr, scope),
+		})
+	}
+}
@@ -25,6 +25,11 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, wsHub *websocket.Hub, cfg *con
 	// Safety AI на базе Gemini, gemini-1.5-flash
 	api.POST("/safety/ask", AskGemini)
 
+	// Гостевой вход во встречи по ссылке
+	api.GET("/meetings/guest/:code", AuthRateLimitMiddleware(), GetMeetingPreview(db))
+	api.POST("/meetings/guest/:code", AuthRateLimitMiddleware(), RequestGuestJoin(db, wsHub))
+	api.GET("/meetings/guest/:code/lobby/:entryId", GetGuestLobbyStatus(db, cfg))
+
 	// Защищенные маршруты (требуют аутентификации)
 	protected := api.Group("")
 	protected.Use(authMiddleware(cfg))
@@ -42,10 +47,22 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, wsHub *websocket.Hub, cfg *con
 	protected.POST("/users/me", UpdateUser(db))
 	protected.POST("/users/me/avatar", UploadAvatar(db))
 	protected.POST("/users/me/status", UpdateUserStatus(db))
+	protected.GET("/presence", GetPresence(db)) // Присутствие видимых пользователей
 	protected.GET("/users/me/notifications", GetUserNotifications(db))
 	protected.POST("/users/me/notifications", UpdateUserNotifications(db))
+	protected.PATCH("/users/me/notifications", UpdateUserNotifications(db))
+	protected.GET("/users/me/notifications/preferences", GetNotificationPreferences(db)) // Настройки по чатам и серверам
+
+	// Уведомления чатов и серверов: отключение звука, только упоминания, ключевые слова, звук
+	protected.GET("/chats/:id/notifications", GetScopeNotifications(db, "chat"))
+	protected.PUT("/chats/:id/notifications", UpdateScopeNotifications(db, "chat"))
+	protected.DELETE("/chats/:id/notifications", ResetScopeNotifications(db, "chat"))
+	protected.GET("/servers/:id/notifications", GetScopeNotifications(db, "server"))
+	protected.PUT("/servers/:id/notifications", UpdateScopeNotifications(db, "server"))
+	protected.DELETE("/servers/:id/notifications", ResetScopeNotifications(db, "server"))
 	protected.GET("/users/me/privacy", GetUserPrivacy(db))
 	protected.POST("/users/me/privacy", UpdateUserPrivacy(db))
+	protected.PATCH("/users/me/privacy", UpdateUserPrivacy(db))
 	protected.POST("/users/me/password", ChangePassword(db))
 	protected.POST("/users/me/2fa/generate", Generate2FA(db))
 	protected.POST("/users/me/2fa/enable", Enable2FA(db))
@@ -58,6 +75,16 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, wsHub *websocket.Hub, cfg *con
 	protected.DELETE("/users/me/sessions/:id", TerminateSession(db))
 	protected.POST("/users/me/sessions/terminate-all", TerminateAllOtherSessions(db))
 
+	// Контакты и блокировки
+	protected.GET("/contacts", GetContacts(db))
+	protected.POST("/contacts", AddContact(db))
+	protected.POST("/contacts/import", ImportContacts(db)) // По именам и SHA-256 от email
+	protected.PATCH("/contacts/:id", UpdateContact(db))
+	protected.DELETE("/contacts/:id", RemoveContact(db))
+	protected.GET("/blocks", GetBlockedUsers(db))
+	protected.POST("/blocks", BlockContact(db))
+	protected.DELETE("/blocks/:id", UnblockContact(db))
+
 	// Статистика
 	protected.GET("/chats/:id/statistics", GetChatStatistics(db))
 
@@ -82,22 +109,36 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, wsHub *websocket.Hub, cfg *con
 	protected.GET("/chats", GetChats(db))
 	protected.POST("/chats", CreateChat(db))
 	protected.GET("/chats/:id", GetChat(db))
-	protected.GET("/chats/:id/messages", GetMessages(db))
-	protected.POST("/chats/:id/messages", CreateMessage(db, wsHub)) // Альтернативный маршрут для создания сообщений
-	protected.POST("/chats/:id/read", MarkChatRead(db, wsHub))      // Отметить все сообщения в чате как прочитанные
-	protected.GET("/chats/:id/pinned", GetPinnedMessages(db))       // Получить закрепленные сообщения
-	protected.GET("/chats/:id/export", ExportChat(db))              // Экспорт истории чата
-	protected.DELETE("/chats/:id", DeleteChat(db))                  // Удалить чат
-	protected.POST("/chats/:id/archive", ArchiveChat(db))           // Архивировать чат
-	protected.POST("/chats/:id/unarchive", UnarchiveChat(db))       // Разархивировать чат
+	protected.GET("/chats/:id/messages", GetMessages(db, wsHub))
+	protected.POST("/chats/:id/messages", CreateMessage(db, wsHub))   // Альтернативный маршрут для создания сообщений
+	protected.POST("/chats/:id/read", MarkChatRead(db, wsHub))        // Отметить все сообщения в чате как прочитанные
+	protected.GET("/chats/:id/pinned", GetPinnedMessages(db))         // Получить закрепленные сообщения
+	protected.GET("/chats/:id/export", ExportChat(db))                // Экспорт истории чата
+	protected.GET("/chats/:id/permissions", GetMyPermissions("chat")) // Итоговые права в чате
+	protected.DELETE("/chats/:id", DeleteChat(db))                    // Удалить чат
+	protected.POST("/chats/:id/archive", ArchiveChat(db))             // Архивировать чат
+	protected.POST("/chats/:id/unarchive", UnarchiveChat(db))         // Разархивировать чат
+	protected.POST("/chats/:id/pin", PinChat(db, wsHub))              // Закрепить чат в списке
+	protected.DELETE("/chats/:id/pin", UnpinChat(db, wsHub))          // Открепить чат
+	protected.PUT("/users/me/pinned-chats", ReorderPinnedChats(db, wsHub))
 	protected.POST("/chats/:id/attach", UploadAttachment(db, wsHub))
 	protected.GET("/chats/:id/attachments", GetAttachments(db)) // Получение медиа файлов
 
+	// Папки чатов
+	protected.GET("/chat-folders", GetChatFolders(db))
+	protected.POST("/chat-folders", CreateChatFolder(db, wsHub))
+	protected.PUT("/chat-folders/order", ReorderChatFolders(db, wsHub))
+	protected.PATCH("/chat-folders/:id", UpdateChatFolder(db, wsHub))
+	protected.DELETE("/chat-folders/:id", DeleteChatFolder(db, wsHub))
+
 	// Сообщения
 	protected.POST("/messages", CreateMessage(db, wsHub))
 	protected.POST("/messages/:id/react", AddReaction(db, wsHub))
+	protected.DELETE("/messages/:id/react", RemoveReaction(db, wsHub))
+	protected.GET("/messages/:id/reactions", GetMessageReactions(db))
 	protected.POST("/messages/:id/edit", EditMessage(db, wsHub))
 	protected.POST("/messages/:id/delete", DeleteMessage(db, wsHub))
+	protected.GET("/messages/:id/revisions", GetMessageRevisions(db))
 	protected.POST("/messages/:id/location", AddLocation(db, wsHub))
 	protected.POST("/messages/:id/read", MarkMessageRead(db, wsHub))
 	protected.GET("/messages/:id/read", GetMessageReadReceipts(db))
@@ -107,18 +148,35 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, wsHub *websocket.Hub, cfg *con
 	protected.POST("/messages/:id/save", SaveMessage(db))                   // Сохранить сообщение в избранное
 	protected.POST("/messages/:id/unsave", UnsaveMessage(db))               // Удалить сообщение из избранного
 	protected.GET("/messages/saved", GetSavedMessages(db))                  // Получить сохраненные сообщения
+	protected.GET("/mentions", GetMentions(db))                             // Входящие упоминания по всем чатам
 	protected.POST("/messages/:id/poll", CreatePoll(db, wsHub))             // Создать опрос в сообщении
 	protected.POST("/polls/:id/vote", VotePoll(db, wsHub))                  // Проголосовать в опросе (по pollId)
 	protected.POST("/messages/:id/poll/vote", VotePollByMessage(db, wsHub)) // Проголосовать в опросе (по messageId)
 	protected.GET("/polls/:id", GetPoll(db))                                // Получить информацию об опросе
+	protected.DELETE("/polls/:id/vote", RetractPollVote(db, wsHub))         // Отозвать голос
+	protected.POST("/polls/:id/close", ClosePoll(db, wsHub))                // Закрыть опрос досрочно
+	protected.POST("/polls/:id/options", AddPollOption(db, wsHub))          // Добавить вариант
 	protected.GET("/search", UniversalSearch(db))                           // Универсальный поиск
 	protected.GET("/messages/search", SearchMessages(db))                   // Поиск сообщений (старый endpoint)
 
 	// Истории (Stories)
-	protected.POST("/stories", CreateStory(db))        // Создать историю
-	protected.GET("/stories", GetStories(db))          // Получить активные истории
-	protected.POST("/stories/:id/view", ViewStory(db)) // Отметить историю как просмотренную
-	protected.DELETE("/stories/:id", DeleteStory(db))  // Удалить историю
+	protected.POST("/stories", CreateStory(db))            // Создать историю
+	protected.POST("/stories/media", UploadStoryMedia(db)) // Загрузить фото/видео истории
+	protected.GET("/stories", GetStories(db))              // Получить активные истории
+	protected.POST("/stories/:id/view", ViewStory(db))     // Отметить историю как просмотренную
+	protected.DELETE("/stories/:id", DeleteStory(db))      // Удалить историю
+	protected.GET("/stories/close-friends", GetStoryAudienceList(db, "closeFriends"))
+	protected.PUT("/stories/close-friends", SetStoryAudienceList(db, "closeFriends"))
+	protected.GET("/stories/hidden", GetStoryAudienceList(db, "hidden"))
+	protected.PUT("/stories/hidden", SetStoryAudienceList(db, "hidden"))
+	protected.GET("/stories/:id/views", GetStoryViews(db))                // Просмотры (только автор)
+	protected.POST("/stories/:id/react", ReactToStory(db, wsHub))         // Реакция на историю
+	protected.DELETE("/stories/:id/react", RemoveStoryReaction(db))       // Снять реакцию
+	protected.POST("/stories/:id/reply", ReplyToStory(db, wsHub))         // Ответ личным сообщением
+	protected.POST("/stories/highlights", CreateStoryHighlight(db))       // Создать альбом
+	protected.PATCH("/stories/highlights/:id", UpdateStoryHighlight(db))  // Изменить альбом
+	protected.DELETE("/stories/highlights/:id", DeleteStoryHighlight(db)) // Удалить альбом
+	protected.GET("/users/:id/highlights", GetUserHighlights(db))         // Альбомы пользователя
 
 	// Push уведомления
 	router.GET("/api/push/vapid_public", GetVAPIDPublicKey()) // Публичный VAPID ключ (без авторизации)
@@ -127,22 +185,62 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, wsHub *websocket.Hub, cfg *con
 	protected.POST("/push/test", TestPush(db))                // Тестовое push-уведомление (полный путь: /api/push/test)
 
 	// Звонки
-	protected.POST("/calls", CreateCall(db))                     // Создать запись о звонке
-	protected.GET("/calls", GetCallHistory(db))                  // Получить историю звонков
-	protected.GET("/calls/missed", GetMissedCalls(db))           // Получить пропущенные звонки
-	protected.POST("/calls/:id/read", MarkCallAsRead(db))        // Отметить звонок как прочитанный
-	protected.POST("/calls/recordings", UploadCallRecording(db)) // Загрузить запись звонка
-	protected.POST("/calls/group", CreateGroupCall(db))          // Создать запись о групповом звонке
-	protected.GET("/calls/group", GetGroupCallHistory(db))       // Получить историю групповых звонков
+	protected.POST("/calls", CreateCall(db))                            // Создать запись о звонке
+	protected.GET("/calls", GetCallHistory(db))                         // Получить историю звонков
+	protected.GET("/calls/missed", GetMissedCalls(db))                  // Получить пропущенные звонки
+	protected.GET("/calls/active", GetActiveCalls(db))                  // Активные звонки (ringing/answered)
+	protected.POST("/calls/:id/read", MarkCallAsRead(db))               // Отметить звонок как прочитанный
+	protected.POST("/calls/recordings", UploadCallRecording(db, wsHub)) // Загрузить файл клиентской записи
+	protected.POST("/calls/group", CreateGroupCall(db))                 // Создать запись о групповом звонке
+	protected.GET("/calls/group", GetGroupCallHistory(db))              // Получить историю групповых звонков
+
+	// Запланированные встречи
+	protected.POST("/meetings", CreateMeeting(db, wsHub, cfg))                                // Запланировать встречу
+	protected.GET("/meetings", GetMeetings(db, cfg))                                          // Встречи пользователя (?chatId=, ?past=true)
+	protected.POST("/meetings/join/:code", JoinMeeting(db, wsHub))                            // Войти по ссылке (или встать в лобби)
+	protected.GET("/meetings/:id", GetMeeting(db, cfg))                                       // Встреча с историей звонка
+	protected.PATCH("/meetings/:id", UpdateMeeting(db, wsHub, cfg))                           // Изменить встречу
+	protected.DELETE("/meetings/:id", CancelMeeting(db, wsHub, cfg))                          // Отменить встречу
+	protected.POST("/meetings/:id/respond", RespondMeeting(db, wsHub))                        // Ответ на приглашение
+	protected.GET("/meetings/:id/ics", GetMeetingICS(db, cfg))                                // Файл для календаря
+	protected.POST("/meetings/:id/start", StartMeeting(db, wsHub, cfg))                       // Начать встречу
+	protected.POST("/meetings/:id/end", EndMeeting(db, wsHub))                                // Завершить встречу
+	protected.GET("/meetings/:id/lobby", GetMeetingLobby(db))                                 // Очередь лобби
+	protected.POST("/meetings/:id/lobby/:entryId/admit", DecideMeetingLobby(db, wsHub, true)) // Допустить
+	protected.POST("/meetings/:id/lobby/:entryId/deny", DecideMeetingLobby(db, wsHub, false)) // Отклонить
+
+	// Записи звонков (с согласия участников) и расшифровки
+	protected.POST("/recordings", StartCallRecording(db, wsHub))                  // Запросить запись звонка
+	protected.GET("/recordings", GetCallRecordings(db))                           // Записи звонка (?callId=) или чата (?chatId=)
+	protected.GET("/recordings/search", SearchCallRecordings(db))                 // Поиск по расшифровкам
+	protected.GET("/recordings/:id", GetCallRecording(db))                        // Запись с расшифровкой
+	protected.GET("/recordings/:id/file", GetRecordingFile(db))                   // Файл записи (только участникам)
+	protected.POST("/recordings/:id/consent", RespondRecordingConsent(db, wsHub)) // Согласие/отказ участника
+	protected.POST("/recordings/:id/stop", StopCallRecording(db, wsHub))          // Остановить запись
+	protected.GET("/chats/:id/recording-policy", GetRecordingPolicy(db))          // Политика записей чата
+	protected.PUT("/chats/:id/recording-policy", UpdateRecordingPolicy(db))       // Изменить политику записей
+	protected.PUT("/chats/:id/link-previews", UpdateChatLinkPreviews(db))         // Включить/отключить превью ссылок в чате
+	protected.PUT("/chats/:id/message-policy", UpdateChatMessagePolicy(db))       // Окна редактирования и удаления
+	protected.GET("/chats/:id/tombstones", GetChatTombstones(db))                 // Удаленные сообщения для офлайн-синхронизации
+	protected.GET("/chats/:id/reactions", GetChatReactionSettings(db))            // Режим и лимит реакций
+	protected.PUT("/chats/:id/reactions", UpdateChatReactionSettings(db))
+	protected.GET("/chats/:id/emoji", GetCustomEmoji(db, "chat")) // Пользовательские эмодзи группы
+	protected.POST("/chats/:id/emoji", UploadCustomEmoji(db, "chat"))
+	protected.DELETE("/emoji/:id", DeleteCustomEmoji(db))
 
 	// Стикеры
 	protected.GET("/sticker-packs", GetStickerPacks(db))
 	protected.GET("/sticker-packs/:packId/stickers", GetStickers(db))
 
 	// Треды
-	protected.POST("/chats/:id/threads", CreateThread(db))
+	protected.POST("/chats/:id/threads", CreateThread(db, wsHub))
 	protected.GET("/chats/:id/threads", GetThreads(db))
 	protected.GET("/threads/:id/messages", GetThreadMessages(db))
+	protected.PATCH("/threads/:id", UpdateThread(db, wsHub))           // Название, архив и блокировка
+	protected.POST("/threads/:id/follow", FollowThread(db, wsHub))     // Подписаться на ответы
+	protected.DELETE("/threads/:id/follow", UnfollowThread(db, wsHub)) // Отписаться
+	protected.POST("/threads/:id/read", MarkThreadRead(db, wsHub))     // Прочитать тред целиком
+	protected.GET("/users/me/threads", GetFollowedThreads(db))         // Входящие треды
 
 	// Серверы
 	protected.POST("/servers", CreateServer(db))
@@ -162,7 +260,35 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, wsHub *websocket.Hub, cfg *con
 	protected.POST("/servers/:id/leave", LeaveServer(db))
 	protected.POST("/servers/:id/invite-link", GenerateServerInviteLink(db))
 	protected.POST("/servers/join/:link", JoinByServerInviteLink(db))
+	protected.GET("/servers/:id/invites", GetInvites(db, "server"))
+	protected.POST("/servers/:id/invites", CreateInvite(db, "server"))
+	protected.DELETE("/servers/:id/invites/:inviteId", RevokeInvite(db, "server"))
+	protected.GET("/servers/:id/invites/:inviteId/stats", GetInviteStats(db, "server"))
+	protected.GET("/servers/:id/join-requests", GetJoinRequests(db, "server"))
+	protected.POST("/servers/:id/join-requests/:requestId/approve", ReviewJoinRequest(db, "server", "approved"))
+	protected.POST("/servers/:id/join-requests/:requestId/reject", ReviewJoinRequest(db, "server", "rejected"))
 	protected.GET("/servers/:id/history", GetServerMemberHistory(db))
+	protected.GET("/servers/:id/bans", GetServerBans(db))
+	protected.POST("/servers/:id/bans", BanServerMember(db))
+	protected.DELETE("/servers/:id/bans/:userId", UnbanServerMember(db))
+	protected.POST("/servers/:id/timeouts", TimeoutServerMember(db))
+	protected.DELETE("/servers/:id/timeouts/:userId", RemoveServerTimeout(db))
+	protected.GET("/servers/:id/moderation/logs", GetServerModerationLogs(db))
+	protected.GET("/servers/:id/permissions", GetMyPermissions("server"))
+	protected.GET("/servers/:id/emoji", GetCustomEmoji(db, "server"))
+	protected.POST("/servers/:id/emoji", UploadCustomEmoji(db, "server"))
+	protected.GET("/servers/:id/roles", GetRoles(db, "server"))
+	protected.POST("/servers/:id/roles", CreateRole(db, "server"))
+	protected.PATCH("/servers/:id/roles/:roleId", UpdateRole(db, "server"))
+	protected.DELETE("/servers/:id/roles/:roleId", DeleteRole(db, "server"))
+	protected.PUT("/servers/:id/members/:userId/roles/:roleId", AssignRole(db, "server"))
+	protected.DELETE("/servers/:id/members/:userId/roles/:roleId", RevokeRole(db, "server"))
+	protected.GET("/servers/:id/channels/:channelId/permissions", GetPermissionOverwrites(db, "channel"))
+	protected.PUT("/servers/:id/channels/:channelId/permissions", SetPermissionOverwrite(db, "channel"))
+	protected.DELETE("/servers/:id/channels/:channelId/permissions/:overwriteId", DeletePermissionOverwrite(db, "channel"))
+	protected.GET("/servers/:id/categories/:categoryId/permissions", GetPermissionOverwrites(db, "category"))
+	protected.PUT("/servers/:id/categories/:categoryId/permissions", SetPermissionOverwrite(db, "category"))
+	protected.DELETE("/servers/:id/categories/:categoryId/permissions/:overwriteId", DeletePermissionOverwrite(db, "category"))
 	protected.GET("/servers/:id", GetServer(db))
 
 	// Группы
@@ -176,6 +302,12 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, wsHub *websocket.Hub, cfg *con
 	protected.PATCH("/groups/:id", UpdateGroup(db))
 	protected.GET("/groups/:id/history", GetGroupMemberHistory(db))
 	protected.GET("/groups/:id/stats", GetGroupStats(db))
+	protected.GET("/groups/:id/roles", GetRoles(db, "chat"))
+	protected.POST("/groups/:id/roles", CreateRole(db, "chat"))
+	protected.PATCH("/groups/:id/roles/:roleId", UpdateRole(db, "chat"))
+	protected.DELETE("/groups/:id/roles/:roleId", DeleteRole(db, "chat"))
+	protected.PUT("/groups/:id/members/:userId/roles/:roleId", AssignRole(db, "chat"))
+	protected.DELETE("/groups/:id/members/:userId/roles/:roleId", RevokeRole(db, "chat"))
 
 	// Модерация чатов (группы/каналы)
 	protected.GET("/chats/:id/moderation/settings", GetChatModerationSettings(db))
@@ -184,6 +316,16 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, wsHub *websocket.Hub, cfg *con
 	protected.GET("/chats/:id/moderation/logs", GetModerationLogs(db))
 	protected.POST("/chats/:id/moderation/ban", BanUser(db))
 	protected.POST("/chats/:id/moderation/unban", UnbanUser(db))
+	protected.POST("/chats/:id/moderation/warn", WarnUser(db))
+	protected.GET("/chats/:id/moderation/warnings", GetChatWarnings(db))
+	protected.POST("/chats/:id/moderation/mute", MuteUser(db))
+	protected.POST("/chats/:id/moderation/unmute", UnmuteUser(db))
+	protected.GET("/chats/:id/moderation/rules", GetModerationRules(db))
+	protected.POST("/chats/:id/moderation/rules", CreateModerationRule(db))
+	protected.POST("/chats/:id/moderation/rules/test", TestModerationRules(db))
+	protected.PATCH("/chats/:id/moderation/rules/:ruleId", UpdateModerationRule(db))
+	protected.DELETE("/chats/:id/moderation/rules/:ruleId", DeleteModerationRule(db))
+	protected.GET("/chats/:id/moderation/dry-run", GetAutomodDryRunLog(db))
 	protected.POST("/messages/:id/moderation/approve", ApproveMessage(db, wsHub))
 	protected.POST("/messages/:id/moderation/reject", RejectMessage(db))
 
@@ -195,6 +337,14 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, wsHub *websocket.Hub, cfg *con
 	// Приглашения по ссылке
 	protected.POST("/chats/:id/invite-link", GenerateInviteLink(db))
 	protected.POST("/chats/join/:link", JoinByInviteLink(db))
+	protected.GET("/chats/:id/invites", GetInvites(db, "chat"))
+	protected.POST("/chats/:id/invites", CreateInvite(db, "chat"))
+	protected.DELETE("/chats/:id/invites/:inviteId", RevokeInvite(db, "chat"))
+	protected.GET("/chats/:id/invites/:inviteId/stats", GetInviteStats(db, "chat"))
+	protected.GET("/chats/:id/join-requests", GetJoinRequests(db, "chat"))
+	protected.POST("/chats/:id/join-requests/:requestId/approve", ReviewJoinRequest(db, "chat", "approved"))
+	protected.POST("/chats/:id/join-requests/:requestId/reject", ReviewJoinRequest(db, "chat", "rejected"))
+	protected.GET("/invites/:code", GetInvitePreview(db))
 
 	// Групповое E2EE
 	protected.GET("/chats/:id/group-key", GetGroupKey(db))
@@ -202,6 +352,13 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, wsHub *websocket.Hub, cfg *con
 	protected.POST("/chats/:id/group-key/update", UpdateGroupKey(db))
 	protected.GET("/chats/:id/group-key/version", GetGroupKeyVersion(db))
 
+	// Жалобы, апелляции и обратная связь
+	protected.POST("/reports", CreateReport(db))
+	protected.GET("/reports/mine", GetMyReports(db))
+	protected.POST("/appeals", CreateAppeal(db))
+	protected.GET("/appeals/mine", GetMyAppeals(db))
+	protected.POST("/feedback", CreateFeedback(db))
+
 	// Админ панель
 	protected.GET("/admin/users", RequireAdmin(db), GetAdminUsers(db))
 	protected.POST("/admin/users/:id/block", RequireAdmin(db), BlockUser(db))
@@ -211,8 +368,13 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, wsHub *websocket.Hub, cfg *con
 	protected.GET("/admin/stats", RequireAdmin(db), GetAdminStats(db))
 	protected.GET("/admin/feedback", RequireAdmin(db), GetAdminFeedback(db))
 	protected.GET("/admin/reports", RequireAdmin(db), GetAdminReports(db))
+	protected.GET("/admin/reports/:id", RequireAdmin(db), GetAdminReport(db))
+	protected.POST("/admin/reports/:id/assign", RequireAdmin(db), AssignReport(db))
+	protected.POST("/admin/reports/:id/resolve", RequireAdmin(db), ResolveReport(db, wsHub))
+	protected.GET("/admin/appeals", RequireAdmin(db), GetAdminAppeals(db))
+	protected.POST("/admin/appeals/:id/review", RequireAdmin(db), ReviewAppeal(db))
 	protected.GET("/admin/modqueue", RequireAdmin(db), GetAdminModQueue(db))
-	protected.POST("/admin/approve/:id", RequireAdmin(db), ApproveModItem(db))
+	protected.POST("/admin/approve/:id", RequireAdmin(db), ApproveModItem(db, wsHub))
 
 	// Панель владельца (только для owner)
 	protected.GET("/owner/dashboard", RequireOwner(db), GetOwnerDashboard(db))
@@ -228,7 +390,7 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, wsHub *websocket.Hub, cfg *con
 	protected.POST("/premium/subscribe/:id", RequireOwner(db), SubscribePremium(db)) // Активировать премиум (только владелец)
 
 	// Управление сервисами (для admin и owner)
-	protected.GET("/admin/services", RequireAdmin(db), GetServicesStatus(db))
+	protected.GET("/admin/services", RequireAdmin(db), GetServicesStatus(db, cfg))
 	protected.POST("/admin/services/:id/start", RequireAdmin(db), StartService(db))
 	protected.POST("/admin/services/:id/stop", RequireAdmin(db), StopService(db))
 	protected.POST("/admin/services/:id/restart", RequireAdmin(db), RestartService(db))
@@ -249,12 +411,27 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, wsHub *websocket.Hub, cfg *con
 	protected.GET("/admin/logs", RequireAdmin(db), GetLogs)
 
 	// WebRTC
-	protected.GET("/rtc/ice", GetICEServers())
+	protected.GET("/rtc/ice", GetICEServers(db, cfg))
+	protected.GET("/sfu/rooms/:roomId/participants", GetSFUParticipants(db)) // Участники комнаты SFU
+	protected.POST("/sfu/rooms/:roomId/mute", MuteSFUParticipant(db))        // Серверный mute участника
+	protected.POST("/sfu/rooms/:roomId/kick", KickSFUParticipant(db))        // Отключить участника
 
 	// Голосовые комнаты
-	protected.POST("/chats/:id/voice-room", CreateVoiceRoom(db))
+	protected.POST("/chats/:id/voice-room", CreateVoiceRoom(db, wsHub))
 	protected.GET("/chats/:id/voice-room", GetVoiceRoom(db))
-	protected.POST("/voice-rooms/:roomId/end", EndVoiceRoom(db))
+	protected.GET("/chats/:id/voice-rooms/scheduled", GetScheduledVoiceRooms(db))
+	protected.PATCH("/voice-rooms/:roomId", UpdateVoiceRoom(db, wsHub))
+	protected.POST("/voice-rooms/:roomId/start", StartVoiceRoom(db, wsHub))
+	protected.POST("/voice-rooms/:roomId/end", EndVoiceRoom(db, wsHub))
+	protected.POST("/voice-rooms/:roomId/hand", RaiseHand(db, wsHub))
+	protected.DELETE("/voice-rooms/:roomId/hand", LowerHand(db, wsHub))
+	protected.POST("/voice-rooms/:roomId/speakers/invite", InviteToSpeak(db, wsHub))
+	protected.POST("/voice-rooms/:roomId/speakers/accept", RespondSpeakerInvite(db, wsHub, true))
+	protected.POST("/voice-rooms/:roomId/speakers/decline", RespondSpeakerInvite(db, wsHub, false))
+	protected.POST("/voice-rooms/:roomId/role", SetVoiceRoomMemberRole(db, wsHub))
+	protected.POST("/voice-rooms/:roomId/mute", MuteVoiceRoomMember(db, wsHub))
+	protected.POST("/voice-rooms/:roomId/subscribe", SubscribeVoiceRoom(db, true))
+	protected.DELETE("/voice-rooms/:roomId/subscribe", SubscribeVoiceRoom(db, false))
 
 	// Статические файлы (загрузки) - должно быть до protected, чтобы не требовалась аутентификация
 	router.Static("/uploads", "./uploads")
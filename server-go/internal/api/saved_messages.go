@@ -92,6 +92,11 @@ func GetSavedMessages(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		senderIDs := make([]string, len(savedMessages))
+		for i, saved := range savedMessages {
+			senderIDs[i] = saved.Message.SenderID
+		}
+		senders := newPrivacyView(db, userIDStr, senderIDs)
 		result := make([]gin.H, len(savedMessages))
 		for i, saved := range savedMessages {
 			msgData := gin.H{
@@ -114,7 +119,7 @@ func GetSavedMessages(db *gorm.DB) gin.HandlerFunc {
 					msgData["sender"] = gin.H{
 						"id":       saved.Message.Sender.ID,
 						"username": saved.Message.Sender.Username,
-						"avatarUrl": saved.Message.Sender.AvatarURL,
+						"avatarUrl": senders.avatar(saved.Message.Sender),
 					}
 				}
 
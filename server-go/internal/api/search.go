@@ -49,6 +49,7 @@ func UniversalSearch(db *gorm.DB) gin.HandlerFunc {
 					Find(&messages)
 			}
 
+			senders := senderPrivacyView(db, userIDStr, messages)
 			messagesData := make([]gin.H, len(messages))
 			for i, msg := range messages {
 				messagesData[i] = gin.H{
@@ -62,7 +63,7 @@ func UniversalSearch(db *gorm.DB) gin.HandlerFunc {
 					messagesData[i]["sender"] = gin.H{
 						"id":       msg.Sender.ID,
 						"username": msg.Sender.Username,
-						"avatarUrl": msg.Sender.AvatarURL,
+						"avatarUrl": senders.avatar(msg.Sender),
 					}
 				}
 				if msg.Chat.ID != "" {
@@ -112,18 +113,13 @@ func UniversalSearch(db *gorm.DB) gin.HandlerFunc {
 			var users []models.User
 			db.Where("LOWER(username) LIKE ?", "%"+queryLower+"%").
 				Where("id != ?", userIDStr).
+				Where("id NOT IN (?)", db.Model(&models.UserBlock{}).Select("blocker_id").Where("blocked_id = ?", userIDStr)).
 				Limit(20).
 				Find(&users)
 
-			usersData := make([]gin.H, len(users))
+			usersData := publicUsers(db, userIDStr, users)
 			for i, user := range users {
-				usersData[i] = gin.H{
-					"id":        user.ID,
-					"username":  user.Username,
-					"avatarUrl": user.AvatarURL,
-					"status":    user.Status,
-					"plan":      user.Plan,
-				}
+				usersData[i]["plan"] = user.Plan
 			}
 			result["users"] = usersData
 		}
@@ -183,8 +179,7 @@ func SearchMessages(db *gorm.DB) gin.HandlerFunc {
 			Order("created_at DESC").
 			Limit(50).
 			Find(&messages)
-
-		c.JSON(http.StatusOK, gin.H{"messages": messages})
+		c.JSON(http.StatusOK, gin.H{"messages": messageViews(db, userIDStr, messages)})
 	}
 }
 
@@ -6,10 +6,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"safegram-server/internal/authz"
 	"safegram-server/internal/models"
 )
 
-// CreateChannelCategory создает категорию каналов (owner/admin)
+// CreateChannelCategory создает категорию каналов (manage_channels)
 func CreateChannelCategory(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		serverID := c.Param("id")
@@ -20,12 +21,7 @@ func CreateChannelCategory(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var member models.ServerMember
-		if err := db.Where("server_id = ? AND user_id = ?", serverID, userIDStr).First(&member).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
-		}
-		if member.Role != "owner" && member.Role != "admin" {
+		if !authz.Can(userIDStr, authz.Server(serverID), authz.ManageChannels) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
@@ -77,7 +73,7 @@ func GetChannelCategories(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// DeleteChannelCategory удаляет категорию (owner/admin)
+// DeleteChannelCategory удаляет категорию (manage_channels)
 func DeleteChannelCategory(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		serverID := c.Param("id")
@@ -89,12 +85,7 @@ func DeleteChannelCategory(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var member models.ServerMember
-		if err := db.Where("server_id = ? AND user_id = ?", serverID, userIDStr).First(&member).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
-		}
-		if member.Role != "owner" && member.Role != "admin" {
+		if !authz.Can(userIDStr, authz.Server(serverID), authz.ManageChannels) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
@@ -107,7 +98,7 @@ func DeleteChannelCategory(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// SetChannelCategory назначает канал в категорию (owner/admin)
+// SetChannelCategory назначает канал в категорию (manage_channels)
 func SetChannelCategory(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		serverID := c.Param("id")
@@ -119,12 +110,7 @@ func SetChannelCategory(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var member models.ServerMember
-		if err := db.Where("server_id = ? AND user_id = ?", serverID, userIDStr).First(&member).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
-		}
-		if member.Role != "owner" && member.Role != "admin" {
+		if !authz.Can(userIDStr, authz.Server(serverID), authz.ManageChannels) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
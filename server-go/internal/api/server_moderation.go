@@ -0,0 +1,299 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"safegram-server/internal/authz"
+	"safegram-server/internal/models"
+)
+
+// serverIDForChat возвращает ID сервера, если чат — канал сервера
+func serverIDForChat(db *gorm.DB, chatID string) string {
+	var ch models.Channel
+	if err := db.Select("server_id").Where("chat_id = ?", chatID).First(&ch).Error; err != nil {
+		return ""
+	}
+	return ch.ServerID
+}
+
+// activeServerBan активный бан пользователя на сервере
+func activeServerBan(db *gorm.DB, serverID, userID string) (*models.ServerBan, bool) {
+	var ban models.ServerBan
+	if err := db.Where("server_id = ? AND user_id = ? AND (expires_at IS NULL OR expires_at > ?)", serverID, userID, time.Now()).
+		First(&ban).Error; err != nil {
+		return nil, false
+	}
+	return &ban, true
+}
+
+// activeServerTimeout активный таймаут пользователя на сервере
+func activeServerTimeout(db *gorm.DB, serverID, userID string) (*models.ServerTimeout, bool) {
+	var timeout models.ServerTimeout
+	if err := db.Where("server_id = ? AND user_id = ? AND expires_at > ?", serverID, userID, time.Now()).
+		First(&timeout).Error; err != nil {
+		return nil, false
+	}
+	return &timeout, true
+}
+
+// serverRestriction проверяет бан/таймаут на сервере, к которому относится чат.
+// Возвращает код ошибки ("server_banned" | "timed_out") и время окончания.
+func serverRestriction(db *gorm.DB, chatID, userID string) (string, *time.Time, bool) {
+	serverID := serverIDForChat(db, chatID)
+	if serverID == "" {
+		return "", nil, false
+	}
+	if ban, ok := activeServerBan(db, serverID, userID); ok {
+		return "server_banned", ban.ExpiresAt, true
+	}
+	if timeout, ok := activeServerTimeout(db, serverID, userID); ok {
+		return "timed_out", &timeout.ExpiresAt, true
+	}
+	return "", nil, false
+}
+
+// removeFromServer удаляет участника из сервера и из чатов всех его каналов
+func removeFromServer(db *gorm.DB, serverID, userID string) {
+	db.Where("server_id = ? AND user_id = ?", serverID, userID).Delete(&models.ServerMember{})
+	db.Where("user_id = ? AND chat_id IN (?)", userID,
+		db.Model(&models.Channel{}).Select("chat_id").Where("server_id = ? AND chat_id != ''", serverID)).
+		Delete(&models.ChatMember{})
+}
+
+// BanServerMember бан на сервере (ban_members); minutes = 0 — бессрочно
+func BanServerMember(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serverID := c.Param("id")
+		userID, _ := c.Get("userID")
+		actorID, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if !authz.Can(actorID, authz.Server(serverID), authz.BanMembers) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var req struct {
+			UserID  string `json:"userId" binding:"required"`
+			Minutes int    `json:"minutes"`
+			Reason  string `json:"reason"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+		if req.UserID == actorID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cannot_ban_self"})
+			return
+		}
+
+		if authz.IsMember(req.UserID, authz.Server(serverID)) && !authz.Outranks(actorID, req.UserID, authz.Server(serverID)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "role_hierarchy"})
+			return
+		}
+
+		var exp *time.Time
+		if req.Minutes > 0 {
+			t := time.Now().Add(time.Duration(req.Minutes) * time.Minute)
+			exp = &t
+		}
+
+		// Повторный бан заменяет предыдущий
+		db.Where("server_id = ? AND user_id = ?", serverID, req.UserID).Delete(&models.ServerBan{})
+		ban := models.ServerBan{
+			ID:        uuid.New().String(),
+			ServerID:  serverID,
+			UserID:    req.UserID,
+			ActorID:   actorID,
+			Reason:    req.Reason,
+			ExpiresAt: exp,
+		}
+		if err := db.Create(&ban).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		removeFromServer(db, serverID, req.UserID)
+
+		logMemberEvent(db, "server", serverID, req.UserID, actorID, "ban", gin.H{"expiresAt": exp, "reason": req.Reason})
+		logModeration(db, "", serverID, actorID, "server_ban", req.UserID, "", gin.H{"expiresAt": exp, "reason": req.Reason})
+		c.JSON(http.StatusOK, gin.H{"ok": true, "ban": ban})
+	}
+}
+
+// UnbanServerMember снимает бан на сервере (ban_members)
+func UnbanServerMember(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serverID := c.Param("id")
+		targetID := c.Param("userId")
+		userID, _ := c.Get("userID")
+		actorID, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if !authz.Can(actorID, authz.Server(serverID), authz.BanMembers) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		res := db.Where("server_id = ? AND user_id = ?", serverID, targetID).Delete(&models.ServerBan{})
+		if res.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+
+		logMemberEvent(db, "server", serverID, targetID, actorID, "unban", nil)
+		logModeration(db, "", serverID, actorID, "server_unban", targetID, "", nil)
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// GetServerBans активные баны сервера (ban_members)
+func GetServerBans(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serverID := c.Param("id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if !authz.Can(userIDStr, authz.Server(serverID), authz.BanMembers) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var bans []models.ServerBan
+		db.Where("server_id = ? AND (expires_at IS NULL OR expires_at > ?)", serverID, time.Now()).
+			Order("created_at DESC").Limit(500).Find(&bans)
+		c.JSON(http.StatusOK, gin.H{"bans": bans})
+	}
+}
+
+// TimeoutServerMember таймаут на сервере (moderate_members)
+func TimeoutServerMember(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serverID := c.Param("id")
+		userID, _ := c.Get("userID")
+		actorID, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if !authz.Can(actorID, authz.Server(serverID), authz.ModerateMembers) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var req struct {
+			UserID  string `json:"userId" binding:"required"`
+			Minutes int    `json:"minutes"`
+			Reason  string `json:"reason"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		if !authz.IsMember(req.UserID, authz.Server(serverID)) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_member"})
+			return
+		}
+		if !authz.Outranks(actorID, req.UserID, authz.Server(serverID)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "role_hierarchy"})
+			return
+		}
+
+		mins := req.Minutes
+		if mins <= 0 {
+			mins = 10
+		}
+		// Таймаут не дольше 28 дней
+		if mins > 28*24*60 {
+			mins = 28 * 24 * 60
+		}
+
+		db.Where("server_id = ? AND user_id = ?", serverID, req.UserID).Delete(&models.ServerTimeout{})
+		timeout := models.ServerTimeout{
+			ID:        uuid.New().String(),
+			ServerID:  serverID,
+			UserID:    req.UserID,
+			ActorID:   actorID,
+			Reason:    req.Reason,
+			ExpiresAt: time.Now().Add(time.Duration(mins) * time.Minute),
+		}
+		if err := db.Create(&timeout).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		logMemberEvent(db, "server", serverID, req.UserID, actorID, "timeout", gin.H{"expiresAt": timeout.ExpiresAt, "reason": req.Reason})
+		logModeration(db, "", serverID, actorID, "server_timeout", req.UserID, "", gin.H{"expiresAt": timeout.ExpiresAt, "reason": req.Reason})
+		c.JSON(http.StatusOK, gin.H{"ok": true, "timeout": timeout})
+	}
+}
+
+// RemoveServerTimeout снимает таймаут (moderate_members)
+func RemoveServerTimeout(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serverID := c.Param("id")
+		targetID := c.Param("userId")
+		userID, _ := c.Get("userID")
+		actorID, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if !authz.Can(actorID, authz.Server(serverID), authz.ModerateMembers) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		db.Where("server_id = ? AND user_id = ?", serverID, targetID).Delete(&models.ServerTimeout{})
+		logMemberEvent(db, "server", serverID, targetID, actorID, "timeout_remove", nil)
+		logModeration(db, "", serverID, actorID, "server_timeout_remove", targetID, "", nil)
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// GetServerModerationLogs лог модерации сервера вместе с логами его каналов (view_audit_log)
+func GetServerModerationLogs(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serverID := c.Param("id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if !authz.Can(userIDStr, authz.Server(serverID), authz.ViewAuditLog) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		query := db.Where("server_id = ? OR chat_id IN (?)", serverID,
+			db.Model(&models.Channel{}).Select("chat_id").Where("server_id = ? AND chat_id != ''", serverID))
+		if action := c.Query("action"); action != "" {
+			query = query.Where("action = ?", action)
+		}
+		if target := c.Query("userId"); target != "" {
+			query = query.Where("target_user_id = ? OR actor_id = ?", target, target)
+		}
+
+		var logs []models.ModerationLog
+		query.Order("created_at DESC").Limit(300).Find(&logs)
+		c.JSON(http.StatusOK, gin.H{"logs": logs})
+	}
+}
@@ -1,8 +1,6 @@
 package api
 
 import (
-	"crypto/rand"
-	"encoding/base64"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -53,11 +51,10 @@ func CreateServer(db *gorm.DB) gin.HandlerFunc {
 		db.Create(&member)
 		logMemberEvent(db, "server", server.ID, userIDStr, userIDStr, "create", gin.H{"name": server.Name})
 
-		// Генерируем invite link для сервера
-		b := make([]byte, 16)
-		_, _ = rand.Read(b)
-		server.InviteLink = base64.URLEncoding.EncodeToString(b)
-		db.Model(&models.Server{}).Where("id = ?", server.ID).Update("invite_link", server.InviteLink)
+		// Ссылка-приглашение по умолчанию
+		if inv, err := createInvite(db, "server", server.ID, userIDStr, "", nil, 0, false); err == nil {
+			server.InviteLink = inv.Code
+		}
 
 		// Создаем чат для канала по умолчанию
 		channelChat := models.Chat{
@@ -6,6 +6,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"safegram-server/internal/authz"
 	"safegram-server/internal/models"
 )
 
@@ -30,6 +31,12 @@ func GetServerMembers(db *gorm.DB) gin.HandlerFunc {
 		var members []models.ServerMember
 		db.Where("server_id = ?", serverID).Preload("User").Find(&members)
 
+		memberIDs := make([]string, len(members))
+		for i, m := range members {
+			memberIDs[i] = m.UserID
+		}
+		view := newPrivacyView(db, userIDStr, memberIDs)
+		view.presence = presenceAmong(memberIDs)
 		result := make([]gin.H, len(members))
 		for i, m := range members {
 			result[i] = gin.H{
@@ -40,8 +47,8 @@ func GetServerMembers(db *gorm.DB) gin.HandlerFunc {
 				"user": gin.H{
 					"id":       m.User.ID,
 					"username": m.User.Username,
-					"avatarUrl": m.User.AvatarURL,
-					"status":   m.User.Status,
+					"avatarUrl": view.avatar(m.User),
+					"status":   view.status(m.User),
 				},
 			}
 		}
@@ -50,6 +57,39 @@ func GetServerMembers(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+// addServerMember добавляет участника на сервер и во все чаты его каналов
+func addServerMember(db *gorm.DB, serverID, userID string) error {
+	member := models.ServerMember{
+		ID:       uuid.New().String(),
+		ServerID: serverID,
+		UserID:   userID,
+		Role:     "member",
+	}
+	if err := db.Create(&member).Error; err != nil {
+		return err
+	}
+
+	var channels []models.Channel
+	db.Where("server_id = ?", serverID).Find(&channels)
+	for _, ch := range channels {
+		if ch.ChatID == "" {
+			continue
+		}
+		// пропускаем если уже есть
+		var cm models.ChatMember
+		if err := db.Where("chat_id = ? AND user_id = ?", ch.ChatID, userID).First(&cm).Error; err == nil {
+			continue
+		}
+		db.Create(&models.ChatMember{
+			ID:     uuid.New().String(),
+			ChatID: ch.ChatID,
+			UserID: userID,
+			Role:   "member",
+		})
+	}
+	return nil
+}
+
 // JoinServer присоединяет пользователя к серверу
 func JoinServer(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -68,32 +108,15 @@ func JoinServer(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		member := models.ServerMember{
-			ID:       uuid.New().String(),
-			ServerID: serverID,
-			UserID:   userIDStr,
-			Role:     "member",
+		// Забаненные на сервере не могут вступить до окончания бана
+		if ban, banned := activeServerBan(db, serverID, userIDStr); banned {
+			c.JSON(http.StatusForbidden, gin.H{"error": "server_banned", "expiresAt": ban.ExpiresAt, "reason": ban.Reason})
+			return
 		}
-		db.Create(&member)
 
-		// Добавляем пользователя во все чаты каналов сервера
-		var channels []models.Channel
-		db.Where("server_id = ?", serverID).Find(&channels)
-		for _, ch := range channels {
-			if ch.ChatID == "" {
-				continue
-			}
-			// пропускаем если уже есть
-			var cm models.ChatMember
-			if err := db.Where("chat_id = ? AND user_id = ?", ch.ChatID, userIDStr).First(&cm).Error; err == nil {
-				continue
-			}
-			db.Create(&models.ChatMember{
-				ID:     uuid.New().String(),
-				ChatID: ch.ChatID,
-				UserID: userIDStr,
-				Role:   "member",
-			})
+		if err := addServerMember(db, serverID, userIDStr); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
 		}
 
 		logMemberEvent(db, "server", serverID, userIDStr, userIDStr, "join", nil)
@@ -142,14 +165,8 @@ func CreateChannel(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Проверяем права (owner или admin)
-		var member models.ServerMember
-		if err := db.Where("server_id = ? AND user_id = ?", serverID, userIDStr).First(&member).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
-		}
-
-		if member.Role != "owner" && member.Role != "admin" {
+		// Проверяем право управлять каналами
+		if !authz.Can(userIDStr, authz.Server(serverID), authz.ManageChannels) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
@@ -254,14 +271,8 @@ func DeleteChannel(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Проверяем права
-		var member models.ServerMember
-		if err := db.Where("server_id = ? AND user_id = ?", serverID, userIDStr).First(&member).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
-		}
-
-		if member.Role != "owner" && member.Role != "admin" {
+		// Проверяем право управлять каналами
+		if !authz.Can(userIDStr, authz.Server(serverID), authz.ManageChannels) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
@@ -6,10 +6,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"safegram-server/internal/authz"
 	"safegram-server/internal/models"
 )
 
-// BulkAddServerMembers массовое добавление участников в сервер (owner/admin)
+// BulkAddServerMembers массовое добавление участников в сервер (invite_members)
 func BulkAddServerMembers(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		serverID := c.Param("id")
@@ -20,12 +21,7 @@ func BulkAddServerMembers(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var member models.ServerMember
-		if err := db.Where("server_id = ? AND user_id = ?", serverID, userIDStr).First(&member).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
-		}
-		if member.Role != "owner" && member.Role != "admin" {
+		if !authz.Can(userIDStr, authz.Server(serverID), authz.InviteMembers) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
@@ -51,6 +47,9 @@ func BulkAddServerMembers(db *gorm.DB) gin.HandlerFunc {
 			if err := db.Where("server_id = ? AND user_id = ?", serverID, uid).First(&existing).Error; err == nil {
 				continue
 			}
+			if _, banned := activeServerBan(db, serverID, uid); banned {
+				continue
+			}
 			sm := models.ServerMember{
 				ID:       uuid.New().String(),
 				ServerID: serverID,
@@ -79,7 +78,7 @@ func BulkAddServerMembers(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// SetServerMemberRole меняет роль участника сервера (owner/admin)
+// SetServerMemberRole меняет встроенную роль участника сервера (manage_roles)
 func SetServerMemberRole(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		serverID := c.Param("id")
@@ -91,12 +90,8 @@ func SetServerMemberRole(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var member models.ServerMember
-		if err := db.Where("server_id = ? AND user_id = ?", serverID, userIDStr).First(&member).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
-		}
-		if member.Role != "owner" && member.Role != "admin" {
+		scope := authz.Server(serverID)
+		if !authz.Can(userIDStr, scope, authz.ManageRoles) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
@@ -109,7 +104,8 @@ func SetServerMemberRole(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		allowed := map[string]bool{"owner": true, "admin": true, "moderator": true, "member": true}
+		// Владение передается отдельно — здесь его не выдают и не снимают
+		allowed := map[string]bool{"admin": true, "moderator": true, "member": true}
 		if !allowed[req.Role] {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
 			return
@@ -120,8 +116,14 @@ func SetServerMemberRole(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
 			return
 		}
-		if target.Role == "owner" && member.Role != "owner" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		if target.Role == "owner" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "role_hierarchy"})
+			return
+		}
+		// Иерархия: менять роль можно только тем, кто ниже, и только на роль ниже своей
+		if !authz.IsOwner(userIDStr, scope) &&
+			(!authz.Outranks(userIDStr, targetUserID, scope) || authz.BuiltinPosition(req.Role) >= authz.Rank(userIDStr, scope)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "role_hierarchy"})
 			return
 		}
 
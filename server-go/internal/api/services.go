@@ -1,11 +1,19 @@
 package api
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"safegram-server/internal/config"
 )
 
 // ServiceStatus представляет статус сервиса
@@ -25,7 +33,7 @@ type Health struct {
 }
 
 // GetServicesStatus возвращает статус всех сервисов
-func GetServicesStatus(db *gorm.DB) gin.HandlerFunc {
+func GetServicesStatus(db *gorm.DB, cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// TODO: Реализовать реальную проверку статусов сервисов
 		// Это может быть интеграция с:
@@ -66,6 +74,7 @@ func GetServicesStatus(db *gorm.DB) gin.HandlerFunc {
 				},
 			},
 		}
+		services = append(services, probeICEServers(cfg)...)
 
 		c.JSON(http.StatusOK, gin.H{
 			"services": services,
@@ -73,6 +82,93 @@ func GetServicesStatus(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+// iceProbeTimeout таймаут проверки одного STUN/TURN сервера
+const iceProbeTimeout = 2 * time.Second
+
+// probeICEServers проверяет доступность настроенных STUN/TURN серверов:
+// UDP — STUN Binding Request (TURN-серверы тоже отвечают на него), TLS — рукопожатие
+func probeICEServers(cfg *config.Config) []ServiceStatus {
+	type target struct {
+		id, name, addr string
+		tls            bool
+	}
+	var targets []target
+	for _, url := range cfg.STUNServers {
+		addr := strings.TrimPrefix(url, "stun:")
+		targets = append(targets, target{"stun:" + addr, "STUN " + addr, addr, false})
+	}
+	for _, addr := range cfg.TURNServers {
+		targets = append(targets, target{"turn:" + addr, "TURN " + addr, addr, false})
+	}
+	for _, addr := range cfg.TURNTLSServers {
+		targets = append(targets, target{"turns:" + addr, "TURN TLS " + addr, addr, true})
+	}
+
+	results := make([]ServiceStatus, len(targets))
+	done := make(chan struct{}, len(targets))
+	for i, t := range targets {
+		go func(i int, t target) {
+			defer func() { done <- struct{}{} }()
+			start := time.Now()
+			var err error
+			if t.tls {
+				err = probeTLS(t.addr)
+			} else {
+				err = probeSTUN(t.addr)
+			}
+			status := ServiceStatus{ID: t.id, Name: t.name, Status: "running", LastCheck: time.Now()}
+			health := &Health{Status: "healthy", ResponseTime: int(time.Since(start).Milliseconds()), LastCheck: time.Now()}
+			if err != nil {
+				status.Status = "error"
+				health.Status = "unhealthy"
+			}
+			status.Health = health
+			results[i] = status
+		}(i, t)
+	}
+	for range targets {
+		<-done
+	}
+	return results
+}
+
+// probeSTUN отправляет STUN Binding Request (RFC 5389) и ждет успешный ответ
+func probeSTUN(addr string) error {
+	conn, err := net.DialTimeout("udp", addr, iceProbeTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(iceProbeTimeout))
+
+	req := make([]byte, 20)
+	binary.BigEndian.PutUint16(req[0:], 0x0001) // Binding Request
+	binary.BigEndian.PutUint32(req[4:], 0x2112A442)
+	rand.Read(req[8:20])
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	resp := make([]byte, 1500)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return err
+	}
+	if n < 20 || binary.BigEndian.Uint16(resp[0:]) != 0x0101 || !bytes.Equal(resp[8:20], req[8:20]) {
+		return errors.New("unexpected stun response")
+	}
+	return nil
+}
+
+// probeTLS проверяет TLS-рукопожатие с TURN сервером
+func probeTLS(addr string) error {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: iceProbeTimeout}, "tcp", addr, &tls.Config{})
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
 // StartService запускает сервис
 func StartService(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,418 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v4"
+	"gorm.io/gorm"
+	"safegram-server/internal/authz"
+	"safegram-server/internal/config"
+	"safegram-server/internal/models"
+	"safegram-server/internal/sfu"
+	"safegram-server/internal/websocket"
+)
+
+// sfuManager встроенный медиасервер; nil — SFU не запущен
+var sfuManager *sfu.Manager
+
+// sfuRoom комната SFU: активный групповой звонок или голосовая комната
+type sfuRoom struct {
+	ID      string
+	Kind    string // "group_call" | "voice_room"
+	ChatID  string
+	OwnerID string
+}
+
+// findSFURoom ищет комнату; activeOnly — только незавершенные
+func findSFURoom(db *gorm.DB, roomID string, activeOnly bool) (sfuRoom, bool) {
+	var call models.GroupCall
+	if err := db.First(&call, "id = ?", roomID).Error; err == nil {
+		if activeOnly && call.Status != "active" {
+			return sfuRoom{}, false
+		}
+		return sfuRoom{ID: call.ID, Kind: "group_call", ChatID: call.ChatID, OwnerID: call.StartedBy}, true
+	}
+	var room models.VoiceRoom
+	if err := db.First(&room, "id = ?", roomID).Error; err == nil {
+		if activeOnly && !room.IsActive {
+			return sfuRoom{}, false
+		}
+		return sfuRoom{ID: room.ID, Kind: "voice_room", ChatID: room.ChatID, OwnerID: room.CreatedBy}, true
+	}
+	return sfuRoom{}, false
+}
+
+// RegisterSFU запускает SFU и подключает обработчики sfu:* к хабу.
+// Вызывается до запуска wsHub.Run.
+func RegisterSFU(db *gorm.DB, hub *websocket.Hub, cfg *config.Config) error {
+	// Новый SFU не знает ни одного участника — присутствие из Redis устарело
+	resetVoiceRoomPresence(db)
+
+	manager, err := sfu.NewManager(sfu.Config{
+		STUNServers: cfg.STUNServers,
+		PublicIPs:   cfg.SFUPublicIPs,
+		UDPPortMin:  uint16(cfg.SFUUDPPortMin),
+		UDPPortMax:  uint16(cfg.SFUUDPPortMax),
+	})
+	if err != nil {
+		return err
+	}
+	sfuManager = manager
+
+	// Участие в групповом звонке пишется в GroupCallParticipant
+	manager.OnJoin = func(roomID, userID string) {
+		room, ok := findSFURoom(db, roomID, true)
+		if !ok {
+			return
+		}
+		if room.Kind == "group_call" {
+			// Гости встреч не пишутся в историю (у них нет аккаунта)
+			if !isGuest(userID) {
+				db.Create(&models.GroupCallParticipant{
+					ID:       uuid.New().String(),
+					CallID:   roomID,
+					UserID:   userID,
+					JoinedAt: time.Now(),
+				})
+			}
+		} else {
+			voiceRoomJoined(db, hub, roomID, userID)
+		}
+		broadcastSFUParticipants(hub, room)
+	}
+	manager.OnLeave = func(roomID, userID string, roomEmpty bool) {
+		room, ok := findSFURoom(db, roomID, false)
+		if !ok {
+			return
+		}
+		if room.Kind == "group_call" {
+			var participant models.GroupCallParticipant
+			if err := db.Where("call_id = ? AND user_id = ? AND left_at IS NULL", roomID, userID).
+				Order("joined_at DESC").First(&participant).Error; err == nil {
+				now := time.Now()
+				db.Model(&participant).Updates(map[string]interface{}{
+					"left_at":  now,
+					"duration": int(now.Sub(participant.JoinedAt).Seconds()),
+				})
+			}
+			// Последний вышел — звонок окончен
+			if roomEmpty {
+				stopCallRecordings(db, hub, roomID)
+				meetingCallEnded(db, hub, roomID)
+				now := time.Now()
+				db.Model(&models.GroupCall{}).Where("id = ? AND status = ?", roomID, "active").
+					Updates(map[string]interface{}{"status": "ended", "ended_at": now})
+			}
+		} else {
+			voiceRoomLeft(db, hub, roomID, userID)
+			if roomEmpty {
+				stopCallRecordings(db, hub, roomID)
+			}
+		}
+		broadcastSFUParticipants(hub, room)
+	}
+
+	hub.On("sfu:join", func(client *websocket.Client, msg map[string]interface{}) {
+		sfuJoin(db, hub, client, msg)
+	})
+	hub.On("sfu:leave", func(client *websocket.Client, msg map[string]interface{}) {
+		roomID, _ := msg["roomId"].(string)
+		sfuManager.Leave(roomID, client.UserID(), client.ID())
+	})
+	hub.On("sfu:offer", func(client *websocket.Client, msg map[string]interface{}) {
+		roomID, _ := msg["roomId"].(string)
+		if err := sfuManager.Offer(roomID, client.UserID(), client.ID(), sdpFromMessage(msg)); err != nil {
+			sfuError(client, roomID, err)
+		}
+	})
+	hub.On("sfu:answer", func(client *websocket.Client, msg map[string]interface{}) {
+		roomID, _ := msg["roomId"].(string)
+		if err := sfuManager.Answer(roomID, client.UserID(), client.ID(), sdpFromMessage(msg)); err != nil {
+			sfuError(client, roomID, err)
+		}
+	})
+	hub.On("sfu:ice", func(client *websocket.Client, msg map[string]interface{}) {
+		roomID, _ := msg["roomId"].(string)
+		var candidate webrtc.ICECandidateInit
+		raw, _ := json.Marshal(msg["candidate"])
+		if err := json.Unmarshal(raw, &candidate); err != nil || candidate.Candidate == "" {
+			return
+		}
+		if err := sfuManager.AddICECandidate(roomID, client.UserID(), client.ID(), candidate); err != nil {
+			sfuError(client, roomID, err)
+		}
+	})
+	hub.On("sfu:layer", func(client *websocket.Client, msg map[string]interface{}) {
+		roomID, _ := msg["roomId"].(string)
+		publisherID, _ := msg["publisherId"].(string)
+		rid, _ := msg["rid"].(string)
+		if err := sfuManager.SetLayer(roomID, client.UserID(), client.ID(), publisherID, rid); err != nil {
+			sfuError(client, roomID, err)
+		}
+	})
+	hub.OnDisconnect(func(userID, clientID string, lastConnection bool) {
+		sfuManager.LeaveClient(clientID)
+	})
+	return nil
+}
+
+// sfuJoin sfu:join {roomId} — вход в групповой звонок или голосовую комнату
+func sfuJoin(db *gorm.DB, hub *websocket.Hub, client *websocket.Client, msg map[string]interface{}) {
+	roomID, _ := msg["roomId"].(string)
+	userID := client.UserID()
+
+	room, ok := findSFURoom(db, roomID, true)
+	if !ok {
+		client.Send(wsEvent("sfu:error", gin.H{"roomId": roomID, "error": "not_found"}))
+		return
+	}
+	// В звонок встречи допускает лобби, в том числе гостей без аккаунта
+	allowed := false
+	meeting, isMeeting := meetingForCall(db, roomID)
+	if client.MeetingID() != "" {
+		allowed = isMeeting && meeting.ID == client.MeetingID() && meetingAdmitted(db, meeting, userID)
+	} else if isMeeting {
+		allowed = meetingAdmitted(db, meeting, userID)
+	} else {
+		allowed = authz.Can(userID, authz.Chat(room.ChatID), authz.Connect)
+	}
+	if !allowed {
+		client.Send(wsEvent("sfu:error", gin.H{"roomId": roomID, "error": "forbidden"}))
+		return
+	}
+	if code, _, restricted := serverRestriction(db, room.ChatID, userID); restricted {
+		client.Send(wsEvent("sfu:error", gin.H{"roomId": roomID, "error": code}))
+		return
+	}
+
+	clientID := client.ID()
+	err := sfuManager.Join(roomID, userID, clientID, func(message []byte) {
+		hub.SendToClient(clientID, message)
+	})
+	if err != nil {
+		log.Printf("SFU join failed: %v", err)
+		client.Send(wsEvent("sfu:error", gin.H{"roomId": roomID, "error": "server_error"}))
+		return
+	}
+
+	// В голосовой комнате слышны только ведущие и спикеры;
+	// в групповом звонке без права говорить участник входит заглушенным
+	if room.Kind == "voice_room" {
+		var voiceRoom models.VoiceRoom
+		if db.First(&voiceRoom, "id = ?", roomID).Error == nil {
+			syncVoiceRoomAudio(voiceRoom, userID)
+		}
+	} else if !isMeeting && !authz.Can(userID, authz.Chat(room.ChatID), authz.Speak) {
+		sfuManager.Mute(roomID, userID, true)
+	}
+
+	client.Send(wsEvent("sfu:joined", gin.H{
+		"roomId":        roomID,
+		"kind":          room.Kind,
+		"participants":  sfuManager.Participants(roomID),
+		"activeSpeaker": sfuManager.ActiveSpeaker(roomID),
+	}))
+	recordingJoined(db, client, roomID)
+}
+
+// sdpFromMessage принимает sdp строкой или RTCSessionDescription {type, sdp}
+func sdpFromMessage(msg map[string]interface{}) string {
+	switch v := msg["sdp"].(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		s, _ := v["sdp"].(string)
+		return s
+	}
+	return ""
+}
+
+func sfuError(client *websocket.Client, roomID string, err error) {
+	code := "bad_request"
+	switch err {
+	case sfu.ErrRoomNotFound, sfu.ErrNotInRoom:
+		code = "not_in_room"
+	}
+	client.Send(wsEvent("sfu:error", gin.H{"roomId": roomID, "error": code}))
+}
+
+// broadcastSFUParticipants сообщает участникам чата, кто сейчас в комнате
+func broadcastSFUParticipants(hub *websocket.Hub, room sfuRoom) {
+	hub.BroadcastToChat(room.ChatID, wsEvent("sfu:participants", gin.H{
+		"roomId":       room.ID,
+		"kind":         room.Kind,
+		"chatId":       room.ChatID,
+		"participants": sfuManager.Participants(room.ID),
+	}))
+}
+
+// closeSFURoom отключает всех участников завершенного звонка/комнаты
+func closeSFURoom(roomID string) {
+	if sfuManager != nil {
+		sfuManager.CloseRoom(roomID)
+	}
+}
+
+// GetSFUParticipants текущие участники комнаты SFU
+func GetSFUParticipants(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID := c.Param("roomId")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		if sfuManager == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "sfu_unavailable"})
+			return
+		}
+
+		room, found := findSFURoom(db, roomID, true)
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		if !authz.IsMember(userIDStr, authz.Chat(room.ChatID)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"participants":  sfuManager.Participants(roomID),
+			"activeSpeaker": sfuManager.ActiveSpeaker(roomID),
+		})
+	}
+}
+
+// sfuModerator проверяет, может ли actor применить perm к target в комнате:
+// создатель комнаты может всегда, остальным нужно право и старшинство роли
+func sfuModerator(room sfuRoom, actorID, targetID string, perm authz.Permission) (string, bool) {
+	if actorID == room.OwnerID {
+		return "", true
+	}
+	scope := authz.Chat(room.ChatID)
+	if !authz.Can(actorID, scope, perm) {
+		return "forbidden", false
+	}
+	if targetID != actorID && !authz.Outranks(actorID, targetID, scope) {
+		return "role_hierarchy", false
+	}
+	return "", true
+}
+
+// MuteSFUParticipant заглушает/включает участника на сервере (mute_members или создатель комнаты)
+func MuteSFUParticipant(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID := c.Param("roomId")
+		userID, _ := c.Get("userID")
+		actorID, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		if sfuManager == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "sfu_unavailable"})
+			return
+		}
+
+		var req struct {
+			UserID string `json:"userId" binding:"required"`
+			Muted  *bool  `json:"muted"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+		muted := req.Muted == nil || *req.Muted
+
+		room, found := findSFURoom(db, roomID, true)
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		if code, allowed := sfuModerator(room, actorID, req.UserID, authz.MuteMembers); !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": code})
+			return
+		}
+
+		// Для голосовых комнат mute хранится в состоянии комнаты
+		if room.Kind == "voice_room" {
+			var voiceRoom models.VoiceRoom
+			if err := db.First(&voiceRoom, "id = ?", roomID).Error; err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+				return
+			}
+			if err := setVoiceRoomMuted(db, voiceRoom, actorID, req.UserID, muted); err != nil {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "state_unavailable"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"ok": true, "muted": muted})
+			return
+		}
+
+		if err := sfuManager.Mute(roomID, req.UserID, muted); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_in_room"})
+			return
+		}
+
+		action := "voice_mute"
+		if !muted {
+			action = "voice_unmute"
+		}
+		logModeration(db, room.ChatID, "", actorID, action, req.UserID, "", gin.H{"roomId": roomID})
+		c.JSON(http.StatusOK, gin.H{"ok": true, "muted": muted})
+	}
+}
+
+// KickSFUParticipant отключает участника от комнаты (kick_members или создатель комнаты)
+func KickSFUParticipant(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID := c.Param("roomId")
+		userID, _ := c.Get("userID")
+		actorID, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		if sfuManager == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "sfu_unavailable"})
+			return
+		}
+
+		var req struct {
+			UserID string `json:"userId" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+		if req.UserID == actorID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cannot_kick_self"})
+			return
+		}
+
+		room, found := findSFURoom(db, roomID, true)
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		if code, allowed := sfuModerator(room, actorID, req.UserID, authz.KickMembers); !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": code})
+			return
+		}
+
+		if err := sfuManager.Kick(roomID, req.UserID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_in_room"})
+			return
+		}
+
+		logModeration(db, room.ChatID, "", actorID, "voice_kick", req.UserID, "", gin.H{"roomId": roomID})
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
@@ -1,15 +1,84 @@
 package api
 
 import (
+	"encoding/json"
+	"io"
+	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"safegram-server/internal/models"
+	"safegram-server/internal/websocket"
 )
 
+// storyDurations допустимое время жизни истории (часы)
+var storyDurations = map[int]bool{6: true, 12: true, 24: true, 48: true}
+
+// storyContactSQL зритель есть в контактах автора
+const storyContactSQL = `EXISTS (SELECT 1 FROM contacts sc WHERE sc.owner_id = stories.user_id AND sc.contact_id = ?)`
+
+// storyVisible условие видимости истории для зрителя: автор видит все,
+// остальные — с учетом аудитории и списка скрытых
+func storyVisible(db *gorm.DB, viewerID string) *gorm.DB {
+	return db.Where(
+		"stories.user_id = ? OR (NOT EXISTS (SELECT 1 FROM story_hidden_users h WHERE h.owner_id = stories.user_id AND h.user_id = ?) AND "+
+			"NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = stories.user_id AND b.blocked_id = ?) AND ("+
+			"stories.audience = 'everyone' OR "+
+			"(stories.audience = 'contacts' AND "+storyContactSQL+") OR "+
+			"(stories.audience = 'close_friends' AND EXISTS (SELECT 1 FROM story_close_friends f WHERE f.owner_id = stories.user_id AND f.user_id = ?))))",
+		viewerID, viewerID, viewerID, viewerID, viewerID,
+	)
+}
+
+// loadVisibleStory история по :id, если зритель может ее видеть
+func loadVisibleStory(c *gin.Context, db *gorm.DB, viewerID string, activeOnly bool) (models.Story, bool) {
+	var story models.Story
+	query := storyVisible(db.Model(&models.Story{}), viewerID).Where("stories.id = ?", c.Param("id"))
+	if activeOnly {
+		query = query.Where("stories.expires_at > ?", time.Now())
+	}
+	if err := query.First(&story).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+		return story, false
+	}
+	return story, true
+}
+
+// storyQuote краткое описание истории для цитаты в сообщении
+func storyQuote(story models.Story) gin.H {
+	return gin.H{
+		"id":              story.ID,
+		"userId":          story.UserID,
+		"type":            story.Type,
+		"contentUrl":      story.ContentURL,
+		"text":            story.Text,
+		"backgroundColor": story.BackgroundColor,
+		"expired":         story.ExpiresAt.Before(time.Now()),
+	}
+}
+
+func storyPayload(story models.Story) gin.H {
+	return gin.H{
+		"id":              story.ID,
+		"userId":          story.UserID,
+		"type":            story.Type,
+		"contentUrl":      story.ContentURL,
+		"text":            story.Text,
+		"backgroundColor": story.BackgroundColor,
+		"caption":         story.Caption,
+		"audience":        story.Audience,
+		"repliesDisabled": story.RepliesDisabled,
+		"expiresAt":       story.ExpiresAt.Unix() * 1000,
+		"createdAt":       story.CreatedAt.Unix() * 1000,
+	}
+}
+
 // CreateStory создает новую историю
 func CreateStory(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -21,10 +90,14 @@ func CreateStory(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		var req struct {
-			Type           string `json:"type" binding:"required"` // image, video, text
-			ContentURL     string `json:"contentUrl,omitempty"`
-			Text           string `json:"text,omitempty"`
+			Type            string `json:"type" binding:"required"` // image, video, text
+			ContentURL      string `json:"contentUrl,omitempty"`
+			Text            string `json:"text,omitempty"`
 			BackgroundColor string `json:"backgroundColor,omitempty"`
+			Caption         string `json:"caption,omitempty"`
+			Audience        string `json:"audience,omitempty"`      // everyone | contacts | close_friends
+			DurationHours   int    `json:"durationHours,omitempty"` // 6 | 12 | 24 | 48
+			RepliesDisabled bool   `json:"repliesDisabled,omitempty"`
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -32,15 +105,48 @@ func CreateStory(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Создаем историю с временем жизни 24 часа
+		switch req.Type {
+		case "image", "video":
+			if req.ContentURL == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "content_required"})
+				return
+			}
+		case "text":
+			if strings.TrimSpace(req.Text) == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "content_required"})
+				return
+			}
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_type"})
+			return
+		}
+
+		if req.Audience == "" {
+			req.Audience = "everyone"
+		}
+		if req.Audience != "everyone" && req.Audience != "contacts" && req.Audience != "close_friends" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_audience"})
+			return
+		}
+		if req.DurationHours == 0 {
+			req.DurationHours = 24
+		}
+		if !storyDurations[req.DurationHours] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_duration"})
+			return
+		}
+
 		story := models.Story{
-			ID:            uuid.New().String(),
-			UserID:        userIDStr,
-			Type:          req.Type,
-			ContentURL:    req.ContentURL,
-			Text:          req.Text,
+			ID:              uuid.New().String(),
+			UserID:          userIDStr,
+			Type:            req.Type,
+			ContentURL:      req.ContentURL,
+			Text:            req.Text,
 			BackgroundColor: req.BackgroundColor,
-			ExpiresAt:     time.Now().Add(24 * time.Hour),
+			Caption:         req.Caption,
+			Audience:        req.Audience,
+			RepliesDisabled: req.RepliesDisabled,
+			ExpiresAt:       time.Now().Add(time.Duration(req.DurationHours) * time.Hour),
 		}
 
 		if err := db.Create(&story).Error; err != nil {
@@ -51,21 +157,11 @@ func CreateStory(db *gorm.DB) gin.HandlerFunc {
 		// Загружаем с пользователем
 		db.Preload("User").First(&story, "id = ?", story.ID)
 
-		response := gin.H{
-			"id":            story.ID,
-			"userId":        story.UserID,
-			"type":          story.Type,
-			"contentUrl":    story.ContentURL,
-			"text":          story.Text,
-			"backgroundColor": story.BackgroundColor,
-			"expiresAt":     story.ExpiresAt.Unix() * 1000,
-			"createdAt":     story.CreatedAt.Unix() * 1000,
-		}
-
+		response := storyPayload(story)
 		if story.User.ID != "" {
 			response["user"] = gin.H{
-				"id":       story.User.ID,
-				"username": story.User.Username,
+				"id":        story.User.ID,
+				"username":  story.User.Username,
 				"avatarUrl": story.User.AvatarURL,
 			}
 		}
@@ -74,7 +170,7 @@ func CreateStory(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// GetStories возвращает активные истории пользователей
+// GetStories возвращает активные истории, доступные пользователю
 func GetStories(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, _ := c.Get("userID")
@@ -84,10 +180,9 @@ func GetStories(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Получаем истории от пользователей, на которых подписан текущий пользователь
-		// Для упрощения показываем все активные истории
 		var stories []models.Story
-		if err := db.Where("expires_at > ?", time.Now()).
+		if err := storyVisible(db, userIDStr).
+			Where("expires_at > ?", time.Now()).
 			Preload("User").
 			Preload("Views", "user_id = ?", userIDStr). // Загружаем только просмотры текущего пользователя
 			Order("created_at DESC").
@@ -96,50 +191,87 @@ func GetStories(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Группируем по пользователям
+		storyIDs := make([]string, 0, len(stories))
+		ownIDs := make([]string, 0)
+		authorIDs := make([]string, 0, len(stories))
+		for _, story := range stories {
+			storyIDs = append(storyIDs, story.ID)
+			authorIDs = append(authorIDs, story.UserID)
+			if story.UserID == userIDStr {
+				ownIDs = append(ownIDs, story.ID)
+			}
+		}
+
+		// Своя реакция на чужие истории
+		myReactions := make(map[string]string)
+		if len(storyIDs) > 0 {
+			var reactions []models.StoryReaction
+			db.Where("story_id IN ? AND user_id = ?", storyIDs, userIDStr).Find(&reactions)
+			for _, reaction := range reactions {
+				myReactions[reaction.StoryID] = reaction.Emoji
+			}
+		}
+
+		// Счетчики просмотров и реакций видит только автор
+		type storyCount struct {
+			StoryID string
+			Count   int64
+		}
+		viewCounts := make(map[string]int64)
+		reactionCounts := make(map[string]int64)
+		if len(ownIDs) > 0 {
+			var counts []storyCount
+			db.Model(&models.StoryView{}).Select("story_id, COUNT(*) AS count").
+				Where("story_id IN ?", ownIDs).Group("story_id").Scan(&counts)
+			for _, count := range counts {
+				viewCounts[count.StoryID] = count.Count
+			}
+			counts = nil
+			db.Model(&models.StoryReaction{}).Select("story_id, COUNT(*) AS count").
+				Where("story_id IN ?", ownIDs).Group("story_id").Scan(&counts)
+			for _, count := range counts {
+				reactionCounts[count.StoryID] = count.Count
+			}
+		}
+
+		// Группируем по пользователям, сохраняя порядок
+		authors := newPrivacyView(db, userIDStr, authorIDs)
 		storiesByUser := make(map[string][]gin.H)
+		userInfo := make(map[string]gin.H)
+		order := make([]string, 0)
 		for _, story := range stories {
 			if story.User.ID == "" {
 				continue
 			}
 
-			storyData := gin.H{
-				"id":            story.ID,
-				"type":          story.Type,
-				"contentUrl":    story.ContentURL,
-				"text":          story.Text,
-				"backgroundColor": story.BackgroundColor,
-				"expiresAt":     story.ExpiresAt.Unix() * 1000,
-				"createdAt":     story.CreatedAt.Unix() * 1000,
-				"viewed":        len(story.Views) > 0, // Просмотрена ли текущим пользователем
+			storyData := storyPayload(story)
+			storyData["viewed"] = len(story.Views) > 0 // Просмотрена ли текущим пользователем
+			if emoji, ok := myReactions[story.ID]; ok {
+				storyData["myReaction"] = emoji
 			}
-
-			userId := story.UserID
-			if _, exists := storiesByUser[userId]; !exists {
-				storiesByUser[userId] = []gin.H{}
+			if story.UserID == userIDStr {
+				storyData["viewCount"] = viewCounts[story.ID]
+				storyData["reactionCount"] = reactionCounts[story.ID]
+			} else {
+				delete(storyData, "audience")
 			}
-			storiesByUser[userId] = append(storiesByUser[userId], storyData)
-		}
 
-		// Формируем ответ
-		result := make([]gin.H, 0, len(storiesByUser))
-		for userId, userStories := range storiesByUser {
-			// Находим информацию о пользователе из первой истории
-			var userInfo gin.H
-			for _, story := range stories {
-				if story.UserID == userId && story.User.ID != "" {
-					userInfo = gin.H{
-						"id":       story.User.ID,
-						"username": story.User.Username,
-						"avatarUrl": story.User.AvatarURL,
-					}
-					break
+			if _, exists := storiesByUser[story.UserID]; !exists {
+				order = append(order, story.UserID)
+				userInfo[story.UserID] = gin.H{
+					"id":        story.User.ID,
+					"username":  story.User.Username,
+					"avatarUrl": authors.avatar(story.User),
 				}
 			}
+			storiesByUser[story.UserID] = append(storiesByUser[story.UserID], storyData)
+		}
 
+		result := make([]gin.H, 0, len(order))
+		for _, ownerID := range order {
 			result = append(result, gin.H{
-				"user":    userInfo,
-				"stories": userStories,
+				"user":    userInfo[ownerID],
+				"stories": storiesByUser[ownerID],
 			})
 		}
 
@@ -150,7 +282,6 @@ func GetStories(db *gorm.DB) gin.HandlerFunc {
 // ViewStory отмечает историю как просмотренную
 func ViewStory(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		storyID := c.Param("id")
 		userID, _ := c.Get("userID")
 		userIDStr, ok := userID.(string)
 		if !ok {
@@ -158,16 +289,19 @@ func ViewStory(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Проверяем существование истории
-		var story models.Story
-		if err := db.First(&story, "id = ?", storyID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+		story, found := loadVisibleStory(c, db, userIDStr, false)
+		if !found {
+			return
+		}
+		// Свои просмотры не считаем
+		if story.UserID == userIDStr {
+			c.JSON(http.StatusOK, gin.H{"ok": true})
 			return
 		}
 
 		// Проверяем, не просмотрена ли уже
 		var existing models.StoryView
-		if err := db.Where("story_id = ? AND user_id = ?", storyID, userIDStr).First(&existing).Error; err == nil {
+		if err := db.Where("story_id = ? AND user_id = ?", story.ID, userIDStr).First(&existing).Error; err == nil {
 			c.JSON(http.StatusOK, gin.H{"ok": true, "alreadyViewed": true})
 			return
 		}
@@ -175,7 +309,7 @@ func ViewStory(db *gorm.DB) gin.HandlerFunc {
 		// Создаем просмотр
 		view := models.StoryView{
 			ID:      uuid.New().String(),
-			StoryID: storyID,
+			StoryID: story.ID,
 			UserID:  userIDStr,
 		}
 
@@ -188,6 +322,615 @@ func ViewStory(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+// GetStoryViews список просмотревших с реакциями (только для автора)
+func GetStoryViews(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var story models.Story
+		if err := db.First(&story, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		if story.UserID != userIDStr {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var views []models.StoryView
+		db.Where("story_id = ?", story.ID).Preload("User").Order("viewed_at DESC").Find(&views)
+		var reactions []models.StoryReaction
+		db.Where("story_id = ?", story.ID).Find(&reactions)
+		reactionByUser := make(map[string]string, len(reactions))
+		for _, reaction := range reactions {
+			reactionByUser[reaction.UserID] = reaction.Emoji
+		}
+
+		viewerIDs := make([]string, len(views))
+		for i, view := range views {
+			viewerIDs[i] = view.UserID
+		}
+		viewers := newPrivacyView(db, userIDStr, viewerIDs)
+		result := make([]gin.H, len(views))
+		for i, view := range views {
+			result[i] = gin.H{
+				"userId":   view.UserID,
+				"viewedAt": view.ViewedAt.Unix() * 1000,
+				"reaction": reactionByUser[view.UserID],
+				"user": gin.H{
+					"id":        view.User.ID,
+					"username":  view.User.Username,
+					"avatarUrl": viewers.avatar(view.User),
+				},
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"views": result, "viewCount": len(views), "reactionCount": len(reactions)})
+	}
+}
+
+// ReactToStory ставит реакцию на историю (повторный вызов заменяет реакцию)
+func ReactToStory(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var req struct {
+			Emoji string `json:"emoji" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || len([]rune(req.Emoji)) > 16 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		story, found := loadVisibleStory(c, db, userIDStr, true)
+		if !found {
+			return
+		}
+		if story.UserID == userIDStr {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "own_story"})
+			return
+		}
+
+		var reaction models.StoryReaction
+		if err := db.Where("story_id = ? AND user_id = ?", story.ID, userIDStr).First(&reaction).Error; err == nil {
+			reaction.Emoji = req.Emoji
+			db.Model(&reaction).Update("emoji", req.Emoji)
+		} else {
+			reaction = models.StoryReaction{ID: uuid.New().String(), StoryID: story.ID, UserID: userIDStr, Emoji: req.Emoji}
+			if err := db.Create(&reaction).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+				return
+			}
+		}
+
+		if wsHub != nil {
+			wsHub.SendToUser(story.UserID, wsEvent("story:reaction", gin.H{"storyId": story.ID, "userId": userIDStr, "emoji": req.Emoji}))
+		}
+		c.JSON(http.StatusOK, gin.H{"reaction": reaction})
+	}
+}
+
+// RemoveStoryReaction снимает свою реакцию
+func RemoveStoryReaction(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		db.Where("story_id = ? AND user_id = ?", c.Param("id"), userIDStr).Delete(&models.StoryReaction{})
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// ReplyToStory ответ на историю приходит автору личным сообщением с цитатой истории
+func ReplyToStory(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var req struct {
+			Text      string `json:"text"`
+			StickerID string `json:"stickerId"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || (strings.TrimSpace(req.Text) == "" && req.StickerID == "") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		story, found := loadVisibleStory(c, db, userIDStr, true)
+		if !found {
+			return
+		}
+		if story.UserID == userIDStr {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "own_story"})
+			return
+		}
+		if story.RepliesDisabled {
+			c.JSON(http.StatusForbidden, gin.H{"error": "replies_disabled"})
+			return
+		}
+		if usersBlocked(db, userIDStr, story.UserID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "blocked"})
+			return
+		}
+
+		chat, err := findOrCreateDM(db, userIDStr, story.UserID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		message := models.Message{
+			ID:               uuid.New().String(),
+			ChatID:           chat.ID,
+			SenderID:         userIDStr,
+			Text:             req.Text,
+			StickerID:        req.StickerID,
+			StoryID:          story.ID,
+			ModerationStatus: "approved",
+		}
+		if err := db.Create(&message).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		bumpUnread(db, message)
+		refreshChatSummary(db, message.ChatID)
+
+		var sender models.User
+		db.First(&sender, "id = ?", userIDStr)
+		response := gin.H{
+			"id":               message.ID,
+			"chatId":           message.ChatID,
+			"senderId":         message.SenderID,
+			"text":             message.Text,
+			"stickerId":        message.StickerID,
+			"moderationStatus": message.ModerationStatus,
+			"storyId":          story.ID,
+			"story":            storyQuote(story),
+			"createdAt":        message.CreatedAt,
+			"sender": gin.H{
+				"id":        sender.ID,
+				"username":  sender.Username,
+				"avatarUrl": publicAvatar(sender),
+			},
+		}
+
+		// Личный чат мог быть только что создан — отправляем участникам напрямую
+		if wsHub != nil {
+			wsMessage, _ := json.Marshal(gin.H{"type": "message", "data": response})
+			wsHub.SendToUser(userIDStr, wsMessage)
+			wsHub.SendToUser(story.UserID, wsMessage)
+		}
+		go notifyChatMessage(db, wsHub, message)
+		if wsHub != nil {
+			go deliverToConnected(db, wsHub, message)
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// storyUserList пользователи списка вместе с профилем, каким его видит владелец списка
+func storyUserList(db *gorm.DB, ownerID string, userIDs []string) []gin.H {
+	result := make([]gin.H, 0, len(userIDs))
+	if len(userIDs) == 0 {
+		return result
+	}
+	var users []models.User
+	db.Where("id IN ?", userIDs).Find(&users)
+	view := newPrivacyView(db, ownerID, userIDs)
+	for _, user := range users {
+		result = append(result, gin.H{"id": user.ID, "username": user.Username, "avatarUrl": view.avatar(user)})
+	}
+	return result
+}
+
+// GetStoryAudienceList список «близкие друзья» (closeFriends) или «скрыть от» (hidden)
+func GetStoryAudienceList(db *gorm.DB, list string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var userIDs []string
+		if list == "closeFriends" {
+			db.Model(&models.StoryCloseFriend{}).Where("owner_id = ?", userIDStr).Pluck("user_id", &userIDs)
+		} else {
+			db.Model(&models.StoryHiddenUser{}).Where("owner_id = ?", userIDStr).Pluck("user_id", &userIDs)
+		}
+		c.JSON(http.StatusOK, gin.H{"users": storyUserList(db, userIDStr, userIDs)})
+	}
+}
+
+// SetStoryAudienceList заменяет список «близкие друзья» или «скрыть от»
+func SetStoryAudienceList(db *gorm.DB, list string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var req struct {
+			UserIDs []string `json:"userIds"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || len(req.UserIDs) > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		// Только существующие пользователи, без себя
+		var userIDs []string
+		if len(req.UserIDs) > 0 {
+			db.Model(&models.User{}).Where("id IN ? AND id <> ?", req.UserIDs, userIDStr).Pluck("id", &userIDs)
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if list == "closeFriends" {
+				if err := tx.Where("owner_id = ?", userIDStr).Delete(&models.StoryCloseFriend{}).Error; err != nil {
+					return err
+				}
+				for _, id := range userIDs {
+					if err := tx.Create(&models.StoryCloseFriend{OwnerID: userIDStr, UserID: id}).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			if err := tx.Where("owner_id = ?", userIDStr).Delete(&models.StoryHiddenUser{}).Error; err != nil {
+				return err
+			}
+			for _, id := range userIDs {
+				if err := tx.Create(&models.StoryHiddenUser{OwnerID: userIDStr, UserID: id}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"users": storyUserList(db, userIDStr, userIDs)})
+	}
+}
+
+// highlightPayload альбом с историями, видимыми зрителю
+func highlightPayload(db *gorm.DB, highlight models.StoryHighlight, viewerID string) gin.H {
+	var stories []models.Story
+	storyVisible(db.Model(&models.Story{}), viewerID).
+		Joins("JOIN story_highlight_items i ON i.story_id = stories.id AND i.highlight_id = ?", highlight.ID).
+		Order("i.position ASC, stories.created_at ASC").
+		Find(&stories)
+
+	items := make([]gin.H, len(stories))
+	for i, story := range stories {
+		items[i] = storyPayload(story)
+		delete(items[i], "expiresAt")
+		if story.UserID != viewerID {
+			delete(items[i], "audience")
+		}
+	}
+	coverURL := highlight.CoverURL
+	if coverURL == "" && len(stories) > 0 {
+		coverURL = stories[0].ContentURL
+	}
+	return gin.H{
+		"id":        highlight.ID,
+		"userId":    highlight.UserID,
+		"title":     highlight.Title,
+		"coverUrl":  coverURL,
+		"position":  highlight.Position,
+		"stories":   items,
+		"createdAt": highlight.CreatedAt.Unix() * 1000,
+	}
+}
+
+// GetUserHighlights альбомы пользователя (пустые для зрителя альбомы не показываются)
+func GetUserHighlights(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		ownerID := c.Param("id")
+		if ownerID == "me" {
+			ownerID = userIDStr
+		}
+
+		var highlights []models.StoryHighlight
+		db.Where("user_id = ?", ownerID).Order("position ASC, created_at ASC").Find(&highlights)
+
+		result := make([]gin.H, 0, len(highlights))
+		for _, highlight := range highlights {
+			payload := highlightPayload(db, highlight, userIDStr)
+			if ownerID != userIDStr && len(payload["stories"].([]gin.H)) == 0 {
+				continue
+			}
+			result = append(result, payload)
+		}
+		c.JSON(http.StatusOK, gin.H{"highlights": result})
+	}
+}
+
+// setHighlightStories добавляет в альбом собственные истории автора
+func setHighlightStories(tx *gorm.DB, highlight models.StoryHighlight, storyIDs []string) error {
+	if len(storyIDs) == 0 {
+		return nil
+	}
+	var owned []string
+	tx.Model(&models.Story{}).Where("id IN ? AND user_id = ?", storyIDs, highlight.UserID).Pluck("id", &owned)
+	ownedSet := make(map[string]bool, len(owned))
+	for _, id := range owned {
+		ownedSet[id] = true
+	}
+
+	var position int
+	tx.Model(&models.StoryHighlightItem{}).Where("highlight_id = ?", highlight.ID).
+		Select("COALESCE(MAX(position), -1) + 1").Scan(&position)
+	for _, storyID := range storyIDs {
+		if !ownedSet[storyID] {
+			continue
+		}
+		var exists int64
+		tx.Model(&models.StoryHighlightItem{}).Where("highlight_id = ? AND story_id = ?", highlight.ID, storyID).Count(&exists)
+		if exists > 0 {
+			continue
+		}
+		if err := tx.Create(&models.StoryHighlightItem{HighlightID: highlight.ID, StoryID: storyID, Position: position}).Error; err != nil {
+			return err
+		}
+		position++
+	}
+	return nil
+}
+
+// CreateStoryHighlight создает альбом из своих историй
+func CreateStoryHighlight(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var req struct {
+			Title    string   `json:"title" binding:"required"`
+			CoverURL string   `json:"coverUrl"`
+			StoryIDs []string `json:"storyIds"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || len([]rune(req.Title)) > 64 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		var count int64
+		db.Model(&models.StoryHighlight{}).Where("user_id = ?", userIDStr).Count(&count)
+		if count >= 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "too_many_highlights"})
+			return
+		}
+
+		highlight := models.StoryHighlight{
+			ID:       uuid.New().String(),
+			UserID:   userIDStr,
+			Title:    strings.TrimSpace(req.Title),
+			CoverURL: req.CoverURL,
+			Position: int(count),
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&highlight).Error; err != nil {
+				return err
+			}
+			return setHighlightStories(tx, highlight, req.StoryIDs)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"highlight": highlightPayload(db, highlight, userIDStr)})
+	}
+}
+
+// UpdateStoryHighlight меняет название/обложку, добавляет и убирает истории
+func UpdateStoryHighlight(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var highlight models.StoryHighlight
+		if err := db.First(&highlight, "id = ? AND user_id = ?", c.Param("id"), userIDStr).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+
+		var req struct {
+			Title          *string  `json:"title"`
+			CoverURL       *string  `json:"coverUrl"`
+			Position       *int     `json:"position"`
+			AddStoryIDs    []string `json:"addStoryIds"`
+			RemoveStoryIDs []string `json:"removeStoryIds"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		updates := map[string]interface{}{}
+		if req.Title != nil && strings.TrimSpace(*req.Title) != "" {
+			highlight.Title = strings.TrimSpace(*req.Title)
+			updates["title"] = highlight.Title
+		}
+		if req.CoverURL != nil {
+			highlight.CoverURL = *req.CoverURL
+			updates["cover_url"] = highlight.CoverURL
+		}
+		if req.Position != nil {
+			highlight.Position = *req.Position
+			updates["position"] = highlight.Position
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if len(updates) > 0 {
+				if err := tx.Model(&highlight).Updates(updates).Error; err != nil {
+					return err
+				}
+			}
+			if len(req.RemoveStoryIDs) > 0 {
+				if err := tx.Where("highlight_id = ? AND story_id IN ?", highlight.ID, req.RemoveStoryIDs).
+					Delete(&models.StoryHighlightItem{}).Error; err != nil {
+					return err
+				}
+			}
+			return setHighlightStories(tx, highlight, req.AddStoryIDs)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"highlight": highlightPayload(db, highlight, userIDStr)})
+	}
+}
+
+// DeleteStoryHighlight удаляет альбом; истекшие истории из него уберет сборщик
+func DeleteStoryHighlight(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var highlight models.StoryHighlight
+		if err := db.First(&highlight, "id = ? AND user_id = ?", c.Param("id"), userIDStr).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		db.Where("highlight_id = ?", highlight.ID).Delete(&models.StoryHighlightItem{})
+		db.Delete(&highlight)
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// storyMediaExts допустимые форматы медиа историй
+var storyMediaExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true,
+	".mp4": true, ".webm": true, ".mov": true,
+}
+
+// UploadStoryMedia загружает фото или видео для истории. Файл принадлежит загрузившему:
+// его имя начинается с ID пользователя, и только такие файлы удаляются вместе с историей
+func UploadStoryMedia(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "detail": "No file provided"})
+			return
+		}
+		if file.Size > maxFileSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "detail": "File too large"})
+			return
+		}
+		ext := strings.ToLower(filepath.Ext(file.Filename))
+		if !storyMediaExts[ext] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "detail": "Invalid file type"})
+			return
+		}
+
+		// Расширение задает клиент, поэтому содержимое проверяется отдельно
+		src, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(src, head)
+		src.Close()
+		contentType := http.DetectContentType(head[:n])
+		if !strings.HasPrefix(contentType, "image/") && !strings.HasPrefix(contentType, "video/") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "detail": "Invalid file type"})
+			return
+		}
+
+		filename := userIDStr + "_" + uuid.New().String() + ext
+		if err := c.SaveUploadedFile(file, filepath.Join(uploadsDir, "stories", filename)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"contentUrl": "/uploads/stories/" + filename})
+	}
+}
+
+// ownStoryMedia файл загружен автором истории через UploadStoryMedia
+func ownStoryMedia(story models.Story) bool {
+	name := strings.TrimPrefix(story.ContentURL, "/uploads/stories/")
+	return name != story.ContentURL && filepath.Base(name) == name && strings.HasPrefix(name, story.UserID+"_")
+}
+
+// removeStoryMedia удаляет файл истории, если его загрузил автор для историй.
+// Прочие ссылки (вложения, аватары) истории не принадлежат и не удаляются
+func removeStoryMedia(story models.Story) {
+	if !ownStoryMedia(story) {
+		return
+	}
+	path := filepath.Join(uploadsDir, "stories", filepath.Base(story.ContentURL))
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove story media %s: %v", path, err)
+	}
+}
+
+// purgeStory удаляет историю со всеми взаимодействиями и файлом
+func purgeStory(db *gorm.DB, story models.Story) {
+	db.Where("story_id = ?", story.ID).Delete(&models.StoryView{})
+	db.Where("story_id = ?", story.ID).Delete(&models.StoryReaction{})
+	db.Where("story_id = ?", story.ID).Delete(&models.StoryHighlightItem{})
+	db.Delete(&story)
+
+	// Тот же файл может использоваться другой историей
+	var shared int64
+	db.Model(&models.Story{}).Where("content_url = ?", story.ContentURL).Count(&shared)
+	if shared == 0 {
+		removeStoryMedia(story)
+	}
+}
+
 // DeleteStory удаляет историю
 func DeleteStory(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -211,11 +954,26 @@ func DeleteStory(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Удаляем просмотры и саму историю
-		db.Where("story_id = ?", storyID).Delete(&models.StoryView{})
-		db.Delete(&story)
+		purgeStory(db, story)
 
 		c.JSON(http.StatusOK, gin.H{"ok": true})
 	}
 }
 
+// StartStoryReaper раз в 10 минут удаляет истекшие истории, не попавшие в альбомы
+func StartStoryReaper(db *gorm.DB) {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for {
+		var stories []models.Story
+		db.Where("expires_at < ? AND NOT EXISTS (SELECT 1 FROM story_highlight_items i WHERE i.story_id = stories.id)", time.Now()).
+			Limit(500).Find(&stories)
+		for _, story := range stories {
+			purgeStory(db, story)
+		}
+		if len(stories) > 0 {
+			log.Printf("Removed %d expired stories", len(stories))
+		}
+		<-ticker.C
+	}
+}
@@ -2,15 +2,265 @@ package api
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"safegram-server/internal/authz"
 	"safegram-server/internal/models"
+	"safegram-server/internal/websocket"
 )
 
-// CreateThread создает новый тред
-func CreateThread(db *gorm.DB) gin.HandlerFunc {
+// threadReadPositionSQL позиция курсора подписчика в треде: время сообщения, на котором он стоит
+const threadReadPositionSQL = "COALESCE((SELECT lr.created_at FROM messages lr WHERE lr.id = thread_followers.last_read_message_id), '-infinity'::timestamptz)"
+
+const maxThreadNameLength = 100
+
+// threadForMember тред, доступный пользователю для чтения
+func threadForMember(db *gorm.DB, threadID, userID string) (models.Thread, int, string) {
+	var thread models.Thread
+	if err := db.First(&thread, "id = ?", threadID).Error; err != nil {
+		return thread, http.StatusNotFound, "not_found"
+	}
+	if !authz.Can(userID, authz.Chat(thread.ChatID), authz.ViewChannel|authz.ReadHistory) {
+		return thread, http.StatusForbidden, "forbidden"
+	}
+	return thread, 0, ""
+}
+
+// threadPayload сводка треда: число ответов, последний ответ, архив и блокировка.
+// avatar определяет, какой аватар автора последнего ответа видит получатель
+func threadPayload(thread models.Thread, lastReply *models.Message, avatar func(models.User) string) gin.H {
+	item := gin.H{
+		"id":            thread.ID,
+		"chatId":        thread.ChatID,
+		"rootMessageId": thread.RootMessageID,
+		"name":          thread.Name,
+		"createdBy":     thread.CreatedBy,
+		"replyCount":    thread.ReplyCount,
+		"lastReplyAt":   thread.LastReplyAt,
+		"archived":      thread.ArchivedAt != nil,
+		"archivedAt":    thread.ArchivedAt,
+		"locked":        thread.LockedAt != nil,
+		"lockedAt":      thread.LockedAt,
+		"createdAt":     thread.CreatedAt,
+	}
+	if lastReply != nil {
+		item["lastReply"] = gin.H{
+			"id":        lastReply.ID,
+			"senderId":  lastReply.SenderID,
+			"text":      lastReply.Text,
+			"entities":  messageEntities(*lastReply),
+			"createdAt": lastReply.CreatedAt,
+			"sender": gin.H{
+				"id":        lastReply.Sender.ID,
+				"username":  lastReply.Sender.Username,
+				"avatarUrl": avatar(lastReply.Sender),
+			},
+		}
+	}
+	return item
+}
+
+// threadPayloads сводки тредов фиксированным числом запросов; с viewerID — вместе
+// с подпиской и непрочитанными ответами зрителя
+func threadPayloads(db *gorm.DB, threads []models.Thread, viewerID string) []gin.H {
+	result := make([]gin.H, 0, len(threads))
+	if len(threads) == 0 {
+		return result
+	}
+
+	threadIDs := make([]string, len(threads))
+	lastIDs := make([]string, 0, len(threads))
+	for i, thread := range threads {
+		threadIDs[i] = thread.ID
+		if thread.LastReplyID != "" {
+			lastIDs = append(lastIDs, thread.LastReplyID)
+		}
+	}
+
+	lastByID := make(map[string]*models.Message, len(lastIDs))
+	var replies []models.Message
+	if len(lastIDs) > 0 {
+		db.Where("id IN ?", lastIDs).Preload("Sender").Find(&replies)
+		for i := range replies {
+			lastByID[replies[i].ID] = &replies[i]
+		}
+	}
+	// Без зрителя сводка рассылается всему чату — только общедоступные аватары
+	avatar := publicAvatar
+	if viewerID != "" {
+		avatar = senderPrivacyView(db, viewerID, replies).avatar
+	}
+
+	followerByThread := make(map[string]models.ThreadFollower)
+	if viewerID != "" {
+		var followers []models.ThreadFollower
+		db.Where("thread_id IN ? AND user_id = ?", threadIDs, viewerID).Find(&followers)
+		for _, follower := range followers {
+			followerByThread[follower.ThreadID] = follower
+		}
+	}
+
+	for _, thread := range threads {
+		item := threadPayload(thread, lastByID[thread.LastReplyID], avatar)
+		if viewerID != "" {
+			follower, following := followerByThread[thread.ID]
+			item["following"] = following
+			item["unreadCount"] = follower.UnreadCount
+			item["lastReadMessageId"] = follower.LastReadMessageID
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+// rootThreads сводки тредов для корневых сообщений страницы: rootMessageID → сводка
+func rootThreads(db *gorm.DB, messages []models.Message, viewerID string) map[string]gin.H {
+	rootIDs := make([]string, 0, len(messages))
+	for _, message := range messages {
+		rootIDs = append(rootIDs, message.ID)
+	}
+	result := make(map[string]gin.H)
+	if len(rootIDs) == 0 {
+		return result
+	}
+	var threads []models.Thread
+	db.Where("root_message_id IN ?", rootIDs).Find(&threads)
+	for _, item := range threadPayloads(db, threads, viewerID) {
+		result[item["rootMessageId"].(string)] = item
+	}
+	return result
+}
+
+// broadcastThreadEvent рассылает сводку треда всему чату: счетчик ответов виден под корневым сообщением
+func broadcastThreadEvent(db *gorm.DB, wsHub *websocket.Hub, thread models.Thread, eventType string) {
+	wsHub.BroadcastToChat(thread.ChatID, wsEvent(eventType, threadPayloads(db, []models.Thread{thread}, "")[0]))
+}
+
+// refreshThreadSummary пересчитывает число ответов и последний ответ треда и рассылает сводку
+func refreshThreadSummary(db *gorm.DB, wsHub *websocket.Hub, threadID string) {
+	if threadID == "" {
+		return
+	}
+	visible := db.Model(&models.Message{}).
+		Where("thread_id = ? AND deleted_at IS NULL AND moderation_status = 'approved'", threadID)
+	var count int64
+	visible.Session(&gorm.Session{}).Count(&count)
+
+	updates := map[string]interface{}{"reply_count": count, "last_reply_id": "", "last_reply_at": nil}
+	var last models.Message
+	if err := visible.Session(&gorm.Session{}).Select("id", "created_at").Order("created_at DESC").First(&last).Error; err == nil {
+		updates["last_reply_id"] = last.ID
+		updates["last_reply_at"] = last.CreatedAt
+	}
+	db.Model(&models.Thread{}).Where("id = ?", threadID).Updates(updates)
+
+	var thread models.Thread
+	if err := db.First(&thread, "id = ?", threadID).Error; err == nil {
+		broadcastThreadEvent(db, wsHub, thread, "thread:update")
+	}
+}
+
+// threadFollowerIDs подписчики треда, остающиеся участниками чата
+func threadFollowerIDs(db *gorm.DB, threadID string) []string {
+	var ids []string
+	db.Table("thread_followers f").
+		Joins("JOIN chat_members m ON m.chat_id = f.chat_id AND m.user_id = f.user_id AND m.deleted_at IS NULL").
+		Where("f.thread_id = ?", threadID).
+		Pluck("f.user_id", &ids)
+	return ids
+}
+
+// broadcastMessageEvent рассылает событие сообщения: ответы в тредах получают только подписчики треда
+func broadcastMessageEvent(db *gorm.DB, wsHub *websocket.Hub, message models.Message, payload []byte) {
+	if message.ThreadID == "" {
+		wsHub.BroadcastToChat(message.ChatID, payload)
+		return
+	}
+	wsHub.SendToUsers(threadFollowerIDs(db, message.ThreadID), payload)
+}
+
+// followThread подписывает пользователя на тред с курсором на readUpTo ("" — с начала).
+// Возвращает false, если подписка уже есть
+func followThread(db *gorm.DB, thread models.Thread, userID, readUpTo string) bool {
+	var existing models.ThreadFollower
+	if err := db.Where("thread_id = ? AND user_id = ?", thread.ID, userID).First(&existing).Error; err == nil {
+		return false
+	}
+	follower := models.ThreadFollower{
+		ID:                uuid.New().String(),
+		ThreadID:          thread.ID,
+		UserID:            userID,
+		ChatID:            thread.ChatID,
+		LastReadMessageID: readUpTo,
+	}
+	if readUpTo != "" {
+		now := time.Now()
+		follower.LastReadAt = &now
+	}
+	return db.Create(&follower).Error == nil
+}
+
+// threadRepliesAfter видимые ответы других участников в треде после момента after
+func threadRepliesAfter(db *gorm.DB, threadID, userID string, after time.Time) int64 {
+	var count int64
+	db.Model(&models.Message{}).
+		Where("thread_id = ? AND sender_id <> ? AND deleted_at IS NULL AND moderation_status = 'approved' AND created_at > ?", threadID, userID, after).
+		Count(&count)
+	return count
+}
+
+// advanceThreadCursor двигает курсор подписчика в треде вперед до message и пересчитывает непрочитанные
+func advanceThreadCursor(db *gorm.DB, threadID, userID string, message models.Message) (bool, error) {
+	result := db.Model(&models.ThreadFollower{}).
+		Where("thread_id = ? AND user_id = ?", threadID, userID).
+		Where(threadReadPositionSQL+" < ?", message.CreatedAt).
+		Updates(map[string]interface{}{
+			"last_read_message_id": message.ID,
+			"last_read_at":         time.Now(),
+			"unread_count":         threadRepliesAfter(db, threadID, userID, message.CreatedAt),
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// bumpThreadUnread новый видимый ответ: автор и упомянутые подписываются на тред,
+// остальным подписчикам добавляется непрочитанный ответ; архивный тред возвращается в активные
+func bumpThreadUnread(db *gorm.DB, message models.Message) {
+	var thread models.Thread
+	if err := db.First(&thread, "id = ?", message.ThreadID).Error; err != nil {
+		return
+	}
+	if !followThread(db, thread, message.SenderID, message.ID) {
+		advanceThreadCursor(db, thread.ID, message.SenderID, message)
+	}
+	var mentioned []string
+	db.Model(&models.MessageMention{}).Where("message_id = ? AND kind = ?", message.ID, mentionUser).Pluck("user_id", &mentioned)
+	for _, userID := range mentioned {
+		followThread(db, thread, userID, thread.LastReplyID)
+	}
+
+	db.Model(&models.ThreadFollower{}).
+		Where("thread_id = ? AND user_id <> ?", thread.ID, message.SenderID).
+		UpdateColumn("unread_count", gorm.Expr("unread_count + 1"))
+	if thread.ArchivedAt != nil {
+		db.Model(&thread).Updates(map[string]interface{}{"archived_at": nil, "archived_by": ""})
+	}
+}
+
+// dropThreadUnread удаленный ответ снимается со счетчиков подписчиков, еще не прочитавших его
+func dropThreadUnread(db *gorm.DB, message models.Message) {
+	db.Model(&models.ThreadFollower{}).
+		Where("thread_id = ? AND user_id <> ? AND unread_count > 0", message.ThreadID, message.SenderID).
+		Where(threadReadPositionSQL+" < ?", message.CreatedAt).
+		UpdateColumn("unread_count", gorm.Expr("unread_count - 1"))
+}
+
+// CreateThread создает тред у сообщения; для сообщения с тредом возвращает существующий
+func CreateThread(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		chatID := c.Param("id")
 		userID, _ := c.Get("userID")
@@ -26,6 +276,10 @@ func CreateThread(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
+		if !authz.Can(userIDStr, authz.Chat(chatID), authz.SendMessages) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden", "detail": "cannot_send_messages"})
+			return
+		}
 
 		var req struct {
 			RootMessageID string `json:"rootMessageId" binding:"required"`
@@ -36,12 +290,34 @@ func CreateThread(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
 			return
 		}
+		req.Name = strings.TrimSpace(req.Name)
+		if len([]rune(req.Name)) > maxThreadNameLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_name"})
+			return
+		}
+
+		var root models.Message
+		if err := db.First(&root, "id = ? AND chat_id = ? AND deleted_at IS NULL", req.RootMessageID, chatID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "message_not_found"})
+			return
+		}
+		if root.ThreadID != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "nested_thread"})
+			return
+		}
+
+		var existing models.Thread
+		if err := db.Where("root_message_id = ?", root.ID).First(&existing).Error; err == nil {
+			c.JSON(http.StatusOK, gin.H{"thread": threadPayloads(db, []models.Thread{existing}, userIDStr)[0]})
+			return
+		}
 
 		thread := models.Thread{
-			ID:           uuid.New().String(),
-			ChatID:       chatID,
-			RootMessageID: req.RootMessageID,
-			Name:         req.Name,
+			ID:            uuid.New().String(),
+			ChatID:        chatID,
+			RootMessageID: root.ID,
+			Name:          req.Name,
+			CreatedBy:     userIDStr,
 		}
 
 		if err := db.Create(&thread).Error; err != nil {
@@ -49,11 +325,19 @@ func CreateThread(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"thread": thread})
+		// Создатель треда и автор сообщения следят за ответами
+		followThread(db, thread, userIDStr, "")
+		if root.SenderID != userIDStr {
+			followThread(db, thread, root.SenderID, "")
+		}
+		broadcastThreadEvent(db, wsHub, thread, "thread:create")
+
+		c.JSON(http.StatusOK, gin.H{"thread": threadPayloads(db, []models.Thread{thread}, userIDStr)[0]})
 	}
 }
 
-// GetThreads возвращает треды чата
+// GetThreads возвращает треды чата, начиная с недавно активных.
+// Параметры: archived=include|only (по умолчанию архивные скрыты), limit
 func GetThreads(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		chatID := c.Param("id")
@@ -65,46 +349,103 @@ func GetThreads(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// Проверяем доступ
-		var member models.ChatMember
-		if err := db.Where("chat_id = ? AND user_id = ?", chatID, userIDStr).First(&member).Error; err != nil {
+		if !authz.Can(userIDStr, authz.Chat(chatID), authz.ViewChannel|authz.ReadHistory) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
 
+		limit := 50
+		if parsed := parseInt(c.Query("limit")); parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+
+		query := db.Where("chat_id = ?", chatID)
+		switch c.Query("archived") {
+		case "include":
+		case "only":
+			query = query.Where("archived_at IS NOT NULL")
+		default:
+			query = query.Where("archived_at IS NULL")
+		}
+
 		var threads []models.Thread
-		if err := db.Where("chat_id = ?", chatID).Find(&threads).Error; err != nil {
+		if err := query.Order("COALESCE(last_reply_at, created_at) DESC").Limit(limit).Find(&threads).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
 			return
 		}
 
-		// Добавляем статистику
-		result := make([]gin.H, len(threads))
-		for i, thread := range threads {
-			var count int64
-			db.Model(&models.Message{}).Where("thread_id = ?", thread.ID).Count(&count)
-			
-			var lastMessage models.Message
-			db.Where("thread_id = ?", thread.ID).Order("created_at DESC").First(&lastMessage)
-
-			result[i] = gin.H{
-				"id":           thread.ID,
-				"chatId":       thread.ChatID,
-				"rootMessageId": thread.RootMessageID,
-				"name":         thread.Name,
-				"createdAt":    thread.CreatedAt,
-				"messageCount": count,
-				"lastMessage":  lastMessage,
+		c.JSON(http.StatusOK, gin.H{"threads": threadPayloads(db, threads, userIDStr)})
+	}
+}
+
+// GetThreadMessages возвращает ответы треда по возрастанию времени.
+// Параметры: limit, before или after (ID ответа) — страница до или после него
+func GetThreadMessages(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		threadID := c.Param("id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		thread, status, code := threadForMember(db, threadID, userIDStr)
+		if status != 0 {
+			c.JSON(status, gin.H{"error": code})
+			return
+		}
+
+		limit := 100
+		if parsed := parseInt(c.Query("limit")); parsed > 0 && parsed <= 200 {
+			limit = parsed
+		}
+
+		query := db.Where("thread_id = ? AND deleted_at IS NULL", threadID).
+			Where(notHiddenSQL, userIDStr).
+			Preload("Sender").
+			Limit(limit)
+		if !authz.Can(userIDStr, authz.Chat(thread.ChatID), authz.ManageMessages) {
+			query = query.Where("(moderation_status = 'approved' OR sender_id = ?)", userIDStr)
+		}
+
+		var messages []models.Message
+		var anchor models.Message
+		newestFirst := false
+		if beforeID := c.Query("before"); beforeID != "" && db.First(&anchor, "id = ? AND thread_id = ?", beforeID, threadID).Error == nil {
+			query = query.Where("created_at < ?", anchor.CreatedAt).Order("created_at DESC")
+			newestFirst = true
+		} else if afterID := c.Query("after"); afterID != "" && db.First(&anchor, "id = ? AND thread_id = ?", afterID, threadID).Error == nil {
+			query = query.Where("created_at > ?", anchor.CreatedAt).Order("created_at ASC")
+		} else {
+			query = query.Order("created_at ASC")
+		}
+		if err := query.Find(&messages).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		if newestFirst {
+			for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+				messages[i], messages[j] = messages[j], messages[i]
 			}
 		}
 
-		c.JSON(http.StatusOK, gin.H{"threads": result})
+		messageIDs := make([]string, len(messages))
+		for i, message := range messages {
+			messageIDs[i] = message.ID
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"thread":    threadPayloads(db, []models.Thread{thread}, userIDStr)[0],
+			"messages":  messageViews(db, userIDStr, messages),
+			"reactions": reactionSummaries(db, messageIDs, userIDStr),
+		})
 	}
 }
 
-// GetThreadMessages возвращает сообщения треда
-func GetThreadMessages(db *gorm.DB) gin.HandlerFunc {
+// UpdateThread переименовывает тред (создатель или модератор), архивирует и закрывает его (модератор)
+func UpdateThread(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		threadID := c.Param("id")
 		userID, _ := c.Get("userID")
 		userIDStr, ok := userID.(string)
 		if !ok {
@@ -112,32 +453,265 @@ func GetThreadMessages(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var thread models.Thread
-		if err := db.First(&thread, "id = ?", threadID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+		thread, status, code := threadForMember(db, c.Param("id"), userIDStr)
+		if status != 0 {
+			c.JSON(status, gin.H{"error": code})
 			return
 		}
 
-		// Проверяем доступ к чату
-		var member models.ChatMember
-		if err := db.Where("chat_id = ? AND user_id = ?", thread.ChatID, userIDStr).First(&member).Error; err != nil {
+		var req struct {
+			Name     *string `json:"name"`
+			Archived *bool   `json:"archived"`
+			Locked   *bool   `json:"locked"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		moderator := authz.Can(userIDStr, authz.Chat(thread.ChatID), authz.ManageMessages)
+		if (req.Archived != nil || req.Locked != nil) && !moderator {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		if req.Name != nil && thread.CreatedBy != userIDStr && !moderator {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
 
-		var messages []models.Message
-		if err := db.Where("thread_id = ? AND deleted_at IS NULL", threadID).
-			Preload("Sender").
-			Preload("Reactions").
-			Preload("Reactions.User").
-			Order("created_at ASC").
-			Limit(100).
-			Find(&messages).Error; err != nil {
+		now := time.Now()
+		updates := make(map[string]interface{})
+		actions := make([]string, 0, 2)
+		if req.Name != nil {
+			name := strings.TrimSpace(*req.Name)
+			if len([]rune(name)) > maxThreadNameLength {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_name"})
+				return
+			}
+			updates["name"] = name
+		}
+		if req.Archived != nil && *req.Archived != (thread.ArchivedAt != nil) {
+			if *req.Archived {
+				updates["archived_at"], updates["archived_by"] = now, userIDStr
+				actions = append(actions, "thread_archived")
+			} else {
+				updates["archived_at"], updates["archived_by"] = nil, ""
+				actions = append(actions, "thread_unarchived")
+			}
+		}
+		if req.Locked != nil && *req.Locked != (thread.LockedAt != nil) {
+			if *req.Locked {
+				updates["locked_at"], updates["locked_by"] = now, userIDStr
+				actions = append(actions, "thread_locked")
+			} else {
+				updates["locked_at"], updates["locked_by"] = nil, ""
+				actions = append(actions, "thread_unlocked")
+			}
+		}
+
+		if len(updates) > 0 {
+			if err := db.Model(&thread).Updates(updates).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+				return
+			}
+			db.First(&thread, "id = ?", thread.ID)
+			for _, action := range actions {
+				logModeration(db, thread.ChatID, "", userIDStr, action, "", thread.RootMessageID, gin.H{"threadId": thread.ID})
+			}
+			broadcastThreadEvent(db, wsHub, thread, "thread:update")
+		}
+
+		c.JSON(http.StatusOK, gin.H{"thread": threadPayloads(db, []models.Thread{thread}, userIDStr)[0]})
+	}
+}
+
+// FollowThread подписывает текущего пользователя на тред; ответы до этого момента считаются прочитанными
+func FollowThread(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		thread, status, code := threadForMember(db, c.Param("id"), userIDStr)
+		if status != 0 {
+			c.JSON(status, gin.H{"error": code})
+			return
+		}
+
+		if followThread(db, thread, userIDStr, thread.LastReplyID) {
+			wsHub.SendToUser(userIDStr, wsEvent("thread:follow", gin.H{"threadId": thread.ID, "chatId": thread.ChatID, "following": true}))
+		}
+		c.JSON(http.StatusOK, gin.H{"following": true})
+	}
+}
+
+// UnfollowThread отписывает текущего пользователя от треда
+func UnfollowThread(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		thread, status, code := threadForMember(db, c.Param("id"), userIDStr)
+		if status != 0 {
+			c.JSON(status, gin.H{"error": code})
+			return
+		}
+
+		result := db.Where("thread_id = ? AND user_id = ?", thread.ID, userIDStr).Delete(&models.ThreadFollower{})
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		if result.RowsAffected > 0 {
+			wsHub.SendToUser(userIDStr, wsEvent("thread:follow", gin.H{"threadId": thread.ID, "chatId": thread.ChatID, "following": false}))
+		}
+		c.JSON(http.StatusOK, gin.H{"following": false})
+	}
+}
+
+// MarkThreadRead ставит курсор подписчика на последний ответ треда
+func MarkThreadRead(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"messages": messages})
+		thread, status, code := threadForMember(db, c.Param("id"), userIDStr)
+		if status != 0 {
+			c.JSON(status, gin.H{"error": code})
+			return
+		}
+
+		var latest models.Message
+		if err := db.First(&latest, "id = ?", thread.LastReplyID).Error; err != nil {
+			c.JSON(http.StatusOK, gin.H{"threadId": thread.ID, "unreadCount": 0})
+			return
+		}
+		advanced, err := advanceThreadCursor(db, thread.ID, userIDStr, latest)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		if advanced {
+			wsHub.SendToUser(userIDStr, wsEvent("thread:read", gin.H{
+				"threadId":          thread.ID,
+				"chatId":            thread.ChatID,
+				"lastReadMessageId": latest.ID,
+				"unreadCount":       0,
+			}))
+		}
+		c.JSON(http.StatusOK, gin.H{"threadId": thread.ID, "lastReadMessageId": latest.ID, "unreadCount": 0})
 	}
 }
 
+// GetFollowedThreads входящие треды: на которые подписан пользователь, по последнему ответу.
+// Параметры: unread=true, archived=include, limit, before (мс) — треды с ответом раньше момента
+func GetFollowedThreads(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		limit := 30
+		if parsed := parseInt(c.Query("limit")); parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+
+		const activitySQL = "COALESCE(threads.last_reply_at, threads.created_at)"
+		followed := func() *gorm.DB {
+			return db.Model(&models.Thread{}).
+				Joins("JOIN thread_followers f ON f.thread_id = threads.id AND f.user_id = ?", userIDStr).
+				Joins("JOIN chat_members m ON m.chat_id = threads.chat_id AND m.user_id = f.user_id AND m.deleted_at IS NULL")
+		}
+		query := followed()
+		if c.Query("archived") != "include" {
+			query = query.Where("threads.archived_at IS NULL")
+		}
+		if c.Query("unread") == "true" {
+			query = query.Where("f.unread_count > 0")
+		}
+		if before, err := strconv.ParseInt(c.Query("before"), 10, 64); err == nil && before > 0 {
+			query = query.Where(activitySQL+" < ?", time.UnixMilli(before))
+		}
+
+		var threads []models.Thread
+		if err := query.Order(activitySQL + " DESC").Limit(limit).Find(&threads).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		chatIDs := make([]string, 0, len(threads))
+		rootIDs := make([]string, 0, len(threads))
+		for _, thread := range threads {
+			chatIDs = append(chatIDs, thread.ChatID)
+			rootIDs = append(rootIDs, thread.RootMessageID)
+		}
+		chats := make(map[string]models.Chat)
+		roots := make(map[string]models.Message)
+		var rootList []models.Message
+		if len(threads) > 0 {
+			var chatList []models.Chat
+			db.Select("id", "type", "name", "avatar_url").Where("id IN ?", chatIDs).Find(&chatList)
+			for _, chat := range chatList {
+				chats[chat.ID] = chat
+			}
+			db.Where("id IN ? AND deleted_at IS NULL", rootIDs).Preload("Sender").Find(&rootList)
+			for _, root := range rootList {
+				roots[root.ID] = root
+			}
+		}
+
+		items := threadPayloads(db, threads, userIDStr)
+		rootView := senderPrivacyView(db, userIDStr, rootList)
+		for i, thread := range threads {
+			chat := chats[thread.ChatID]
+			items[i]["chat"] = gin.H{
+				"id":        chat.ID,
+				"type":      chat.Type,
+				"name":      chat.Name,
+				"avatarUrl": chat.AvatarURL,
+			}
+			if root, ok := roots[thread.RootMessageID]; ok {
+				items[i]["rootMessage"] = gin.H{
+					"id":        root.ID,
+					"senderId":  root.SenderID,
+					"text":      root.Text,
+					"entities":  messageEntities(root),
+					"createdAt": root.CreatedAt,
+					"sender": gin.H{
+						"id":        root.Sender.ID,
+						"username":  root.Sender.Username,
+						"avatarUrl": rootView.avatar(root.Sender),
+					},
+				}
+			}
+		}
+
+		var unreadThreads int64
+		followed().Where("threads.archived_at IS NULL AND f.unread_count > 0").Count(&unreadThreads)
+
+		response := gin.H{"threads": items, "unreadThreads": unreadThreads}
+		if len(threads) == limit {
+			last := threads[len(threads)-1]
+			activity := last.CreatedAt
+			if last.LastReplyAt != nil {
+				activity = *last.LastReplyAt
+			}
+			response["nextBefore"] = activity.UnixMilli()
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"safegram-server/internal/authz"
 	"safegram-server/internal/models"
 	"safegram-server/internal/websocket"
 )
@@ -26,6 +27,9 @@ func init() {
 	os.MkdirAll(filepath.Join(uploadsDir, "avatars"), 0755)
 	os.MkdirAll(filepath.Join(uploadsDir, "attachments"), 0755)
 	os.MkdirAll(filepath.Join(uploadsDir, "stickers"), 0755)
+	os.MkdirAll(filepath.Join(uploadsDir, "stories"), 0755)
+	os.MkdirAll(filepath.Join(uploadsDir, "previews"), 0755)
+	os.MkdirAll(filepath.Join(uploadsDir, "emoji"), 0755)
 }
 
 // UploadAvatar загружает аватар пользователя
@@ -103,6 +107,18 @@ func UploadAttachment(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
+		if !authz.Can(userIDStr, authz.Chat(chatID), authz.SendMessages|authz.AttachFiles) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden", "detail": "cannot_attach_files"})
+			return
+		}
+		if dmBlocked(db, chatID, userIDStr) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "blocked"})
+			return
+		}
+		if restriction := sendRestriction(db, chatID, userIDStr); restriction != nil {
+			c.JSON(http.StatusForbidden, restriction)
+			return
+		}
 
 		file, err := c.FormFile("file")
 		if err != nil {
@@ -143,13 +159,18 @@ func UploadAttachment(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
 			return
 		}
+		bumpUnread(db, message)
+		refreshChatSummary(db, message.ChatID)
 
 		// Загружаем полную информацию о сообщении
-		db.Preload("Sender").Preload("Reactions").First(&message, "id = ?", message.ID)
+		db.Preload("Sender").First(&message, "id = ?", message.ID)
+		message.Sender.AvatarURL = publicAvatar(message.Sender)
 
 		// Отправляем через WebSocket
 		messageJSON, _ := json.Marshal(gin.H{"type": "message", "data": message})
 		wsHub.BroadcastToChat(chatID, messageJSON)
+		go deliverToConnected(db, wsHub, message)
+		go attachLinkPreview(db, wsHub, message)
 
 		c.JSON(http.StatusOK, gin.H{"message": message})
 	}
@@ -7,7 +7,6 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"safegram-server/internal/models"
-	"safegram-server/internal/redis"
 )
 
 // GetCurrentUser возвращает текущего пользователя
@@ -43,26 +42,19 @@ func GetCurrentUser(db *gorm.DB) gin.HandlerFunc {
 // GetUsers возвращает список всех пользователей (для загрузки контактов)
 func GetUsers(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, _ := userID.(string)
+
+		// Заблокировавшие текущего пользователя в список не попадают
 		var users []models.User
-		if err := db.Limit(1000).Find(&users).Error; err != nil {
+		if err := db.Where("id NOT IN (?)", db.Model(&models.UserBlock{}).Select("blocker_id").Where("blocked_id = ?", userIDStr)).
+			Limit(1000).Find(&users).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
 			return
 		}
 
-		result := make([]gin.H, len(users))
-		for i, user := range users {
-			// Проверяем онлайн статус через Redis
-			isOnline, _ := redis.IsOnline(user.ID)
-			result[i] = gin.H{
-				"id":       user.ID,
-				"username": user.Username,
-				"avatarUrl": user.AvatarURL,
-				"status":   user.Status,
-				"isOnline": isOnline,
-			}
-		}
-
-		c.JSON(http.StatusOK, gin.H{"users": result})
+		// Онлайн статус и приватные поля — по настройкам приватности
+		c.JSON(http.StatusOK, gin.H{"users": publicUsers(db, userIDStr, users)})
 	}
 }
 
@@ -75,29 +67,20 @@ func SearchUsers(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		userID, _ := c.Get("userID")
+		userIDStr, _ := userID.(string)
+
 		var users []models.User
 		searchTerm := "%" + strings.ToLower(query) + "%"
 		if err := db.Where("LOWER(username) LIKE ?", searchTerm).
+			Where("id NOT IN (?)", db.Model(&models.UserBlock{}).Select("blocker_id").Where("blocked_id = ?", userIDStr)).
 			Limit(20).
 			Find(&users).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
 			return
 		}
 
-		result := make([]gin.H, len(users))
-		for i, user := range users {
-			// Проверяем онлайн статус через Redis
-			isOnline, _ := redis.IsOnline(user.ID)
-			result[i] = gin.H{
-				"id":       user.ID,
-				"username": user.Username,
-				"avatarUrl": user.AvatarURL,
-				"status":   user.Status,
-				"isOnline": isOnline,
-			}
-		}
-
-		c.JSON(http.StatusOK, gin.H{"users": result})
+		c.JSON(http.StatusOK, gin.H{"users": publicUsers(db, userIDStr, users)})
 	}
 }
 
@@ -3,7 +3,6 @@ package api
 import (
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
@@ -96,29 +95,15 @@ func UpdateUserStatus(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		allowedStatuses := []string{"online", "offline", "away", "busy", "invisible"}
-		valid := false
-		for _, s := range allowedStatuses {
-			if req.Status == s {
-				valid = true
-				break
-			}
-		}
+		// online | idle | dnd | invisible; старые away/busy/offline приводятся к ним
+		mode, valid := presenceMode(req.Status)
 		if !valid {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request", "detail": "Invalid status"})
 			return
 		}
 
-		now := time.Now()
-		updates := map[string]interface{}{
-			"status": req.Status,
-		}
-		if req.Status == "offline" {
-			updates["last_seen"] = &now
-		}
-
-		db.Model(&models.User{}).Where("id = ?", userIDStr).Updates(updates)
-		c.JSON(http.StatusOK, gin.H{"ok": true, "status": req.Status})
+		setPresenceMode(userIDStr, mode)
+		c.JSON(http.StatusOK, gin.H{"ok": true, "status": mode})
 	}
 }
 
@@ -166,11 +151,12 @@ func ChangePassword(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// GetUserProfile возвращает профиль пользователя
+// GetUserProfile возвращает профиль пользователя с учетом его настроек приватности
 func GetUserProfile(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.Param("id")
 		currentUserID, _ := c.Get("userID")
+		currentUserIDStr, _ := currentUserID.(string)
 
 		var user models.User
 		if err := db.First(&user, "id = ?", userID).Error; err != nil {
@@ -178,44 +164,22 @@ func GetUserProfile(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Если это не свой профиль, скрываем приватные данные
-		if userID != currentUserID {
-			if !user.ShowAvatar {
-				user.AvatarURL = ""
-			}
-			if !user.ShowBio {
-				user.About = ""
-			}
+		// Свой профиль отдаем целиком
+		if userID == currentUserIDStr {
+			c.JSON(http.StatusOK, gin.H{"user": user})
+			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"user": user})
-	}
-}
-
-// GetUserNotifications возвращает настройки уведомлений
-func GetUserNotifications(db *gorm.DB) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Пока возвращаем дефолтные настройки
-		c.JSON(http.StatusOK, gin.H{
-			"notifications": gin.H{
-				"messages":      true,
-				"mentions":      true,
-				"reactions":     false,
-				"calls":         true,
-				"groups":        true,
-				"servers":       true,
-				"email":         false,
-				"push":          true,
-			},
-		})
-	}
-}
+		view := newPrivacyView(db, currentUserIDStr, []string{user.ID})
+		profile := view.publicUser(user)
+		profile["plan"] = user.Plan
+		profile["createdAt"] = user.CreatedAt
+		blocked := view.blocked[user.ID] || view.blockedBy[user.ID]
+		profile["canCall"] = !blocked && view.allows(user, user.PrivacyCalls)
+		profile["canAddToGroups"] = !blocked && view.allows(user, user.PrivacyGroupAdd)
+		profile["canMessage"] = !blocked
 
-// UpdateUserNotifications обновляет настройки уведомлений
-func UpdateUserNotifications(db *gorm.DB) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Пока просто подтверждаем
-		c.JSON(http.StatusOK, gin.H{"ok": true})
+		c.JSON(http.StatusOK, gin.H{"user": profile})
 	}
 }
 
@@ -236,13 +200,19 @@ func GetUserPrivacy(db *gorm.DB) gin.HandlerFunc {
 			"privacy": gin.H{
 				"showBio":    user.ShowBio,
 				"showAvatar": user.ShowAvatar,
-				"lastSeen":   "everyone", // можно расширить
+				"lastSeen":   privacyRule(user.PrivacyLastSeen),
+				"avatar":     avatarRule(user),
+				"bio":        bioRule(user),
+				"calls":      privacyRule(user.PrivacyCalls),
+				"groupAdd":   privacyRule(user.PrivacyGroupAdd),
+				// Превью ссылок из сообщений пользователя (сервер обращается к сайту по ссылке)
+				"linkPreviews": user.LinkPreviews,
 			},
 		})
 	}
 }
 
-// UpdateUserPrivacy обновляет настройки приватности
+// UpdateUserPrivacy обновляет настройки приватности (everyone | contacts | nobody)
 func UpdateUserPrivacy(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, _ := c.Get("userID")
@@ -253,8 +223,14 @@ func UpdateUserPrivacy(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		var req struct {
-			ShowBio    *bool `json:"showBio"`
-			ShowAvatar *bool `json:"showAvatar"`
+			ShowBio      *bool   `json:"showBio"`
+			ShowAvatar   *bool   `json:"showAvatar"`
+			LastSeen     *string `json:"lastSeen"`
+			Avatar       *string `json:"avatar"`
+			Bio          *string `json:"bio"`
+			Calls        *string `json:"calls"`
+			GroupAdd     *string `json:"groupAdd"`
+			LinkPreviews *bool   `json:"linkPreviews"`
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -265,9 +241,50 @@ func UpdateUserPrivacy(db *gorm.DB) gin.HandlerFunc {
 		updates := make(map[string]interface{})
 		if req.ShowBio != nil {
 			updates["show_bio"] = *req.ShowBio
+			if *req.ShowBio {
+				updates["privacy_bio"] = models.PrivacyEveryone
+			} else {
+				updates["privacy_bio"] = models.PrivacyNobody
+			}
 		}
 		if req.ShowAvatar != nil {
 			updates["show_avatar"] = *req.ShowAvatar
+			if *req.ShowAvatar {
+				updates["privacy_avatar"] = models.PrivacyEveryone
+			} else {
+				updates["privacy_avatar"] = models.PrivacyNobody
+			}
+		}
+
+		rules := []struct {
+			value  *string
+			column string
+		}{
+			{req.LastSeen, "privacy_last_seen"},
+			{req.Avatar, "privacy_avatar"},
+			{req.Bio, "privacy_bio"},
+			{req.Calls, "privacy_calls"},
+			{req.GroupAdd, "privacy_group_add"},
+		}
+		for _, rule := range rules {
+			if rule.value == nil {
+				continue
+			}
+			if !validPrivacyRule(*rule.value) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_rule"})
+				return
+			}
+			updates[rule.column] = *rule.value
+		}
+		// Старые флаги остаются согласованными с правилами
+		if req.Avatar != nil {
+			updates["show_avatar"] = *req.Avatar != models.PrivacyNobody
+		}
+		if req.Bio != nil {
+			updates["show_bio"] = *req.Bio != models.PrivacyNobody
+		}
+		if req.LinkPreviews != nil {
+			updates["link_previews"] = *req.LinkPreviews
 		}
 
 		if len(updates) > 0 {
@@ -277,4 +294,3 @@ func UpdateUserPrivacy(db *gorm.DB) gin.HandlerFunc {
 		c.JSON(http.StatusOK, gin.H{"ok": true})
 	}
 }
-
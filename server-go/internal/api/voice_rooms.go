@@ -1,16 +1,164 @@
 package api
 
 import (
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"safegram-server/internal/authz"
 	"safegram-server/internal/models"
+	"safegram-server/internal/redis"
+	"safegram-server/internal/websocket"
 )
 
-// CreateVoiceRoom создает голосовую комнату
-func CreateVoiceRoom(db *gorm.DB) gin.HandlerFunc {
+// voiceRoomReminderLead за сколько до начала напоминать о запланированной комнате
+const voiceRoomReminderLead = 10 * time.Minute
+
+// voiceRoomRole роль пользователя в комнате: "host" | "speaker" | "listener"
+func voiceRoomRole(room models.VoiceRoom, state *redis.VoiceRoomState, userID string) string {
+	if room.CreatedBy == userID {
+		return "host"
+	}
+	if state != nil {
+		if role := state.Roles[userID]; role != "" {
+			return role
+		}
+	}
+	// В обычной голосовой комнате говорят все
+	if room.Kind != "stage" {
+		return "speaker"
+	}
+	return "listener"
+}
+
+// currentVoiceRoomRole роль пользователя без загрузки всего состояния
+func currentVoiceRoomRole(room models.VoiceRoom, userID string) string {
+	role, _ := redis.GetVoiceRoomRole(room.ID, userID)
+	return voiceRoomRole(room, &redis.VoiceRoomState{Roles: map[string]string{userID: role}}, userID)
+}
+
+// voiceRoomHost ведущий комнаты: создатель, назначенный host или управляющий каналами
+func voiceRoomHost(room models.VoiceRoom, userID string) bool {
+	if room.CreatedBy == userID || authz.Can(userID, authz.Chat(room.ChatID), authz.ManageChannels) {
+		return true
+	}
+	role, _ := redis.GetVoiceRoomRole(room.ID, userID)
+	return role == "host"
+}
+
+// voiceRoomPayload комната вместе с живым состоянием и списком участников
+func voiceRoomPayload(db *gorm.DB, room models.VoiceRoom) gin.H {
+	payload := gin.H{
+		"id":          room.ID,
+		"chatId":      room.ChatID,
+		"createdBy":   room.CreatedBy,
+		"kind":        room.Kind,
+		"topic":       room.Topic,
+		"status":      room.Status,
+		"scheduledAt": room.ScheduledAt,
+		"startedAt":   room.StartedAt,
+		"isActive":    room.IsActive,
+		"createdAt":   room.CreatedAt,
+	}
+	if room.Status != "live" {
+		return payload
+	}
+
+	state, err := redis.GetVoiceRoomState(room.ID)
+	if err != nil {
+		log.Printf("Voice room state unavailable: %v", err)
+		payload["participants"] = []gin.H{}
+		payload["hands"] = []string{}
+		return payload
+	}
+
+	userIDs := make([]string, 0, len(state.Present))
+	for userID := range state.Present {
+		userIDs = append(userIDs, userID)
+	}
+	var users []models.User
+	if len(userIDs) > 0 {
+		db.Where("id IN ?", userIDs).Find(&users)
+	}
+
+	hands := make(map[string]bool, len(state.Hands))
+	for _, userID := range state.Hands {
+		hands[userID] = true
+	}
+
+	participants := make([]gin.H, 0, len(users))
+	for _, user := range users {
+		participants = append(participants, gin.H{
+			"userId":     user.ID,
+			"username":   user.Username,
+			"avatarUrl":  publicAvatar(user),
+			"role":       voiceRoomRole(room, state, user.ID),
+			"muted":      state.Muted[user.ID],
+			"handRaised": hands[user.ID],
+			"invited":    state.Invites[user.ID],
+			"joinedAt":   state.Present[user.ID] * 1000,
+		})
+	}
+	payload["participants"] = participants
+	payload["hands"] = state.Hands
+	return payload
+}
+
+// broadcastVoiceRoom рассылает участникам чата актуальное состояние комнаты
+func broadcastVoiceRoom(db *gorm.DB, wsHub *websocket.Hub, room models.VoiceRoom) {
+	if wsHub == nil {
+		return
+	}
+	wsHub.BroadcastToChat(room.ChatID, wsEvent("voice_room:state", voiceRoomPayload(db, room)))
+}
+
+// syncVoiceRoomAudio серверный mute в SFU: слушатели, заглушенные модератором
+// и участники без права speak не слышны
+func syncVoiceRoomAudio(room models.VoiceRoom, userID string) {
+	if sfuManager == nil {
+		return
+	}
+	state, err := redis.GetVoiceRoomState(room.ID)
+	if err != nil {
+		return
+	}
+	muted := state.Muted[userID] || voiceRoomRole(room, state, userID) == "listener" ||
+		!authz.Can(userID, authz.Chat(room.ChatID), authz.Speak)
+	sfuManager.Mute(room.ID, userID, muted)
+}
+
+// loadVoiceRoom комната по :roomId
+func loadVoiceRoom(c *gin.Context, db *gorm.DB) (models.VoiceRoom, bool) {
+	var room models.VoiceRoom
+	if err := db.First(&room, "id = ?", c.Param("roomId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+		return room, false
+	}
+	return room, true
+}
+
+// loadLiveVoiceRoom идущая комната, в которой пользователь состоит в чате
+func loadLiveVoiceRoom(c *gin.Context, db *gorm.DB, userID string) (models.VoiceRoom, bool) {
+	room, ok := loadVoiceRoom(c, db)
+	if !ok {
+		return room, false
+	}
+	if !authz.IsMember(userID, authz.Chat(room.ChatID)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return room, false
+	}
+	if room.Status != "live" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "room_not_live"})
+		return room, false
+	}
+	return room, true
+}
+
+// CreateVoiceRoom создает голосовую комнату; со scheduledAt — запланированную
+func CreateVoiceRoom(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		chatID := c.Param("id")
 		userID, _ := c.Get("userID")
@@ -20,33 +168,75 @@ func CreateVoiceRoom(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Проверяем доступ к чату
-		var member models.ChatMember
-		if err := db.Where("chat_id = ? AND user_id = ?", chatID, userIDStr).First(&member).Error; err != nil {
+		var req struct {
+			Kind        string `json:"kind"` // "voice" | "stage"
+			Topic       string `json:"topic"`
+			ScheduledAt int64  `json:"scheduledAt"` // мс
+		}
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+				return
+			}
+		}
+		if req.Kind != "stage" {
+			req.Kind = "voice"
+		}
+
+		// Проверяем право подключаться к голосу
+		if !authz.Can(userIDStr, authz.Chat(chatID), authz.Connect) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
 
-		// Проверяем, нет ли уже активной комнаты
-		var existing models.VoiceRoom
-		if err := db.Where("chat_id = ? AND is_active = ?", chatID, true).First(&existing).Error; err == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "room_exists"})
+		if code, expiresAt, restricted := serverRestriction(db, chatID, userIDStr); restricted {
+			c.JSON(http.StatusForbidden, gin.H{"error": code, "expiresAt": expiresAt})
 			return
 		}
 
+		now := time.Now()
 		room := models.VoiceRoom{
 			ID:        uuid.New().String(),
 			ChatID:    chatID,
 			CreatedBy: userIDStr,
+			Kind:      req.Kind,
+			Topic:     req.Topic,
+			Status:    "live",
+			StartedAt: &now,
 			IsActive:  true,
 		}
 
-		if err := db.Create(&room).Error; err != nil {
+		if req.ScheduledAt > 0 {
+			scheduledAt := time.UnixMilli(req.ScheduledAt)
+			if scheduledAt.Before(now) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "scheduled_in_past"})
+				return
+			}
+			room.Status = "scheduled"
+			room.ScheduledAt = &scheduledAt
+			room.StartedAt = nil
+			room.IsActive = false
+		} else {
+			// Проверяем, нет ли уже активной комнаты
+			var existing models.VoiceRoom
+			if err := db.Where("chat_id = ? AND is_active = ?", chatID, true).First(&existing).Error; err == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "room_exists"})
+				return
+			}
+		}
+
+		// Select("*"): IsActive=false не должен подменяться значением по умолчанию
+		if err := db.Select("*").Create(&room).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"room": room})
+		if room.Status == "live" {
+			broadcastVoiceRoom(db, wsHub, room)
+		} else if wsHub != nil {
+			wsHub.BroadcastToChat(chatID, wsEvent("voice_room:scheduled", voiceRoomPayload(db, room)))
+		}
+		c.JSON(http.StatusOK, gin.H{"room": voiceRoomPayload(db, room)})
 	}
 }
 
@@ -62,26 +252,170 @@ func GetVoiceRoom(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// Проверяем доступ
-		var member models.ChatMember
-		if err := db.Where("chat_id = ? AND user_id = ?", chatID, userIDStr).First(&member).Error; err != nil {
+		if !authz.IsMember(userIDStr, authz.Chat(chatID)) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
 
+		if code, expiresAt, restricted := serverRestriction(db, chatID, userIDStr); restricted {
+			c.JSON(http.StatusForbidden, gin.H{"error": code, "expiresAt": expiresAt})
+			return
+		}
+
 		var room models.VoiceRoom
 		if err := db.Where("chat_id = ? AND is_active = ?", chatID, true).First(&room).Error; err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"room": room})
+		c.JSON(http.StatusOK, gin.H{"room": voiceRoomPayload(db, room)})
+	}
+}
+
+// GetScheduledVoiceRooms запланированные комнаты чата
+func GetScheduledVoiceRooms(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chatID := c.Param("id")
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		if !authz.IsMember(userIDStr, authz.Chat(chatID)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var rooms []models.VoiceRoom
+		db.Where("chat_id = ? AND status = ?", chatID, "scheduled").Order("scheduled_at ASC").Limit(50).Find(&rooms)
+
+		var subscribed []string
+		db.Model(&models.VoiceRoomSubscriber{}).Where("user_id = ?", userIDStr).Pluck("room_id", &subscribed)
+		subscribedSet := make(map[string]bool, len(subscribed))
+		for _, id := range subscribed {
+			subscribedSet[id] = true
+		}
+
+		result := make([]gin.H, len(rooms))
+		for i, room := range rooms {
+			result[i] = voiceRoomPayload(db, room)
+			result[i]["subscribed"] = subscribedSet[room.ID]
+		}
+		c.JSON(http.StatusOK, gin.H{"rooms": result})
+	}
+}
+
+// UpdateVoiceRoom меняет тему или время запланированной комнаты (ведущий)
+func UpdateVoiceRoom(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		room, found := loadVoiceRoom(c, db)
+		if !found {
+			return
+		}
+		if !voiceRoomHost(room, userIDStr) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		var req struct {
+			Topic       *string `json:"topic"`
+			ScheduledAt *int64  `json:"scheduledAt"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		updates := map[string]interface{}{}
+		if req.Topic != nil {
+			updates["topic"] = *req.Topic
+		}
+		if req.ScheduledAt != nil {
+			if room.Status != "scheduled" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "not_scheduled"})
+				return
+			}
+			scheduledAt := time.UnixMilli(*req.ScheduledAt)
+			if scheduledAt.Before(time.Now()) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "scheduled_in_past"})
+				return
+			}
+			// Новое время — новое напоминание
+			updates["scheduled_at"] = scheduledAt
+			updates["reminder_sent_at"] = nil
+		}
+		if len(updates) > 0 {
+			db.Model(&room).Updates(updates)
+		}
+		db.First(&room, "id = ?", room.ID)
+
+		broadcastVoiceRoom(db, wsHub, room)
+		c.JSON(http.StatusOK, gin.H{"room": voiceRoomPayload(db, room)})
+	}
+}
+
+// StartVoiceRoom открывает запланированную комнату (ведущий)
+func StartVoiceRoom(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		room, found := loadVoiceRoom(c, db)
+		if !found {
+			return
+		}
+		if !voiceRoomHost(room, userIDStr) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		if room.Status != "scheduled" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "not_scheduled"})
+			return
+		}
+
+		var existing models.VoiceRoom
+		if err := db.Where("chat_id = ? AND is_active = ?", room.ChatID, true).First(&existing).Error; err == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "room_exists"})
+			return
+		}
+
+		now := time.Now()
+		db.Model(&room).Updates(map[string]interface{}{"status": "live", "is_active": true, "started_at": now})
+		room.Status, room.IsActive, room.StartedAt = "live", true, &now
+
+		// Подписчики узнают о начале
+		var subscribers []string
+		db.Model(&models.VoiceRoomSubscriber{}).Where("room_id = ?", room.ID).Pluck("user_id", &subscribers)
+		for _, subscriberID := range subscribers {
+			if wsHub != nil {
+				wsHub.SendToUser(subscriberID, wsEvent("voice_room:started", gin.H{"roomId": room.ID, "chatId": room.ChatID, "topic": room.Topic}))
+			}
+			SendPushNotification(db, subscriberID, "Комната началась", room.Topic, map[string]interface{}{
+				"type": "voice_room:started", "roomId": room.ID, "chatId": room.ChatID,
+			})
+		}
+
+		broadcastVoiceRoom(db, wsHub, room)
+		c.JSON(http.StatusOK, gin.H{"room": voiceRoomPayload(db, room)})
 	}
 }
 
 // EndVoiceRoom завершает голосовую комнату
-func EndVoiceRoom(db *gorm.DB) gin.HandlerFunc {
+func EndVoiceRoom(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		roomID := c.Param("roomId")
 		userID, _ := c.Get("userID")
 		userIDStr, ok := userID.(string)
 		if !ok {
@@ -89,20 +423,384 @@ func EndVoiceRoom(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var room models.VoiceRoom
-		if err := db.First(&room, "id = ?", roomID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+		room, found := loadVoiceRoom(c, db)
+		if !found {
 			return
 		}
 
-		// Только создатель может завершить комнату
-		if room.CreatedBy != userIDStr {
+		// Завершить комнату может ведущий или управляющий каналами
+		if !voiceRoomHost(room, userIDStr) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
 
-		db.Model(&room).Update("is_active", false)
+		now := time.Now()
+		db.Model(&room).Updates(map[string]interface{}{"is_active": false, "status": "ended", "ended_at": now})
+		redis.ClearVoiceRoom(room.ID)
+		stopCallRecordings(db, wsHub, room.ID)
+		closeSFURoom(room.ID)
+
+		if wsHub != nil {
+			wsHub.BroadcastToChat(room.ChatID, wsEvent("voice_room:ended", gin.H{"roomId": room.ID, "chatId": room.ChatID}))
+		}
 		c.JSON(http.StatusOK, gin.H{"ok": true})
 	}
 }
 
+// RaiseHand поднимает руку (слушатель просит слова)
+func RaiseHand(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		room, found := loadLiveVoiceRoom(c, db, userIDStr)
+		if !found {
+			return
+		}
+		if currentVoiceRoomRole(room, userIDStr) != "listener" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "already_speaker"})
+			return
+		}
+
+		if err := redis.SetVoiceRoomHand(room.ID, userIDStr, true); err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "state_unavailable"})
+			return
+		}
+		broadcastVoiceRoom(db, wsHub, room)
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// LowerHand опускает руку; ведущий может опустить чужую (?userId=)
+func LowerHand(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		room, found := loadLiveVoiceRoom(c, db, userIDStr)
+		if !found {
+			return
+		}
+		targetID := userIDStr
+		if target := c.Query("userId"); target != "" && target != userIDStr {
+			if !voiceRoomHost(room, userIDStr) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+				return
+			}
+			targetID = target
+		}
+
+		if err := redis.SetVoiceRoomHand(room.ID, targetID, false); err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "state_unavailable"})
+			return
+		}
+		broadcastVoiceRoom(db, wsHub, room)
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// InviteToSpeak ведущий приглашает слушателя выступить
+func InviteToSpeak(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var req struct {
+			UserID string `json:"userId" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+
+		room, found := loadLiveVoiceRoom(c, db, userIDStr)
+		if !found {
+			return
+		}
+		if !voiceRoomHost(room, userIDStr) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		if !authz.IsMember(req.UserID, authz.Chat(room.ChatID)) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_member"})
+			return
+		}
+
+		if err := redis.SetVoiceRoomInvite(room.ID, req.UserID, true); err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "state_unavailable"})
+			return
+		}
+		if wsHub != nil {
+			wsHub.SendToUser(req.UserID, wsEvent("voice_room:invited", gin.H{"roomId": room.ID, "chatId": room.ChatID, "by": userIDStr}))
+		}
+		broadcastVoiceRoom(db, wsHub, room)
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// RespondSpeakerInvite принимает (accept=true) или отклоняет приглашение выступить
+func RespondSpeakerInvite(db *gorm.DB, wsHub *websocket.Hub, accept bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		room, found := loadLiveVoiceRoom(c, db, userIDStr)
+		if !found {
+			return
+		}
+		invited, err := redis.IsVoiceRoomInvited(room.ID, userIDStr)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "state_unavailable"})
+			return
+		}
+		if !invited {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "not_invited"})
+			return
+		}
+
+		if accept {
+			err = redis.SetVoiceRoomRole(room.ID, userIDStr, "speaker")
+		} else {
+			err = redis.SetVoiceRoomInvite(room.ID, userIDStr, false)
+		}
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "state_unavailable"})
+			return
+		}
+
+		syncVoiceRoomAudio(room, userIDStr)
+		broadcastVoiceRoom(db, wsHub, room)
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// SetVoiceRoomMemberRole назначает роль host | speaker | listener (ведущий);
+// любой может сам перейти в слушатели
+func SetVoiceRoomMemberRole(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var req struct {
+			UserID string `json:"userId" binding:"required"`
+			Role   string `json:"role" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+		if req.Role != "host" && req.Role != "speaker" && req.Role != "listener" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_role"})
+			return
+		}
+
+		room, found := loadLiveVoiceRoom(c, db, userIDStr)
+		if !found {
+			return
+		}
+		stepDown := req.UserID == userIDStr && req.Role == "listener"
+		if !stepDown && !voiceRoomHost(room, userIDStr) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		if req.UserID == room.CreatedBy && req.UserID != userIDStr {
+			c.JSON(http.StatusForbidden, gin.H{"error": "cannot_change_creator"})
+			return
+		}
+
+		if err := redis.SetVoiceRoomRole(room.ID, req.UserID, req.Role); err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "state_unavailable"})
+			return
+		}
+
+		syncVoiceRoomAudio(room, req.UserID)
+		broadcastVoiceRoom(db, wsHub, room)
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// MuteVoiceRoomMember серверный mute участника (ведущий или mute_members)
+func MuteVoiceRoomMember(db *gorm.DB, wsHub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		var req struct {
+			UserID string `json:"userId" binding:"required"`
+			Muted  *bool  `json:"muted"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad_request"})
+			return
+		}
+		muted := req.Muted == nil || *req.Muted
+
+		room, found := loadLiveVoiceRoom(c, db, userIDStr)
+		if !found {
+			return
+		}
+		if !voiceRoomHost(room, userIDStr) && !authz.Can(userIDStr, authz.Chat(room.ChatID), authz.MuteMembers) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		if req.UserID == room.CreatedBy && req.UserID != userIDStr {
+			c.JSON(http.StatusForbidden, gin.H{"error": "cannot_mute_creator"})
+			return
+		}
+
+		if err := setVoiceRoomMuted(db, room, userIDStr, req.UserID, muted); err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "state_unavailable"})
+			return
+		}
+		broadcastVoiceRoom(db, wsHub, room)
+		c.JSON(http.StatusOK, gin.H{"ok": true, "muted": muted})
+	}
+}
+
+// setVoiceRoomMuted сохраняет mute в состоянии комнаты, применяет в SFU и пишет в лог модерации
+func setVoiceRoomMuted(db *gorm.DB, room models.VoiceRoom, actorID, targetID string, muted bool) error {
+	if err := redis.SetVoiceRoomMuted(room.ID, targetID, muted); err != nil {
+		return err
+	}
+	syncVoiceRoomAudio(room, targetID)
+
+	action := "voice_mute"
+	if !muted {
+		action = "voice_unmute"
+	}
+	logModeration(db, room.ChatID, "", actorID, action, targetID, "", gin.H{"roomId": room.ID})
+	return nil
+}
+
+// SubscribeVoiceRoom напомнить о начале запланированной комнаты (subscribe=false — отписаться)
+func SubscribeVoiceRoom(db *gorm.DB, subscribe bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		room, found := loadVoiceRoom(c, db)
+		if !found {
+			return
+		}
+		if !authz.IsMember(userIDStr, authz.Chat(room.ChatID)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		if !subscribe {
+			db.Where("room_id = ? AND user_id = ?", room.ID, userIDStr).Delete(&models.VoiceRoomSubscriber{})
+			c.JSON(http.StatusOK, gin.H{"ok": true})
+			return
+		}
+		if room.Status != "scheduled" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "not_scheduled"})
+			return
+		}
+
+		var existing models.VoiceRoomSubscriber
+		if err := db.Where("room_id = ? AND user_id = ?", room.ID, userIDStr).First(&existing).Error; err != nil {
+			db.Create(&models.VoiceRoomSubscriber{ID: uuid.New().String(), RoomID: room.ID, UserID: userIDStr})
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// resetVoiceRoomPresence очищает присутствие идущих комнат при старте: участники
+// заново попадут в него, когда переподключатся к SFU
+func resetVoiceRoomPresence(db *gorm.DB) {
+	var roomIDs []string
+	db.Model(&models.VoiceRoom{}).Where("status = ?", "live").Pluck("id", &roomIDs)
+	if err := redis.ResetVoiceRoomPresence(roomIDs); err != nil {
+		log.Printf("Voice room state unavailable: %v", err)
+	}
+}
+
+// voiceRoomJoined вызывается SFU при входе участника в голосовую комнату
+func voiceRoomJoined(db *gorm.DB, wsHub *websocket.Hub, roomID, userID string) {
+	var room models.VoiceRoom
+	if err := db.First(&room, "id = ?", roomID).Error; err != nil {
+		return
+	}
+	if err := redis.SetVoiceRoomPresent(roomID, userID, true); err != nil {
+		log.Printf("Voice room state unavailable: %v", err)
+	}
+	broadcastVoiceRoom(db, wsHub, room)
+}
+
+// voiceRoomLeft вызывается SFU при выходе участника; роль и приглашения сохраняются
+func voiceRoomLeft(db *gorm.DB, wsHub *websocket.Hub, roomID, userID string) {
+	var room models.VoiceRoom
+	if err := db.First(&room, "id = ?", roomID).Error; err != nil || room.Status != "live" {
+		return
+	}
+	if err := redis.SetVoiceRoomPresent(roomID, userID, false); err != nil {
+		log.Printf("Voice room state unavailable: %v", err)
+	}
+	broadcastVoiceRoom(db, wsHub, room)
+}
+
+// StartVoiceRoomReminders раз в минуту напоминает подписчикам о скором начале запланированных комнат
+func StartVoiceRoomReminders(db *gorm.DB, wsHub *websocket.Hub) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		var rooms []models.VoiceRoom
+		db.Where("status = ? AND reminder_sent_at IS NULL AND scheduled_at <= ?", "scheduled", time.Now().Add(voiceRoomReminderLead)).
+			Limit(100).Find(&rooms)
+
+		for _, room := range rooms {
+			now := time.Now()
+			// Помечаем заранее, чтобы не напомнить дважды
+			res := db.Model(&models.VoiceRoom{}).Where("id = ? AND reminder_sent_at IS NULL", room.ID).Update("reminder_sent_at", now)
+			if res.RowsAffected == 0 {
+				continue
+			}
+
+			var recipients []string
+			db.Model(&models.VoiceRoomSubscriber{}).Where("room_id = ?", room.ID).Pluck("user_id", &recipients)
+			recipients = append(recipients, room.CreatedBy)
+
+			seen := make(map[string]bool)
+			for _, recipientID := range recipients {
+				if seen[recipientID] {
+					continue
+				}
+				seen[recipientID] = true
+				wsHub.SendToUser(recipientID, wsEvent("voice_room:reminder", gin.H{
+					"roomId": room.ID, "chatId": room.ChatID, "topic": room.Topic, "scheduledAt": room.ScheduledAt,
+				}))
+				SendPushNotification(db, recipientID, "Скоро начнется комната", room.Topic, map[string]interface{}{
+					"type": "voice_room:reminder", "roomId": room.ID, "chatId": room.ChatID,
+				})
+			}
+		}
+	}
+}
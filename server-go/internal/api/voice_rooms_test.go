@@ -0,0 +1,43 @@
+package api
+
+import (
+	"testing"
+
+	"safegram-server/internal/models"
+	"safegram-server/internal/redis"
+)
+
+func TestVoiceRoomRole(t *testing.T) {
+	voice := models.VoiceRoom{ID: "room", CreatedBy: "creator", Kind: "voice"}
+	stage := models.VoiceRoom{ID: "room", CreatedBy: "creator", Kind: "stage"}
+	state := &redis.VoiceRoomState{Roles: map[string]string{
+		"creator": "speaker",
+		"cohost":  "host",
+		"guest":   "speaker",
+	}}
+
+	tests := []struct {
+		name   string
+		room   models.VoiceRoom
+		state  *redis.VoiceRoomState
+		userID string
+		want   string
+	}{
+		{"создатель всегда ведущий", stage, state, "creator", "host"},
+		{"создатель без состояния", stage, nil, "creator", "host"},
+		{"назначенный ведущий", stage, state, "cohost", "host"},
+		{"выступающий на сцене", stage, state, "guest", "speaker"},
+		{"слушатель на сцене", stage, state, "listener", "listener"},
+		{"сцена без состояния", stage, nil, "guest", "listener"},
+		{"в голосовой комнате говорят все", voice, state, "listener", "speaker"},
+		{"голосовая комната без состояния", voice, nil, "guest", "speaker"},
+		{"пустая роль в состоянии", stage, &redis.VoiceRoomState{Roles: map[string]string{"guest": ""}}, "guest", "listener"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := voiceRoomRole(tt.room, tt.state, tt.userID); got != tt.want {
+				t.Errorf("voiceRoomRole(%q) = %q, want %q", tt.userID, got, tt.want)
+			}
+		})
+	}
+}
@@ -9,10 +9,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"safegram-server/internal/authz"
 	"safegram-server/internal/models"
 )
 
-// GetChatWebhooks список вебхуков чата (модераторы)
+// GetChatWebhooks список вебхуков чата (manage_webhooks)
 func GetChatWebhooks(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		chatID := c.Param("id")
@@ -23,12 +24,7 @@ func GetChatWebhooks(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var member models.ChatMember
-		if err := db.Where("chat_id = ? AND user_id = ?", chatID, userIDStr).First(&member).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
-		}
-		if !isChatModerator(member.Role) {
+		if !authz.Can(userIDStr, authz.Chat(chatID), authz.ManageWebhooks) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
@@ -39,7 +35,7 @@ func GetChatWebhooks(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// CreateChatWebhook создать вебхук (модераторы)
+// CreateChatWebhook создать вебхук (manage_webhooks)
 func CreateChatWebhook(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		chatID := c.Param("id")
@@ -50,12 +46,7 @@ func CreateChatWebhook(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var member models.ChatMember
-		if err := db.Where("chat_id = ? AND user_id = ?", chatID, userIDStr).First(&member).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
-		}
-		if !isChatModerator(member.Role) {
+		if !authz.Can(userIDStr, authz.Chat(chatID), authz.ManageWebhooks) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
@@ -85,7 +76,7 @@ func CreateChatWebhook(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// DeleteChatWebhook удалить вебхук (модераторы)
+// DeleteChatWebhook удалить вебхук (manage_webhooks)
 func DeleteChatWebhook(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		chatID := c.Param("id")
@@ -97,12 +88,7 @@ func DeleteChatWebhook(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var member models.ChatMember
-		if err := db.Where("chat_id = ? AND user_id = ?", chatID, userIDStr).First(&member).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-			return
-		}
-		if !isChatModerator(member.Role) {
+		if !authz.Can(userIDStr, authz.Chat(chatID), authz.ManageWebhooks) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
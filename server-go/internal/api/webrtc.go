@@ -1,43 +1,102 @@
 package api
 
 import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"safegram-server/internal/authz"
+	"safegram-server/internal/config"
+	"safegram-server/internal/models"
 )
 
-// GetICEServers возвращает список ICE серверов для WebRTC
-func GetICEServers() gin.HandlerFunc {
+// turnCredentials временные учетные данные по схеме TURN REST API
+// (coturn use-auth-secret): username = "<expiry>:<userID>[:<callID>]",
+// credential = base64(HMAC-SHA1(secret, username))
+func turnCredentials(secret, userID, callID string, ttl time.Duration) (string, string, time.Time) {
+	expiresAt := time.Now().Add(ttl)
+	username := strconv.FormatInt(expiresAt.Unix(), 10) + ":" + userID
+	if callID != "" {
+		username += ":" + callID
+	}
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return username, base64.StdEncoding.EncodeToString(mac.Sum(nil)), expiresAt
+}
+
+// turnURLs список TURN URL со всеми включенными транспортами
+func turnURLs(cfg *config.Config) []string {
+	var urls []string
+	for _, host := range cfg.TURNServers {
+		urls = append(urls, "turn:"+host+"?transport=udp")
+		if cfg.TURNEnableTCP {
+			urls = append(urls, "turn:"+host+"?transport=tcp")
+		}
+	}
+	for _, host := range cfg.TURNTLSServers {
+		urls = append(urls, "turns:"+host+"?transport=tcp")
+	}
+	return urls
+}
+
+// callParticipant проверяет, что пользователь участвует в звонке (1:1 или групповом)
+func callParticipant(db *gorm.DB, callID, userID string) bool {
+	var call models.Call
+	if err := db.Select("caller_id", "receiver_id").First(&call, "id = ?", callID).Error; err == nil {
+		return call.CallerID == userID || call.ReceiverID == userID
+	}
+	var groupCall models.GroupCall
+	if err := db.Select("chat_id").First(&groupCall, "id = ?", callID).Error; err == nil {
+		return authz.IsMember(userID, authz.Chat(groupCall.ChatID))
+	}
+	return false
+}
+
+// GetICEServers возвращает список ICE серверов для WebRTC.
+// TURN выдается с временными учетными данными на пользователя,
+// а при ?callId= — привязанными к конкретному звонку.
+func GetICEServers(db *gorm.DB, cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// STUN серверы (публичные, бесплатные)
-		// RTCPeerConnection не поддерживает query параметры в URL
-		iceServers := []gin.H{
-			{
-				"urls": "stun:stun.l.google.com:19302",
-			},
-			{
-				"urls": "stun:stun1.l.google.com:19302",
-			},
-			{
-				"urls": "stun:stun2.l.google.com:19302",
-			},
+		userID, _ := c.Get("userID")
+		userIDStr, ok := userID.(string)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
 		}
 
-		// Если есть TURN серверы в конфиге, добавляем их
-		// В production здесь должны быть ваши TURN серверы
-		// turnServer := os.Getenv("TURN_SERVER")
-		// if turnServer != "" {
-		// 	iceServers = append(iceServers, gin.H{
-		// 		"urls":       []string{turnServer},
-		// 		"username":  os.Getenv("TURN_USERNAME"),
-		// 		"credential": os.Getenv("TURN_PASSWORD"),
-		// 	})
-		// }
-
-		c.JSON(http.StatusOK, gin.H{"iceServers": iceServers})
+		callID := c.Query("callId")
+		if callID != "" && !callParticipant(db, callID, userIDStr) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		// RTCPeerConnection не поддерживает query параметры в STUN URL
+		iceServers := []gin.H{}
+		if len(cfg.STUNServers) > 0 {
+			iceServers = append(iceServers, gin.H{"urls": cfg.STUNServers})
+		}
+
+		response := gin.H{}
+		if urls := turnURLs(cfg); len(urls) > 0 && cfg.TURNSecret != "" {
+			username, credential, expiresAt := turnCredentials(cfg.TURNSecret, userIDStr, callID, cfg.TURNTTL)
+			iceServers = append(iceServers, gin.H{
+				"urls":       urls,
+				"username":   username,
+				"credential": credential,
+			})
+			response["expiresAt"] = expiresAt.Unix() * 1000
+			response["ttl"] = int(cfg.TURNTTL.Seconds())
+		}
+
+		response["iceServers"] = iceServers
+		c.JSON(http.StatusOK, response)
 	}
 }
 
 // WebRTC signaling будет через WebSocket
 // События: webrtc:offer, webrtc:answer, webrtc:ice, webrtc:hangup
-
@@ -7,6 +7,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	gorillaWS "github.com/gorilla/websocket"
+	"safegram-server/internal/authz"
 	"safegram-server/internal/config"
 	"safegram-server/internal/websocket"
 )
@@ -57,6 +58,14 @@ func handleWebSocket(hub *websocket.Hub, cfg *config.Config) gin.HandlerFunc {
 			return
 		}
 
+		// Гостевой токен встречи действует только для ее звонка
+		guest, _ := claims["guest"].(bool)
+		meetingID, _ := claims["meetingId"].(string)
+		if guest && meetingID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
 		// Обновляем соединение до WebSocket
 		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 		if err != nil {
@@ -66,6 +75,9 @@ func handleWebSocket(hub *websocket.Hub, cfg *config.Config) gin.HandlerFunc {
 
 		// Создаем клиента
 		client := websocket.NewClient(hub, conn, userID)
+		if guest {
+			client = websocket.NewGuestClient(hub, conn, userID, meetingID)
+		}
 		hub.Register(client)
 
 		// Запускаем горутины для чтения и записи
@@ -74,3 +86,19 @@ func handleWebSocket(hub *websocket.Hub, cfg *config.Config) gin.HandlerFunc {
 	}
 }
 
+// RegisterChatSubscriptions подключает подписку на события чата (до запуска Run):
+// подписаться можно только на чат, который пользователь видит
+func RegisterChatSubscriptions(hub *websocket.Hub) {
+	hub.On("subscribe", func(client *websocket.Client, msg map[string]interface{}) {
+		chatID, _ := msg["chatId"].(string)
+		if chatID == "" {
+			return
+		}
+		if !authz.IsMember(client.UserID(), authz.Chat(chatID)) ||
+			!authz.Can(client.UserID(), authz.Chat(chatID), authz.ViewChannel) {
+			client.Send(wsEvent("subscribe:error", gin.H{"chatId": chatID, "error": "forbidden"}))
+			return
+		}
+		client.SubscribeToChat(chatID)
+	})
+}
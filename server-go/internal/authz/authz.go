@@ -0,0 +1,284 @@
+package authz
+
+import (
+	"math"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"safegram-server/internal/models"
+)
+
+// Позиции встроенных ролей в иерархии. Пользовательские роли
+// могут располагаться как выше, так и ниже них.
+const (
+	OwnerPosition     = math.MaxInt32
+	AdminPosition     = 100
+	ModeratorPosition = 50
+)
+
+// Scope область, в которой проверяются права
+// Type: "chat" | "server" | "channel"
+type Scope struct {
+	Type string
+	ID   string
+}
+
+// Chat область чата. Если чат принадлежит каналу сервера,
+// права считаются по серверу с учетом переопределений канала.
+func Chat(chatID string) Scope {
+	return Scope{Type: "chat", ID: chatID}
+}
+
+// Server область сервера
+func Server(serverID string) Scope {
+	return Scope{Type: "server", ID: serverID}
+}
+
+// Channel область канала сервера
+func Channel(channelID string) Scope {
+	return Scope{Type: "channel", ID: channelID}
+}
+
+var db *gorm.DB
+
+// Init инициализирует сервис прав
+func Init(database *gorm.DB) {
+	db = database
+}
+
+// target область после разрешения: группа/чат или сервер (+ канал)
+type target struct {
+	scopeType string // "chat" | "server"
+	scopeID   string
+	chatType  string
+	channel   *models.Channel
+}
+
+func resolve(scope Scope) (target, bool) {
+	switch scope.Type {
+	case "server":
+		return target{scopeType: "server", scopeID: scope.ID}, true
+	case "channel":
+		var ch models.Channel
+		if err := db.First(&ch, "id = ?", scope.ID).Error; err != nil {
+			return target{}, false
+		}
+		return target{scopeType: "server", scopeID: ch.ServerID, channel: &ch}, true
+	case "chat":
+		var ch models.Channel
+		if err := db.Where("chat_id = ?", scope.ID).First(&ch).Error; err == nil {
+			return target{scopeType: "server", scopeID: ch.ServerID, channel: &ch}, true
+		}
+		var chat models.Chat
+		if err := db.First(&chat, "id = ?", scope.ID).Error; err != nil {
+			return target{}, false
+		}
+		return target{scopeType: "chat", scopeID: chat.ID, chatType: chat.Type}, true
+	}
+	return target{}, false
+}
+
+// membership возвращает встроенную роль участника (owner/admin/moderator/member)
+func membership(userID string, t target) (string, bool) {
+	if t.scopeType == "server" {
+		var member models.ServerMember
+		if err := db.Where("server_id = ? AND user_id = ?", t.scopeID, userID).First(&member).Error; err != nil {
+			return "", false
+		}
+		var server models.Server
+		if err := db.Select("owner_id").First(&server, "id = ?", t.scopeID).Error; err == nil && server.OwnerID == userID {
+			return "owner", true
+		}
+		return member.Role, true
+	}
+
+	var member models.ChatMember
+	if err := db.Where("chat_id = ? AND user_id = ?", t.scopeID, userID).First(&member).Error; err != nil {
+		return "", false
+	}
+	return member.Role, true
+}
+
+func builtinPermissions(role string) Permission {
+	switch role {
+	case "admin":
+		return AdminPermissions
+	case "moderator":
+		return ModeratorPermissions
+	}
+	return 0
+}
+
+// BuiltinPosition позиция встроенной роли (owner/admin/moderator/member) в иерархии
+func BuiltinPosition(role string) int {
+	switch role {
+	case "owner":
+		return OwnerPosition
+	case "admin":
+		return AdminPosition
+	case "moderator":
+		return ModeratorPosition
+	}
+	return 0
+}
+
+func memberRoles(userID string, t target) []models.Role {
+	var roles []models.Role
+	db.Joins("JOIN member_roles ON member_roles.role_id = roles.id").
+		Where("member_roles.user_id = ? AND roles.scope_type = ? AND roles.scope_id = ?", userID, t.scopeType, t.scopeID).
+		Find(&roles)
+	return roles
+}
+
+// Permissions вычисляет итоговые права пользователя в области
+func Permissions(userID string, scope Scope) Permission {
+	if db == nil || userID == "" {
+		return 0
+	}
+	t, ok := resolve(scope)
+	if !ok {
+		return 0
+	}
+	builtin, isMember := membership(userID, t)
+	if !isMember {
+		return 0
+	}
+	if builtin == "owner" {
+		return AllPermissions
+	}
+	if t.chatType == "dm" {
+		return DMPermissions
+	}
+
+	perms := DefaultPermissions
+	var everyone models.Role
+	if err := db.Where("scope_type = ? AND scope_id = ? AND is_default = ?", t.scopeType, t.scopeID, true).First(&everyone).Error; err == nil {
+		perms = Permission(everyone.Permissions)
+	}
+	perms |= builtinPermissions(builtin)
+
+	roles := memberRoles(userID, t)
+	roleIDs := make(map[string]bool, len(roles))
+	for _, r := range roles {
+		perms |= Permission(r.Permissions)
+		roleIDs[r.ID] = true
+	}
+
+	if perms.Has(Administrator) {
+		return AllPermissions
+	}
+
+	if t.channel != nil {
+		perms = applyOverwrites(perms, userID, roleIDs, t.channel)
+	}
+	return perms
+}
+
+// applyOverwrites применяет переопределения категории, затем канала.
+// Внутри уровня порядок: @everyone, роли, конкретный участник.
+func applyOverwrites(perms Permission, userID string, roleIDs map[string]bool, ch *models.Channel) Permission {
+	var overwrites []models.PermissionOverwrite
+	db.Where("(target_type = 'channel' AND target_id = ?) OR (target_type = 'category' AND target_id = ? AND target_id != '')", ch.ID, ch.CategoryID).
+		Find(&overwrites)
+
+	for _, level := range []string{"category", "channel"} {
+		for _, subject := range []string{"everyone", "role", "member"} {
+			var allow, deny Permission
+			for _, o := range overwrites {
+				if o.TargetType != level || o.SubjectType != subject {
+					continue
+				}
+				if subject == "role" && !roleIDs[o.SubjectID] {
+					continue
+				}
+				if subject == "member" && o.SubjectID != userID {
+					continue
+				}
+				allow |= Permission(o.Allow)
+				deny |= Permission(o.Deny)
+			}
+			perms = (perms &^ deny) | allow
+		}
+	}
+	return perms
+}
+
+// Can проверяет наличие права у пользователя в области
+func Can(userID string, scope Scope, perm Permission) bool {
+	return Permissions(userID, scope).Has(perm)
+}
+
+// IsMember проверяет членство пользователя в области
+func IsMember(userID string, scope Scope) bool {
+	if db == nil {
+		return false
+	}
+	t, ok := resolve(scope)
+	if !ok {
+		return false
+	}
+	_, isMember := membership(userID, t)
+	return isMember
+}
+
+// IsOwner проверяет, что пользователь владелец группы/сервера
+func IsOwner(userID string, scope Scope) bool {
+	if db == nil {
+		return false
+	}
+	t, ok := resolve(scope)
+	if !ok {
+		return false
+	}
+	builtin, isMember := membership(userID, t)
+	return isMember && builtin == "owner"
+}
+
+// Rank позиция пользователя в иерархии ролей (0 — не участник или без ролей)
+func Rank(userID string, scope Scope) int {
+	if db == nil {
+		return 0
+	}
+	t, ok := resolve(scope)
+	if !ok {
+		return 0
+	}
+	builtin, isMember := membership(userID, t)
+	if !isMember {
+		return 0
+	}
+	rank := BuiltinPosition(builtin)
+	for _, r := range memberRoles(userID, t) {
+		if r.Position > rank {
+			rank = r.Position
+		}
+	}
+	return rank
+}
+
+// Outranks проверяет, что actor выше target в иерархии области
+func Outranks(actorID, targetID string, scope Scope) bool {
+	return Rank(actorID, scope) > Rank(targetID, scope)
+}
+
+// DefaultRole возвращает роль @everyone области, создавая ее при необходимости
+func DefaultRole(scopeType, scopeID string) (models.Role, error) {
+	var role models.Role
+	err := db.Where("scope_type = ? AND scope_id = ? AND is_default = ?", scopeType, scopeID, true).First(&role).Error
+	if err == nil {
+		return role, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return role, err
+	}
+	role = models.Role{
+		ID:          uuid.New().String(),
+		ScopeType:   scopeType,
+		ScopeID:     scopeID,
+		Name:        "@everyone",
+		Position:    0,
+		Permissions: int64(DefaultPermissions),
+		IsDefault:   true,
+	}
+	return role, db.Create(&role).Error
+}
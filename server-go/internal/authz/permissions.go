@@ -0,0 +1,108 @@
+package authz
+
+import "sort"
+
+// Permission битовая маска прав (как в Discord)
+type Permission int64
+
+// Значения битов хранятся в БД (roles.permissions, permission_overwrites.allow/deny),
+// поэтому новые права добавляются только в конец списка, перед permissionLimit.
+const (
+	ViewChannel Permission = 1 << iota
+	SendMessages
+	ReadHistory
+	AttachFiles
+	AddReactions
+	MentionEveryone
+	PinMessages
+	ManageMessages   // удаление чужих сообщений, мод-очередь
+	InviteMembers    // приглашения и добавление участников
+	KickMembers      // исключение участников
+	BanMembers       // баны
+	ModerateMembers  // предупреждения и таймауты
+	ManageModeration // настройки автомодерации
+	ViewAuditLog     // логи модерации и история участников
+	ManageWebhooks
+	ManageKeys     // групповые E2EE ключи
+	ManageChannels // каналы и категории
+	ManageRoles    // роли и переопределения прав
+	ManageSettings // название, описание, аватар группы/сервера
+	Connect        // вход в голосовые комнаты и звонки
+	Speak
+	MuteMembers
+	Administrator // все права, игнорирует переопределения каналов
+	ManageEmoji   // пользовательские эмодзи
+
+	permissionLimit
+)
+
+const (
+	// AllPermissions все известные права
+	AllPermissions = permissionLimit - 1
+
+	// DefaultPermissions права роли @everyone, если она не настроена
+	DefaultPermissions = ViewChannel | SendMessages | ReadHistory | AttachFiles | AddReactions | Connect | Speak
+
+	// DMPermissions права участников личного чата
+	DMPermissions = DefaultPermissions | PinMessages
+
+	// ModeratorPermissions права встроенной роли moderator
+	ModeratorPermissions = ManageMessages | BanMembers | ModerateMembers | ManageModeration |
+		ViewAuditLog | ManageWebhooks | MuteMembers
+
+	// AdminPermissions права встроенной роли admin
+	AdminPermissions = AllPermissions &^ Administrator
+)
+
+var permissionNames = map[Permission]string{
+	ViewChannel:      "view_channel",
+	SendMessages:     "send_messages",
+	ReadHistory:      "read_history",
+	AttachFiles:      "attach_files",
+	AddReactions:     "add_reactions",
+	MentionEveryone:  "mention_everyone",
+	PinMessages:      "pin_messages",
+	ManageMessages:   "manage_messages",
+	InviteMembers:    "invite_members",
+	KickMembers:      "kick_members",
+	BanMembers:       "ban_members",
+	ModerateMembers:  "moderate_members",
+	ManageModeration: "manage_moderation",
+	ViewAuditLog:     "view_audit_log",
+	ManageWebhooks:   "manage_webhooks",
+	ManageKeys:       "manage_keys",
+	ManageChannels:   "manage_channels",
+	ManageRoles:      "manage_roles",
+	ManageSettings:   "manage_settings",
+	Connect:          "connect",
+	Speak:            "speak",
+	MuteMembers:      "mute_members",
+	Administrator:    "administrator",
+	ManageEmoji:      "manage_emoji",
+}
+
+// Has проверяет, что маска содержит все биты perm
+func (p Permission) Has(perm Permission) bool {
+	return p&perm == perm
+}
+
+// Names возвращает имена прав, входящих в маску
+func (p Permission) Names() []string {
+	names := make([]string, 0)
+	for bit, name := range permissionNames {
+		if p&bit != 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AllNames возвращает справочник всех прав: имя -> бит
+func AllNames() map[string]int64 {
+	result := make(map[string]int64, len(permissionNames))
+	for bit, name := range permissionNames {
+		result[name] = int64(bit)
+	}
+	return result
+}
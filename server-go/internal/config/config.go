@@ -2,6 +2,9 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -11,6 +14,33 @@ type Config struct {
 	RedisURL    string
 	NodeEnv     string
 	WebhookURL  string
+	AppURL      string // публичный адрес клиента (ссылки в письмах)
+
+	// ICE/TURN (coturn с use-auth-secret)
+	STUNServers    []string      // stun:host:port
+	TURNServers    []string      // host:port — выдаются как turn:...?transport=udp
+	TURNTLSServers []string      // host:port — выдаются как turns:...?transport=tcp
+	TURNEnableTCP  bool          // дополнительно turn:...?transport=tcp
+	TURNSecret     string        // static-auth-secret coturn
+	TURNTTL        time.Duration // время жизни выданных учетных данных
+
+	// Встроенный SFU
+	SFUPublicIPs  []string // внешние IP медиасервера за 1:1 NAT
+	SFUUDPPortMin int
+	SFUUDPPortMax int
+
+	// Записи звонков и расшифровка
+	RecordingRetentionDays int    // срок хранения по умолчанию
+	TranscribeBackend      string // none | stub | command | http
+	TranscribeCommand      string
+	TranscribeURL          string
+	TranscribeAPIKey       string
+	TranscribeModel        string
+	TranscribeLanguage     string
+
+	// Превью ссылок
+	LinkPreviews       bool
+	LinkPreviewTimeout time.Duration
 }
 
 func Load() *Config {
@@ -21,6 +51,29 @@ func Load() *Config {
 		RedisURL:    getEnv("REDIS_URL", "localhost:6379"),
 		NodeEnv:     getEnv("NODE_ENV", "development"),
 		WebhookURL:  getEnv("WEBHOOK_URL", ""),
+		AppURL:      getEnv("APP_URL", "https://safegram.app"),
+
+		STUNServers:    getEnvList("STUN_SERVERS", "stun:stun.l.google.com:19302,stun:stun1.l.google.com:19302"),
+		TURNServers:    getEnvList("TURN_SERVERS", ""),
+		TURNTLSServers: getEnvList("TURN_TLS_SERVERS", ""),
+		TURNEnableTCP:  getEnv("TURN_ENABLE_TCP", "false") == "true",
+		TURNSecret:     getEnv("TURN_SECRET", ""),
+		TURNTTL:        time.Duration(getEnvInt("TURN_TTL_SECONDS", 86400)) * time.Second,
+
+		SFUPublicIPs:  getEnvList("SFU_PUBLIC_IPS", ""),
+		SFUUDPPortMin: getEnvInt("SFU_UDP_PORT_MIN", 0),
+		SFUUDPPortMax: getEnvInt("SFU_UDP_PORT_MAX", 0),
+
+		RecordingRetentionDays: getEnvInt("RECORDING_RETENTION_DAYS", 30),
+		TranscribeBackend:      getEnv("TRANSCRIBE_BACKEND", "none"),
+		TranscribeCommand:      getEnv("TRANSCRIBE_COMMAND", ""),
+		TranscribeURL:          getEnv("TRANSCRIBE_URL", ""),
+		TranscribeAPIKey:       getEnv("TRANSCRIBE_API_KEY", ""),
+		TranscribeModel:        getEnv("TRANSCRIBE_MODEL", ""),
+		TranscribeLanguage:     getEnv("TRANSCRIBE_LANGUAGE", "ru"),
+
+		LinkPreviews:       getEnv("LINK_PREVIEWS", "true") == "true",
+		LinkPreviewTimeout: time.Duration(getEnvInt("LINK_PREVIEW_TIMEOUT_SECONDS", 5)) * time.Second,
 	}
 }
 
@@ -31,3 +84,21 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+
+// getEnvList читает список через запятую
+func getEnvList(key, defaultValue string) []string {
+	var list []string
+	for _, item := range strings.Split(getEnv(key, defaultValue), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+	return defaultValue
+}
@@ -15,17 +15,27 @@ func AutoMigrate(db *gorm.DB) error {
 	db.Exec("ALTER TABLE polls DROP CONSTRAINT IF EXISTS fk_messages_poll")
 	db.Exec("ALTER TABLE polls DROP CONSTRAINT IF EXISTS fk_polls_message")
 
+	// Повторные одинаковые реакции мешают уникальному индексу idx_message_reaction
+	db.Exec(`DELETE FROM message_reactions a USING message_reactions b
+		WHERE a.message_id = b.message_id AND a.user_id = b.user_id AND a.emoji = b.emoji AND a.id > b.id`)
+
 	// Миграция всех моделей
 	err := db.AutoMigrate(
 		&models.User{},
 		&models.Chat{},
 		&models.ChatMember{},
+		&models.ChatSummary{},
+		&models.ChatFolder{},
 		&models.MemberEvent{},
 		&models.Message{},
 		&models.MessageReaction{},
-		&models.MessageReadReceipt{},
+		&models.MessageMention{},
+		&models.MessageRevision{},
+		&models.HiddenMessage{},
+		&models.LinkPreview{},
 		&models.PinnedMessage{},
 		&models.Thread{},
+		&models.ThreadFollower{},
 		&models.Server{},
 		&models.ServerMember{},
 		&models.ChannelCategory{},
@@ -34,21 +44,51 @@ func AutoMigrate(db *gorm.DB) error {
 		&models.ChatModerationSettings{},
 		&models.ChatWarning{},
 		&models.ChatBan{},
+		&models.ChatMute{},
+		&models.ServerBan{},
+		&models.ServerTimeout{},
+		&models.ModerationRule{},
 		&models.ModerationLog{},
+		&models.Report{},
+		&models.Appeal{},
+		&models.Feedback{},
+		&models.Role{},
+		&models.MemberRole{},
+		&models.PermissionOverwrite{},
+		&models.Invite{},
+		&models.JoinRequest{},
 		&models.Webhook{},
 		&models.StickerPack{},
 		&models.Sticker{},
+		&models.CustomEmoji{},
 		&models.VoiceRoom{},
+		&models.VoiceRoomSubscriber{},
 		&models.PushSubscription{},
+		&models.NotificationSettings{},
+		&models.NotificationPreference{},
+		&models.NotificationDigestItem{},
 		&models.SavedMessage{},
 		&models.Poll{},
 		&models.PollOption{},
 		&models.PollVote{},
 		&models.Story{},
 		&models.StoryView{},
+		&models.StoryReaction{},
+		&models.StoryCloseFriend{},
+		&models.StoryHiddenUser{},
+		&models.StoryHighlight{},
+		&models.StoryHighlightItem{},
+		&models.Contact{},
+		&models.UserBlock{},
 		&models.Call{},
 		&models.GroupCall{},
 		&models.GroupCallParticipant{},
+		&models.CallRecording{},
+		&models.RecordingConsent{},
+		&models.RecordingPolicy{},
+		&models.Meeting{},
+		&models.MeetingInvitee{},
+		&models.MeetingLobbyEntry{},
 		&models.Session{},
 		&models.MaintenanceMode{}, // Режим технических работ
 	)
@@ -57,6 +97,47 @@ func AutoMigrate(db *gorm.DB) error {
 		return err
 	}
 
+	// Голосовые комнаты до появления статусов: неактивные считаем завершенными
+	db.Exec("UPDATE voice_rooms SET status = 'ended' WHERE is_active = false AND status = 'live'")
+
+	// Режимы присутствия раньше писались в users.status; теперь они только в Redis
+	db.Exec("UPDATE users SET status = 'online' WHERE status IN ('invisible', 'dnd', 'idle', 'away', 'busy', 'offline')")
+
+	// Сводки чатов для списка: заполняем из истории сообщений при первом запуске
+	db.Exec("UPDATE chat_members SET updated_at = joined_at WHERE updated_at IS NULL")
+	var summaries int64
+	db.Model(&models.ChatSummary{}).Count(&summaries)
+	if summaries == 0 {
+		db.Exec(`INSERT INTO chat_summaries (chat_id, last_message_id, last_message_at, updated_at)
+			SELECT DISTINCT ON (chat_id) chat_id, id, created_at, NOW() FROM messages
+			WHERE deleted_at IS NULL AND moderation_status = 'approved' AND COALESCE(thread_id, '') = ''
+			ORDER BY chat_id, created_at DESC`)
+	}
+
+	// Сводки тредов, созданных до появления счетчиков ответов
+	db.Exec(`UPDATE threads t SET reply_count = s.replies, last_reply_id = s.last_id, last_reply_at = s.last_at
+		FROM (SELECT DISTINCT ON (thread_id) thread_id, id AS last_id, created_at AS last_at,
+				COUNT(*) OVER (PARTITION BY thread_id) AS replies
+			FROM messages WHERE thread_id <> '' AND deleted_at IS NULL AND moderation_status = 'approved'
+			ORDER BY thread_id, created_at DESC) s
+		WHERE s.thread_id = t.id AND t.last_reply_at IS NULL`)
+
+	// История редактирования из edit_history_json переносится в message_revisions
+	db.Exec(`INSERT INTO message_revisions (id, message_id, revision, chat_id, text, entities_json, authored_at, created_at)
+		SELECT md5(m.id || ':' || h.ord)::uuid::text, m.id, h.ord, m.chat_id,
+			COALESCE(h.entry->>'text', ''), COALESCE((h.entry->'entities')::text, ''),
+			COALESCE((h.entry->>'editedAt')::timestamptz, m.created_at),
+			COALESCE(LEAD((h.entry->>'editedAt')::timestamptz) OVER (PARTITION BY m.id ORDER BY h.ord), m.edited_at, m.created_at)
+		FROM messages m, json_array_elements(m.edit_history_json::json) WITH ORDINALITY AS h(entry, ord)
+		WHERE m.edit_history_json <> ''`)
+	db.Exec(`UPDATE messages m SET revision_count = r.revisions, edit_history_json = ''
+		FROM (SELECT message_id, COUNT(*) AS revisions FROM message_revisions GROUP BY message_id) r
+		WHERE r.message_id = m.id AND m.edit_history_json <> ''`)
+
+	if HasLegacyReadReceipts(db) {
+		log.Println("⚠️  Found legacy message_read_receipts table: run cmd/collapse-read-receipts to move it into read cursors")
+	}
+
 	log.Println("✅ Database migrations completed successfully")
 	return nil
 }
@@ -96,6 +177,20 @@ func CreateIndexes(db *gorm.DB) error {
 		log.Printf("Warning: failed to create index on chat_members.chat: %v", err)
 	}
 
+	// Индексы для ролей и прав
+	if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_member_roles_role_user ON member_roles(role_id, user_id)").Error; err != nil {
+		log.Printf("Warning: failed to create index on member_roles: %v", err)
+	}
+
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_member_roles_scope_user ON member_roles(scope_type, scope_id, user_id)").Error; err != nil {
+		log.Printf("Warning: failed to create index on member_roles.scope: %v", err)
+	}
+
+	// Полнотекстовый поиск по расшифровкам записей
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_call_recordings_transcript ON call_recordings USING GIN (to_tsvector('simple', coalesce(transcript, '')))").Error; err != nil {
+		log.Printf("Warning: failed to create index on call_recordings.transcript: %v", err)
+	}
+
 	log.Println("✅ Database indexes created successfully")
 	return nil
 }
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"gorm.io/gorm"
+)
+
+// legacyReadReceiptsTable таблица поштучных отметок о прочтении, замененная курсорами chat_members
+const legacyReadReceiptsTable = "message_read_receipts"
+
+// HasLegacyReadReceipts в базе осталась таблица старых отметок о прочтении
+func HasLegacyReadReceipts(db *gorm.DB) bool {
+	return db.Migrator().HasTable(legacyReadReceiptsTable)
+}
+
+// CollapseReadReceipts переносит старые отметки о прочтении в курсоры участников:
+// курсор ставится на самое позднее прочитанное сообщение чата, после чего
+// пересчитываются счетчики непрочитанных. Участники с уже выставленным курсором
+// не трогаются, поэтому повторный запуск безопасен. Возвращает число обновленных участников.
+func CollapseReadReceipts(db *gorm.DB) (int64, error) {
+	var updated int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if HasLegacyReadReceipts(tx) {
+			result := tx.Exec(`UPDATE chat_members cm
+				SET last_read_message_id = r.message_id, last_read_at = r.read_at,
+					last_delivered_message_id = r.message_id, last_delivered_at = r.read_at
+				FROM (
+					SELECT DISTINCT ON (m.chat_id, rr.user_id) m.chat_id, rr.user_id, rr.message_id, rr.read_at
+					FROM message_read_receipts rr
+					JOIN messages m ON m.id = rr.message_id
+					ORDER BY m.chat_id, rr.user_id, m.created_at DESC
+				) r
+				WHERE cm.chat_id = r.chat_id AND cm.user_id = r.user_id
+					AND COALESCE(cm.last_read_message_id, '') = ''`)
+			if result.Error != nil {
+				return result.Error
+			}
+			updated = result.RowsAffected
+		}
+
+		return RecountUnread(tx)
+	})
+	return updated, err
+}
+
+// DropLegacyReadReceipts удаляет таблицу старых отметок о прочтении
+func DropLegacyReadReceipts(db *gorm.DB) error {
+	if !HasLegacyReadReceipts(db) {
+		return nil
+	}
+	return db.Migrator().DropTable(legacyReadReceiptsTable)
+}
+
+// RecountUnread пересчитывает счетчики непрочитанных всех участников по их курсорам
+func RecountUnread(db *gorm.DB) error {
+	return db.Exec(`UPDATE chat_members cm SET unread_count = (
+			SELECT COUNT(*) FROM messages m
+			WHERE m.chat_id = cm.chat_id AND m.sender_id <> cm.user_id
+				AND m.deleted_at IS NULL AND m.moderation_status = 'approved'
+				AND COALESCE(m.thread_id, '') = ''
+				AND m.created_at > COALESCE(
+					(SELECT lr.created_at FROM messages lr WHERE lr.id = cm.last_read_message_id),
+					'-infinity'::timestamptz)
+		)
+		WHERE cm.deleted_at IS NULL`).Error
+}
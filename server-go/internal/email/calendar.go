@@ -0,0 +1,306 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Attachment вложение письма
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+}
+
+// CalendarEvent событие для приглашения в формате iCalendar (RFC 5545)
+type CalendarEvent struct {
+	UID            string
+	Sequence       int    // увеличивается при каждом изменении
+	Method         string // REQUEST | CANCEL
+	Title          string
+	Description    string
+	URL            string
+	Start          time.Time
+	End            time.Time
+	OrganizerName  string
+	OrganizerEmail string
+	Attendees      []string
+}
+
+// icsEscape экранирует текст по RFC 5545
+func icsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// icsFold переносит строки длиннее 75 байт
+func icsFold(line string) string {
+	var b strings.Builder
+	for len(line) > 75 {
+		cut := 75
+		// Не разрываем многобайтовый символ
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+	}
+	b.WriteString(line)
+	return b.String()
+}
+
+// ICS формирует файл .ics
+func (e CalendarEvent) ICS() []byte {
+	const layout = "20060102T150405Z"
+	method := e.Method
+	if method == "" {
+		method = "REQUEST"
+	}
+	status := "CONFIRMED"
+	if method == "CANCEL" {
+		status = "CANCELLED"
+	}
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//SafeGram//Meetings//RU",
+		"CALSCALE:GREGORIAN",
+		"METHOD:" + method,
+		"BEGIN:VEVENT",
+		"UID:" + e.UID,
+		fmt.Sprintf("SEQUENCE:%d", e.Sequence),
+		"DTSTAMP:" + time.Now().UTC().Format(layout),
+		"DTSTART:" + e.Start.UTC().Format(layout),
+		"DTEND:" + e.End.UTC().Format(layout),
+		"SUMMARY:" + icsEscape(e.Title),
+		"STATUS:" + status,
+	}
+	if e.Description != "" {
+		lines = append(lines, "DESCRIPTION:"+icsEscape(e.Description))
+	}
+	if e.URL != "" {
+		lines = append(lines, "URL:"+e.URL, "LOCATION:"+icsEscape(e.URL))
+	}
+	if e.OrganizerEmail != "" {
+		lines = append(lines, fmt.Sprintf("ORGANIZER;CN=%s:mailto:%s", icsEscape(e.OrganizerName), e.OrganizerEmail))
+	}
+	for _, attendee := range e.Attendees {
+		lines = append(lines, "ATTENDEE;ROLE=REQ-PARTICIPANT;RSVP=TRUE:mailto:"+attendee)
+	}
+	if method != "CANCEL" {
+		lines = append(lines,
+			"BEGIN:VALARM",
+			"ACTION:DISPLAY",
+			"DESCRIPTION:"+icsEscape(e.Title),
+			"TRIGGER:-PT10M",
+			"END:VALARM",
+		)
+	}
+	lines = append(lines, "END:VEVENT", "END:VCALENDAR")
+
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(icsFold(line) + "\r\n")
+	}
+	return []byte(b.String())
+}
+
+// SendMeetingInvite отправляет приглашение на встречу (или отмену) с файлом .ics
+func SendMeetingInvite(to, username, inviterName string, event CalendarEvent) error {
+	subject := fmt.Sprintf("Приглашение: %s", event.Title)
+	if event.Method == "CANCEL" {
+		subject = fmt.Sprintf("Отменено: %s", event.Title)
+	} else if event.Sequence > 0 {
+		subject = fmt.Sprintf("Изменено: %s", event.Title)
+	}
+	data := EmailTemplateData{
+		Username:    username,
+		InviterName: inviterName,
+		GroupName:   event.Title,
+		Message:     event.Description,
+		Timestamp:   event.Start.Format("02.01.2006 в 15:04 MST"),
+		Link:        event.URL,
+		ActionText:  event.Method,
+	}
+	method := event.Method
+	if method == "" {
+		method = "REQUEST"
+	}
+	return SendEmailWithAttachments(to, subject, TemplateMeetingInvite(data), []Attachment{{
+		Filename:    "invite.ics",
+		ContentType: "text/calendar; charset=UTF-8; method=" + method,
+		Content:     event.ICS(),
+	}})
+}
+
+// SendMeetingReminder напоминает о скорой встрече
+func SendMeetingReminder(to, username, title, startsAt, link string) error {
+	subject := fmt.Sprintf("Скоро начнется: %s", title)
+	data := EmailTemplateData{
+		Username:  username,
+		GroupName: title,
+		Timestamp: startsAt,
+		Link:      link,
+	}
+	return SendEmail(to, subject, TemplateMeetingReminder(data))
+}
+
+// SendEmailWithAttachments отправляет письмо с вложениями через выбранный провайдер
+func SendEmailWithAttachments(to, subject, body string, attachments []Attachment) error {
+	config := LoadConfig()
+
+	if config.Provider == "" || (config.SMTPUser == "" && config.APIKey == "") {
+		fmt.Printf("[EMAIL DEBUG] To: %s, Subject: %s, Attachments: %d\n", to, subject, len(attachments))
+		fmt.Printf("[EMAIL DEBUG] Body: %s\n", body)
+		return nil
+	}
+
+	switch config.Provider {
+	case "gmail", "smtp":
+		return sendAttachmentsViaSMTP(config, to, subject, body, attachments)
+	case "sendgrid":
+		return sendAttachmentsViaJSON(config, sendGridAttachmentPayload(config, to, subject, body, attachments), "sendgrid")
+	case "resend":
+		return sendAttachmentsViaJSON(config, resendAttachmentPayload(config, to, subject, body, attachments), "resend")
+	case "mailgun":
+		return sendAttachmentsViaMailgun(config, to, subject, body, attachments)
+	default:
+		return fmt.Errorf("unsupported email provider: %s", config.Provider)
+	}
+}
+
+// sendAttachmentsViaSMTP собирает multipart/mixed письмо
+func sendAttachmentsViaSMTP(config *EmailConfig, to, subject, body string, attachments []Attachment) error {
+	var msg bytes.Buffer
+	writer := multipart.NewWriter(&msg)
+
+	fmt.Fprintf(&msg, "From: %s <%s>\r\n", config.FromName, config.FromEmail)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", writer.Boundary())
+
+	part, err := writer.CreatePart(map[string][]string{"Content-Type": {"text/html; charset=UTF-8"}})
+	if err != nil {
+		return err
+	}
+	part.Write([]byte(body))
+
+	for _, attachment := range attachments {
+		part, err := writer.CreatePart(map[string][]string{
+			"Content-Type":              {attachment.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf(`attachment; filename="%s"`, attachment.Filename)},
+		})
+		if err != nil {
+			return err
+		}
+		encoded := base64.StdEncoding.EncodeToString(attachment.Content)
+		for len(encoded) > 76 {
+			part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		part.Write([]byte(encoded + "\r\n"))
+	}
+	writer.Close()
+
+	addr := fmt.Sprintf("%s:%s", config.SMTPHost, config.SMTPPort)
+	auth := smtp.PlainAuth("", config.SMTPUser, config.SMTPPass, config.SMTPHost)
+	return smtp.SendMail(addr, auth, config.FromEmail, []string{to}, msg.Bytes())
+}
+
+func sendGridAttachmentPayload(config *EmailConfig, to, subject, body string, attachments []Attachment) interface{} {
+	files := make([]map[string]string, 0, len(attachments))
+	for _, attachment := range attachments {
+		files = append(files, map[string]string{
+			"content":     base64.StdEncoding.EncodeToString(attachment.Content),
+			"filename":    attachment.Filename,
+			"type":        attachment.ContentType,
+			"disposition": "attachment",
+		})
+	}
+	return map[string]interface{}{
+		"personalizations": []map[string]interface{}{{"to": []map[string]string{{"email": to}}}},
+		"from":             map[string]string{"email": config.FromEmail, "name": config.FromName},
+		"subject":          subject,
+		"content":          []map[string]string{{"type": "text/html", "value": body}},
+		"attachments":      files,
+	}
+}
+
+func resendAttachmentPayload(config *EmailConfig, to, subject, body string, attachments []Attachment) interface{} {
+	files := make([]map[string]string, 0, len(attachments))
+	for _, attachment := range attachments {
+		files = append(files, map[string]string{
+			"filename": attachment.Filename,
+			"content":  base64.StdEncoding.EncodeToString(attachment.Content),
+		})
+	}
+	return map[string]interface{}{
+		"from":        fmt.Sprintf("%s <%s>", config.FromName, config.FromEmail),
+		"to":          []string{to},
+		"subject":     subject,
+		"html":        body,
+		"attachments": files,
+	}
+}
+
+// sendAttachmentsViaJSON отправляет письмо через JSON API (SendGrid, Resend)
+func sendAttachmentsViaJSON(config *EmailConfig, payload interface{}, provider string) error {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	if err := sendHTTPRequest(config.APIURL, config.APIKey, string(jsonData)); err != nil {
+		return fmt.Errorf("%s: %w", provider, err)
+	}
+	return nil
+}
+
+// sendAttachmentsViaMailgun отправляет письмо через Mailgun (multipart/form-data)
+func sendAttachmentsViaMailgun(config *EmailConfig, to, subject, body string, attachments []Attachment) error {
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	writer.WriteField("from", fmt.Sprintf("%s <%s>", config.FromName, config.FromEmail))
+	writer.WriteField("to", to)
+	writer.WriteField("subject", subject)
+	writer.WriteField("html", body)
+	for _, attachment := range attachments {
+		part, err := writer.CreateFormFile("attachment", attachment.Filename)
+		if err != nil {
+			return err
+		}
+		part.Write(attachment.Content)
+	}
+	writer.Close()
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+	req, err := http.NewRequest("POST", config.APIURL, &form)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.SetBasicAuth("api", config.APIKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("mailgun error: %d - %s", resp.StatusCode, string(bodyBytes))
+	}
+	return nil
+}
@@ -423,6 +423,16 @@ func SendNewMessageNotification(to, username, senderName, message, chatName, cha
 	return SendEmail(to, subject, htmlBody)
 }
 
+// SendNotificationDigest отправляет дайджест пропущенных уведомлений
+func SendNotificationDigest(to, username, appURL string, items []DigestItem) error {
+	subject := fmt.Sprintf("Пропущенные уведомления: %d", len(items))
+	data := EmailTemplateData{
+		Username: username,
+		Link:     appURL,
+	}
+	return SendEmail(to, subject, TemplateNotificationDigest(data, items))
+}
+
 // SendGroupInvite отправляет приглашение в группу
 func SendGroupInvite(to, username, inviterName, groupName, groupURL string) error {
 	subject := fmt.Sprintf("Приглашение в группу %s", groupName)
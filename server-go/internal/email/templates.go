@@ -2,6 +2,8 @@ package email
 
 import (
 	"fmt"
+	"html"
+	"strings"
 	"time"
 )
 
@@ -634,3 +636,108 @@ func TemplateMaintenanceNotification(data EmailTemplateData) string {
 	)
 	return GetBaseTemplate("Технические работы", content)
 }
+
+// TemplateMeetingInvite шаблон приглашения на встречу
+func TemplateMeetingInvite(data EmailTemplateData) string {
+	heading := "Приглашение на встречу"
+	intro := fmt.Sprintf("<strong>%s</strong> приглашает вас на видеовстречу.", data.InviterName)
+	if data.ActionText == "CANCEL" {
+		heading = "Встреча отменена"
+		intro = "Организатор отменил встречу."
+	}
+	content := fmt.Sprintf(`
+		<h2>%s</h2>
+		<p>Здравствуйте, <strong>%s</strong>!</p>
+		<p>%s</p>
+		<div class="info-box">
+			<p><strong>📅 Встреча:</strong> %s</p>
+			<p><strong>⏰ Начало:</strong> %s</p>
+			%s
+		</div>
+		%s
+		<p style="font-size: 14px; color: rgba(233, 236, 245, 0.7);">
+			Во вложении — файл приглашения для вашего календаря.
+		</p>
+	`,
+		heading,
+		data.Username,
+		intro,
+		data.GroupName,
+		data.Timestamp,
+		func() string {
+			if data.Message != "" {
+				return fmt.Sprintf("<p>%s</p>", data.Message)
+			}
+			return ""
+		}(),
+		func() string {
+			if data.Link != "" && data.ActionText != "CANCEL" {
+				return fmt.Sprintf(`<div style="text-align: center; margin: 30px 0;">
+			<a href="%s" class="button">Присоединиться</a>
+		</div>`, data.Link)
+			}
+			return ""
+		}(),
+	)
+	return GetBaseTemplate(heading, content)
+}
+
+// TemplateMeetingReminder шаблон напоминания о встрече
+func TemplateMeetingReminder(data EmailTemplateData) string {
+	content := fmt.Sprintf(`
+		<h2>⏰ Встреча скоро начнется</h2>
+		<p>Здравствуйте, <strong>%s</strong>!</p>
+		<div class="info-box">
+			<p><strong>📅 Встреча:</strong> %s</p>
+			<p><strong>⏰ Начало:</strong> %s</p>
+		</div>
+		<div style="text-align: center; margin: 30px 0;">
+			<a href="%s" class="button">Присоединиться</a>
+		</div>
+	`,
+		data.Username,
+		data.GroupName,
+		data.Timestamp,
+		data.Link,
+	)
+	return GetBaseTemplate("Напоминание о встрече", content)
+}
+
+// DigestItem строка почтового дайджеста уведомлений
+type DigestItem struct {
+	Title string
+	Body  string
+	Link  string
+}
+
+// TemplateNotificationDigest шаблон дайджеста пропущенных уведомлений
+func TemplateNotificationDigest(data EmailTemplateData, items []DigestItem) string {
+	var rows strings.Builder
+	for _, item := range items {
+		rows.WriteString(fmt.Sprintf(`
+			<div class="info-box">
+				<p><strong>%s</strong></p>
+				<p style="color: rgba(233, 236, 245, 0.8);">%s</p>
+				<p><a href="%s">Открыть</a></p>
+			</div>`,
+			html.EscapeString(item.Title),
+			html.EscapeString(item.Body),
+			item.Link,
+		))
+	}
+	content := fmt.Sprintf(`
+		<h2>Пока вас не было</h2>
+		<p>Здравствуйте, <strong>%s</strong>!</p>
+		<p>Пропущенные уведомления: %d.</p>
+		%s
+		<div style="text-align: center; margin: 30px 0;">
+			<a href="%s" class="button">Открыть SafeGram</a>
+		</div>
+	`,
+		data.Username,
+		len(items),
+		rows.String(),
+		data.Link,
+	)
+	return GetBaseTemplate("Пропущенные уведомления", content)
+}
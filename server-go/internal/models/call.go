@@ -10,7 +10,7 @@ type Call struct {
 	CallerID    string     `gorm:"index;not null" json:"callerId"`
 	ReceiverID  string     `gorm:"index;not null" json:"receiverId"`
 	Type        string     `gorm:"not null" json:"type"` // "voice" | "video"
-	Status      string     `gorm:"index;not null" json:"status"` // "completed" | "missed" | "declined" | "cancelled"
+	Status      string     `gorm:"index;not null" json:"status"` // "ringing" | "answered" | "ended" | "missed" | "declined" | "busy" | "cancelled" ("completed" — устаревшие записи)
 	Duration    int        `json:"duration"` // в секундах
 	StartedAt   time.Time  `gorm:"index" json:"startedAt"`
 	AnsweredAt  *time.Time `json:"answeredAt,omitempty"`
@@ -13,7 +13,13 @@ type Chat struct {
 	Description string    `json:"description,omitempty"`
 	AvatarURL   string    `json:"avatarUrl,omitempty"`
 	CreatedBy   string    `json:"createdBy,omitempty"`
-	InviteLink  string    `gorm:"uniqueIndex;column:invite_link" json:"inviteLink,omitempty"` // Ссылка для приглашения
+	InviteLink  string    `gorm:"uniqueIndex;column:invite_link" json:"inviteLink,omitempty"` // Устаревшая ссылка для приглашения (новые хранятся в invites)
+	LinkPreviews bool     `gorm:"not null;default:true" json:"linkPreviews"` // Превью ссылок в чате (отключается администраторами)
+	EditWindow   int      `gorm:"not null;default:0" json:"editWindow"`      // Сколько секунд после отправки можно редактировать (0 — без ограничения)
+	DeleteWindow int      `gorm:"not null;default:0" json:"deleteWindow"`    // Сколько секунд можно удалять у всех (0 — без ограничения)
+	ReactionMode  string  `gorm:"not null;default:all" json:"reactionMode"`  // Реакции: all, whitelist или none
+	ReactionLimit int     `gorm:"not null;default:1" json:"reactionLimit"`   // Сколько разных реакций участник может поставить на одно сообщение
+	ReactionWhitelistJSON string `gorm:"type:text" json:"-"`               // JSON списка разрешенных реакций (эмодзи или ID пользовательских эмодзи)
 	CreatedAt   time.Time `gorm:"autoCreateTime" json:"createdAt"`
 	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
@@ -30,6 +36,17 @@ type ChatMember struct {
 	Role      string    `gorm:"default:member" json:"role"` // owner, admin, member
 	JoinedAt  time.Time `gorm:"autoCreateTime" json:"joinedAt"`
 	ArchivedAt *time.Time `gorm:"index" json:"archivedAt,omitempty"` // Когда пользователь заархивировал чат
+
+	// Курсоры чтения и доставки: все сообщения не позже курсора считаются прочитанными/доставленными
+	LastReadMessageID      string     `gorm:"size:36" json:"lastReadMessageId,omitempty"`
+	LastReadAt             *time.Time `json:"lastReadAt,omitempty"`
+	LastDeliveredMessageID string     `gorm:"size:36" json:"lastDeliveredMessageId,omitempty"`
+	LastDeliveredAt        *time.Time `json:"lastDeliveredAt,omitempty"`
+	UnreadCount            int        `gorm:"not null;default:0" json:"-"` // Поддерживается инкрементально, отдается только владельцу
+	UnreadMentions         int        `gorm:"not null;default:0" json:"-"` // Непрочитанные упоминания участника
+
+	PinOrder  int       `gorm:"not null;default:0" json:"-"` // Позиция закрепленного чата у пользователя (0 — не закреплен)
+	UpdatedAt time.Time `gorm:"autoUpdateTime;index" json:"-"` // Для дельта-синхронизации списка чатов
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// Relations
@@ -37,6 +54,19 @@ type ChatMember struct {
 	Chat Chat `gorm:"foreignKey:ChatID" json:"chat,omitempty"`
 }
 
+// ChatSummary денормализованная сводка чата для списка чатов;
+// обновляется при создании, редактировании и удалении сообщений
+type ChatSummary struct {
+	ChatID        string     `gorm:"primaryKey" json:"chatId"`
+	LastMessageID string     `gorm:"size:36" json:"lastMessageId,omitempty"`
+	LastMessageAt *time.Time `gorm:"index" json:"lastMessageAt,omitempty"`
+	UpdatedAt     time.Time  `gorm:"index" json:"updatedAt"`
+}
+
+func (ChatSummary) TableName() string {
+	return "chat_summaries"
+}
+
 func (Chat) TableName() string {
 	return "chats"
 }
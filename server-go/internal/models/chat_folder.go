@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// ChatFolder пользовательская папка в списке чатов. Чат попадает в папку, если подходит
+// по типу (с учетом исключений muted/read/archived) или указан явно, и не исключен явно
+type ChatFolder struct {
+	ID              string    `gorm:"primaryKey" json:"id"`
+	UserID          string    `gorm:"index;not null" json:"-"`
+	Name            string    `gorm:"not null" json:"name"`
+	Emoji           string    `json:"emoji,omitempty"`
+	Position        int       `gorm:"not null;default:0" json:"position"`
+	IncludeTypes    string    `gorm:"type:text" json:"-"` // JSON массивы как строки: dm, group, channel
+	IncludeChatIDs  string    `gorm:"type:text" json:"-"`
+	ExcludeChatIDs  string    `gorm:"type:text" json:"-"`
+	ExcludeMuted    bool      `json:"excludeMuted"`
+	ExcludeRead     bool      `json:"excludeRead"`
+	IncludeArchived bool      `json:"includeArchived"`
+	CreatedAt       time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt       time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (ChatFolder) TableName() string {
+	return "chat_folders"
+}
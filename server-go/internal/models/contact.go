@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Правила приватности: кто видит данные пользователя или может с ним взаимодействовать
+const (
+	PrivacyEveryone = "everyone"
+	PrivacyContacts = "contacts"
+	PrivacyNobody   = "nobody"
+)
+
+// Contact пользователь в списке контактов владельца
+type Contact struct {
+	OwnerID   string    `gorm:"primaryKey" json:"ownerId"`
+	ContactID string    `gorm:"primaryKey;index" json:"contactId"`
+	Nickname  string    `json:"nickname,omitempty"` // Имя, под которым владелец видит контакт
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	// Relations
+	Contact User `gorm:"foreignKey:ContactID" json:"contact,omitempty"`
+}
+
+func (Contact) TableName() string {
+	return "contacts"
+}
+
+// UserBlock пользователь BlockedID заблокирован пользователем BlockerID
+type UserBlock struct {
+	BlockerID string    `gorm:"primaryKey" json:"blockerId"`
+	BlockedID string    `gorm:"primaryKey;index" json:"blockedId"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+
+	// Relations
+	Blocked User `gorm:"foreignKey:BlockedID" json:"blocked,omitempty"`
+}
+
+func (UserBlock) TableName() string {
+	return "user_blocks"
+}
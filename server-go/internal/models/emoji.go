@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// CustomEmoji пользовательский эмодзи сервера или группы. Доступен в реакциях
+// всех чатов своей области (каналов сервера или самой группы)
+type CustomEmoji struct {
+	ID        string    `gorm:"primaryKey" json:"id"`
+	ScopeType string    `gorm:"uniqueIndex:idx_custom_emoji_name;not null" json:"scopeType"` // server | chat
+	ScopeID   string    `gorm:"uniqueIndex:idx_custom_emoji_name;not null" json:"scopeId"`
+	Name      string    `gorm:"uniqueIndex:idx_custom_emoji_name;not null" json:"name"` // Короткое имя без двоеточий
+	URL       string    `gorm:"not null" json:"url"`
+	Animated  bool      `json:"animated"`
+	CreatedBy string    `gorm:"index" json:"createdBy"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+func (CustomEmoji) TableName() string {
+	return "custom_emoji"
+}
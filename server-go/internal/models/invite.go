@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Invite ссылка-приглашение в группу/канал или на сервер
+// ScopeType: "chat" | "server"
+type Invite struct {
+	ID               string     `gorm:"primaryKey" json:"id"`
+	Code             string     `gorm:"uniqueIndex;not null" json:"code"`
+	ScopeType        string     `gorm:"index;not null" json:"scopeType"`
+	ScopeID          string     `gorm:"index;not null" json:"scopeId"`
+	Name             string     `json:"name,omitempty"`
+	CreatorID        string     `gorm:"index" json:"creatorId"`
+	ExpiresAt        *time.Time `json:"expiresAt,omitempty"` // nil — бессрочно
+	MaxUses          int        `json:"maxUses"`             // 0 — без ограничений
+	Uses             int        `json:"uses"`
+	RequiresApproval bool       `json:"requiresApproval"` // вступление только после одобрения заявки
+	RevokedAt        *time.Time `gorm:"index" json:"revokedAt,omitempty"`
+	RevokedBy        string     `json:"revokedBy,omitempty"`
+	CreatedAt        time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+func (Invite) TableName() string {
+	return "invites"
+}
+
+// JoinRequest заявка на вступление по ссылке с одобрением
+// Status: "pending" | "approved" | "rejected"
+type JoinRequest struct {
+	ID         string     `gorm:"primaryKey" json:"id"`
+	InviteID   string     `gorm:"index;not null" json:"inviteId"`
+	ScopeType  string     `gorm:"index;not null" json:"scopeType"`
+	ScopeID    string     `gorm:"index;not null" json:"scopeId"`
+	UserID     string     `gorm:"index;not null" json:"userId"`
+	Message    string     `gorm:"type:text" json:"message,omitempty"`
+	Status     string     `gorm:"index;default:pending" json:"status"`
+	ReviewerID string     `json:"reviewerId,omitempty"`
+	ReviewedAt *time.Time `json:"reviewedAt,omitempty"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime;index" json:"createdAt"`
+
+	// Relations
+	User User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+func (JoinRequest) TableName() string {
+	return "join_requests"
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// LinkPreview кэш превью ссылки; ключ — SHA-256 нормализованного URL.
+// Неудачные попытки тоже сохраняются (Status = failed), чтобы не повторять их до истечения срока
+type LinkPreview struct {
+	URLHash     string    `gorm:"primaryKey;size:64" json:"-"`
+	URL         string    `gorm:"type:text;not null" json:"url"`
+	Status      string    `gorm:"not null;default:ok" json:"-"` // ok | failed
+	Type        string    `json:"type,omitempty"`
+	SiteName    string    `json:"siteName,omitempty"`
+	Title       string    `gorm:"type:text" json:"title,omitempty"`
+	Description string    `gorm:"type:text" json:"description,omitempty"`
+	ImageURL    string    `json:"imageUrl,omitempty"` // локальная копия в uploads/previews
+	FetchedAt   time.Time `gorm:"index" json:"fetchedAt"`
+}
+
+func (LinkPreview) TableName() string {
+	return "link_previews"
+}
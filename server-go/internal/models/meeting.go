@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// Meeting запланированная встреча в чате или голосовом канале сервера
+// Status: "scheduled" | "live" | "ended" | "cancelled"
+type Meeting struct {
+	ID              string     `gorm:"primaryKey" json:"id"`
+	ChatID          string     `gorm:"index;not null" json:"chatId"`
+	ChannelID       string     `gorm:"index" json:"channelId,omitempty"` // канал сервера, если встреча в нем
+	CreatedBy       string     `gorm:"index;not null" json:"createdBy"`
+	Title           string     `gorm:"not null" json:"title"`
+	Description     string     `gorm:"type:text" json:"description,omitempty"`
+	StartsAt        time.Time  `gorm:"index;not null" json:"startsAt"`
+	EndsAt          time.Time  `json:"endsAt"`
+	Status          string     `gorm:"index;not null" json:"status"`
+	JoinCode        string     `gorm:"uniqueIndex;not null" json:"joinCode"`
+	LobbyEnabled    bool       `json:"lobbyEnabled"`  // участники чата тоже ждут в лобби
+	GuestsAllowed   bool       `json:"guestsAllowed"` // вход по ссылке без аккаунта
+	ReminderMinutes int        `json:"reminderMinutes"`
+	ReminderSentAt  *time.Time `json:"reminderSentAt,omitempty"`
+	Sequence        int        `json:"-"` // версия для .ics
+	GroupCallID     *string    `gorm:"index" json:"groupCallId,omitempty"`
+	StartedAt       *time.Time `json:"startedAt,omitempty"`
+	EndedAt         *time.Time `json:"endedAt,omitempty"`
+	CreatedAt       time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt       time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (Meeting) TableName() string {
+	return "meetings"
+}
+
+// MeetingInvitee приглашенный: пользователь или внешний email
+type MeetingInvitee struct {
+	ID          string     `gorm:"primaryKey" json:"id"`
+	MeetingID   string     `gorm:"index;not null" json:"meetingId"`
+	UserID      *string    `gorm:"index" json:"userId,omitempty"`
+	Email       string     `json:"email,omitempty"`
+	Response    string     `gorm:"default:pending" json:"response"` // pending | accepted | declined
+	EmailSentAt *time.Time `json:"emailSentAt,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+func (MeetingInvitee) TableName() string {
+	return "meeting_invitees"
+}
+
+// MeetingLobbyEntry ожидающий допуска в лобби
+// Status: "waiting" | "admitted" | "denied" | "left"
+type MeetingLobbyEntry struct {
+	ID         string     `gorm:"primaryKey" json:"id"`
+	MeetingID  string     `gorm:"index;not null" json:"meetingId"`
+	UserID     *string    `gorm:"index" json:"userId,omitempty"` // nil — гость
+	GuestName  string     `json:"guestName,omitempty"`
+	SecretHash string     `json:"-"` // ключ гостя для опроса статуса
+	Status     string     `gorm:"index;not null" json:"status"`
+	DecidedBy  string     `json:"decidedBy,omitempty"`
+	DecidedAt  *time.Time `json:"decidedAt,omitempty"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+func (MeetingLobbyEntry) TableName() string {
+	return "meeting_lobby_entries"
+}
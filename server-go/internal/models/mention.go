@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// MessageMention упомянутый в сообщении пользователь: основа входящих упоминаний
+// и счетчиков непрочитанных упоминаний
+type MessageMention struct {
+	ID        string    `gorm:"primaryKey" json:"id"`
+	MessageID string    `gorm:"uniqueIndex:idx_message_mention;not null" json:"messageId"`
+	UserID    string    `gorm:"uniqueIndex:idx_message_mention;index:idx_mentions_user_created,priority:1;not null" json:"userId"`
+	ChatID    string    `gorm:"index;not null" json:"chatId"`
+	Kind      string    `gorm:"not null" json:"kind"` // user | role | everyone | here
+	CreatedAt time.Time `gorm:"autoCreateTime;index:idx_mentions_user_created,priority:2" json:"createdAt"`
+}
+
+func (MessageMention) TableName() string {
+	return "message_mentions"
+}
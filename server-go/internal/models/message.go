@@ -22,15 +22,21 @@ type Message struct {
 	LocationLon *float64  `json:"locationLon,omitempty"`
 	EditedAt    *time.Time `json:"editedAt,omitempty"`
 	DeletedAt   *time.Time `gorm:"index" json:"deletedAt,omitempty"`
+	DeletedBy   string    `json:"deletedBy,omitempty"` // sender | moderator
 	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
 	CreatedAt   time.Time `gorm:"autoCreateTime;index" json:"createdAt"`
 	
 	// Новые типы сообщений
 	PollID      string    `gorm:"index" json:"pollId,omitempty"` // ID опроса
+	StoryID     string    `gorm:"index" json:"storyId,omitempty"` // ответ на историю
 	CalendarEventJSON string `gorm:"type:text" json:"-"` // JSON календарного события
 	ContactJSON string    `gorm:"type:text" json:"-"` // JSON контакта
 	DocumentJSON string   `gorm:"type:text" json:"-"` // JSON документа
-	EditHistoryJSON string `gorm:"type:text" json:"-"` // JSON истории редактирования
+	EditHistoryJSON string `gorm:"type:text" json:"-"` // Устарело: история переносится в message_revisions при миграции
+	RevisionCount int     `gorm:"not null;default:0" json:"revisionCount,omitempty"` // Число прежних версий в message_revisions
+	MentionsJSON string   `gorm:"type:text" json:"-"` // JSON упоминаний (offset/length в UTF-16)
+	EntitiesJSON string   `gorm:"type:text" json:"-"` // JSON форматирования текста (offset/length в UTF-16)
+	PreviewJSON string    `gorm:"type:text" json:"-"` // JSON превью первой ссылки (заполняется асинхронно)
 
 	// Relations
 	Sender User `gorm:"foreignKey:SenderID" json:"sender,omitempty"`
@@ -40,17 +46,39 @@ type Message struct {
 }
 
 type MessageReaction struct {
-	ID        string    `gorm:"primaryKey" json:"id"`
-	MessageID string    `gorm:"index;not null" json:"messageId"`
-	UserID    string    `gorm:"index;not null" json:"userId"`
-	Emoji     string    `gorm:"not null" json:"emoji"`
-	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	ID            string    `gorm:"primaryKey" json:"id"`
+	MessageID     string    `gorm:"index;uniqueIndex:idx_message_reaction;not null" json:"messageId"`
+	UserID        string    `gorm:"index;uniqueIndex:idx_message_reaction;not null" json:"userId"`
+	Emoji         string    `gorm:"uniqueIndex:idx_message_reaction;not null" json:"emoji"`                            // Для пользовательского эмодзи — :name:
+	CustomEmojiID string    `gorm:"index;uniqueIndex:idx_message_reaction;not null;default:''" json:"customEmojiId,omitempty"` // models.CustomEmoji
+	CreatedAt     time.Time `gorm:"autoCreateTime" json:"createdAt"`
 
 	// Relations
 	Message Message `gorm:"foreignKey:MessageID" json:"-"`
 	User    User    `gorm:"foreignKey:UserID" json:"user,omitempty"`
 }
 
+// MessageRevision прежняя версия текста сообщения, сохраняется при каждом редактировании
+type MessageRevision struct {
+	ID           string    `gorm:"primaryKey" json:"id"`
+	MessageID    string    `gorm:"uniqueIndex:idx_message_revision;not null" json:"messageId"`
+	Revision     int       `gorm:"uniqueIndex:idx_message_revision;not null" json:"revision"` // 1 — исходный текст
+	ChatID       string    `gorm:"index;not null" json:"chatId"`
+	Text         string    `gorm:"type:text" json:"text"`
+	EntitiesJSON string    `gorm:"type:text" json:"-"`
+	AuthoredAt   time.Time `json:"authoredAt"`                       // Когда версия появилась
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"replacedAt"` // Когда ее заменила следующая
+}
+
+// HiddenMessage сообщение, удаленное пользователем только у себя
+type HiddenMessage struct {
+	ID        string    `gorm:"primaryKey" json:"id"`
+	UserID    string    `gorm:"uniqueIndex:idx_hidden_message;not null" json:"userId"`
+	MessageID string    `gorm:"uniqueIndex:idx_hidden_message;not null" json:"messageId"`
+	ChatID    string    `gorm:"index;not null" json:"chatId"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"createdAt"`
+}
+
 func (Message) TableName() string {
 	return "messages"
 }
@@ -59,3 +87,11 @@ func (MessageReaction) TableName() string {
 	return "message_reactions"
 }
 
+func (MessageRevision) TableName() string {
+	return "message_revisions"
+}
+
+func (HiddenMessage) TableName() string {
+	return "hidden_messages"
+}
+
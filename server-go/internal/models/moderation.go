@@ -16,6 +16,7 @@ type ChatModerationSettings struct {
 	WarnThreshold      int    `gorm:"default:2" json:"warnThreshold"`         // после N предупреждений — бан
 	BanMinutes         int    `gorm:"default:10" json:"banMinutes"`           // длительность временного бана
 	QueueOnViolation   bool   `gorm:"default:false" json:"queueOnViolation"`  // отправлять в мод-очередь вместо автоделита
+	DryRun             bool   `gorm:"default:false" json:"dryRun"`            // правила только логируются, без действий
 	UpdatedAt          time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
 }
 
@@ -53,6 +54,77 @@ func (ChatBan) TableName() string {
 	return "chat_bans"
 }
 
+// ChatMute запрет писать в чат (таймаут)
+type ChatMute struct {
+	ID        string     `gorm:"primaryKey" json:"id"`
+	ChatID    string     `gorm:"index;not null" json:"chatId"`
+	UserID    string     `gorm:"index;not null" json:"userId"`
+	ActorID   string     `gorm:"index" json:"actorId,omitempty"`
+	Reason    string     `gorm:"type:text" json:"reason,omitempty"`
+	ExpiresAt *time.Time `gorm:"index" json:"expiresAt,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime;index" json:"createdAt"`
+}
+
+func (ChatMute) TableName() string {
+	return "chat_mutes"
+}
+
+// ServerBan бан на сервере: действует во всех каналах сервера
+type ServerBan struct {
+	ID        string         `gorm:"primaryKey" json:"id"`
+	ServerID  string         `gorm:"index;not null" json:"serverId"`
+	UserID    string         `gorm:"index;not null" json:"userId"`
+	ActorID   string         `gorm:"index" json:"actorId,omitempty"`
+	Reason    string         `gorm:"type:text" json:"reason,omitempty"`
+	ExpiresAt *time.Time     `gorm:"index" json:"expiresAt,omitempty"` // nil — бессрочно
+	CreatedAt time.Time      `gorm:"autoCreateTime;index" json:"createdAt"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+func (ServerBan) TableName() string {
+	return "server_bans"
+}
+
+// ServerTimeout таймаут на сервере: нельзя писать, реагировать и заходить в голос
+type ServerTimeout struct {
+	ID        string    `gorm:"primaryKey" json:"id"`
+	ServerID  string    `gorm:"index;not null" json:"serverId"`
+	UserID    string    `gorm:"index;not null" json:"userId"`
+	ActorID   string    `gorm:"index" json:"actorId,omitempty"`
+	Reason    string    `gorm:"type:text" json:"reason,omitempty"`
+	ExpiresAt time.Time `gorm:"index;not null" json:"expiresAt"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"createdAt"`
+}
+
+func (ServerTimeout) TableName() string {
+	return "server_timeouts"
+}
+
+// ModerationRule правило автомодерации чата
+// Condition: "regex" | "banned_words" | "links" | "invites" | "caps" | "flood" | "account_age" | "repeated_text"
+// Actions: CSV из "delete" | "queue" | "warn" | "mute" | "temp_ban" | "kick"
+type ModerationRule struct {
+	ID              string    `gorm:"primaryKey" json:"id"`
+	ChatID          string    `gorm:"index;not null" json:"chatId"`
+	Name            string    `gorm:"not null" json:"name"`
+	Enabled         bool      `json:"enabled"`
+	DryRun          bool      `gorm:"default:false" json:"dryRun"`
+	Priority        int       `json:"priority"` // правила проверяются по возрастанию
+	Condition       string    `gorm:"not null" json:"condition"`
+	Pattern         string    `gorm:"type:text" json:"pattern,omitempty"` // regex, список слов или разрешенных доменов
+	Threshold       int       `json:"threshold,omitempty"`                // % капса, кол-во сообщений, возраст аккаунта в минутах
+	WindowSeconds   int       `json:"windowSeconds,omitempty"`            // окно для flood/repeated_text
+	Actions         string    `gorm:"not null" json:"actions"`
+	DurationMinutes int       `json:"durationMinutes,omitempty"` // для mute/temp_ban
+	CreatedBy       string    `json:"createdBy,omitempty"`
+	CreatedAt       time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt       time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (ModerationRule) TableName() string {
+	return "moderation_rules"
+}
+
 // ModerationLog лог действий модераторов
 type ModerationLog struct {
 	ID        string    `gorm:"primaryKey" json:"id"`
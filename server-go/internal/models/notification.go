@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// NotificationSettings глобальные настройки уведомлений пользователя
+type NotificationSettings struct {
+	UserID    string `gorm:"primaryKey" json:"-"`
+	Messages  bool   `json:"messages"`
+	Mentions  bool   `json:"mentions"`
+	Reactions bool   `json:"reactions"`
+	Calls     bool   `json:"calls"`
+	Groups    bool   `json:"groups"`
+	Servers   bool   `json:"servers"`
+	Email     bool   `json:"email"` // Дайджест по почте для пропущенного, пока пользователь не в сети
+	Push      bool   `json:"push"`
+	// Расписание «не беспокоить» в часовом поясе пользователя (HH:MM, может переходить через полночь)
+	DNDEnabled bool      `json:"dndEnabled"`
+	DNDStart   string    `json:"dndStart"`
+	DNDEnd     string    `json:"dndEnd"`
+	TimeZone   string    `json:"timeZone"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (NotificationSettings) TableName() string {
+	return "notification_settings"
+}
+
+// NotificationPreference настройки уведомлений для отдельного чата или сервера
+type NotificationPreference struct {
+	ID         string     `gorm:"primaryKey" json:"id"`
+	UserID     string     `gorm:"uniqueIndex:idx_notification_pref;not null" json:"userId"`
+	ScopeType  string     `gorm:"uniqueIndex:idx_notification_pref;not null" json:"scopeType"` // chat | server
+	ScopeID    string     `gorm:"uniqueIndex:idx_notification_pref;not null" json:"scopeId"`
+	MutedUntil *time.Time `json:"mutedUntil,omitempty"`
+	Level      string     `gorm:"not null;default:all" json:"level"` // all | mentions | none
+	Keywords   string     `gorm:"type:text" json:"-"`                // JSON массив как строка
+	Sound      string     `json:"sound,omitempty"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt  time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (NotificationPreference) TableName() string {
+	return "notification_preferences"
+}
+
+// NotificationDigestItem уведомление, ожидающее отправки в почтовом дайджесте
+type NotificationDigestItem struct {
+	ID        string    `gorm:"primaryKey" json:"id"`
+	UserID    string    `gorm:"index;not null" json:"userId"`
+	Kind      string    `gorm:"not null" json:"kind"` // message | mention | reaction | call
+	ChatID    string    `json:"chatId,omitempty"`
+	Title     string    `json:"title"`
+	Body      string    `gorm:"type:text" json:"body"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"createdAt"`
+}
+
+func (NotificationDigestItem) TableName() string {
+	return "notification_digest_items"
+}
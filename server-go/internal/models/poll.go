@@ -14,6 +14,17 @@ type Poll struct {
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
+	// Режимы опроса
+	MultipleChoice     bool       `gorm:"not null;default:false" json:"multipleChoice"`
+	Anonymous          bool       `gorm:"not null;default:false" json:"anonymous"` // Результаты без списка проголосовавших
+	Quiz               bool       `gorm:"not null;default:false" json:"quiz"`      // Викторина: один правильный ответ, голос не меняется
+	CorrectOptionID    string     `json:"-"`                                       // Раскрывается проголосовавшим и после закрытия
+	Explanation        string     `gorm:"type:text" json:"-"`
+	AllowAddingOptions bool       `gorm:"not null;default:false" json:"allowAddingOptions"` // Варианты могут добавлять все участники
+	CloseAt            *time.Time `gorm:"index" json:"closeAt,omitempty"`                   // Автоматическое закрытие
+	ClosedAt           *time.Time `json:"closedAt,omitempty"`
+	ClosedBy           string     `json:"closedBy,omitempty"`
+
 	// Relations
 	Message Message `gorm:"foreignKey:MessageID;references:ID" json:"-"`
 	Options []PollOption `gorm:"foreignKey:PollID" json:"options"`
@@ -21,17 +32,18 @@ type Poll struct {
 }
 
 type PollOption struct {
-	ID     string `gorm:"primaryKey" json:"id"`
-	PollID string `gorm:"index;not null" json:"pollId"`
-	Text   string `gorm:"not null" json:"text"`
-	Order  int    `json:"order"`
+	ID      string `gorm:"primaryKey" json:"id"`
+	PollID  string `gorm:"index;not null" json:"pollId"`
+	Text    string `gorm:"not null" json:"text"`
+	Order   int    `json:"order"`
+	AddedBy string `json:"addedBy,omitempty"` // Автор варианта, добавленного после создания опроса
 }
 
 type PollVote struct {
 	ID         string    `gorm:"primaryKey" json:"id"`
-	PollID     string    `gorm:"index;not null" json:"pollId"`
-	OptionID   string    `gorm:"index;not null" json:"optionId"`
-	UserID     string    `gorm:"index;not null" json:"userId"`
+	PollID     string    `gorm:"index;uniqueIndex:idx_poll_vote;not null" json:"pollId"`
+	OptionID   string    `gorm:"index;uniqueIndex:idx_poll_vote;not null" json:"optionId"`
+	UserID     string    `gorm:"index;uniqueIndex:idx_poll_vote;not null" json:"userId"`
 	CreatedAt  time.Time `gorm:"autoCreateTime" json:"createdAt"`
 
 	// Relations
@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// CallRecording запись звонка, группового звонка или голосовой комнаты
+// CallKind: "call" | "group_call" | "voice_room"
+// Status: "pending_consent" | "declined" | "cancelled" | "recording" | "stopped" (ждем файл от клиента) | "processing" | "ready" | "failed" | "expired"
+// Source: "sfu" — пишет сервер | "client" — файл загружает участник
+// TranscriptStatus: "none" | "pending" | "done" | "failed"
+type CallRecording struct {
+	ID               string     `gorm:"primaryKey" json:"id"`
+	CallID           string     `gorm:"index;not null" json:"callId"`
+	CallKind         string     `gorm:"not null" json:"callKind"`
+	ChatID           string     `gorm:"index;not null" json:"chatId"`
+	StartedBy        string     `gorm:"not null" json:"startedBy"`
+	Status           string     `gorm:"index;not null" json:"status"`
+	Source           string     `gorm:"not null" json:"source"`
+	Participants     string     `gorm:"type:text" json:"-"` // JSON: участники, чье согласие требуется
+	FilePath         string     `json:"-"`
+	URL              string     `json:"url,omitempty"`
+	Size             int64      `json:"size"`
+	Duration         int        `json:"duration"` // в секундах
+	StartedAt        *time.Time `json:"startedAt,omitempty"`
+	StoppedAt        *time.Time `json:"stoppedAt,omitempty"`
+	ExpiresAt        *time.Time `gorm:"index" json:"expiresAt,omitempty"`
+	TranscriptStatus string     `gorm:"default:none" json:"transcriptStatus"`
+	Transcript       string     `gorm:"type:text" json:"transcript,omitempty"`
+	TranscriptJSON   string     `gorm:"type:text" json:"-"` // сегменты с таймкодами
+	Language         string     `json:"language,omitempty"`
+	Error            string     `json:"error,omitempty"`
+	CreatedAt        time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+func (CallRecording) TableName() string {
+	return "call_recordings"
+}
+
+// RecordingConsent ответ участника на запрос записи
+type RecordingConsent struct {
+	ID          string    `gorm:"primaryKey" json:"id"`
+	RecordingID string    `gorm:"uniqueIndex:idx_recording_consent;not null" json:"recordingId"`
+	UserID      string    `gorm:"uniqueIndex:idx_recording_consent;not null" json:"userId"`
+	Consented   bool      `json:"consented"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+func (RecordingConsent) TableName() string {
+	return "recording_consents"
+}
+
+// RecordingPolicy политика записей чата: запрет, срок хранения, расшифровка
+type RecordingPolicy struct {
+	ChatID        string    `gorm:"primaryKey" json:"chatId"`
+	Disabled      bool      `json:"disabled"`      // запись звонков запрещена
+	RetentionDays int       `json:"retentionDays"` // 0 — по умолчанию сервера
+	Transcribe    bool      `json:"transcribe"`
+	UpdatedBy     string    `json:"updatedBy"`
+	UpdatedAt     time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (RecordingPolicy) TableName() string {
+	return "recording_policies"
+}
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// Report жалоба пользователя
+// TargetType: "message" | "user" | "chat" | "story"
+// Status: "open" | "in_review" | "resolved" | "dismissed"
+// Resolution: "warn" | "ban" | "delete" | "dismiss"
+type Report struct {
+	ID             string     `gorm:"primaryKey" json:"id"`
+	ReporterID     string     `gorm:"index;not null" json:"reporterId"`
+	TargetType     string     `gorm:"index;not null" json:"targetType"`
+	TargetID       string     `gorm:"index;not null" json:"targetId"`
+	TargetUserID   string     `gorm:"index" json:"targetUserId,omitempty"` // автор сообщения/истории или сам пользователь
+	ChatID         string     `gorm:"index" json:"chatId,omitempty"`
+	Reason         string     `gorm:"not null" json:"reason"` // spam | abuse | violence | nsfw | scam | other
+	Comment        string     `gorm:"type:text" json:"comment,omitempty"`
+	Evidence       string     `gorm:"type:text" json:"evidence,omitempty"` // JSON снимок объекта на момент жалобы
+	Status         string     `gorm:"index;default:open" json:"status"`
+	AssigneeID     string     `gorm:"index" json:"assigneeId,omitempty"`
+	Resolution     string     `json:"resolution,omitempty"`
+	ResolutionNote string     `gorm:"type:text" json:"resolutionNote,omitempty"`
+	ResolvedBy     string     `json:"resolvedBy,omitempty"`
+	ResolvedAt     *time.Time `json:"resolvedAt,omitempty"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime;index" json:"createdAt"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (Report) TableName() string {
+	return "reports"
+}
+
+// Appeal апелляция на бан
+// Scope: "platform" (блокировка аккаунта) | "chat" (бан в чате)
+// Status: "pending" | "accepted" | "rejected"
+type Appeal struct {
+	ID         string     `gorm:"primaryKey" json:"id"`
+	UserID     string     `gorm:"index;not null" json:"userId"`
+	Scope      string     `gorm:"not null" json:"scope"`
+	ChatID     string     `gorm:"index" json:"chatId,omitempty"`
+	ReportID   string     `gorm:"index" json:"reportId,omitempty"` // жалоба, по которой был выдан бан
+	Text       string     `gorm:"type:text;not null" json:"text"`
+	Status     string     `gorm:"index;default:pending" json:"status"`
+	ReviewerID string     `json:"reviewerId,omitempty"`
+	ReviewNote string     `gorm:"type:text" json:"reviewNote,omitempty"`
+	ReviewedAt *time.Time `json:"reviewedAt,omitempty"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime;index" json:"createdAt"`
+}
+
+func (Appeal) TableName() string {
+	return "appeals"
+}
+
+// Feedback обратная связь от пользователей
+type Feedback struct {
+	ID        string    `gorm:"primaryKey" json:"id"`
+	UserID    string    `gorm:"index;not null" json:"userId"`
+	Subject   string    `gorm:"not null" json:"subject"`
+	Body      string    `gorm:"type:text;not null" json:"body"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"createdAt"`
+}
+
+func (Feedback) TableName() string {
+	return "feedback"
+}
@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// Role пользовательская роль в группе или на сервере (как в Discord)
+// ScopeType: "chat" | "server"
+type Role struct {
+	ID          string    `gorm:"primaryKey" json:"id"`
+	ScopeType   string    `gorm:"index;not null" json:"scopeType"`
+	ScopeID     string    `gorm:"index;not null" json:"scopeId"`
+	Name        string    `gorm:"not null" json:"name"`
+	Color       string    `json:"color,omitempty"`
+	Position    int       `json:"position"`                             // чем больше, тем выше в иерархии
+	Permissions int64     `json:"permissions"`                          // битовая маска authz.Permission
+	IsDefault   bool      `gorm:"default:false;index" json:"isDefault"` // роль @everyone, есть у всех участников
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (Role) TableName() string {
+	return "roles"
+}
+
+// MemberRole назначение роли участнику группы/сервера
+type MemberRole struct {
+	ID        string    `gorm:"primaryKey" json:"id"`
+	RoleID    string    `gorm:"index;not null" json:"roleId"`
+	ScopeType string    `gorm:"index;not null" json:"scopeType"`
+	ScopeID   string    `gorm:"index;not null" json:"scopeId"`
+	UserID    string    `gorm:"index;not null" json:"userId"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+func (MemberRole) TableName() string {
+	return "member_roles"
+}
+
+// PermissionOverwrite переопределение прав для канала или категории сервера
+// TargetType: "channel" | "category"
+// SubjectType: "everyone" | "role" | "member"
+type PermissionOverwrite struct {
+	ID          string    `gorm:"primaryKey" json:"id"`
+	ServerID    string    `gorm:"index;not null" json:"serverId"`
+	TargetType  string    `gorm:"not null" json:"targetType"`
+	TargetID    string    `gorm:"index;not null" json:"targetId"`
+	SubjectType string    `gorm:"not null" json:"subjectType"`
+	SubjectID   string    `gorm:"index" json:"subjectId,omitempty"` // ID роли или пользователя (пусто для everyone)
+	Allow       int64     `json:"allow"`
+	Deny        int64     `json:"deny"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (PermissionOverwrite) TableName() string {
+	return "permission_overwrites"
+}
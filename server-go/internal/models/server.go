@@ -10,7 +10,7 @@ type Server struct {
 	Description string    `json:"description,omitempty"`
 	OwnerID     string    `gorm:"index;not null" json:"ownerId"`
 	IconURL     string    `json:"iconUrl,omitempty"`
-	InviteLink  string    `gorm:"uniqueIndex;column:invite_link" json:"inviteLink,omitempty"` // Ссылка-приглашение на сервер
+	InviteLink  string    `gorm:"uniqueIndex;column:invite_link" json:"inviteLink,omitempty"` // Устаревшая ссылка-приглашение (новые хранятся в invites)
 	CreatedAt   time.Time `gorm:"autoCreateTime" json:"createdAt"`
 	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
 }
@@ -4,26 +4,29 @@ import "time"
 
 // Story представляет историю/статус пользователя
 type Story struct {
-	ID          string    `gorm:"primaryKey" json:"id"`
-	UserID      string    `gorm:"index;not null" json:"userId"`
-	Type        string    `gorm:"not null" json:"type"` // image, video, text
-	ContentURL  string    `json:"contentUrl,omitempty"` // URL изображения/видео
-	Text        string    `json:"text,omitempty"`       // Текст для текстовых историй
-	BackgroundColor string `json:"backgroundColor,omitempty"` // Цвет фона для текстовых историй
-	ExpiresAt   time.Time `gorm:"index;not null" json:"expiresAt"` // Время истечения (обычно 24 часа)
-	CreatedAt   time.Time `gorm:"autoCreateTime;index" json:"createdAt"`
+	ID              string    `gorm:"primaryKey" json:"id"`
+	UserID          string    `gorm:"index;not null" json:"userId"`
+	Type            string    `gorm:"not null" json:"type"`      // image, video, text
+	ContentURL      string    `json:"contentUrl,omitempty"`      // URL изображения/видео
+	Text            string    `json:"text,omitempty"`            // Текст для текстовых историй
+	BackgroundColor string    `json:"backgroundColor,omitempty"` // Цвет фона для текстовых историй
+	Caption         string    `json:"caption,omitempty"`
+	Audience        string    `gorm:"not null;default:everyone" json:"audience"` // everyone | contacts | close_friends
+	RepliesDisabled bool      `json:"repliesDisabled"`
+	ExpiresAt       time.Time `gorm:"index;not null" json:"expiresAt"` // Время истечения (обычно 24 часа)
+	CreatedAt       time.Time `gorm:"autoCreateTime;index" json:"createdAt"`
 
 	// Relations
-	User User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	User  User        `gorm:"foreignKey:UserID" json:"user,omitempty"`
 	Views []StoryView `gorm:"foreignKey:StoryID" json:"views,omitempty"`
 }
 
 // StoryView представляет просмотр истории пользователем
 type StoryView struct {
-	ID        string    `gorm:"primaryKey" json:"id"`
-	StoryID   string    `gorm:"index;not null" json:"storyId"`
-	UserID    string    `gorm:"index;not null" json:"userId"`
-	ViewedAt  time.Time `gorm:"autoCreateTime" json:"viewedAt"`
+	ID       string    `gorm:"primaryKey" json:"id"`
+	StoryID  string    `gorm:"index;not null" json:"storyId"`
+	UserID   string    `gorm:"index;not null" json:"userId"`
+	ViewedAt time.Time `gorm:"autoCreateTime" json:"viewedAt"`
 
 	// Relations
 	Story Story `gorm:"foreignKey:StoryID" json:"-"`
@@ -38,3 +41,64 @@ func (StoryView) TableName() string {
 	return "story_views"
 }
 
+// StoryReaction реакция на историю (одна на пользователя)
+type StoryReaction struct {
+	ID        string    `gorm:"primaryKey" json:"id"`
+	StoryID   string    `gorm:"uniqueIndex:idx_story_reaction;not null" json:"storyId"`
+	UserID    string    `gorm:"uniqueIndex:idx_story_reaction;not null" json:"userId"`
+	Emoji     string    `gorm:"not null" json:"emoji"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// StoryCloseFriend пользователь из списка «близкие друзья» автора
+type StoryCloseFriend struct {
+	OwnerID   string    `gorm:"primaryKey" json:"ownerId"`
+	UserID    string    `gorm:"primaryKey" json:"userId"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// StoryHiddenUser пользователь, от которого автор скрывает все свои истории
+type StoryHiddenUser struct {
+	OwnerID   string    `gorm:"primaryKey" json:"ownerId"`
+	UserID    string    `gorm:"primaryKey" json:"userId"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// StoryHighlight постоянный альбом историй в профиле
+type StoryHighlight struct {
+	ID        string    `gorm:"primaryKey" json:"id"`
+	UserID    string    `gorm:"index;not null" json:"userId"`
+	Title     string    `gorm:"not null" json:"title"`
+	CoverURL  string    `json:"coverUrl,omitempty"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// StoryHighlightItem история в альбоме; такие истории не удаляются по истечении
+type StoryHighlightItem struct {
+	HighlightID string    `gorm:"primaryKey" json:"highlightId"`
+	StoryID     string    `gorm:"primaryKey;index" json:"storyId"`
+	Position    int       `json:"position"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+func (StoryReaction) TableName() string {
+	return "story_reactions"
+}
+
+func (StoryCloseFriend) TableName() string {
+	return "story_close_friends"
+}
+
+func (StoryHiddenUser) TableName() string {
+	return "story_hidden_users"
+}
+
+func (StoryHighlight) TableName() string {
+	return "story_highlights"
+}
+
+func (StoryHighlightItem) TableName() string {
+	return "story_highlight_items"
+}
@@ -4,15 +4,42 @@ import (
 	"time"
 )
 
+// Thread ветка обсуждения вокруг сообщения. Ответы (Message.ThreadID) не попадают в основную
+// ленту чата; сводка ответов хранится здесь и обновляется при каждом изменении треда
 type Thread struct {
-	ID           string    `gorm:"primaryKey" json:"id"`
-	ChatID       string    `gorm:"index;not null" json:"chatId"`
-	RootMessageID string   `gorm:"index;not null" json:"rootMessageId"`
-	Name         string    `json:"name,omitempty"`
-	CreatedAt    time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	ID            string     `gorm:"primaryKey" json:"id"`
+	ChatID        string     `gorm:"index;not null" json:"chatId"`
+	RootMessageID string     `gorm:"index;not null" json:"rootMessageId"`
+	Name          string     `json:"name,omitempty"`
+	CreatedBy     string     `gorm:"index" json:"createdBy,omitempty"`
+	ReplyCount    int        `gorm:"not null;default:0" json:"replyCount"`
+	LastReplyID   string     `gorm:"size:36" json:"lastReplyId,omitempty"`
+	LastReplyAt   *time.Time `gorm:"index" json:"lastReplyAt,omitempty"`
+	ArchivedAt    *time.Time `json:"archivedAt,omitempty"` // Скрыт из списка активных тредов; новый ответ возвращает тред
+	ArchivedBy    string     `json:"archivedBy,omitempty"`
+	LockedAt      *time.Time `json:"lockedAt,omitempty"` // Отвечать могут только модераторы
+	LockedBy      string     `json:"lockedBy,omitempty"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt     time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
 }
 
 func (Thread) TableName() string {
 	return "threads"
 }
 
+// ThreadFollower подписка пользователя на тред и его курсор прочтения в треде
+type ThreadFollower struct {
+	ID                string     `gorm:"primaryKey" json:"id"`
+	ThreadID          string     `gorm:"uniqueIndex:idx_thread_follower;not null" json:"threadId"`
+	UserID            string     `gorm:"uniqueIndex:idx_thread_follower;index;not null" json:"userId"`
+	ChatID            string     `gorm:"index;not null" json:"chatId"`
+	LastReadMessageID string     `gorm:"size:36" json:"lastReadMessageId,omitempty"`
+	LastReadAt        *time.Time `json:"lastReadAt,omitempty"`
+	UnreadCount       int        `gorm:"not null;default:0" json:"unreadCount"`
+	CreatedAt         time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt         time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (ThreadFollower) TableName() string {
+	return "thread_followers"
+}
@@ -21,6 +21,13 @@ type User struct {
 	ShowBio       bool      `gorm:"default:true" json:"showBio"`
 	ShowAvatar    bool      `gorm:"default:true" json:"showAvatar"`
 	LastSeen      *time.Time `json:"lastSeen,omitempty"`
+	// Правила приватности: everyone | contacts | nobody
+	PrivacyLastSeen string `gorm:"not null;default:everyone" json:"-"`
+	PrivacyAvatar   string `gorm:"not null;default:everyone" json:"-"`
+	PrivacyBio      string `gorm:"not null;default:everyone" json:"-"`
+	PrivacyCalls    string `gorm:"not null;default:everyone" json:"-"`
+	PrivacyGroupAdd string `gorm:"not null;default:everyone" json:"-"`
+	LinkPreviews    bool   `gorm:"not null;default:true" json:"-"` // Загружать превью ссылок из сообщений пользователя
 	TwoFASecret   string    `json:"-"`
 	RecoveryCodes string    `gorm:"type:text" json:"-"` // JSON массив как строка
 	PinHash       string    `json:"-"`
@@ -4,15 +4,36 @@ import (
 	"time"
 )
 
+// VoiceRoom голосовая комната чата
+// Kind: "voice" — все говорят | "stage" — ведущие, спикеры и слушатели
+// Status: "scheduled" | "live" | "ended"
 type VoiceRoom struct {
-	ID        string    `gorm:"primaryKey" json:"id"`
-	ChatID    string    `gorm:"index;not null" json:"chatId"`
-	CreatedBy string    `gorm:"not null" json:"createdBy"`
-	IsActive  bool      `gorm:"default:true" json:"isActive"`
-	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	ID             string     `gorm:"primaryKey" json:"id"`
+	ChatID         string     `gorm:"index;not null" json:"chatId"`
+	CreatedBy      string     `gorm:"not null" json:"createdBy"`
+	Kind           string     `gorm:"default:voice" json:"kind"`
+	Topic          string     `json:"topic,omitempty"`
+	Status         string     `gorm:"index;default:live" json:"status"`
+	ScheduledAt    *time.Time `gorm:"index" json:"scheduledAt,omitempty"`
+	StartedAt      *time.Time `json:"startedAt,omitempty"`
+	EndedAt        *time.Time `json:"endedAt,omitempty"`
+	ReminderSentAt *time.Time `json:"-"`
+	IsActive       bool       `gorm:"default:true" json:"isActive"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"createdAt"`
 }
 
 func (VoiceRoom) TableName() string {
 	return "voice_rooms"
 }
 
+// VoiceRoomSubscriber пользователь, попросивший напомнить о запланированной комнате
+type VoiceRoomSubscriber struct {
+	ID        string    `gorm:"primaryKey" json:"id"`
+	RoomID    string    `gorm:"uniqueIndex:idx_voice_room_subscriber;not null" json:"roomId"`
+	UserID    string    `gorm:"uniqueIndex:idx_voice_room_subscriber;not null" json:"userId"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+func (VoiceRoomSubscriber) TableName() string {
+	return "voice_room_subscribers"
+}
@@ -27,34 +27,14 @@ func Init(redisURL string) error {
 	return err
 }
 
-// SetOnline устанавливает пользователя как онлайн
-func SetOnline(userID string, ttl time.Duration) error {
-	return client.Set(ctx, "online:"+userID, "1", ttl).Err()
-}
-
-// SetOffline устанавливает пользователя как оффлайн
-func SetOffline(userID string) error {
-	return client.Del(ctx, "online:"+userID).Err()
-}
-
-// IsOnline проверяет, онлайн ли пользователь
+// IsOnline проверяет, есть ли у пользователя подключенные устройства
 func IsOnline(userID string) (bool, error) {
-	val, err := client.Exists(ctx, "online:"+userID).Result()
-	return val > 0, err
+	return client.SIsMember(ctx, presenceOnlineKey, userID).Result()
 }
 
-// GetOnlineUsers возвращает список онлайн пользователей
+// GetOnlineUsers возвращает список пользователей онлайн
 func GetOnlineUsers() ([]string, error) {
-	keys, err := client.Keys(ctx, "online:*").Result()
-	if err != nil {
-		return nil, err
-	}
-
-	users := make([]string, len(keys))
-	for i, key := range keys {
-		users[i] = key[7:] // Убираем префикс "online:"
-	}
-	return users, nil
+	return client.SMembers(ctx, presenceOnlineKey).Result()
 }
 
 // SetUserStatus устанавливает статус пользователя
@@ -0,0 +1,19 @@
+package redis
+
+import (
+	"time"
+)
+
+func linkPreviewKey(urlHash string) string {
+	return "linkpreview:" + urlHash
+}
+
+// GetLinkPreview JSON превью ссылки из кэша
+func GetLinkPreview(urlHash string) (string, error) {
+	return client.Get(ctx, linkPreviewKey(urlHash)).Result()
+}
+
+// SetLinkPreview кэширует JSON превью ссылки
+func SetLinkPreview(urlHash, data string, ttl time.Duration) error {
+	return client.Set(ctx, linkPreviewKey(urlHash), data, ttl).Err()
+}
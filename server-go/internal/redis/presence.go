@@ -0,0 +1,167 @@
+package redis
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DeviceTTL время жизни записи устройства без heartbeat
+const DeviceTTL = 5 * time.Minute
+
+const (
+	presenceOnlineKey    = "presence:online" // Множество пользователей с подключенными устройствами
+	presenceDevicePrefix = "presence:device:"
+)
+
+func presenceDeviceKey(userID, clientID string) string {
+	return presenceDevicePrefix + userID + ":" + clientID
+}
+
+func presenceDevicesKey(userID string) string {
+	return "presence:devices:" + userID
+}
+
+func presenceModeKey(userID string) string {
+	return "presence:mode:" + userID
+}
+
+// SetDevicePresence отмечает устройство пользователя подключенным с активностью active | idle
+func SetDevicePresence(userID, clientID, activity string) error {
+	pipe := client.TxPipeline()
+	pipe.Set(ctx, presenceDeviceKey(userID, clientID), activity, DeviceTTL)
+	pipe.SAdd(ctx, presenceDevicesKey(userID), clientID)
+	pipe.SAdd(ctx, presenceOnlineKey, userID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// TouchDevicePresence продлевает запись устройства (heartbeat)
+func TouchDevicePresence(userID, clientID string) error {
+	ok, err := client.Expire(ctx, presenceDeviceKey(userID, clientID), DeviceTTL).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// Запись успела истечь — восстанавливаем
+		return SetDevicePresence(userID, clientID, "active")
+	}
+	return nil
+}
+
+// RemoveDevicePresence удаляет устройство пользователя
+func RemoveDevicePresence(userID, clientID string) error {
+	pipe := client.TxPipeline()
+	pipe.Del(ctx, presenceDeviceKey(userID, clientID))
+	pipe.SRem(ctx, presenceDevicesKey(userID), clientID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// DeviceActivities возвращает активность подключенных устройств пользователя;
+// истекшие устройства удаляются, пользователь без устройств убирается из онлайна
+func DeviceActivities(userID string) (map[string]string, error) {
+	clientIDs, err := client.SMembers(ctx, presenceDevicesKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	activities := make(map[string]string, len(clientIDs))
+	if len(clientIDs) > 0 {
+		keys := make([]string, len(clientIDs))
+		for i, clientID := range clientIDs {
+			keys[i] = presenceDeviceKey(userID, clientID)
+		}
+		values, err := client.MGet(ctx, keys...).Result()
+		if err != nil {
+			return nil, err
+		}
+		stale := make([]interface{}, 0)
+		for i, value := range values {
+			if activity, ok := value.(string); ok {
+				activities[clientIDs[i]] = activity
+			} else {
+				stale = append(stale, clientIDs[i])
+			}
+		}
+		if len(stale) > 0 {
+			client.SRem(ctx, presenceDevicesKey(userID), stale...)
+		}
+	}
+
+	if len(activities) == 0 {
+		client.SRem(ctx, presenceOnlineKey, userID)
+	}
+	return activities, nil
+}
+
+// SetPresenceMode сохраняет выбранный пользователем режим (online | idle | dnd | invisible)
+func SetPresenceMode(userID, mode string) error {
+	return client.Set(ctx, presenceModeKey(userID), mode, 0).Err()
+}
+
+// GetPresenceMode возвращает режим пользователя ("" — не задан)
+func GetPresenceMode(userID string) (string, error) {
+	mode, err := client.Get(ctx, presenceModeKey(userID)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return mode, err
+}
+
+// OnlineAmong возвращает пользователей из списка, у которых есть подключенные устройства
+func OnlineAmong(userIDs []string) (map[string]bool, error) {
+	result := make(map[string]bool)
+	if len(userIDs) == 0 {
+		return result, nil
+	}
+	members := make([]interface{}, len(userIDs))
+	for i, id := range userIDs {
+		members[i] = id
+	}
+	flags, err := client.SMIsMember(ctx, presenceOnlineKey, members...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, flag := range flags {
+		if flag {
+			result[userIDs[i]] = true
+		}
+	}
+	return result, nil
+}
+
+// OnlineCount количество пользователей онлайн
+func OnlineCount() (int64, error) {
+	return client.SCard(ctx, presenceOnlineKey).Result()
+}
+
+// SubscribeDeviceExpiry вызывает handler, когда запись устройства истекает без отключения
+// (например, упал процесс сервера). Требует уведомлений keyspace о событиях expired.
+func SubscribeDeviceExpiry(handler func(userID, clientID string)) {
+	flags, err := client.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err == nil {
+		current := flags["notify-keyspace-events"]
+		if !strings.Contains(current, "E") || !(strings.Contains(current, "x") || strings.Contains(current, "A")) {
+			if err := client.ConfigSet(ctx, "notify-keyspace-events", current+"Ex").Err(); err != nil {
+				log.Printf("Presence: cannot enable keyspace events: %v", err)
+			}
+		}
+	}
+
+	pubsub := client.PSubscribe(ctx, "__keyevent@*__:expired")
+	defer pubsub.Close()
+	for msg := range pubsub.Channel() {
+		if !strings.HasPrefix(msg.Payload, presenceDevicePrefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(msg.Payload, presenceDevicePrefix)
+		sep := strings.LastIndex(rest, ":")
+		if sep <= 0 {
+			continue
+		}
+		handler(rest[:sep], rest[sep+1:])
+	}
+}
@@ -0,0 +1,170 @@
+package redis
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Живое состояние голосовых комнат (роли, присутствие, поднятые руки, приглашения
+// выступить, серверный mute). Хранится в Redis, чтобы переживать перезапуск API.
+// Ключи истекают через voiceRoomTTL после последнего изменения.
+const voiceRoomTTL = 24 * time.Hour
+
+func voiceRoomKey(roomID, part string) string {
+	return "voice_room:" + roomID + ":" + part
+}
+
+func touchVoiceRoom(pipe redis.Pipeliner, roomID string) {
+	for _, part := range []string{"roles", "present", "hands", "invites", "muted"} {
+		pipe.Expire(ctx, voiceRoomKey(roomID, part), voiceRoomTTL)
+	}
+}
+
+// VoiceRoomState снимок состояния комнаты
+type VoiceRoomState struct {
+	Roles   map[string]string // userID -> "host" | "speaker" (слушатели не хранятся)
+	Present map[string]int64  // userID -> время входа (unix)
+	Hands   []string          // очередь поднятых рук по времени
+	Invites map[string]bool   // приглашены выступить
+	Muted   map[string]bool   // заглушены модератором
+}
+
+// GetVoiceRoomState читает состояние комнаты
+func GetVoiceRoomState(roomID string) (*VoiceRoomState, error) {
+	pipe := client.Pipeline()
+	roles := pipe.HGetAll(ctx, voiceRoomKey(roomID, "roles"))
+	present := pipe.HGetAll(ctx, voiceRoomKey(roomID, "present"))
+	hands := pipe.ZRange(ctx, voiceRoomKey(roomID, "hands"), 0, -1)
+	invites := pipe.SMembers(ctx, voiceRoomKey(roomID, "invites"))
+	muted := pipe.SMembers(ctx, voiceRoomKey(roomID, "muted"))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	state := &VoiceRoomState{
+		Roles:   roles.Val(),
+		Present: make(map[string]int64),
+		Hands:   hands.Val(),
+		Invites: make(map[string]bool),
+		Muted:   make(map[string]bool),
+	}
+	for userID, joined := range present.Val() {
+		state.Present[userID], _ = strconv.ParseInt(joined, 10, 64)
+	}
+	for _, userID := range invites.Val() {
+		state.Invites[userID] = true
+	}
+	for _, userID := range muted.Val() {
+		state.Muted[userID] = true
+	}
+	return state, nil
+}
+
+// GetVoiceRoomRole роль пользователя; "" — слушатель
+func GetVoiceRoomRole(roomID, userID string) (string, error) {
+	role, err := client.HGet(ctx, voiceRoomKey(roomID, "roles"), userID).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return role, err
+}
+
+// SetVoiceRoomRole назначает роль; "" или "listener" — снимает
+func SetVoiceRoomRole(roomID, userID, role string) error {
+	pipe := client.TxPipeline()
+	if role == "" || role == "listener" {
+		pipe.HDel(ctx, voiceRoomKey(roomID, "roles"), userID)
+	} else {
+		pipe.HSet(ctx, voiceRoomKey(roomID, "roles"), userID, role)
+	}
+	// Новая роль закрывает руку и приглашение
+	pipe.ZRem(ctx, voiceRoomKey(roomID, "hands"), userID)
+	pipe.SRem(ctx, voiceRoomKey(roomID, "invites"), userID)
+	touchVoiceRoom(pipe, roomID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// SetVoiceRoomPresent отмечает вход/выход пользователя
+func SetVoiceRoomPresent(roomID, userID string, present bool) error {
+	pipe := client.TxPipeline()
+	if present {
+		pipe.HSet(ctx, voiceRoomKey(roomID, "present"), userID, time.Now().Unix())
+	} else {
+		pipe.HDel(ctx, voiceRoomKey(roomID, "present"), userID)
+		pipe.ZRem(ctx, voiceRoomKey(roomID, "hands"), userID)
+	}
+	touchVoiceRoom(pipe, roomID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// SetVoiceRoomHand поднимает/опускает руку
+func SetVoiceRoomHand(roomID, userID string, raised bool) error {
+	pipe := client.TxPipeline()
+	if raised {
+		pipe.ZAddNX(ctx, voiceRoomKey(roomID, "hands"), redis.Z{Score: float64(time.Now().UnixMilli()), Member: userID})
+	} else {
+		pipe.ZRem(ctx, voiceRoomKey(roomID, "hands"), userID)
+	}
+	touchVoiceRoom(pipe, roomID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// SetVoiceRoomInvite приглашает выступить / отзывает приглашение
+func SetVoiceRoomInvite(roomID, userID string, invited bool) error {
+	pipe := client.TxPipeline()
+	if invited {
+		pipe.SAdd(ctx, voiceRoomKey(roomID, "invites"), userID)
+	} else {
+		pipe.SRem(ctx, voiceRoomKey(roomID, "invites"), userID)
+	}
+	touchVoiceRoom(pipe, roomID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// IsVoiceRoomInvited проверяет приглашение выступить
+func IsVoiceRoomInvited(roomID, userID string) (bool, error) {
+	return client.SIsMember(ctx, voiceRoomKey(roomID, "invites"), userID).Result()
+}
+
+// SetVoiceRoomMuted серверный mute модератором
+func SetVoiceRoomMuted(roomID, userID string, muted bool) error {
+	pipe := client.TxPipeline()
+	if muted {
+		pipe.SAdd(ctx, voiceRoomKey(roomID, "muted"), userID)
+	} else {
+		pipe.SRem(ctx, voiceRoomKey(roomID, "muted"), userID)
+	}
+	touchVoiceRoom(pipe, roomID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// ResetVoiceRoomPresence сбрасывает присутствие и поднятые руки комнат: после перезапуска
+// SFU пуст, и записи о вошедших до него участниках устарели. Роли и приглашения сохраняются
+func ResetVoiceRoomPresence(roomIDs []string) error {
+	if client == nil || len(roomIDs) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(roomIDs)*2)
+	for _, roomID := range roomIDs {
+		keys = append(keys, voiceRoomKey(roomID, "present"), voiceRoomKey(roomID, "hands"))
+	}
+	return client.Del(ctx, keys...).Err()
+}
+
+// ClearVoiceRoom удаляет состояние завершенной комнаты
+func ClearVoiceRoom(roomID string) error {
+	return client.Del(ctx,
+		voiceRoomKey(roomID, "roles"),
+		voiceRoomKey(roomID, "present"),
+		voiceRoomKey(roomID, "hands"),
+		voiceRoomKey(roomID, "invites"),
+		voiceRoomKey(roomID, "muted"),
+	).Err()
+}
@@ -0,0 +1,311 @@
+package sfu
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+)
+
+// Peer подключение участника к SFU
+type Peer struct {
+	room     *Room
+	userID   string
+	clientID string
+	pc       *webrtc.PeerConnection
+	signal   Signal
+
+	muted atomic.Bool // заглушен модератором
+
+	// Уровень звука за текущий интервал определения говорящего
+	levelSum   atomic.Int64
+	levelCount atomic.Int64
+
+	mu                 sync.Mutex
+	closed             bool
+	pendingNegotiation bool
+	publications       map[string]*publication // ID дорожки -> публикация участника
+	downTracks         map[*publication]*downTrack
+	layers             map[string]string // publisherID -> желаемый слой simulcast
+}
+
+func newPeer(room *Room, userID, clientID string, pc *webrtc.PeerConnection, signal Signal) *Peer {
+	p := &Peer{
+		room:         room,
+		userID:       userID,
+		clientID:     clientID,
+		pc:           pc,
+		signal:       signal,
+		publications: make(map[string]*publication),
+		downTracks:   make(map[*publication]*downTrack),
+		layers:       make(map[string]string),
+	}
+
+	pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate != nil {
+			p.send("sfu:ice", map[string]interface{}{"candidate": candidate.ToJSON()})
+		}
+	})
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+			room.removePeer(p)
+		}
+	})
+	pc.OnTrack(p.onTrack)
+	return p
+}
+
+func (p *Peer) send(eventType string, data map[string]interface{}) {
+	p.signal(event(eventType, p.room.id, data))
+}
+
+func (p *Peer) participant() Participant {
+	publishing := []string{}
+	for _, pub := range p.publicationList() {
+		publishing = append(publishing, pub.kind.String())
+	}
+	return Participant{UserID: p.userID, Muted: p.muted.Load(), Publishing: publishing}
+}
+
+// info данные участника для событий сигналинга
+func (p *Peer) info() map[string]interface{} {
+	info := p.participant()
+	return map[string]interface{}{
+		"userId":     info.UserID,
+		"muted":      info.Muted,
+		"publishing": info.Publishing,
+	}
+}
+
+func (p *Peer) publicationList() []*publication {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	list := make([]*publication, 0, len(p.publications))
+	for _, pub := range p.publications {
+		list = append(list, pub)
+	}
+	return list
+}
+
+// onTrack вызывается на каждую входящую дорожку; при simulcast — на каждый слой
+func (p *Peer) onTrack(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	pub, exists := p.publications[track.ID()]
+	if !exists {
+		pub = newPublication(p, track)
+		p.publications[track.ID()] = pub
+	}
+	p.mu.Unlock()
+
+	audioLevelID := 0
+	if track.Kind() == webrtc.RTPCodecTypeAudio {
+		for _, ext := range receiver.GetParameters().HeaderExtensions {
+			if ext.URI == sdp.AudioLevelURI {
+				audioLevelID = ext.ID
+			}
+		}
+	}
+
+	pub.addLayer(track)
+	if !exists {
+		p.room.publish(pub)
+	}
+	go p.forward(pub, track, audioLevelID)
+}
+
+// forward читает RTP слоя и раздает подписчикам
+func (p *Peer) forward(pub *publication, track *webrtc.TrackRemote, audioLevelID int) {
+	rid := track.RID()
+	for {
+		pkt, _, err := track.ReadRTP()
+		if err != nil {
+			pub.removeLayer(rid)
+			return
+		}
+		if audioLevelID != 0 {
+			if ext := pkt.GetExtension(uint8(audioLevelID)); ext != nil {
+				var level rtp.AudioLevelExtension
+				if level.Unmarshal(ext) == nil {
+					p.levelSum.Add(int64(level.Level))
+					p.levelCount.Add(1)
+				}
+			}
+		}
+		// Заглушенный модератором участник не слышен остальным и не попадает в запись,
+		// даже если клиент не согласовал расширение уровня звука
+		if pub.kind == webrtc.RTPCodecTypeAudio {
+			if p.muted.Load() {
+				continue
+			}
+			if rec := p.room.manager.recorder(p.room.id); rec != nil {
+				rec.write(pub, pkt)
+			}
+		}
+		pub.write(rid, pkt)
+	}
+}
+
+// takeAudioLevel средний уровень звука с прошлого вызова
+func (p *Peer) takeAudioLevel() (int, bool) {
+	count := p.levelCount.Swap(0)
+	sum := p.levelSum.Swap(0)
+	if count == 0 {
+		return 0, false
+	}
+	return int(sum / count), true
+}
+
+// subscribe добавляет чужую публикацию в PeerConnection участника
+func (p *Peer) subscribe(pub *publication) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || p.downTracks[pub] != nil {
+		return
+	}
+
+	local, err := webrtc.NewTrackLocalStaticRTP(pub.codec, pub.id, pub.publisher.userID)
+	if err != nil {
+		log.Printf("SFU: create track: %v", err)
+		return
+	}
+	sender, err := p.pc.AddTrack(local)
+	if err != nil {
+		log.Printf("SFU: add track: %v", err)
+		return
+	}
+
+	dt := &downTrack{pub: pub, subscriber: p, local: local, sender: sender}
+	dt.target = p.layers[pub.publisher.userID]
+	p.downTracks[pub] = dt
+	pub.addSubscriber(dt)
+	go dt.readRTCP()
+}
+
+// unsubscribe убирает дорожку ушедшего участника
+func (p *Peer) unsubscribe(pub *publication) {
+	p.mu.Lock()
+	dt := p.downTracks[pub]
+	delete(p.downTracks, pub)
+	closed := p.closed
+	p.mu.Unlock()
+
+	if dt == nil || closed {
+		return
+	}
+	if err := p.pc.RemoveTrack(dt.sender); err != nil {
+		log.Printf("SFU: remove track: %v", err)
+	}
+	p.negotiate()
+}
+
+func (p *Peer) setPreferredLayer(publisherID, rid string) {
+	p.mu.Lock()
+	p.layers[publisherID] = rid
+	var targets []*downTrack
+	for pub, dt := range p.downTracks {
+		if pub.publisher.userID == publisherID {
+			targets = append(targets, dt)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, dt := range targets {
+		dt.setTarget(rid)
+	}
+}
+
+// negotiate отправляет участнику серверный offer; если идет другой обмен —
+// откладывает до его завершения. Свои дорожки участник публикует собственным offer.
+func (p *Peer) negotiate() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || len(p.pc.GetTransceivers()) == 0 {
+		return
+	}
+	if p.pc.SignalingState() != webrtc.SignalingStateStable {
+		p.pendingNegotiation = true
+		return
+	}
+	p.pendingNegotiation = false
+
+	offer, err := p.pc.CreateOffer(nil)
+	if err != nil {
+		log.Printf("SFU: create offer: %v", err)
+		return
+	}
+	if err := p.pc.SetLocalDescription(offer); err != nil {
+		log.Printf("SFU: set local offer: %v", err)
+		return
+	}
+	p.send("sfu:offer", map[string]interface{}{"sdp": offer})
+}
+
+// handleOffer обрабатывает offer участника (публикация дорожек)
+func (p *Peer) handleOffer(sdpText string) error {
+	p.mu.Lock()
+	// Встречные offer: уступаем клиенту и повторяем свой позже
+	if p.pc.SignalingState() == webrtc.SignalingStateHaveLocalOffer {
+		if err := p.pc.SetLocalDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeRollback}); err != nil {
+			p.mu.Unlock()
+			return err
+		}
+		p.pendingNegotiation = true
+	}
+
+	err := p.pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: sdpText})
+	if err == nil {
+		var answer webrtc.SessionDescription
+		if answer, err = p.pc.CreateAnswer(nil); err == nil {
+			if err = p.pc.SetLocalDescription(answer); err == nil {
+				p.send("sfu:answer", map[string]interface{}{"sdp": answer})
+			}
+		}
+	}
+	pending := p.pendingNegotiation
+	p.mu.Unlock()
+
+	if pending {
+		p.negotiate()
+	}
+	return err
+}
+
+// handleAnswer обрабатывает answer участника на серверный offer
+func (p *Peer) handleAnswer(sdpText string) error {
+	p.mu.Lock()
+	err := p.pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: sdpText})
+	pending := p.pendingNegotiation
+	p.mu.Unlock()
+
+	if pending {
+		p.negotiate()
+	}
+	return err
+}
+
+// close закрывает PeerConnection и отписывает участника от чужих публикаций
+func (p *Peer) close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	downTracks := p.downTracks
+	p.downTracks = make(map[*publication]*downTrack)
+	p.mu.Unlock()
+
+	for pub, dt := range downTracks {
+		pub.removeSubscriber(dt)
+	}
+	if err := p.pc.Close(); err != nil {
+		log.Printf("SFU: close peer: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package sfu
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4/pkg/media/oggwriter"
+)
+
+var ErrAlreadyRecording = errors.New("already recording")
+
+// RecordedTrack аудиодорожка участника, записанная сервером
+type RecordedTrack struct {
+	UserID string
+	Path   string
+	Offset time.Duration // от начала записи
+}
+
+// recorder пишет аудио каждого участника комнаты в отдельный Ogg/Opus файл.
+// Сведение дорожек в одну выполняется после остановки (см. api).
+type recorder struct {
+	dir     string
+	started time.Time
+
+	mu       sync.Mutex
+	writers  map[*publication]*oggwriter.OggWriter
+	tracks   []RecordedTrack
+	excluded map[string]bool // Участники, еще не давшие согласия на запись
+}
+
+func (r *recorder) write(pub *publication, pkt *rtp.Packet) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.writers == nil || r.excluded[pub.publisher.userID] {
+		return
+	}
+	w, ok := r.writers[pub]
+	if !ok {
+		path := filepath.Join(r.dir, pub.publisher.userID+"-"+time.Now().Format("150405.000")+".ogg")
+		var err error
+		if w, err = oggwriter.New(path, 48000, 2); err != nil {
+			log.Printf("SFU: create recording track: %v", err)
+			r.writers[pub] = nil
+			return
+		}
+		r.writers[pub] = w
+		r.tracks = append(r.tracks, RecordedTrack{UserID: pub.publisher.userID, Path: path, Offset: time.Since(r.started)})
+	}
+	if w == nil {
+		return
+	}
+	if err := w.WriteRTP(pkt); err != nil {
+		log.Printf("SFU: write recording: %v", err)
+	}
+}
+
+func (r *recorder) stop() []RecordedTrack {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, w := range r.writers {
+		if w != nil {
+			w.Close()
+		}
+	}
+	r.writers = nil
+	return r.tracks
+}
+
+func (m *Manager) recorder(roomID string) *recorder {
+	m.recMu.Lock()
+	defer m.recMu.Unlock()
+	return m.recorders[roomID]
+}
+
+// StartRecording начинает запись аудио комнаты в каталог dir
+func (m *Manager) StartRecording(roomID, dir string) error {
+	if m.room(roomID, false) == nil {
+		return ErrRoomNotFound
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	m.recMu.Lock()
+	defer m.recMu.Unlock()
+	if m.recorders[roomID] != nil {
+		return ErrAlreadyRecording
+	}
+	m.recorders[roomID] = &recorder{
+		dir:      dir,
+		started:  time.Now(),
+		writers:  make(map[*publication]*oggwriter.OggWriter),
+		excluded: make(map[string]bool),
+	}
+	return nil
+}
+
+// ExcludeFromRecording не пишет (excluded) или снова пишет звук участника в идущую запись комнаты
+func (m *Manager) ExcludeFromRecording(roomID, userID string, excluded bool) {
+	rec := m.recorder(roomID)
+	if rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if excluded {
+		rec.excluded[userID] = true
+	} else {
+		delete(rec.excluded, userID)
+	}
+}
+
+// StopRecording останавливает запись и возвращает записанные дорожки
+func (m *Manager) StopRecording(roomID string) []RecordedTrack {
+	m.recMu.Lock()
+	rec := m.recorders[roomID]
+	delete(m.recorders, roomID)
+	m.recMu.Unlock()
+	if rec == nil {
+		return nil
+	}
+	return rec.stop()
+}
@@ -0,0 +1,185 @@
+package sfu
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	speakerInterval = 400 * time.Millisecond
+	// Уровень звука в -dBov (0 — громко, 127 — тишина); тише порога — молчание
+	speakerThreshold = 60
+)
+
+// Room комната SFU (групповой звонок или голосовая комната)
+type Room struct {
+	id      string
+	manager *Manager
+
+	mu      sync.RWMutex
+	peers   map[string]*Peer // userID -> участник
+	speaker string
+	closed  bool
+
+	done chan struct{}
+	once sync.Once
+}
+
+func newRoom(m *Manager, id string) *Room {
+	room := &Room{id: id, manager: m, peers: make(map[string]*Peer), done: make(chan struct{})}
+	go room.detectSpeaker()
+	return room
+}
+
+func (r *Room) close() {
+	r.once.Do(func() { close(r.done) })
+}
+
+func (r *Room) peer(userID string) *Peer {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.peers[userID]
+}
+
+func (r *Room) peerList() []*Peer {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]*Peer, 0, len(r.peers))
+	for _, p := range r.peers {
+		list = append(list, p)
+	}
+	return list
+}
+
+// addPeer добавляет участника; false — комната уже закрыта
+func (r *Room) addPeer(p *Peer) bool {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return false
+	}
+	old := r.peers[p.userID]
+	r.peers[p.userID] = p
+	r.mu.Unlock()
+
+	if old != nil {
+		old.send("sfu:replaced", map[string]interface{}{})
+		r.detach(old)
+	}
+
+	// Новый участник получает дорожки всех остальных
+	for _, other := range r.peerList() {
+		if other == p {
+			continue
+		}
+		for _, pub := range other.publicationList() {
+			p.subscribe(pub)
+		}
+	}
+	p.negotiate()
+
+	r.broadcast("sfu:participant-joined", p.info(), p.userID)
+	if old == nil && r.manager.OnJoin != nil {
+		r.manager.OnJoin(r.id, p.userID)
+	}
+	return true
+}
+
+// removePeer отключает участника; последний вышедший закрывает комнату
+func (r *Room) removePeer(p *Peer) {
+	r.mu.Lock()
+	if r.peers[p.userID] != p {
+		r.mu.Unlock()
+		return
+	}
+	delete(r.peers, p.userID)
+	if r.speaker == p.userID {
+		r.speaker = ""
+	}
+	empty := len(r.peers) == 0
+	r.mu.Unlock()
+
+	r.detach(p)
+	r.broadcast("sfu:participant-left", map[string]interface{}{"userId": p.userID}, "")
+
+	if r.manager.OnLeave != nil {
+		r.manager.OnLeave(r.id, p.userID, empty)
+	}
+	if empty {
+		r.manager.dropRoom(r)
+	}
+}
+
+// detach закрывает подключение участника и снимает его дорожки у остальных
+func (r *Room) detach(p *Peer) {
+	for _, pub := range p.publicationList() {
+		pub.unpublish()
+	}
+	p.close()
+}
+
+// publish раздает новую дорожку всем участникам, кроме автора
+func (r *Room) publish(pub *publication) {
+	for _, p := range r.peerList() {
+		if p == pub.publisher {
+			continue
+		}
+		p.subscribe(pub)
+		p.negotiate()
+	}
+	r.broadcast("sfu:participant", pub.publisher.info(), "")
+}
+
+// broadcast отправляет событие всем участникам, кроме exceptUserID
+func (r *Room) broadcast(eventType string, data map[string]interface{}, exceptUserID string) {
+	for _, p := range r.peerList() {
+		if p.userID != exceptUserID {
+			p.signal(event(eventType, r.id, copyData(data)))
+		}
+	}
+}
+
+func copyData(data map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(data)+1)
+	for k, v := range data {
+		out[k] = v
+	}
+	return out
+}
+
+// detectSpeaker периодически выбирает самого громкого участника
+// по RTP-расширению ssrc-audio-level
+func (r *Room) detectSpeaker() {
+	ticker := time.NewTicker(speakerInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+
+		loudest, best := "", speakerThreshold
+		for _, p := range r.peerList() {
+			level, ok := p.takeAudioLevel()
+			if ok && !p.muted.Load() && level < best {
+				loudest, best = p.userID, level
+			}
+		}
+		if loudest == "" {
+			continue
+		}
+
+		r.mu.Lock()
+		changed := r.speaker != loudest
+		r.speaker = loudest
+		r.mu.Unlock()
+
+		if changed {
+			r.broadcast("sfu:speaker", map[string]interface{}{"userId": loudest}, "")
+			if r.manager.OnSpeaker != nil {
+				r.manager.OnSpeaker(r.id, loudest)
+			}
+		}
+	}
+}
@@ -0,0 +1,284 @@
+// Package sfu встроенный Selective Forwarding Unit (pion/webrtc) для групповых
+// звонков и голосовых комнат: каждый участник держит одно PeerConnection с сервером,
+// сервер пересылает его дорожки остальным участникам комнаты.
+package sfu
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+)
+
+var (
+	ErrRoomNotFound = errors.New("room not found")
+	ErrNotInRoom    = errors.New("not in room")
+)
+
+// Config настройки медиасервера
+type Config struct {
+	STUNServers []string // stun:host:port — для определения внешнего адреса
+	PublicIPs   []string // внешний IP за 1:1 NAT (необязательно)
+	UDPPortMin  uint16   // диапазон UDP портов (0 — любые)
+	UDPPortMax  uint16
+}
+
+// Signal отправляет сообщение сигналинга подключению участника
+type Signal func(message []byte)
+
+// Participant участник комнаты
+type Participant struct {
+	UserID     string   `json:"userId"`
+	Muted      bool     `json:"muted"`      // заглушен модератором
+	Publishing []string `json:"publishing"` // "audio" | "video"
+}
+
+// Manager реестр комнат SFU
+type Manager struct {
+	api        *webrtc.API
+	iceServers []webrtc.ICEServer
+
+	mu    sync.Mutex
+	rooms map[string]*Room
+
+	recMu     sync.Mutex
+	recorders map[string]*recorder // roomID -> серверная запись (переживает пересоздание комнаты)
+
+	// Обработчики событий (назначаются до использования)
+	OnJoin    func(roomID, userID string)
+	OnLeave   func(roomID, userID string, roomEmpty bool)
+	OnSpeaker func(roomID, userID string)
+}
+
+// NewManager создает SFU с поддержкой simulcast и уровня громкости
+func NewManager(cfg Config) (*Manager, error) {
+	mediaEngine := &webrtc.MediaEngine{}
+	if err := mediaEngine.RegisterDefaultCodecs(); err != nil {
+		return nil, err
+	}
+	if err := webrtc.ConfigureSimulcastExtensionHeaders(mediaEngine); err != nil {
+		return nil, err
+	}
+	if err := mediaEngine.RegisterHeaderExtension(
+		webrtc.RTPHeaderExtensionCapability{URI: sdp.AudioLevelURI}, webrtc.RTPCodecTypeAudio,
+	); err != nil {
+		return nil, err
+	}
+
+	registry := &interceptor.Registry{}
+	if err := webrtc.RegisterDefaultInterceptors(mediaEngine, registry); err != nil {
+		return nil, err
+	}
+
+	settings := webrtc.SettingEngine{}
+	if len(cfg.PublicIPs) > 0 {
+		settings.SetNAT1To1IPs(cfg.PublicIPs, webrtc.ICECandidateTypeHost)
+	}
+	if cfg.UDPPortMin > 0 && cfg.UDPPortMax >= cfg.UDPPortMin {
+		if err := settings.SetEphemeralUDPPortRange(cfg.UDPPortMin, cfg.UDPPortMax); err != nil {
+			return nil, err
+		}
+	}
+
+	m := &Manager{
+		api: webrtc.NewAPI(
+			webrtc.WithMediaEngine(mediaEngine),
+			webrtc.WithInterceptorRegistry(registry),
+			webrtc.WithSettingEngine(settings),
+		),
+		rooms:     make(map[string]*Room),
+		recorders: make(map[string]*recorder),
+	}
+	if len(cfg.STUNServers) > 0 {
+		m.iceServers = []webrtc.ICEServer{{URLs: cfg.STUNServers}}
+	}
+	return m, nil
+}
+
+func (m *Manager) room(roomID string, create bool) *Room {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	room, ok := m.rooms[roomID]
+	if !ok && create {
+		room = newRoom(m, roomID)
+		m.rooms[roomID] = room
+	}
+	return room
+}
+
+// dropRoom удаляет комнату, если в ней не осталось участников
+func (m *Manager) dropRoom(room *Room) {
+	m.mu.Lock()
+	room.mu.Lock()
+	empty := len(room.peers) == 0
+	if empty {
+		room.closed = true
+		if m.rooms[room.id] == room {
+			delete(m.rooms, room.id)
+		}
+	}
+	room.mu.Unlock()
+	m.mu.Unlock()
+	if empty {
+		room.close()
+	}
+}
+
+// peer участник комнаты, подключенный с устройства clientID
+func (m *Manager) peer(roomID, userID, clientID string) (*Peer, error) {
+	room := m.room(roomID, false)
+	if room == nil {
+		return nil, ErrRoomNotFound
+	}
+	p := room.peer(userID)
+	if p == nil || (clientID != "" && p.clientID != clientID) {
+		return nil, ErrNotInRoom
+	}
+	return p, nil
+}
+
+// Join подключает участника к комнате. Повторный вход с другого устройства
+// заменяет предыдущее подключение.
+func (m *Manager) Join(roomID, userID, clientID string, signal Signal) error {
+	for {
+		room := m.room(roomID, true)
+		pc, err := m.api.NewPeerConnection(webrtc.Configuration{ICEServers: m.iceServers})
+		if err != nil {
+			return err
+		}
+		if room.addPeer(newPeer(room, userID, clientID, pc, signal)) {
+			return nil
+		}
+		// Комната закрылась между поиском и входом — создаем заново
+		pc.Close()
+	}
+}
+
+// Leave отключает участника; clientID — только если он подключен с этого устройства
+func (m *Manager) Leave(roomID, userID, clientID string) {
+	if p, err := m.peer(roomID, userID, clientID); err == nil {
+		p.room.removePeer(p)
+	}
+}
+
+// LeaveClient отключает устройство от всех комнат (при закрытии WebSocket)
+func (m *Manager) LeaveClient(clientID string) {
+	m.mu.Lock()
+	rooms := make([]*Room, 0, len(m.rooms))
+	for _, room := range m.rooms {
+		rooms = append(rooms, room)
+	}
+	m.mu.Unlock()
+
+	for _, room := range rooms {
+		for _, p := range room.peerList() {
+			if p.clientID == clientID {
+				room.removePeer(p)
+			}
+		}
+	}
+}
+
+// Offer применяет SDP offer участника и отправляет ему answer
+func (m *Manager) Offer(roomID, userID, clientID, offer string) error {
+	p, err := m.peer(roomID, userID, clientID)
+	if err != nil {
+		return err
+	}
+	return p.handleOffer(offer)
+}
+
+// Answer применяет SDP answer на серверный offer (ренеготиация)
+func (m *Manager) Answer(roomID, userID, clientID, answer string) error {
+	p, err := m.peer(roomID, userID, clientID)
+	if err != nil {
+		return err
+	}
+	return p.handleAnswer(answer)
+}
+
+// AddICECandidate добавляет ICE кандидата участника
+func (m *Manager) AddICECandidate(roomID, userID, clientID string, candidate webrtc.ICECandidateInit) error {
+	p, err := m.peer(roomID, userID, clientID)
+	if err != nil {
+		return err
+	}
+	return p.pc.AddICECandidate(candidate)
+}
+
+// SetLayer выбирает слой simulcast ("q" | "h" | "f"), который участник получает от publisherID
+func (m *Manager) SetLayer(roomID, userID, clientID, publisherID, rid string) error {
+	p, err := m.peer(roomID, userID, clientID)
+	if err != nil {
+		return err
+	}
+	p.setPreferredLayer(publisherID, rid)
+	return nil
+}
+
+// Mute заглушает/включает звук участника на сервере (его аудио перестает пересылаться)
+func (m *Manager) Mute(roomID, userID string, muted bool) error {
+	p, err := m.peer(roomID, userID, "")
+	if err != nil {
+		return err
+	}
+	p.muted.Store(muted)
+	p.room.broadcast("sfu:participant", p.info(), "")
+	return nil
+}
+
+// Kick принудительно отключает участника
+func (m *Manager) Kick(roomID, userID string) error {
+	p, err := m.peer(roomID, userID, "")
+	if err != nil {
+		return err
+	}
+	p.send("sfu:kicked", map[string]interface{}{})
+	p.room.removePeer(p)
+	return nil
+}
+
+// Participants текущие участники комнаты
+func (m *Manager) Participants(roomID string) []Participant {
+	room := m.room(roomID, false)
+	if room == nil {
+		return []Participant{}
+	}
+	result := []Participant{}
+	for _, p := range room.peerList() {
+		result = append(result, p.participant())
+	}
+	return result
+}
+
+// ActiveSpeaker текущий говорящий в комнате
+func (m *Manager) ActiveSpeaker(roomID string) string {
+	if room := m.room(roomID, false); room != nil {
+		room.mu.RLock()
+		defer room.mu.RUnlock()
+		return room.speaker
+	}
+	return ""
+}
+
+// CloseRoom отключает всех участников и удаляет комнату
+func (m *Manager) CloseRoom(roomID string) {
+	room := m.room(roomID, false)
+	if room == nil {
+		return
+	}
+	for _, p := range room.peerList() {
+		p.send("sfu:closed", map[string]interface{}{})
+		room.removePeer(p)
+	}
+	m.dropRoom(room)
+}
+
+func event(eventType, roomID string, data map[string]interface{}) []byte {
+	data["roomId"] = roomID
+	payload, _ := json.Marshal(map[string]interface{}{"type": eventType, "data": data})
+	return payload
+}
@@ -0,0 +1,240 @@
+package sfu
+
+import (
+	"log"
+	"sync"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+// defaultLayer слой simulcast по умолчанию для подписчиков
+const defaultLayer = "h"
+
+// layerRank качество слоя simulcast; "" — дорожка без simulcast
+var layerRank = map[string]int{"q": 0, "h": 1, "f": 2, "": 1}
+
+// publication дорожка участника (при simulcast — набор слоев rid)
+type publication struct {
+	id        string
+	publisher *Peer
+	kind      webrtc.RTPCodecType
+	codec     webrtc.RTPCodecCapability
+
+	mu          sync.RWMutex
+	layers      map[string]*webrtc.TrackRemote // rid -> слой
+	subscribers map[*downTrack]struct{}
+}
+
+func newPublication(p *Peer, track *webrtc.TrackRemote) *publication {
+	return &publication{
+		id:          track.ID(),
+		publisher:   p,
+		kind:        track.Kind(),
+		codec:       track.Codec().RTPCodecCapability,
+		layers:      make(map[string]*webrtc.TrackRemote),
+		subscribers: make(map[*downTrack]struct{}),
+	}
+}
+
+func (pub *publication) addLayer(track *webrtc.TrackRemote) {
+	pub.mu.Lock()
+	pub.layers[track.RID()] = track
+	subscribers := pub.subscriberList()
+	pub.mu.Unlock()
+
+	// Появился слой — подписчики могли его ждать
+	for _, dt := range subscribers {
+		dt.resolveLayer()
+	}
+}
+
+func (pub *publication) removeLayer(rid string) {
+	pub.mu.Lock()
+	delete(pub.layers, rid)
+	subscribers := pub.subscriberList()
+	pub.mu.Unlock()
+
+	for _, dt := range subscribers {
+		dt.resolveLayer()
+	}
+}
+
+// subscriberList копия подписчиков (под pub.mu)
+func (pub *publication) subscriberList() []*downTrack {
+	list := make([]*downTrack, 0, len(pub.subscribers))
+	for dt := range pub.subscribers {
+		list = append(list, dt)
+	}
+	return list
+}
+
+func (pub *publication) addSubscriber(dt *downTrack) {
+	pub.mu.Lock()
+	pub.subscribers[dt] = struct{}{}
+	pub.mu.Unlock()
+	dt.resolveLayer()
+}
+
+func (pub *publication) removeSubscriber(dt *downTrack) {
+	pub.mu.Lock()
+	delete(pub.subscribers, dt)
+	pub.mu.Unlock()
+}
+
+// selectLayer лучший доступный слой не выше желаемого, иначе самый низкий
+func (pub *publication) selectLayer(target string) string {
+	if target == "" {
+		target = defaultLayer
+	}
+	pub.mu.RLock()
+	defer pub.mu.RUnlock()
+	if _, ok := pub.layers[target]; ok {
+		return target
+	}
+	best, bestRank := "", -1
+	lowest, lowestRank := "", 3
+	for rid := range pub.layers {
+		rank := layerRank[rid]
+		if rank <= layerRank[target] && rank > bestRank {
+			best, bestRank = rid, rank
+		}
+		if rank < lowestRank {
+			lowest, lowestRank = rid, rank
+		}
+	}
+	if bestRank >= 0 {
+		return best
+	}
+	return lowest
+}
+
+// write отправляет пакет слоя rid подписчикам, выбравшим этот слой
+func (pub *publication) write(rid string, pkt *rtp.Packet) {
+	pub.mu.RLock()
+	subscribers := pub.subscriberList()
+	pub.mu.RUnlock()
+	for _, dt := range subscribers {
+		dt.write(rid, pkt)
+	}
+}
+
+// requestKeyframe запрашивает у автора ключевой кадр слоя (PLI)
+func (pub *publication) requestKeyframe(rid string) {
+	if pub.kind != webrtc.RTPCodecTypeVideo {
+		return
+	}
+	pub.mu.RLock()
+	track, ok := pub.layers[rid]
+	pub.mu.RUnlock()
+	if !ok {
+		return
+	}
+	if err := pub.publisher.pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(track.SSRC())}}); err != nil {
+		log.Printf("SFU: send PLI: %v", err)
+	}
+}
+
+// unpublish снимает дорожку у всех подписчиков
+func (pub *publication) unpublish() {
+	pub.mu.Lock()
+	subscribers := pub.subscriberList()
+	pub.subscribers = make(map[*downTrack]struct{})
+	pub.mu.Unlock()
+
+	for _, dt := range subscribers {
+		dt.subscriber.unsubscribe(pub)
+	}
+}
+
+// downTrack пересылка публикации одному подписчику
+type downTrack struct {
+	pub        *publication
+	subscriber *Peer
+	local      *webrtc.TrackLocalStaticRTP
+	sender     *webrtc.RTPSender
+
+	mu     sync.Mutex
+	target string // желаемый слой
+	rid    string // слой, который сейчас пересылается
+	resync bool   // при смене слоя пересчитать смещения seq/timestamp
+
+	started   bool
+	seqOffset uint16
+	tsOffset  uint32
+	lastSeq   uint16
+	lastTS    uint32
+}
+
+func (dt *downTrack) setTarget(rid string) {
+	dt.mu.Lock()
+	dt.target = rid
+	dt.mu.Unlock()
+	dt.resolveLayer()
+}
+
+// resolveLayer переключает пересылку на подходящий доступный слой
+func (dt *downTrack) resolveLayer() {
+	dt.mu.Lock()
+	rid := dt.pub.selectLayer(dt.target)
+	changed := rid != dt.rid || !dt.started
+	if rid != dt.rid {
+		dt.rid = rid
+		dt.resync = true
+	}
+	dt.mu.Unlock()
+
+	if changed {
+		dt.pub.requestKeyframe(rid)
+	}
+}
+
+// write пересылает пакет, если он из текущего слоя. Номера пакетов и метки
+// времени переписываются, чтобы смена слоя выглядела для подписчика непрерывной.
+func (dt *downTrack) write(rid string, pkt *rtp.Packet) {
+	dt.mu.Lock()
+	if rid != dt.rid {
+		dt.mu.Unlock()
+		return
+	}
+	if dt.resync && dt.started {
+		dt.seqOffset = dt.lastSeq + 1 - pkt.SequenceNumber
+		dt.tsOffset = dt.lastTS + 1 - pkt.Timestamp
+	}
+	dt.resync = false
+	dt.started = true
+
+	out := rtp.Packet{Header: pkt.Header, Payload: pkt.Payload}
+	out.SequenceNumber += dt.seqOffset
+	out.Timestamp += dt.tsOffset
+	// Расширения согласованы с автором, а не с подписчиком
+	out.Extension = false
+	out.Extensions = nil
+	dt.lastSeq = out.SequenceNumber
+	dt.lastTS = out.Timestamp
+	dt.mu.Unlock()
+
+	if err := dt.local.WriteRTP(&out); err != nil {
+		log.Printf("SFU: write rtp: %v", err)
+	}
+}
+
+// readRTCP читает RTCP подписчика и передает запросы ключевого кадра автору
+func (dt *downTrack) readRTCP() {
+	for {
+		packets, _, err := dt.sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+		for _, packet := range packets {
+			switch packet.(type) {
+			case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+				dt.mu.Lock()
+				rid := dt.rid
+				dt.mu.Unlock()
+				dt.pub.requestKeyframe(rid)
+			}
+		}
+	}
+}
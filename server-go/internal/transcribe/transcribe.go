@@ -0,0 +1,172 @@
+// Package transcribe подключаемые движки расшифровки записей звонков.
+// Движок выбирается настройкой TRANSCRIBE_BACKEND:
+//
+//	none    — расшифровка отключена
+//	stub    — локальная заглушка для разработки (без распознавания речи)
+//	command — внешняя программа (например whisper.cpp), путь к файлу передается аргументом, текст читается из stdout
+//	http    — OpenAI-совместимый /v1/audio/transcriptions
+package transcribe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Segment фрагмент расшифровки
+type Segment struct {
+	Start float64 `json:"start"` // секунды от начала записи
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+// Result результат расшифровки
+type Result struct {
+	Text     string    `json:"text"`
+	Language string    `json:"language,omitempty"`
+	Segments []Segment `json:"segments,omitempty"`
+}
+
+// Transcriber движок расшифровки
+type Transcriber interface {
+	Name() string
+	Transcribe(ctx context.Context, path, language string) (*Result, error)
+}
+
+// Config настройки движка
+type Config struct {
+	Backend string
+	Command string // для command
+	URL     string // для http
+	APIKey  string
+	Model   string
+}
+
+// New создает движок по настройкам; nil — расшифровка отключена
+func New(cfg Config) (Transcriber, error) {
+	switch cfg.Backend {
+	case "", "none":
+		return nil, nil
+	case "stub":
+		return stub{}, nil
+	case "command":
+		fields := strings.Fields(cfg.Command)
+		if len(fields) == 0 {
+			return nil, errors.New("transcribe: TRANSCRIBE_COMMAND is empty")
+		}
+		return command{name: fields[0], args: fields[1:]}, nil
+	case "http":
+		if cfg.URL == "" {
+			return nil, errors.New("transcribe: TRANSCRIBE_URL is empty")
+		}
+		model := cfg.Model
+		if model == "" {
+			model = "whisper-1"
+		}
+		return httpBackend{url: cfg.URL, apiKey: cfg.APIKey, model: model, client: &http.Client{Timeout: 10 * time.Minute}}, nil
+	}
+	return nil, fmt.Errorf("transcribe: unknown backend %q", cfg.Backend)
+}
+
+// stub не распознает речь: возвращает служебный текст, чтобы проверить конвейер целиком
+type stub struct{}
+
+func (stub) Name() string { return "stub" }
+
+func (stub) Transcribe(ctx context.Context, path, language string) (*Result, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	text := fmt.Sprintf("[расшифровка-заглушка: %s, %d байт]", filepath.Base(path), info.Size())
+	return &Result{Text: text, Language: language, Segments: []Segment{{Start: 0, End: 0, Text: text}}}, nil
+}
+
+// command запускает внешнюю программу
+type command struct {
+	name string
+	args []string
+}
+
+func (c command) Name() string { return "command" }
+
+func (c command) Transcribe(ctx context.Context, path, language string) (*Result, error) {
+	args := append(append([]string{}, c.args...), path)
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("transcribe: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return &Result{Text: strings.TrimSpace(stdout.String()), Language: language}, nil
+}
+
+// httpBackend OpenAI-совместимый сервис (Whisper API, faster-whisper-server и т.п.)
+type httpBackend struct {
+	url    string
+	apiKey string
+	model  string
+	client *http.Client
+}
+
+func (h httpBackend) Name() string { return "http" }
+
+func (h httpBackend) Transcribe(ctx context.Context, path, language string) (*Result, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return nil, err
+	}
+	form.WriteField("model", h.model)
+	form.WriteField("response_format", "verbose_json")
+	if language != "" {
+		form.WriteField("language", language)
+	}
+	form.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if h.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+h.apiKey)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("transcribe: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var result Result
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,422 @@
+// Package unfurl получает превью ссылок: метаданные OpenGraph, oEmbed и картинку.
+// Запросы изолированы от внутренней сети: адреса проверяются после разрешения DNS
+// при каждом подключении (включая редиректы), ограничены порты, размер ответа,
+// время и число редиректов
+package unfurl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+var (
+	ErrForbiddenAddress = errors.New("unfurl: address is not allowed")
+	ErrUnsupported      = errors.New("unfurl: unsupported content")
+	ErrTooManyRedirects = errors.New("unfurl: too many redirects")
+)
+
+// Preview метаданные страницы
+type Preview struct {
+	URL         string `json:"url"`
+	Type        string `json:"type"` // website | article | video | photo | ...
+	SiteName    string `json:"siteName,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"imageUrl,omitempty"` // исходный адрес картинки
+}
+
+// Config ограничения загрузчика
+type Config struct {
+	Timeout       time.Duration // на весь запрос, включая редиректы
+	MaxBodyBytes  int64         // HTML и oEmbed
+	MaxImageBytes int64
+	MaxRedirects  int
+	UserAgent     string
+}
+
+// Fetcher загрузчик превью; безопасен для параллельного использования
+type Fetcher struct {
+	cfg    Config
+	client *http.Client
+}
+
+// Ограничения текстовых полей превью (в символах)
+const (
+	maxTitleLength       = 300
+	maxDescriptionLength = 1000
+	maxSiteNameLength    = 100
+)
+
+// blockedNetworks диапазоны, не входящие в IsPrivate/IsLoopback и т.п., но недоступные извне
+var blockedNetworks = func() []*net.IPNet {
+	cidrs := []string{
+		"0.0.0.0/8",       // "этот" хост
+		"100.64.0.0/10",   // CGNAT
+		"192.0.0.0/24",    // IETF
+		"192.0.2.0/24",    // документация
+		"198.18.0.0/15",   // бенчмарки
+		"198.51.100.0/24", // документация
+		"203.0.113.0/24",  // документация
+		"240.0.0.0/4",     // зарезервировано
+		"64:ff9b::/96",    // NAT64 — обертка над IPv4
+		"64:ff9b:1::/48",
+		"2001:db8::/32", // документация
+	}
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// PublicIP адрес в публичном интернете
+func PublicIP(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// New создает загрузчик; нулевые поля заменяются значениями по умолчанию
+func New(cfg Config) *Fetcher {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = 1 << 20
+	}
+	if cfg.MaxImageBytes <= 0 {
+		cfg.MaxImageBytes = 5 << 20
+	}
+	if cfg.MaxRedirects <= 0 {
+		cfg.MaxRedirects = 3
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = "SafegramBot/1.0 (link preview)"
+	}
+
+	// Проверка в Control срабатывает после разрешения DNS для каждого подключения,
+	// поэтому подмена DNS между проверкой и подключением не помогает
+	dialer := &net.Dialer{
+		Timeout: cfg.Timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, port, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if port != "80" && port != "443" {
+				return ErrForbiddenAddress
+			}
+			if !PublicIP(net.ParseIP(host)) {
+				return ErrForbiddenAddress
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		Proxy:                  nil, // прокси из окружения обошел бы проверку адресов
+		DialContext:            dialer.DialContext,
+		TLSHandshakeTimeout:    cfg.Timeout,
+		ResponseHeaderTimeout:  cfg.Timeout,
+		MaxResponseHeaderBytes: 64 << 10,
+		MaxIdleConns:           16,
+		IdleConnTimeout:        30 * time.Second,
+	}
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   cfg.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > cfg.MaxRedirects {
+				return ErrTooManyRedirects
+			}
+			return checkURL(req.URL)
+		},
+	}
+	return &Fetcher{cfg: cfg, client: client}
+}
+
+// checkURL только http(s) без учетных данных и с именем хоста
+func checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrUnsupported
+	}
+	if u.User != nil || u.Hostname() == "" {
+		return ErrForbiddenAddress
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !PublicIP(ip) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// get выполняет GET и проверяет статус; тело нужно закрыть
+func (f *Fetcher) get(ctx context.Context, rawURL, accept string) (*http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkURL(u); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", f.cfg.UserAgent)
+	req.Header.Set("Accept", accept)
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unfurl: status %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// readLimited читает тело не больше limit байт; больший ответ — ошибка
+func readLimited(body io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, ErrUnsupported
+	}
+	return data, nil
+}
+
+// Fetch загружает страницу и собирает превью из OpenGraph, oEmbed и обычных meta-тегов.
+// Прямая ссылка на картинку дает превью типа photo
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*Preview, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.cfg.Timeout)
+	defer cancel()
+
+	resp, err := f.get(ctx, rawURL, "text/html,application/xhtml+xml;q=0.9,image/*;q=0.8")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	finalURL := resp.Request.URL
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if strings.HasPrefix(mediaType, "image/") {
+		return &Preview{URL: rawURL, Type: "photo", ImageURL: finalURL.String()}, nil
+	}
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, ErrUnsupported
+	}
+
+	// Метаданные находятся в начале документа: читаем не больше лимита, без ошибки на длинных страницах
+	reader, err := charset.NewReader(io.LimitReader(resp.Body, f.cfg.MaxBodyBytes), resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	meta := parseHead(reader)
+
+	preview := &Preview{
+		URL:         rawURL,
+		Type:        firstNonEmpty(meta.og["type"], "website"),
+		SiteName:    firstNonEmpty(meta.og["site_name"], finalURL.Hostname()),
+		Title:       firstNonEmpty(meta.og["title"], meta.twitter["title"], meta.title),
+		Description: firstNonEmpty(meta.og["description"], meta.twitter["description"], meta.description),
+		ImageURL:    resolve(finalURL, firstNonEmpty(meta.og["image:secure_url"], meta.og["image"], meta.twitter["image"])),
+	}
+
+	// oEmbed дополняет то, чего нет в OpenGraph
+	if oembedURL := resolve(finalURL, meta.oembed); oembedURL != "" && (preview.Title == "" || preview.ImageURL == "") {
+		if embed, err := f.fetchOEmbed(ctx, oembedURL); err == nil {
+			preview.Title = firstNonEmpty(preview.Title, embed.Title)
+			preview.SiteName = firstNonEmpty(meta.og["site_name"], embed.ProviderName, preview.SiteName)
+			preview.ImageURL = firstNonEmpty(preview.ImageURL, resolve(finalURL, embed.ThumbnailURL))
+			if embed.Type == "video" || embed.Type == "photo" {
+				preview.Type = embed.Type
+			}
+		}
+	}
+
+	preview.Title = truncate(preview.Title, maxTitleLength)
+	preview.Description = truncate(preview.Description, maxDescriptionLength)
+	preview.SiteName = truncate(preview.SiteName, maxSiteNameLength)
+	if preview.Title == "" && preview.Description == "" && preview.ImageURL == "" {
+		return nil, ErrUnsupported
+	}
+	return preview, nil
+}
+
+// FetchImage загружает картинку превью: только распространенные растровые форматы в пределах лимита
+func (f *Fetcher) FetchImage(ctx context.Context, rawURL string) ([]byte, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.cfg.Timeout)
+	defer cancel()
+
+	resp, err := f.get(ctx, rawURL, "image/webp,image/png,image/jpeg,image/gif")
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.ContentLength > f.cfg.MaxImageBytes {
+		return nil, "", ErrUnsupported
+	}
+	data, err := readLimited(resp.Body, f.cfg.MaxImageBytes)
+	if err != nil {
+		return nil, "", err
+	}
+	switch contentType := http.DetectContentType(data); contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return data, contentType, nil
+	}
+	return nil, "", ErrUnsupported
+}
+
+type oembed struct {
+	Type         string `json:"type"`
+	Title        string `json:"title"`
+	ProviderName string `json:"provider_name"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+func (f *Fetcher) fetchOEmbed(ctx context.Context, rawURL string) (*oembed, error) {
+	resp, err := f.get(ctx, rawURL, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := readLimited(resp.Body, f.cfg.MaxBodyBytes)
+	if err != nil {
+		return nil, err
+	}
+	var embed oembed
+	if err := json.Unmarshal(data, &embed); err != nil {
+		return nil, err
+	}
+	return &embed, nil
+}
+
+// headMeta метаданные из <head>
+type headMeta struct {
+	title       string
+	description string
+	og          map[string]string // og:* без префикса
+	twitter     map[string]string // twitter:* без префикса
+	oembed      string            // ссылка на JSON oEmbed
+}
+
+// parseHead разбирает документ до конца <head> (или до лимита чтения)
+func parseHead(r io.Reader) headMeta {
+	meta := headMeta{og: make(map[string]string), twitter: make(map[string]string)}
+	tokenizer := html.NewTokenizer(r)
+	inTitle := false
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return meta
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "head":
+				return meta
+			case "title":
+				inTitle = false
+			}
+		case html.TextToken:
+			if inTitle && meta.title == "" {
+				meta.title = strings.TrimSpace(string(tokenizer.Text()))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			tag := string(name)
+			if tag == "body" {
+				return meta
+			}
+			if tag == "title" {
+				inTitle = true
+				continue
+			}
+			if !hasAttr || (tag != "meta" && tag != "link") {
+				continue
+			}
+			attrs := make(map[string]string)
+			for {
+				key, value, more := tokenizer.TagAttr()
+				attrs[strings.ToLower(string(key))] = strings.TrimSpace(string(value))
+				if !more {
+					break
+				}
+			}
+			if tag == "link" {
+				if strings.EqualFold(attrs["type"], "application/json+oembed") && meta.oembed == "" {
+					meta.oembed = attrs["href"]
+				}
+				continue
+			}
+			key := strings.ToLower(firstNonEmpty(attrs["property"], attrs["name"]))
+			content := attrs["content"]
+			switch {
+			case content == "":
+			case strings.HasPrefix(key, "og:"):
+				if _, ok := meta.og[key[3:]]; !ok {
+					meta.og[key[3:]] = content
+				}
+			case strings.HasPrefix(key, "twitter:"):
+				if _, ok := meta.twitter[key[8:]]; !ok {
+					meta.twitter[key[8:]] = content
+				}
+			case key == "description" && meta.description == "":
+				meta.description = content
+			}
+		}
+	}
+}
+
+// resolve абсолютный адрес ссылки относительно страницы; только http(s)
+func resolve(base *url.URL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return u.String()
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// truncate обрезает строку до limit символов, схлопывая пробельные символы
+func truncate(s string, limit int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:limit-1])) + "…"
+}
@@ -3,8 +3,10 @@ package websocket
 import (
 	"encoding/json"
 	"log"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"safegram-server/internal/redis"
 )
@@ -30,16 +32,21 @@ var upgrader = websocket.Upgrader{
 
 // Client представляет одно WebSocket подключение
 type Client struct {
+	id     string // ID подключения (у пользователя может быть несколько устройств)
 	hub    *Hub
 	conn   *websocket.Conn
 	send   chan []byte
 	userID string
 	chats  map[string]bool // Подписки на чаты
+
+	// Гостевое подключение встречи: доступны только события SFU этой встречи
+	meetingID string
 }
 
 // NewClient создает нового клиента
 func NewClient(hub *Hub, conn *websocket.Conn, userID string) *Client {
 	return &Client{
+		id:     uuid.New().String(),
 		hub:    hub,
 		conn:   conn,
 		send:   make(chan []byte, 256),
@@ -48,6 +55,34 @@ func NewClient(hub *Hub, conn *websocket.Conn, userID string) *Client {
 	}
 }
 
+// NewGuestClient создает подключение гостя встречи без аккаунта
+func NewGuestClient(hub *Hub, conn *websocket.Conn, guestID, meetingID string) *Client {
+	client := NewClient(hub, conn, guestID)
+	client.meetingID = meetingID
+	return client
+}
+
+// MeetingID возвращает встречу гостевого подключения ("" для пользователей)
+func (c *Client) MeetingID() string {
+	return c.meetingID
+}
+
+// ID возвращает ID подключения
+func (c *Client) ID() string {
+	return c.id
+}
+
+// UserID возвращает ID пользователя подключения
+func (c *Client) UserID() string {
+	return c.userID
+}
+
+// Send ставит сообщение в очередь отправки клиенту (без блокировки).
+// Отключенному клиенту сообщение не отправляется.
+func (c *Client) Send(message []byte) {
+	c.hub.sendTo(c, message)
+}
+
 // SubscribeToChat подписывает клиента на чат
 func (c *Client) SubscribeToChat(chatID string) {
 	c.chats[chatID] = true
@@ -65,25 +100,23 @@ func (c *Client) isSubscribedToChat(chatID string) bool {
 
 // ReadPump читает сообщения из WebSocket соединения
 func (c *Client) ReadPump() {
+	done := make(chan struct{})
 	defer func() {
+		close(done)
 		c.hub.unregister <- c
 		c.conn.Close()
 	}()
-	
-	// Обновляем онлайн статус каждые 2 минуты
+
+	// Продлеваем запись устройства в presence каждые 2 минуты
 	go func() {
 		ticker := time.NewTicker(2 * time.Minute)
 		defer ticker.Stop()
 		for {
 			select {
 			case <-ticker.C:
-				// Обновляем TTL онлайн статуса
-				redis.SetOnline(c.userID, 5*time.Minute)
-			case _, ok := <-c.send:
-				// Если канал закрыт, выходим
-				if !ok {
-					return
-				}
+				redis.TouchDevicePresence(c.userID, c.id)
+			case <-done:
+				return
 			}
 		}
 	}()
@@ -109,8 +142,11 @@ func (c *Client) ReadPump() {
 		if err := json.Unmarshal(message, &msg); err == nil {
 			// Проверяем тип сообщения
 			msgType, _ := msg["type"].(string)
-			if msgType == "webrtc:offer" || msgType == "webrtc:answer" || msgType == "webrtc:ice" || msgType == "webrtc:hangup" {
-				c.HandleWebRTCMessage(msg)
+			if c.meetingID != "" && !strings.HasPrefix(msgType, "sfu:") {
+				continue
+			}
+			if handler, ok := c.hub.handler(msgType); ok {
+				handler(c, msg)
 			} else {
 				c.handleMessage(msg)
 			}
@@ -167,11 +203,8 @@ func (c *Client) handleMessage(msg map[string]interface{}) {
 		return
 	}
 
+		// subscribe регистрируется пакетом api: подписка требует доступа к чату
 		switch msgType {
-		case "subscribe":
-			if chatID, ok := msg["chatId"].(string); ok {
-				c.SubscribeToChat(chatID)
-			}
 		case "unsubscribe":
 			if chatID, ok := msg["chatId"].(string); ok {
 				c.UnsubscribeFromChat(chatID)
@@ -1,11 +1,8 @@
 package websocket
 
 import (
-	"encoding/json"
 	"log"
-	"time"
-
-	"safegram-server/internal/redis"
+	"sync"
 )
 
 // Hub поддерживает множество активных подключений и рассылает сообщения
@@ -24,8 +21,31 @@ type Hub struct {
 
 	// Канал для отправки сообщения конкретному чату
 	sendToChat chan *ChatMessage
+
+	// Защищает clients: SendToUser и др. вызываются из HTTP-обработчиков
+	mu sync.RWMutex
+
+	// Обработчики входящих событий по типу (регистрируются до Run)
+	handlers map[string]EventHandler
+
+	// Вызываются при подключении клиента
+	connectHooks []ConnectHook
+
+	// Вызываются при отключении клиента
+	disconnectHooks []DisconnectHook
 }
 
+// EventHandler обработчик входящего события клиента, зарегистрированный вне пакета
+type EventHandler func(client *Client, msg map[string]interface{})
+
+// ConnectHook вызывается при подключении клиента;
+// firstConnection — других подключений у пользователя нет
+type ConnectHook func(userID, clientID string, firstConnection bool)
+
+// DisconnectHook вызывается при отключении клиента;
+// lastConnection — у пользователя не осталось других подключений
+type DisconnectHook func(userID, clientID string, lastConnection bool)
+
 type ChatMessage struct {
 	ChatID  string
 	Message []byte
@@ -39,9 +59,30 @@ func NewHub() *Hub {
 		unregister: make(chan *Client),
 		broadcast:  make(chan []byte, 256),
 		sendToChat: make(chan *ChatMessage, 256),
+		handlers:   make(map[string]EventHandler),
 	}
 }
 
+// On регистрирует обработчик события msgType (до запуска Run)
+func (h *Hub) On(msgType string, handler EventHandler) {
+	h.handlers[msgType] = handler
+}
+
+// OnDisconnect регистрирует обработчик отключения клиента (до запуска Run)
+func (h *Hub) OnDisconnect(hook DisconnectHook) {
+	h.disconnectHooks = append(h.disconnectHooks, hook)
+}
+
+// OnConnect регистрирует обработчик подключения клиента (до запуска Run)
+func (h *Hub) OnConnect(hook ConnectHook) {
+	h.connectHooks = append(h.connectHooks, hook)
+}
+
+func (h *Hub) handler(msgType string) (EventHandler, bool) {
+	handler, ok := h.handlers[msgType]
+	return handler, ok
+}
+
 // Register регистрирует нового клиента
 func (h *Hub) Register(client *Client) {
 	h.register <- client
@@ -52,59 +93,52 @@ func (h *Hub) Run() {
 	for {
 		select {
 		case client := <-h.register:
+			h.mu.Lock()
+			firstConnection := true
+			for c := range h.clients {
+				if c.userID == client.userID {
+					firstConnection = false
+					break
+				}
+			}
 			h.clients[client] = true
+			h.mu.Unlock()
 			log.Printf("Client connected: %s", client.userID)
-			
-			// Устанавливаем пользователя как онлайн в Redis
-			redis.SetOnline(client.userID, 5*time.Minute)
-			
-			// Отправляем событие presence всем клиентам
-			onlineUsers, _ := redis.GetOnlineUsers()
-			presenceJSON, _ := json.Marshal(map[string]interface{}{
-				"type": "presence",
-				"data": map[string]interface{}{
-					"userId": client.userID,
-					"status": "online",
-					"online": onlineUsers,
-				},
-			})
-			h.broadcast <- presenceJSON
+
+			for _, hook := range h.connectHooks {
+				go hook(client.userID, client.id, firstConnection)
+			}
 
 		case client := <-h.unregister:
-			if _, ok := h.clients[client]; ok {
+			h.mu.Lock()
+			_, ok := h.clients[client]
+			hasOtherConnections := false
+			if ok {
 				delete(h.clients, client)
 				close(client.send)
-				log.Printf("Client disconnected: %s", client.userID)
-				
+
 				// Проверяем, есть ли еще подключения этого пользователя
-				hasOtherConnections := false
 				for c := range h.clients {
 					if c.userID == client.userID {
 						hasOtherConnections = true
 						break
 					}
 				}
-				
-				// Если нет других подключений, устанавливаем офлайн
-				if !hasOtherConnections {
-					redis.SetOffline(client.userID)
-					
-					// Отправляем событие presence
-					onlineUsers, _ := redis.GetOnlineUsers()
-					presenceJSON, _ := json.Marshal(map[string]interface{}{
-						"type": "presence",
-						"data": map[string]interface{}{
-							"userId": client.userID,
-							"status": "offline",
-							"online": onlineUsers,
-						},
-					})
-					h.broadcast <- presenceJSON
+			}
+			h.mu.Unlock()
+
+			if ok {
+				log.Printf("Client disconnected: %s", client.userID)
+
+				for _, hook := range h.disconnectHooks {
+					go hook(client.userID, client.id, !hasOtherConnections)
 				}
+
 			}
 
 		case message := <-h.broadcast:
 			// Рассылаем всем подключенным клиентам
+			h.mu.Lock()
 			for client := range h.clients {
 				select {
 				case client.send <- message:
@@ -113,9 +147,11 @@ func (h *Hub) Run() {
 					delete(h.clients, client)
 				}
 			}
+			h.mu.Unlock()
 
 		case chatMsg := <-h.sendToChat:
 			// Рассылаем сообщение только клиентам, подписанным на этот чат
+			h.mu.Lock()
 			for client := range h.clients {
 				if client.isSubscribedToChat(chatMsg.ChatID) {
 					select {
@@ -126,6 +162,7 @@ func (h *Hub) Run() {
 					}
 				}
 			}
+			h.mu.Unlock()
 		}
 	}
 }
@@ -140,8 +177,15 @@ func (h *Hub) BroadcastToChat(chatID string, message []byte) {
 
 // SendToUser отправляет сообщение конкретному пользователю
 func (h *Hub) SendToUser(userID string, message []byte) {
+	h.SendToUserExcept(userID, "", message)
+}
+
+// SendToUserExcept отправляет сообщение всем устройствам пользователя, кроме подключения exceptClientID
+func (h *Hub) SendToUserExcept(userID, exceptClientID string, message []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	for client := range h.clients {
-		if client.userID == userID {
+		if client.userID == userID && client.id != exceptClientID {
 			select {
 			case client.send <- message:
 			default:
@@ -152,3 +196,81 @@ func (h *Hub) SendToUser(userID string, message []byte) {
 	}
 }
 
+// SendToUsers отправляет сообщение всем устройствам перечисленных пользователей
+func (h *Hub) SendToUsers(userIDs []string, message []byte) {
+	if len(userIDs) == 0 {
+		return
+	}
+	targets := make(map[string]bool, len(userIDs))
+	for _, id := range userIDs {
+		targets[id] = true
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.clients {
+		if targets[client.userID] {
+			select {
+			case client.send <- message:
+			default:
+				close(client.send)
+				delete(h.clients, client)
+			}
+		}
+	}
+}
+
+// sendTo отправляет сообщение клиенту, если он еще зарегистрирован: канал send
+// закрывается при отключении под h.mu, поэтому писать в него можно только под блокировкой
+func (h *Hub) sendTo(client *Client, message []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.clients[client] {
+		return
+	}
+	select {
+	case client.send <- message:
+	default:
+	}
+}
+
+// SendToClient отправляет сообщение одному подключению
+func (h *Hub) SendToClient(clientID string, message []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.clients {
+		if client.id == clientID {
+			select {
+			case client.send <- message:
+			default:
+				close(client.send)
+				delete(h.clients, client)
+			}
+			return
+		}
+	}
+}
+
+// HasClient проверяет, что подключение clientID еще активно
+func (h *Hub) HasClient(clientID string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for client := range h.clients {
+		if client.id == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// IsConnected проверяет, есть ли у пользователя активные подключения
+func (h *Hub) IsConnected(userID string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for client := range h.clients {
+		if client.userID == userID {
+			return true
+		}
+	}
+	return false
+}
+
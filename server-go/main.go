@@ -8,6 +8,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"safegram-server/internal/api"
+	"safegram-server/internal/authz"
 	"safegram-server/internal/config"
 	"safegram-server/internal/database"
 	"safegram-server/internal/logger"
@@ -47,6 +48,9 @@ func main() {
 		log.Printf("Warning: failed to create indexes: %v", err)
 	}
 
+	// Инициализация сервиса прав
+	authz.Init(db)
+
 	// Инициализация Redis (если используется)
 	if cfg.RedisURL != "" {
 		if err := redis.Init(cfg.RedisURL); err != nil {
@@ -63,7 +67,23 @@ func main() {
 
 	// Инициализация WebSocket hub
 	wsHub := websocket.NewHub()
+	api.RegisterCallSignaling(db, wsHub)
+	api.RegisterPresence(db, wsHub)
+	api.RegisterChatSubscriptions(wsHub)
+	if err := api.RegisterSFU(db, wsHub, cfg); err != nil {
+		log.Printf("SFU disabled: %v", err)
+	}
 	go wsHub.Run()
+	go api.StartVoiceRoomReminders(db, wsHub)
+	if err := api.InitRecordings(db, cfg); err != nil {
+		log.Printf("Transcription disabled: %v", err)
+	}
+	go api.StartRecordingRetention(db)
+	api.InitLinkPreviews(cfg)
+	go api.StartStoryReaper(db)
+	go api.StartNotificationDigest(db, cfg)
+	go api.StartMeetingReminders(db, wsHub, cfg)
+	go api.StartPollCloser(db, wsHub)
 
 	// Настройка роутера
 	router := gin.Default()